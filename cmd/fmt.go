@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/JorritSalverda/infinity/pkg/lib"
+	"github.com/spf13/cobra"
+)
+
+var (
+	fmtCmd = &cobra.Command{
+		Use:   "fmt",
+		Short: "Format the .infinity.yaml manifest with its keys in canonical order, keeping comments",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manifestPath := filepath.Join(buildDirectoryFlag, buildManifestFilenameFlag)
+
+			info, err := os.Stat(manifestPath)
+			if os.IsNotExist(err) {
+				return fmt.Errorf("manifest %v does not exist, cannot continue", manifestPath)
+			}
+			if err != nil {
+				return err
+			}
+
+			manifestBytes, err := ioutil.ReadFile(manifestPath)
+			if err != nil {
+				return err
+			}
+
+			formattedBytes, err := lib.FormatManifest(manifestBytes)
+			if err != nil {
+				return fmt.Errorf("formatting manifest %v failed: %w", manifestPath, err)
+			}
+
+			if bytes.Equal(manifestBytes, formattedBytes) {
+				fmt.Printf("Manifest %v is formatted\n", manifestPath)
+				return nil
+			}
+
+			if fmtCheckFlag {
+				return fmt.Errorf("manifest %v is not formatted; run 'infinity fmt' to format it", manifestPath)
+			}
+
+			if err = ioutil.WriteFile(manifestPath, formattedBytes, info.Mode()); err != nil {
+				return err
+			}
+			fmt.Printf("Formatted manifest %v\n", manifestPath)
+
+			return nil
+		},
+	}
+
+	fmtCheckFlag bool
+)
+
+func init() {
+	fmtCmd.Flags().BoolVar(&fmtCheckFlag, "check", false, "Fail if the manifest is not formatted instead of formatting it, for use in CI")
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/JorritSalverda/infinity/pkg/lib"
+	"github.com/spf13/cobra"
+)
+
+var (
+	graphCmd = &cobra.Command{
+		Use:   "graph [target]",
+		Short: "Print the stages of a target as a graph in dot, mermaid or json format; defaults to build/local",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manifestReader := lib.NewManifestReader()
+
+			manifest, err := manifestReader.GetManifest(cmd.Context(), filepath.Join(buildDirectoryFlag, buildManifestFilenameFlag))
+			if err != nil {
+				return err
+			}
+
+			// extract arguments
+			target := lib.DefaultTarget
+			if len(args) > 0 {
+				target = args[0]
+			}
+
+			graph, err := lib.GetPipelineGraph(manifest, target)
+			if err != nil {
+				return err
+			}
+
+			switch graphFormatFlag {
+			case "dot":
+				fmt.Print(graph.ToDOT())
+			case "mermaid":
+				fmt.Print(graph.ToMermaid())
+			case "json":
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(graph)
+			default:
+				return fmt.Errorf("format %v is not supported; use --format dot|mermaid|json", graphFormatFlag)
+			}
+
+			return nil
+		},
+	}
+
+	graphFormatFlag string
+)
+
+func init() {
+	graphCmd.Flags().StringVarP(&graphFormatFlag, "format", "f", "mermaid", "Output format; dot for Graphviz, mermaid for markdown documents or json")
+}
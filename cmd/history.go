@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/JorritSalverda/infinity/pkg/lib"
+	"github.com/spf13/cobra"
+)
+
+var (
+	historyCmd = &cobra.Command{
+		Use:   "history",
+		Short: "Show the history of local runs with average stage durations and the flakiest stage",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			runHistory := lib.NewRunHistory(buildDirectoryFlag)
+
+			runs, err := runHistory.GetRuns(cmd.Context(), historyTargetFlag)
+			if err != nil {
+				return err
+			}
+			if len(runs) == 0 {
+				fmt.Println("There are no runs in the history yet")
+				return nil
+			}
+
+			recentRuns := runs
+			if historyLimitFlag > 0 && len(recentRuns) > historyLimitFlag {
+				recentRuns = recentRuns[len(recentRuns)-historyLimitFlag:]
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tTARGET\tREVISION\tSTATUS\tSTARTED\tDURATION")
+			for i := len(recentRuns) - 1; i >= 0; i-- {
+				r := recentRuns[i]
+				fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\n", r.ID, r.Target, formatRevision(r.Revision, r.Dirty), r.Status, r.Start.Local().Format("2006-01-02 15:04:05"), formatSeconds(r.DurationSeconds))
+			}
+			if err = w.Flush(); err != nil {
+				return err
+			}
+
+			trends := lib.GetStageTrends(recentRuns)
+			if len(trends) == 0 {
+				return nil
+			}
+
+			fmt.Println()
+			w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "STAGE\tRUNS\tAVERAGE DURATION\tFAILURES\tFLIPS")
+			for _, t := range trends {
+				fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", t.Path, t.Runs, formatSeconds(t.AverageDurationSeconds), t.Failures, t.Flips)
+			}
+			if err = w.Flush(); err != nil {
+				return err
+			}
+
+			if flakiestStage := lib.GetFlakiestStage(trends); flakiestStage != nil {
+				fmt.Printf("\nFlakiest stage is %v; it flipped between passing and failing %v times in %v runs\n", flakiestStage.Path, flakiestStage.Flips, flakiestStage.Runs)
+			}
+
+			return nil
+		},
+	}
+
+	historyShowCmd = &cobra.Command{
+		Use:   "show [run-id]",
+		Short: "Show the status and timing of each stage of a run compared to the average of previous runs",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			runHistory := lib.NewRunHistory(buildDirectoryFlag)
+
+			run, err := runHistory.GetRun(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+
+			// compare with the runs of the same target before this one
+			runs, err := runHistory.GetRuns(cmd.Context(), run.Target)
+			if err != nil {
+				return err
+			}
+			previousRuns := []lib.RunHistoryEntry{}
+			for _, r := range runs {
+				if r.ID == run.ID {
+					break
+				}
+				previousRuns = append(previousRuns, r)
+			}
+			averageDurations := map[string]float64{}
+			for _, t := range lib.GetStageTrends(previousRuns) {
+				averageDurations[t.Path] = t.AverageDurationSeconds
+			}
+
+			fmt.Printf("Run:      %v\n", run.ID)
+			fmt.Printf("Target:   %v\n", run.Target)
+			fmt.Printf("Revision: %v\n", formatRevision(run.Revision, run.Dirty))
+			if run.Version != "" {
+				fmt.Printf("Version:  %v\n", run.Version)
+			}
+			fmt.Printf("Status:   %v\n", run.Status)
+			fmt.Printf("Started:  %v\n", run.Start.Local().Format("2006-01-02 15:04:05"))
+			fmt.Printf("Duration: %v\n\n", formatSeconds(run.DurationSeconds))
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "STAGE\tSTATUS\tEXIT CODE\tDURATION\tAVERAGE DURATION\tDIFFERENCE")
+			for _, s := range run.Stages {
+				exitCode := ""
+				if s.ExitCode != nil {
+					exitCode = fmt.Sprintf("%v", *s.ExitCode)
+				}
+				average, difference := "", ""
+				if a, ok := averageDurations[s.Path]; ok {
+					average = formatSeconds(a)
+					if s.Status == lib.StageStatusPassed || s.Status == lib.StageStatusFailed {
+						difference = formatSeconds(s.DurationSeconds - a)
+						if s.DurationSeconds >= a {
+							difference = "+" + difference
+						}
+					}
+				}
+				fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\n", s.Path, s.Status, exitCode, formatSeconds(s.DurationSeconds), average, difference)
+			}
+
+			return w.Flush()
+		},
+	}
+
+	historyTargetFlag string
+	historyLimitFlag  int
+)
+
+func init() {
+	historyCmd.Flags().StringVarP(&historyTargetFlag, "target", "t", "", "Only show runs of this target")
+	historyCmd.Flags().IntVarP(&historyLimitFlag, "limit", "l", 20, "Number of most recent runs to show and calculate trends for")
+
+	historyCmd.AddCommand(historyShowCmd)
+}
+
+func formatRevision(revision string, dirty bool) string {
+	if len(revision) > 7 {
+		revision = revision[:7]
+	}
+	if dirty {
+		revision += "-dirty"
+	}
+
+	return revision
+}
+
+func formatSeconds(seconds float64) string {
+	return time.Duration(seconds * float64(time.Second)).Round(time.Millisecond).String()
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/JorritSalverda/infinity/pkg/lib"
+	"github.com/spf13/cobra"
+)
+
+var (
+	lintCmd = &cobra.Command{
+		Use:   "lint",
+		Short: "Lint the .infinity.yaml manifest for unpinned images, risky stages and other practices configured in .infinity-lint.yaml",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			format := lib.AnnotationFormat(lintFormatFlag)
+			if !format.IsSupported() {
+				return fmt.Errorf("format %v is not supported; use --format %v", format, strings.Join(lib.SupportedAnnotationFormats.ToStringArray(), "|"))
+			}
+
+			config, err := lib.ReadLintConfig(filepath.Join(buildDirectoryFlag, lib.LintConfigFilename))
+			if err != nil {
+				return err
+			}
+
+			manifestReader := lib.NewManifestReader()
+			secretMasker := lib.NewSecretMasker()
+			commandRunner := lib.NewCommandRunner(secretMasker, verboseFlag)
+			randomStringGenerator := lib.NewRandomStringGenerator()
+			dockerRunner := lib.NewDockerRunner(commandRunner, randomStringGenerator, buildDirectoryFlag, false, nil, false)
+			hostRunner := lib.NewHostRunner(commandRunner, buildDirectoryFlag)
+			secretProvider := lib.NewSecretProvider(buildDirectoryFlag, secretKeyFlag)
+
+			envFileReader := lib.NewEnvFileReader(buildDirectoryFlag)
+			gitReader := lib.NewGitReader(buildDirectoryFlag)
+
+			runner := lib.NewRunner(manifestReader, dockerRunner, hostRunner, secretProvider, secretMasker, envFileReader, gitReader, nil, nil, 0, map[string]string{}, buildDirectoryFlag, buildManifestFilenameFlag)
+
+			// validation errors are reported along with the lint findings; validation warnings are left to 'infinity validate'
+			var warnings []error
+			manifest, _, errs, err := runner.ValidateManifest(cmd.Context())
+			if err != nil {
+				var invalidErr *lib.ManifestInvalidError
+				if !errors.As(err, &invalidErr) {
+					return err
+				}
+				errs = invalidErr.Errors
+			} else {
+				var lintErrors []error
+				warnings, lintErrors = manifest.Lint(config)
+				errs = append(errs, lintErrors...)
+			}
+
+			err = lib.WriteManifestAnnotations(os.Stdout, format, filepath.Join(buildDirectoryFlag, buildManifestFilenameFlag), warnings, errs)
+			if err != nil {
+				return err
+			}
+
+			if len(errs) > 0 {
+				return fmt.Errorf("manifest failed linting")
+			}
+
+			return nil
+		},
+	}
+
+	lintFormatFlag string
+)
+
+func init() {
+	lintCmd.Flags().StringVarP(&lintFormatFlag, "format", "f", string(lib.AnnotationFormatText), "Print findings as text for file:line:column lines, github for GitHub Actions annotations or gitlab for a GitLab code quality report")
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/JorritSalverda/infinity/pkg/lib"
+	"github.com/spf13/cobra"
+)
+
+var (
+	listCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List the targets of the manifest with their stages, runners, images and parameters",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manifestReader := lib.NewManifestReader()
+
+			manifest, err := manifestReader.GetManifest(cmd.Context(), filepath.Join(buildDirectoryFlag, buildManifestFilenameFlag))
+			if err != nil {
+				return err
+			}
+
+			targets := lib.GetTargetSummaries(manifest)
+
+			if listJSONFlag {
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				if targets == nil {
+					targets = []lib.TargetSummary{}
+				}
+				return encoder.Encode(targets)
+			}
+
+			if len(targets) == 0 {
+				fmt.Printf("Manifest %v has no targets\n", buildManifestFilenameFlag)
+				return nil
+			}
+
+			var output bytes.Buffer
+			w := tabwriter.NewWriter(&output, 0, 0, 2, ' ', 0)
+			for i, t := range targets {
+				if i > 0 {
+					fmt.Fprintln(w)
+				}
+				if t.Default {
+					fmt.Fprintf(w, "%v (default)\n", t.Name)
+				} else {
+					fmt.Fprintln(w, t.Name)
+				}
+				writeStageTree(w, t.Stages, "")
+			}
+			if err = w.Flush(); err != nil {
+				return err
+			}
+
+			// stages without image or details leave trailing padding
+			for _, line := range strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n") {
+				fmt.Println(strings.TrimRight(line, " "))
+			}
+
+			return nil
+		},
+	}
+
+	listJSONFlag bool
+)
+
+func init() {
+	listCmd.Flags().BoolVar(&listJSONFlag, "json", false, "Print the targets as json")
+}
+
+func writeStageTree(w io.Writer, stages []lib.StageSummary, indent string) {
+	for i, s := range stages {
+		branch, nestedIndent := "├── ", "│   "
+		if i == len(stages)-1 {
+			branch, nestedIndent = "└── ", "    "
+		}
+
+		if len(s.Stages) > 0 {
+			fmt.Fprintf(w, "%v%v%v\tparallel\t\t\n", indent, branch, s.Name)
+			writeStageTree(w, s.Stages, indent+nestedIndent)
+			continue
+		}
+
+		details := []string{}
+		if s.Background {
+			details = append(details, "background")
+		}
+		if len(s.Parameters) > 0 {
+			details = append(details, formatParameters(s.Parameters))
+		}
+		fmt.Fprintf(w, "%v%v%v\t%v\t%v\t%v\n", indent, branch, s.Name, s.RunnerType, s.Image, strings.Join(details, ", "))
+	}
+}
+
+func formatParameters(parameters map[string]interface{}) string {
+	keys := []string{}
+	for k := range parameters {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	formattedParameters := []string{}
+	for _, k := range keys {
+		value, err := json.Marshal(parameters[k])
+		if err != nil {
+			value = []byte(fmt.Sprintf("%v", parameters[k]))
+		}
+		formattedParameters = append(formattedParameters, fmt.Sprintf("%v=%s", k, strings.Trim(string(value), `"`)))
+	}
+
+	return strings.Join(formattedParameters, " ")
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/JorritSalverda/infinity/pkg/lib"
+	"github.com/spf13/cobra"
+)
+
+var (
+	lockCmd = &cobra.Command{
+		Use:   "lock",
+		Short: "Pin the images of the .infinity.yaml manifest to their current digest in .infinity.lock",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manifestReader := lib.NewManifestReader()
+			secretMasker := lib.NewSecretMasker()
+			commandRunner := lib.NewCommandRunner(secretMasker, verboseFlag)
+			randomStringGenerator := lib.NewRandomStringGenerator()
+			dockerRunner := lib.NewDockerRunner(commandRunner, randomStringGenerator, buildDirectoryFlag, false, nil, false)
+			hostRunner := lib.NewHostRunner(commandRunner, buildDirectoryFlag)
+			secretProvider := lib.NewSecretProvider(buildDirectoryFlag, secretKeyFlag)
+
+			envFileReader := lib.NewEnvFileReader(buildDirectoryFlag)
+			gitReader := lib.NewGitReader(buildDirectoryFlag)
+
+			runner := lib.NewRunner(manifestReader, dockerRunner, hostRunner, secretProvider, secretMasker, envFileReader, gitReader, nil, nil, 0, map[string]string{}, buildDirectoryFlag, buildManifestFilenameFlag)
+
+			return runner.Lock(cmd.Context(), lockCheckFlag)
+		},
+	}
+
+	lockCheckFlag bool
+)
+
+func init() {
+	lockCmd.Flags().BoolVar(&lockCheckFlag, "check", false, "Fail if the lockfile doesn't match the images of the manifest instead of updating it, for use in CI")
+}
+
+// getImageLock reads the lockfile images get pinned with; with --locked it has to exist
+func getImageLock(locked bool) (*lib.ImageLock, error) {
+	lockPath := filepath.Join(buildDirectoryFlag, lib.ImageLockFilename)
+
+	lock, err := lib.ReadImageLock(lockPath)
+	if err != nil {
+		return nil, err
+	}
+	if lock == nil && locked {
+		return nil, fmt.Errorf("--locked needs lockfile %v; run 'infinity lock' to create it", lockPath)
+	}
+
+	return lock, nil
+}
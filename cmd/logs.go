@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/JorritSalverda/infinity/pkg/lib"
+	"github.com/spf13/cobra"
+)
+
+var logsCmd = &cobra.Command{
+	Use:   "logs [run-id] [stage]",
+	Short: "Show the stage logs of a previous run; defaults to the latest run and all of its stages",
+	Args:  cobra.MaximumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logStore := lib.NewLogStore(buildDirectoryFlag)
+
+		runIDs, err := logStore.GetRunIDs(cmd.Context())
+		if err != nil {
+			return err
+		}
+		if len(runIDs) == 0 {
+			return fmt.Errorf("there are no run logs in %v yet", filepath.Join(buildDirectoryFlag, ".infinity", "runs"))
+		}
+
+		// extract arguments
+		runID := runIDs[len(runIDs)-1]
+		if len(args) > 0 && args[0] != "latest" {
+			runID = args[0]
+		}
+
+		stagePaths, err := logStore.GetStagePaths(cmd.Context(), runID)
+		if err != nil {
+			return err
+		}
+
+		// a stage can be selected by its full path or by its name
+		if len(args) > 1 {
+			selectedStagePaths := []string{}
+			for _, p := range stagePaths {
+				if p == args[1] || strings.HasSuffix(p, "/"+args[1]) {
+					selectedStagePaths = append(selectedStagePaths, p)
+				}
+			}
+			if len(selectedStagePaths) == 0 {
+				return fmt.Errorf("run %v has no logs for stage %v; available stages are %v", runID, args[1], strings.Join(stagePaths, ", "))
+			}
+			stagePaths = selectedStagePaths
+		}
+
+		for i, p := range stagePaths {
+			stageLog, err := logStore.ReadStageLog(cmd.Context(), runID, p)
+			if err != nil {
+				return err
+			}
+
+			if len(stagePaths) > 1 {
+				if i > 0 {
+					fmt.Println()
+				}
+				fmt.Printf("==> %v <==\n", p)
+			}
+			fmt.Print(string(stageLog))
+		}
+
+		return nil
+	},
+}
@@ -14,6 +14,7 @@ var (
 	verboseFlag               bool
 	buildDirectoryFlag        string
 	buildManifestFilenameFlag string
+	secretKeyFlag             string
 
 	version = "v0.0.0"
 )
@@ -27,9 +28,20 @@ func init() {
 	rootCmd.PersistentFlags().BoolVarP(&verboseFlag, "verbose", "v", false, "Enable verbose logging")
 	rootCmd.PersistentFlags().StringVarP(&buildDirectoryFlag, "directory", "d", "", "Directory path containing manifest file")
 	rootCmd.PersistentFlags().StringVarP(&buildManifestFilenameFlag, "manifest", "m", ".infinity.yaml", "Manifest file name")
+	rootCmd.PersistentFlags().StringVar(&secretKeyFlag, "secret-key", "", "Base64 encoded key to decrypt encrypted secrets with; defaults to envvar INFINITY_SECRET_KEY")
 
 	rootCmd.AddCommand(scaffoldCmd)
 	rootCmd.AddCommand(validateCmd)
+	rootCmd.AddCommand(fmtCmd)
+	rootCmd.AddCommand(lintCmd)
+	rootCmd.AddCommand(lockCmd)
+	rootCmd.AddCommand(listCmd)
+	rootCmd.AddCommand(graphCmd)
+	rootCmd.AddCommand(schemaCmd)
 	rootCmd.AddCommand(runCmd)
+	rootCmd.AddCommand(shellCmd)
+	rootCmd.AddCommand(logsCmd)
+	rootCmd.AddCommand(historyCmd)
+	rootCmd.AddCommand(secretCmd)
 	rootCmd.AddCommand(versionCmd)
 }
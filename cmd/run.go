@@ -1,36 +1,284 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
 	"github.com/JorritSalverda/infinity/pkg/lib"
+	"github.com/logrusorgru/aurora"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 var (
 	runCmd = &cobra.Command{
-		Use:   "run",
-		Short: "Run a target to build or release your application using the .infinity.yaml manifest",
+		Use:   "run [target]",
+		Short: "Run a target to build or release your application using the .infinity.yaml manifest; defaults to build/local",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if debugOnFailureFlag && !term.IsTerminal(int(os.Stdin.Fd())) {
+				return fmt.Errorf("--debug-on-failure needs an interactive terminal to start a shell in")
+			}
+			if watchFlag && debugOnFailureFlag {
+				return fmt.Errorf("--watch can't be combined with --debug-on-failure")
+			}
+			if maxParallelFlag < 0 {
+				return fmt.Errorf("--max-parallel %v is invalid; use a positive number, or 0 to not limit parallel stages", maxParallelFlag)
+			}
+
+			imageLock, err := getImageLock(lockedFlag)
+			if err != nil {
+				return err
+			}
+
 			manifestReader := lib.NewManifestReader()
-			commandRunner := lib.NewCommandRunner(verboseFlag)
+			secretMasker := lib.NewSecretMasker()
+			commandRunner := lib.NewCommandRunner(secretMasker, verboseFlag)
 			randomStringGenerator := lib.NewRandomStringGenerator()
-			dockerRunner := lib.NewDockerRunner(commandRunner, randomStringGenerator, buildDirectoryFlag)
+			dockerRunner := lib.NewDockerRunner(commandRunner, randomStringGenerator, buildDirectoryFlag, debugOnFailureFlag, imageLock, lockedFlag)
 			hostRunner := lib.NewHostRunner(commandRunner, buildDirectoryFlag)
+			secretProvider := lib.NewSecretProvider(buildDirectoryFlag, secretKeyFlag)
+			envFileReader := lib.NewEnvFileReader(buildDirectoryFlag)
+			gitReader := lib.NewGitReader(buildDirectoryFlag)
+
+			env, err := getEnvOverrides(cmd.Context(), envFileReader, envFileFlag, envFlag)
+			if err != nil {
+				return err
+			}
+
+			var eventWriter lib.RunEventWriter
+			switch outputFlag {
+			case "text":
+				// the live view can't share the terminal with a debug shell
+				if progressFlag && !debugOnFailureFlag && isInteractiveTerminal() {
+					eventWriter = lib.NewProgressView(os.Stdout, getTerminalWidth())
+
+					// print logs of this command above the rows of the live view as well, instead of in between
+					log.SetOutput(eventWriter.LogOutput(nil))
+				}
+			case "json":
+				eventWriter = lib.NewRunEventWriter(os.Stdout)
+			default:
+				return fmt.Errorf("output %v is not supported; use --output text|json", outputFlag)
+			}
 
-			runner := lib.NewRunner(manifestReader, dockerRunner, hostRunner, forcePullFlag, buildDirectoryFlag, buildManifestFilenameFlag)
+			var logStore lib.LogStore
+			if logRetentionFlag > 0 {
+				logStore = lib.NewLogStore(buildDirectoryFlag)
+			}
+
+			runner := lib.NewRunner(manifestReader, dockerRunner, hostRunner, secretProvider, secretMasker, envFileReader, gitReader, eventWriter, logStore, maxParallelFlag, env, buildDirectoryFlag, buildManifestFilenameFlag)
 
 			// extract arguments
-			target := "build/local"
+			target := lib.DefaultTarget
 			if len(args) > 0 {
 				target = args[0]
+			} else {
+				log.Println(aurora.Gray(12, fmt.Sprintf("No target passed, running %v; see 'infinity list' for all targets", target)))
+			}
+
+			// record a trace of the run if it gets exported anywhere
+			ctx := cmd.Context()
+			var tracer lib.Tracer
+			if traceEndpointFlag != "" || traceFileFlag != "" {
+				tracer = lib.NewTracer()
+				ctx = lib.ContextWithTracer(ctx, tracer)
 			}
 
-			return runner.Run(cmd.Context(), target)
+			if watchFlag {
+				fileWatcher := lib.NewFileWatcher(buildDirectoryFlag, watchPathsFlag, getOutputPaths())
+				changes, err := fileWatcher.Watch(ctx)
+				if err != nil {
+					return err
+				}
+
+				// keep watching after failed runs, they're expected while working on a change
+				return runner.Watch(ctx, target, changes, func(runCtx context.Context, report *lib.RunReport, err error) error {
+					if err != nil {
+						log.Println(aurora.BrightRed(err.Error()))
+					}
+					return writeRunOutputs(report, err, logStore, lib.GetTracerFromContext(runCtx))
+				})
+			}
+
+			report, err := runner.Run(ctx, target)
+
+			if outputErr := writeRunOutputs(report, err, logStore, tracer); outputErr != nil {
+				return outputErr
+			}
+
+			return err
 		},
 	}
 
-	forcePullFlag bool
+	lockedFlag           bool
+	maxParallelFlag      int
+	envFlag              []string
+	envFileFlag          []string
+	reportJUnitFlag      string
+	outputFlag           string
+	summaryFileFlag      string
+	traceEndpointFlag    string
+	traceFileFlag        string
+	logRetentionFlag     int
+	historyRetentionFlag int
+	progressFlag         bool
+	debugOnFailureFlag   bool
+	watchFlag            bool
+	watchPathsFlag       []string
 )
 
 func init() {
-	runCmd.Flags().BoolVarP(&forcePullFlag, "pull", "p", false, "Force pulling images")
+	runCmd.Flags().BoolVar(&lockedFlag, "locked", false, "Fail stages whose image is not pinned in .infinity.lock instead of warning, for use in CI")
+	runCmd.Flags().IntVar(&maxParallelFlag, "max-parallel", 0, "Maximum number of stages to run at the same time, to keep parallel stages from exhausting memory; 0 doesn't limit them")
+	runCmd.Flags().StringArrayVarP(&envFlag, "env", "e", []string{}, "Set environment variable KEY=VALUE for all stages, overriding the manifest; KEY without value takes it from the current environment")
+	runCmd.Flags().StringArrayVar(&envFileFlag, "env-file", []string{}, "Read environment variables for all stages from a dotenv file, overriding the manifest")
+	runCmd.Flags().StringVar(&reportJUnitFlag, "report-junit", "", "Write a JUnit XML report with a testcase per stage to this path")
+	runCmd.Flags().StringVarP(&outputFlag, "output", "o", "text", "Output format; json writes newline-delimited json events to stdout and human readable logs to stderr")
+	runCmd.Flags().StringVar(&summaryFileFlag, "summary-file", "", "Write a json summary with the status, exit code and duration of each stage to this path")
+	runCmd.Flags().StringVar(&traceEndpointFlag, "trace-endpoint", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "Export an OpenTelemetry trace of the run over OTLP/HTTP to this collector endpoint")
+	runCmd.Flags().StringVar(&traceFileFlag, "trace-file", "", "Write an OpenTelemetry trace of the run as OTLP json to this path")
+	runCmd.Flags().BoolVar(&progressFlag, "progress", true, "Show a live row per stage while parallel stages run if stdout is a terminal; CI environments always get plain logs")
+	runCmd.Flags().BoolVar(&debugOnFailureFlag, "debug-on-failure", false, "Start an interactive shell in the container of a failed stage, with the same image, mounts and envvars")
+	runCmd.Flags().BoolVarP(&watchFlag, "watch", "w", false, "Re-run the target whenever files in the build directory change, skipping files ignored by .gitignore and .dockerignore")
+	runCmd.Flags().StringArrayVar(&watchPathsFlag, "paths", []string{}, "Only re-run for changes to files matching this glob, like **/*.go; can be repeated")
+	runCmd.Flags().IntVar(&logRetentionFlag, "log-retention", 10, "Number of most recent runs to keep stage log files for in .infinity/runs; 0 disables writing them")
+	runCmd.Flags().IntVar(&historyRetentionFlag, "history-retention", 1000, "Number of most recent runs to keep in .infinity/history.jsonl; 0 disables recording them")
+}
+
+// writeRunOutputs writes the reports, history and trace of a run; errors writing them only get returned if the run itself succeeded
+func writeRunOutputs(report *lib.RunReport, runErr error, logStore lib.LogStore, tracer lib.Tracer) error {
+	if report == nil {
+		return nil
+	}
+
+	// write the report for failed runs as well, since that's when it's needed most
+	if reportJUnitFlag != "" {
+		junitReportWriter := lib.NewJUnitReportWriter()
+		if reportErr := junitReportWriter.WriteReport(context.Background(), report, reportJUnitFlag); reportErr != nil && runErr == nil {
+			return reportErr
+		}
+	}
+	if summaryFileFlag != "" {
+		jsonReportWriter := lib.NewJSONReportWriter()
+		if reportErr := jsonReportWriter.WriteReport(context.Background(), report, summaryFileFlag); reportErr != nil && runErr == nil {
+			return reportErr
+		}
+	}
+
+	if historyRetentionFlag > 0 {
+		runHistory := lib.NewRunHistory(buildDirectoryFlag)
+		if historyErr := runHistory.AddRun(context.Background(), report); historyErr != nil && runErr == nil {
+			return historyErr
+		}
+		if pruneErr := runHistory.Prune(context.Background(), historyRetentionFlag); pruneErr != nil && runErr == nil {
+			return pruneErr
+		}
+	}
+
+	if logStore != nil {
+		if runErr != nil {
+			log.Printf("View the logs of this run with 'infinity logs %v'", report.ID)
+		}
+		if pruneErr := logStore.Prune(context.Background(), logRetentionFlag); pruneErr != nil && runErr == nil {
+			return pruneErr
+		}
+	}
+
+	// export with a fresh context, so canceled runs still get their trace exported
+	if tracer != nil {
+		if traceErr := exportTrace(context.Background(), tracer); traceErr != nil && runErr == nil {
+			return traceErr
+		}
+	}
+
+	return nil
+}
+
+// getOutputPaths returns the paths of the files a run writes, relative to the build directory
+func getOutputPaths() (outputPaths []string) {
+	buildDirectory, err := filepath.Abs(buildDirectoryFlag)
+	if err != nil {
+		return
+	}
+
+	for _, p := range []string{reportJUnitFlag, summaryFileFlag, traceFileFlag} {
+		if p == "" {
+			continue
+		}
+		absolutePath, err := filepath.Abs(p)
+		if err != nil {
+			continue
+		}
+		relativePath, err := filepath.Rel(buildDirectory, absolutePath)
+		if err != nil || strings.HasPrefix(relativePath, "..") {
+			continue
+		}
+		outputPaths = append(outputPaths, filepath.ToSlash(relativePath))
+	}
+
+	return
+}
+
+func exportTrace(ctx context.Context, tracer lib.Tracer) (err error) {
+	if traceEndpointFlag != "" {
+		err = lib.NewOTLPHTTPTraceExporter(traceEndpointFlag).Export(ctx, tracer.GetSpans())
+		if err != nil {
+			return
+		}
+	}
+
+	if traceFileFlag != "" {
+		err = lib.NewOTLPFileTraceExporter(traceFileFlag).Export(ctx, tracer.GetSpans())
+		if err != nil {
+			return
+		}
+	}
+
+	return nil
+}
+
+// getEnvOverrides reads the env files and envvars passed with --env-file and --env, the latter taking precedence
+func getEnvOverrides(ctx context.Context, envFileReader lib.EnvFileReader, envFiles, envs []string) (env map[string]string, err error) {
+	// explicitly passed env files have to exist
+	env, err = envFileReader.ReadEnvFiles(ctx, envFiles, false)
+	if err != nil {
+		return
+	}
+
+	// single envvars override those from env files
+	for _, e := range envs {
+		keyAndValue := strings.SplitN(e, "=", 2)
+		if keyAndValue[0] == "" {
+			return nil, fmt.Errorf("env %v is invalid; please use --env KEY=VALUE", e)
+		}
+		if len(keyAndValue) == 1 {
+			env[keyAndValue[0]] = os.Getenv(keyAndValue[0])
+			continue
+		}
+		env[keyAndValue[0]] = keyAndValue[1]
+	}
+
+	return
+}
+
+// isInteractiveTerminal returns true if stdout is a terminal outside of CI, where redrawing rows works and is followed by a person
+func isInteractiveTerminal() bool {
+	if os.Getenv("CI") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+
+	return term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+func getTerminalWidth() int {
+	width, _, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width <= 0 {
+		return 80
+	}
+
+	return width
 }
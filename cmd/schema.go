@@ -0,0 +1,21 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/JorritSalverda/infinity/pkg/lib"
+	"github.com/spf13/cobra"
+)
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema of the .infinity.yaml manifest, for editors to autocomplete and validate it",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(lib.GetManifestSchema())
+	},
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/JorritSalverda/infinity/pkg/lib"
+	"github.com/spf13/cobra"
+)
+
+var (
+	secretCmd = &cobra.Command{
+		Use:   "secret",
+		Short: "Manage secrets used in the .infinity.yaml manifest",
+	}
+
+	secretKeyCmd = &cobra.Command{
+		Use:   "key",
+		Short: "Generate a new key to encrypt secrets with",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			secretProvider := lib.NewSecretProvider(buildDirectoryFlag, secretKeyFlag)
+
+			key, err := secretProvider.GenerateKey(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			fmt.Println(key)
+
+			return nil
+		},
+	}
+
+	secretEncryptCmd = &cobra.Command{
+		Use:   "encrypt [input file] [output file]",
+		Short: "Encrypt a file for use as 'encryptedFile' secret source",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			secretProvider := lib.NewSecretProvider(buildDirectoryFlag, secretKeyFlag)
+
+			plaintext, err := ioutil.ReadFile(args[0])
+			if err != nil {
+				return err
+			}
+
+			ciphertext, err := secretProvider.Encrypt(cmd.Context(), plaintext)
+			if err != nil {
+				return err
+			}
+
+			return ioutil.WriteFile(args[1], ciphertext, 0644)
+		},
+	}
+)
+
+func init() {
+	secretCmd.AddCommand(secretKeyCmd)
+	secretCmd.AddCommand(secretEncryptCmd)
+}
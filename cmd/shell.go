@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/JorritSalverda/infinity/pkg/lib"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var shellCmd = &cobra.Command{
+	Use:   "shell [target] [stage]",
+	Short: "Start an interactive shell in the container of a stage, with the target's background stages running alongside",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return fmt.Errorf("shell needs an interactive terminal")
+		}
+
+		imageLock, err := getImageLock(shellLockedFlag)
+		if err != nil {
+			return err
+		}
+
+		manifestReader := lib.NewManifestReader()
+		secretMasker := lib.NewSecretMasker()
+		commandRunner := lib.NewCommandRunner(secretMasker, verboseFlag)
+		randomStringGenerator := lib.NewRandomStringGenerator()
+		dockerRunner := lib.NewDockerRunner(commandRunner, randomStringGenerator, buildDirectoryFlag, false, imageLock, shellLockedFlag)
+		hostRunner := lib.NewHostRunner(commandRunner, buildDirectoryFlag)
+		secretProvider := lib.NewSecretProvider(buildDirectoryFlag, secretKeyFlag)
+		envFileReader := lib.NewEnvFileReader(buildDirectoryFlag)
+		gitReader := lib.NewGitReader(buildDirectoryFlag)
+
+		env, err := getEnvOverrides(cmd.Context(), envFileReader, shellEnvFileFlag, shellEnvFlag)
+		if err != nil {
+			return err
+		}
+
+		runner := lib.NewRunner(manifestReader, dockerRunner, hostRunner, secretProvider, secretMasker, envFileReader, gitReader, nil, nil, 0, env, buildDirectoryFlag, buildManifestFilenameFlag)
+
+		return runner.Shell(cmd.Context(), args[0], args[1])
+	},
+}
+
+var (
+	shellLockedFlag  bool
+	shellEnvFlag     []string
+	shellEnvFileFlag []string
+)
+
+func init() {
+	shellCmd.Flags().BoolVar(&shellLockedFlag, "locked", false, "Fail if the image of the stage is not pinned in .infinity.lock instead of warning")
+	shellCmd.Flags().StringArrayVarP(&shellEnvFlag, "env", "e", []string{}, "Set environment variable KEY=VALUE, overriding the manifest; KEY without value takes it from the current environment")
+	shellCmd.Flags().StringArrayVar(&shellEnvFileFlag, "env-file", []string{}, "Read environment variables from a dotenv file, overriding the manifest")
+}
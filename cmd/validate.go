@@ -1,23 +1,74 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
 	"github.com/JorritSalverda/infinity/pkg/lib"
 	"github.com/spf13/cobra"
 )
 
-var validateCmd = &cobra.Command{
-	Use:   "validate",
-	Short: "Validate the .infinity.yaml manifest",
-	RunE: func(cmd *cobra.Command, args []string) error {
-		manifestReader := lib.NewManifestReader()
-		commandRunner := lib.NewCommandRunner(verboseFlag)
-		randomStringGenerator := lib.NewRandomStringGenerator()
-		dockerRunner := lib.NewDockerRunner(commandRunner, randomStringGenerator, buildDirectoryFlag)
-		hostRunner := lib.NewHostRunner(commandRunner, buildDirectoryFlag)
+var (
+	validateCmd = &cobra.Command{
+		Use:   "validate",
+		Short: "Validate the .infinity.yaml manifest",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			format := lib.AnnotationFormat(validateFormatFlag)
+			if format != "" && !format.IsSupported() {
+				return fmt.Errorf("format %v is not supported; use --format %v", format, strings.Join(lib.SupportedAnnotationFormats.ToStringArray(), "|"))
+			}
+
+			manifestReader := lib.NewManifestReader()
+			secretMasker := lib.NewSecretMasker()
+			commandRunner := lib.NewCommandRunner(secretMasker, verboseFlag)
+			randomStringGenerator := lib.NewRandomStringGenerator()
+			dockerRunner := lib.NewDockerRunner(commandRunner, randomStringGenerator, buildDirectoryFlag, false, nil, false)
+			hostRunner := lib.NewHostRunner(commandRunner, buildDirectoryFlag)
+			secretProvider := lib.NewSecretProvider(buildDirectoryFlag, secretKeyFlag)
+
+			envFileReader := lib.NewEnvFileReader(buildDirectoryFlag)
+			gitReader := lib.NewGitReader(buildDirectoryFlag)
+
+			runner := lib.NewRunner(manifestReader, dockerRunner, hostRunner, secretProvider, secretMasker, envFileReader, gitReader, nil, nil, 0, map[string]string{}, buildDirectoryFlag, buildManifestFilenameFlag)
+
+			if format != "" {
+				return validateWithAnnotations(cmd, runner, format)
+			}
+
+			_, err := runner.Validate(cmd.Context())
+			return err
+		},
+	}
+
+	validateFormatFlag string
+)
+
+func init() {
+	validateCmd.Flags().StringVarP(&validateFormatFlag, "format", "f", "", "Print warnings and errors as annotations to stdout; text for file:line:column lines, github for GitHub Actions annotations or gitlab for a GitLab code quality report")
+}
 
-		runner := lib.NewRunner(manifestReader, dockerRunner, hostRunner, forcePullFlag, buildDirectoryFlag, buildManifestFilenameFlag)
+// validateWithAnnotations prints the findings in a format CI systems pick up to annotate the manifest
+func validateWithAnnotations(cmd *cobra.Command, runner lib.Runner, format lib.AnnotationFormat) error {
+	_, warnings, errs, err := runner.ValidateManifest(cmd.Context())
+	if err != nil {
+		var invalidErr *lib.ManifestInvalidError
+		if !errors.As(err, &invalidErr) {
+			return err
+		}
+		errs = invalidErr.Errors
+	}
 
-		_, err := runner.Validate(cmd.Context())
+	err = lib.WriteManifestAnnotations(os.Stdout, format, filepath.Join(buildDirectoryFlag, buildManifestFilenameFlag), warnings, errs)
+	if err != nil {
 		return err
-	},
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("manifest failed validation")
+	}
+
+	return nil
 }
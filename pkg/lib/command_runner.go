@@ -18,24 +18,27 @@ import (
 type CommandRunner interface {
 	RunCommand(ctx context.Context, logger *log.Logger, dir, command string, args []string, env ...string) (err error)
 	RunCommandWithOutput(ctx context.Context, logger *log.Logger, dir, command string, args []string, env ...string) (output []byte, err error)
+	RunInteractiveCommand(ctx context.Context, logger *log.Logger, dir, command string, args []string, env ...string) (err error)
 }
 
 type commandRunner struct {
-	verbose bool
+	secretMasker SecretMasker
+	verbose      bool
 }
 
-func NewCommandRunner(verbose bool) CommandRunner {
+func NewCommandRunner(secretMasker SecretMasker, verbose bool) CommandRunner {
 	return &commandRunner{
-		verbose: verbose,
+		secretMasker: secretMasker,
+		verbose:      verbose,
 	}
 }
 
 func (c *commandRunner) RunCommand(ctx context.Context, logger *log.Logger, dir, command string, args []string, env ...string) (err error) {
 	if c.verbose {
 		if logger != nil {
-			logger.Printf(aurora.Gray(12, "> %v %v").String(), command, strings.Join(args, " "))
+			logger.Printf(aurora.Gray(12, "> %v %v").String(), command, c.secretMasker.Mask(strings.Join(args, " ")))
 		} else {
-			log.Printf(aurora.Gray(12, "> %v %v").String(), command, strings.Join(args, " "))
+			log.Printf(aurora.Gray(12, "> %v %v").String(), command, c.secretMasker.Mask(strings.Join(args, " ")))
 		}
 	}
 
@@ -61,10 +64,12 @@ func (c *commandRunner) RunCommand(ctx context.Context, logger *log.Logger, dir,
 	multi := io.MultiReader(stdout, stderr)
 	scanner := bufio.NewScanner(multi)
 	for scanner.Scan() {
+		// redact secret values before they reach the stage logger
+		line := c.secretMasker.Mask(scanner.Text())
 		if logger != nil {
-			logger.Printf(scanner.Text())
+			logger.Print(line)
 		} else {
-			log.Print(scanner.Text())
+			log.Print(line)
 		}
 	}
 
@@ -79,9 +84,9 @@ func (c *commandRunner) RunCommand(ctx context.Context, logger *log.Logger, dir,
 func (c *commandRunner) RunCommandWithOutput(ctx context.Context, logger *log.Logger, dir, command string, args []string, env ...string) (output []byte, err error) {
 	if c.verbose {
 		if logger != nil {
-			logger.Printf(aurora.Gray(12, "> %v %v").String(), command, strings.Join(args, " "))
+			logger.Printf(aurora.Gray(12, "> %v %v").String(), command, c.secretMasker.Mask(strings.Join(args, " ")))
 		} else {
-			log.Printf(aurora.Gray(12, "> %v %v").String(), command, strings.Join(args, " "))
+			log.Printf(aurora.Gray(12, "> %v %v").String(), command, c.secretMasker.Mask(strings.Join(args, " ")))
 		}
 	}
 
@@ -92,6 +97,26 @@ func (c *commandRunner) RunCommandWithOutput(ctx context.Context, logger *log.Lo
 	return cmd.CombinedOutput()
 }
 
+// RunInteractiveCommand attaches the command to the terminal, so a user can interact with it
+func (c *commandRunner) RunInteractiveCommand(ctx context.Context, logger *log.Logger, dir, command string, args []string, env ...string) (err error) {
+	if c.verbose {
+		if logger != nil {
+			logger.Printf(aurora.Gray(12, "> %v %v").String(), command, c.secretMasker.Mask(strings.Join(args, " ")))
+		} else {
+			log.Printf(aurora.Gray(12, "> %v %v").String(), command, c.secretMasker.Mask(strings.Join(args, " ")))
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, command, args...)
+	cmd.Env = c.overrideEnvvars(os.Environ(), env...)
+	cmd.Dir = dir
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
+
 func (c *commandRunner) overrideEnvvars(env []string, extraEnv ...string) (combinedEnv []string) {
 	// convert to map
 	envMap := c.envToMap(env)
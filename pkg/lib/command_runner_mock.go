@@ -73,3 +73,22 @@ func (mr *MockCommandRunnerMockRecorder) RunCommandWithOutput(ctx, logger, dir,
 	varargs := append([]interface{}{ctx, logger, dir, command, args}, env...)
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunCommandWithOutput", reflect.TypeOf((*MockCommandRunner)(nil).RunCommandWithOutput), varargs...)
 }
+
+// RunInteractiveCommand mocks base method.
+func (m *MockCommandRunner) RunInteractiveCommand(ctx context.Context, logger *log.Logger, dir, command string, args []string, env ...string) error {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, logger, dir, command, args}
+	for _, a := range env {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "RunInteractiveCommand", varargs...)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RunInteractiveCommand indicates an expected call of RunInteractiveCommand.
+func (mr *MockCommandRunnerMockRecorder) RunInteractiveCommand(ctx, logger, dir, command, args interface{}, env ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, logger, dir, command, args}, env...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunInteractiveCommand", reflect.TypeOf((*MockCommandRunner)(nil).RunInteractiveCommand), varargs...)
+}
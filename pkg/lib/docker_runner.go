@@ -3,13 +3,18 @@ package lib
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/logrusorgru/aurora"
 	"golang.org/x/sync/errgroup"
@@ -19,16 +24,22 @@ import (
 type DockerRunner interface {
 	ContainerImageIsPulled(ctx context.Context, logger *log.Logger, stage ManifestStage) (isPulled bool, err error)
 	ContainerPull(ctx context.Context, logger *log.Logger, stage ManifestStage) (err error)
-	ContainerStart(ctx context.Context, logger *log.Logger, stage ManifestStage, env map[string]string, needsNetwork bool) (err error)
+	ContainerImageDigest(ctx context.Context, logger *log.Logger, stage ManifestStage) (digest string, err error)
+	ContainerImageParameters(ctx context.Context, logger *log.Logger, stage ManifestStage) (parameters []string, err error)
+	ContainerStart(ctx context.Context, logger *log.Logger, stage ManifestStage, env, secretEnv, secretFiles map[string]string, needsNetwork bool) (err error)
+	ContainerShell(ctx context.Context, logger *log.Logger, stage ManifestStage, env, secretEnv, secretFiles map[string]string, needsNetwork bool) (err error)
 	ContainerLogs(ctx context.Context, logger *log.Logger, stage ManifestStage, containerID string) (err error)
 	ContainerGetExitCode(ctx context.Context, logger *log.Logger, containerID string) (exitCode int, err error)
 	ContainerWait(ctx context.Context, logger *log.Logger, containerID string) (err error)
 	ContainerRemove(ctx context.Context, logger *log.Logger, containerID string) (err error)
 	ContainerStop(ctx context.Context, logger *log.Logger, stage ManifestStage, containerID string, timeoutSeconds int) (err error)
+	ContainerIsRunning(ctx context.Context, logger *log.Logger, stage ManifestStage) (isRunning bool, err error)
+	RegistryLogin(ctx context.Context, logger *log.Logger, credentials []RegistryCredentials) (tokens []string, err error)
+	RegistryLogout(ctx context.Context, logger *log.Logger) (err error)
 	NetworkCreate(ctx context.Context, logger *log.Logger) (err error)
 	NetworkRemove(ctx context.Context, logger *log.Logger) (err error)
 	NeedsNetwork(stages []*ManifestStage) bool
-	StopRunningContainers(ctx context.Context) (err error)
+	StopRunningContainers(ctx context.Context, logOutput io.Writer) (err error)
 }
 
 type dockerRunner struct {
@@ -38,12 +49,29 @@ type dockerRunner struct {
 	pulledImagesMutex      *MapMutex
 	runningContainers      map[string]ManifestStage
 	runningContainersMutex *MapMutex
+	secretFileDirectories  map[string]string
 	networkName            string
+	debugOnFailure         bool
+	imageLock              *ImageLock
+	locked                 bool
+	unlockedImages         map[string]struct{}
+	unlockedImagesMutex    *MapMutex
+	lockedImages           map[string]struct{}
+	lockedImagesMutex      *MapMutex
+	registryConfigDir      string
+	registryHosts          map[string]bool
+
+	// debug shells share the terminal, so only the first failing stage gets one, once the other running stages are done
+	debugMutex    *sync.Mutex
+	debugCond     *sync.Cond
+	debugStarted  bool
+	runningStages int
 }
 
-func NewDockerRunner(commandRunner CommandRunner, randomStringGenerator RandomStringGenerator, buildDirectory string) DockerRunner {
+func NewDockerRunner(commandRunner CommandRunner, randomStringGenerator RandomStringGenerator, buildDirectory string, debugOnFailure bool, imageLock *ImageLock, locked bool) DockerRunner {
 
 	networkName := fmt.Sprintf("infinity-%v", randomStringGenerator.GenerateRandomString(10))
+	debugMutex := &sync.Mutex{}
 
 	return &dockerRunner{
 		commandRunner:          commandRunner,
@@ -52,120 +80,295 @@ func NewDockerRunner(commandRunner CommandRunner, randomStringGenerator RandomSt
 		pulledImagesMutex:      NewMapMutex(),
 		runningContainers:      make(map[string]ManifestStage),
 		runningContainersMutex: NewMapMutex(),
+		secretFileDirectories:  make(map[string]string),
 		networkName:            networkName,
+		debugOnFailure:         debugOnFailure,
+		imageLock:              imageLock,
+		locked:                 locked,
+		unlockedImages:         make(map[string]struct{}),
+		unlockedImagesMutex:    NewMapMutex(),
+		lockedImages:           make(map[string]struct{}),
+		lockedImagesMutex:      NewMapMutex(),
+		debugMutex:             debugMutex,
+		debugCond:              sync.NewCond(debugMutex),
 	}
 }
 
 func (b *dockerRunner) ContainerImageIsPulled(ctx context.Context, logger *log.Logger, stage ManifestStage) (isPulled bool, err error) {
 
-	b.pulledImagesMutex.Lock(stage.Image)
-	defer b.pulledImagesMutex.Unlock(stage.Image)
+	image, err := b.getImage(logger, stage)
+	if err != nil {
+		return
+	}
+	if err = b.checkLockedDigest(ctx, logger, stage); err != nil {
+		return
+	}
+
+	b.pulledImagesMutex.Lock(image)
+	defer b.pulledImagesMutex.Unlock(image)
 
-	if _, ok := b.pulledImages[stage.Image]; ok {
-		logger.Printf(aurora.Gray(12, "Already pulled image %v").String(), aurora.BrightBlue(stage.Image))
+	if _, ok := b.pulledImages[image]; ok {
+		logger.Printf(aurora.Gray(12, "Already pulled image %v").String(), aurora.BrightBlue(image))
 		return true, nil
 	}
 
 	dockerCommand := "docker"
-	dockerPullArgs := []string{
-		"images",
-		"--format='{{.Repository}}:{{.Tag}}'",
-		stage.Image,
+	dockerInspectArgs := []string{
+		"image",
+		"inspect",
+		"--format={{.Id}}",
+		image,
 	}
 
-	output, err := b.commandRunner.RunCommandWithOutput(ctx, logger, "", dockerCommand, dockerPullArgs)
+	// inspect resolves the image reference like pull and run do, including the implicit latest tag and digests
+	output, err := b.commandRunner.RunCommandWithOutput(ctx, logger, "", dockerCommand, dockerInspectArgs)
 	if err != nil {
-		return false, err
+		if strings.Contains(strings.ToLower(string(output)), "no such image") {
+			return false, nil
+		}
+		return false, fmt.Errorf("inspecting image %v for stage %v failed: %v: %w", image, stage.Name, strings.TrimSpace(string(output)), err)
 	}
 
-	output = bytes.Trim(output, "'\n")
+	b.pulledImages[image] = struct{}{}
 
-	if string(output) == stage.Image {
-		return true, nil
-	}
-
-	return false, nil
+	return true, nil
 }
 
 func (b *dockerRunner) ContainerPull(ctx context.Context, logger *log.Logger, stage ManifestStage) (err error) {
 
-	b.pulledImagesMutex.Lock(stage.Image)
-	defer b.pulledImagesMutex.Unlock(stage.Image)
+	image, err := b.getImage(logger, stage)
+	if err != nil {
+		return
+	}
+	if err = b.checkLockedDigest(ctx, logger, stage); err != nil {
+		return
+	}
+
+	b.pulledImagesMutex.Lock(image)
+	defer b.pulledImagesMutex.Unlock(image)
 
-	if _, ok := b.pulledImages[stage.Image]; ok {
-		logger.Printf(aurora.Gray(12, "Already pulled image %v").String(), aurora.BrightBlue(stage.Image))
+	if _, ok := b.pulledImages[image]; ok {
+		logger.Printf(aurora.Gray(12, "Already pulled image %v").String(), aurora.BrightBlue(image))
 		return
 	}
 
 	dockerCommand := "docker"
-	dockerPullArgs := []string{
-		"pull",
-		stage.Image,
+	dockerPullArgs := b.getRegistryArgs(image, "pull", image)
+
+	logger.Printf(aurora.Gray(12, "Pulling image %v").String(), aurora.BrightBlue(image))
+
+	err = b.commandRunner.RunCommand(ctx, logger, "", dockerCommand, dockerPullArgs)
+	if err != nil {
+		return fmt.Errorf("pulling image %v for stage %v failed: %w", image, stage.Name, err)
 	}
 
+	b.pulledImages[image] = struct{}{}
+
+	return nil
+}
+
+// ContainerImageDigest pulls the image of the stage as tagged in the manifest, ignoring the lockfile, and returns the digest the tag currently resolves to
+func (b *dockerRunner) ContainerImageDigest(ctx context.Context, logger *log.Logger, stage ManifestStage) (digest string, err error) {
+
+	dockerCommand := "docker"
+	dockerPullArgs := b.getRegistryArgs(stage.Image, "pull", stage.Image)
+
 	logger.Printf(aurora.Gray(12, "Pulling image %v").String(), aurora.BrightBlue(stage.Image))
 
 	err = b.commandRunner.RunCommand(ctx, logger, "", dockerCommand, dockerPullArgs)
 	if err != nil {
-		return fmt.Errorf("pulling image %v for stage %v failed: %w", stage.Image, stage.Name, err)
+		return "", fmt.Errorf("pulling image %v failed: %w", stage.Image, err)
+	}
+
+	dockerInspectArgs := []string{
+		"image",
+		"inspect",
+		`--format={{ join .RepoDigests "," }}`,
+		stage.Image,
 	}
 
-	b.pulledImages[stage.Image] = struct{}{}
+	output, err := b.commandRunner.RunCommandWithOutput(ctx, logger, "", dockerCommand, dockerInspectArgs)
+	if err != nil {
+		return "", fmt.Errorf("inspecting image %v failed: %w", stage.Image, err)
+	}
 
-	return nil
+	digest, ok := getRepoDigest(stage.Image, output)
+	if !ok {
+		return "", fmt.Errorf("image %v has no digest for repository %v; only images pulled from a registry can be locked", stage.Image, getImageRepository(stage.Image))
+	}
+
+	return digest, nil
 }
 
-func (b *dockerRunner) ContainerStart(ctx context.Context, logger *log.Logger, stage ManifestStage, env map[string]string, needsNetwork bool) (err error) {
+// getRepoDigest picks the digest of the image's repository from the comma separated repo digests docker inspect returns
+func getRepoDigest(image string, output []byte) (digest string, ok bool) {
+	repoDigests := []string{}
+	for _, d := range strings.Split(strings.TrimSpace(string(output)), ",") {
+		if strings.Contains(d, "@") {
+			repoDigests = append(repoDigests, d)
+		}
+	}
 
-	pwd, err := filepath.Abs(b.buildDirectory)
+	// an image pushed to several repositories has a digest for each of them
+	repository := getImageRepository(image)
+	for _, d := range repoDigests {
+		if getImageRepository(d) == repository {
+			return strings.SplitN(d, "@", 2)[1], true
+		}
+	}
+	if len(repoDigests) == 1 {
+		return strings.SplitN(repoDigests[0], "@", 2)[1], true
+	}
+
+	return "", false
+}
+
+// RegistryLogin writes the credentials to a docker config that pulls from these registries use, leaving the docker logins of the host untouched; token commands run now, so short-lived tokens are fresh for the pulls that follow, and their tokens are returned to be masked
+func (b *dockerRunner) RegistryLogin(ctx context.Context, logger *log.Logger, credentials []RegistryCredentials) (tokens []string, err error) {
+
+	registryHosts := map[string]bool{}
+	resolvedCredentials := []RegistryCredentials{}
+	for _, c := range credentials {
+		if c.Command != "" {
+			logger.Printf(aurora.Gray(12, "Getting token for registry %v").String(), aurora.BrightBlue(c.Host))
+
+			output, err := b.commandRunner.RunCommandWithOutput(ctx, logger, b.buildDirectory, "sh", []string{"-c", c.Command})
+			if err != nil {
+				return tokens, fmt.Errorf("getting token for registry %v with command %v failed: %w", c.Host, c.Command, err)
+			}
+
+			// the output includes stderr, where tools print their warnings before the token
+			lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+			c.Password = strings.TrimSpace(lines[len(lines)-1])
+			if c.Password == "" {
+				return tokens, fmt.Errorf("getting token for registry %v with command %v failed: it printed no token", c.Host, c.Command)
+			}
+			tokens = append(tokens, c.Password)
+		}
+
+		registryHosts[getRegistryHost(c.Host)] = true
+		resolvedCredentials = append(resolvedCredentials, c)
+	}
+
+	config, err := getDockerConfig(resolvedCredentials)
+	if err != nil {
+		return
+	}
+
+	configDir, err := ioutil.TempDir("", "infinity-docker-config-")
 	if err != nil {
 		return
 	}
+	if err = ioutil.WriteFile(filepath.Join(configDir, "config.json"), config, 0600); err != nil {
+		os.RemoveAll(configDir)
+		return
+	}
+
+	b.registryConfigDir = configDir
+	b.registryHosts = registryHosts
+
+	return tokens, nil
+}
+
+// RegistryLogout removes the docker config with the registry credentials
+func (b *dockerRunner) RegistryLogout(ctx context.Context, logger *log.Logger) (err error) {
+	if b.registryConfigDir == "" {
+		return nil
+	}
+
+	err = os.RemoveAll(b.registryConfigDir)
+	b.registryConfigDir = ""
+	b.registryHosts = nil
+
+	return err
+}
+
+// getRegistryArgs prefixes the docker arguments with the docker config holding the registry credentials if the image comes from one of those registries
+func (b *dockerRunner) getRegistryArgs(image string, args ...string) []string {
+	if b.registryConfigDir != "" && b.registryHosts[getImageRegistry(image)] {
+		return append([]string{fmt.Sprintf("--config=%v", b.registryConfigDir)}, args...)
+	}
+
+	return args
+}
+
+// ContainerImageParameters returns the parameters the pulled image declares through its label; it returns nil if the image has no label, or isn't pulled after all
+func (b *dockerRunner) ContainerImageParameters(ctx context.Context, logger *log.Logger, stage ManifestStage) (parameters []string, err error) {
+
+	// pulling the image reported unlocked images already
+	image, _ := b.getPinnedImage(stage)
 
 	dockerCommand := "docker"
-	dockerRunArgs := []string{
-		"run",
-		"--detach",
+	dockerInspectArgs := []string{
+		"image",
+		"inspect",
+		fmt.Sprintf("--format={{ index .Config.Labels %q }}", ParameterLabel),
+		image,
 	}
 
-	if stage.Background {
-		dockerRunArgs = append(dockerRunArgs, fmt.Sprintf("--name=%v", stage.Name))
+	output, err := b.commandRunner.RunCommandWithOutput(ctx, logger, "", dockerCommand, dockerInspectArgs)
+	if err != nil {
+		if strings.Contains(strings.ToLower(string(output)), "no such image") {
+			logger.Printf(aurora.Gray(12, "Image %v is not pulled; skipping the check of its parameters").String(), aurora.BrightBlue(image))
+			return nil, nil
+		}
+		return nil, fmt.Errorf("inspecting image %v failed: %v: %w", image, strings.TrimSpace(string(output)), err)
 	}
 
-	if needsNetwork {
-		dockerRunArgs = append(dockerRunArgs, fmt.Sprintf("--network=%v", b.networkName))
+	label := strings.TrimSpace(string(output))
+	if label == "" || label == "<no value>" {
+		return nil, nil
 	}
 
-	if stage.MountWorkingDirectory != nil && *stage.MountWorkingDirectory {
-		dockerRunArgs = append(dockerRunArgs, fmt.Sprintf("--volume=%v:%v", pwd, stage.WorkingDirectory))
-		dockerRunArgs = append(dockerRunArgs, fmt.Sprintf("--workdir=%v", stage.WorkingDirectory))
+	for _, p := range strings.Split(label, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			parameters = append(parameters, p)
+		}
 	}
 
-	for _, v := range stage.Volumes {
-		dockerRunArgs = append(dockerRunArgs, fmt.Sprintf("--volume=%v", v))
+	return parameters, nil
+}
+
+func (b *dockerRunner) ContainerStart(ctx context.Context, logger *log.Logger, stage ManifestStage, env, secretEnv, secretFiles map[string]string, needsNetwork bool) (err error) {
+
+	image, err := b.getImage(logger, stage)
+	if err != nil {
+		return
 	}
-	for _, d := range stage.Devices {
-		dockerRunArgs = append(dockerRunArgs, fmt.Sprintf("--device=%v", d))
+
+	dockerCommand := "docker"
+	dockerRunArgs := []string{
+		"run",
+		"--detach",
 	}
 
-	// loop envvars in sorted order
-	envKeys := make([]string, 0, len(env))
-	for k := range env {
-		envKeys = append(envKeys, k)
+	if stage.Background {
+		dockerRunArgs = append(dockerRunArgs, fmt.Sprintf("--name=%v", stage.Name))
 	}
-	sort.Strings(envKeys)
-	for _, k := range envKeys {
-		dockerRunArgs = append(dockerRunArgs, fmt.Sprintf("--env=%v=%v", k, env[k]))
+
+	// don't start writing to the terminal of a debug shell; the run fails with the debugged stage anyway
+	if !b.stageStarted(stage) {
+		return fmt.Errorf("stage %v is not started, since a failed stage is being debugged: %w", stage.Name, ErrCanceled)
 	}
+	defer b.stageFinished(stage)
 
-	if stage.Privileged {
-		dockerRunArgs = append(dockerRunArgs, "--privileged")
+	secretFilesDirectory, secretFileArgs, err := b.writeSecretFiles(ctx, logger, image, env, secretFiles)
+	if err != nil {
+		return
+	}
+
+	containerArgs, secretEnvArray, err := b.getContainerArgs(stage, env, secretEnv, secretFileArgs, needsNetwork)
+	if err != nil {
+		b.removeSecretFiles(secretFilesDirectory)
+		return
 	}
+	dockerRunArgs = append(dockerRunArgs, containerArgs...)
+
 	if len(stage.Commands) > 0 {
 		dockerRunArgs = append(dockerRunArgs, fmt.Sprintf("--entrypoint=%v", stage.Shell))
 	}
 
-	dockerRunArgs = append(dockerRunArgs, stage.Image)
+	dockerRunArgs = append(dockerRunArgs, image)
 
 	if len(stage.Commands) > 0 {
 		commandsArg := []string{"set -e"}
@@ -193,13 +396,18 @@ func (b *dockerRunner) ContainerStart(ctx context.Context, logger *log.Logger, s
 		logger.Printf(aurora.Gray(12, "Starting stage").String())
 	}
 
-	containerIDBytes, err := b.commandRunner.RunCommandWithOutput(context.Background(), logger, "", dockerCommand, dockerRunArgs)
+	_, startSpan := StartSpan(ctx, "start", map[string]interface{}{
+		"container.image.name": image,
+	})
+	containerIDBytes, err := b.commandRunner.RunCommandWithOutput(context.Background(), logger, "", dockerCommand, dockerRunArgs, secretEnvArray...)
+	startSpan.Finish(err)
 	if err != nil {
+		b.removeSecretFiles(secretFilesDirectory)
 		return
 	}
 
 	containerID := strings.TrimSuffix(string(containerIDBytes), "\n")
-	b.addRunningContainer(stage, containerID)
+	b.addRunningContainer(stage, containerID, secretFilesDirectory)
 
 	if stage.Background {
 		return
@@ -230,7 +438,9 @@ func (b *dockerRunner) ContainerStart(ctx context.Context, logger *log.Logger, s
 	}()
 
 	// tail logs
-	err = b.ContainerLogs(ctx, logger, stage, containerID)
+	logsCtx, logsSpan := StartSpan(ctx, "logs", nil)
+	err = b.ContainerLogs(logsCtx, logger, stage, containerID)
+	logsSpan.Finish(err)
 	if err != nil {
 		return
 	}
@@ -241,12 +451,310 @@ func (b *dockerRunner) ContainerStart(ctx context.Context, logger *log.Logger, s
 		return
 	}
 	if exitCode > 0 {
-		return fmt.Errorf("stage %v failed with exit code %v", stage.Name, exitCode)
+		if b.debugOnFailure && ctx.Err() == nil {
+			b.debugContainer(ctx, logger, stage, containerID, containerArgs, secretEnvArray)
+		}
+		return &StageExitError{Stage: stage.Name, ExitCode: exitCode}
 	}
 
 	return
 }
 
+// ContainerShell starts an interactive shell in a container for the stage instead of running its commands
+func (b *dockerRunner) ContainerShell(ctx context.Context, logger *log.Logger, stage ManifestStage, env, secretEnv, secretFiles map[string]string, needsNetwork bool) (err error) {
+
+	image, err := b.getImage(logger, stage)
+	if err != nil {
+		return
+	}
+
+	secretFilesDirectory, secretFileArgs, err := b.writeSecretFiles(ctx, logger, image, env, secretFiles)
+	if err != nil {
+		return
+	}
+	defer b.removeSecretFiles(secretFilesDirectory)
+
+	containerArgs, secretEnvArray, err := b.getContainerArgs(stage, env, secretEnv, secretFileArgs, needsNetwork)
+	if err != nil {
+		return
+	}
+
+	dockerRunArgs := []string{
+		"run",
+		"--rm",
+		"--interactive",
+		"--tty",
+		fmt.Sprintf("--entrypoint=%v", stage.Shell),
+	}
+	dockerRunArgs = append(dockerRunArgs, containerArgs...)
+	dockerRunArgs = append(dockerRunArgs, image)
+
+	logger.Printf(aurora.Gray(12, "Starting %v in stage container").String(), stage.Shell)
+
+	return b.commandRunner.RunInteractiveCommand(ctx, logger, "", "docker", dockerRunArgs, secretEnvArray...)
+}
+
+// getImage returns the image of the stage pinned to its locked digest; an image missing from the lockfile fails with --locked and gets a warning otherwise
+func (b *dockerRunner) getImage(logger *log.Logger, stage ManifestStage) (image string, err error) {
+	image, ok := b.getPinnedImage(stage)
+	if ok {
+		return image, nil
+	}
+
+	if b.locked {
+		return "", fmt.Errorf("image %v of stage %v is not pinned in %v; run 'infinity lock' to pin it", stage.Image, stage.Name, ImageLockFilename)
+	}
+	if b.imageLock == nil {
+		return stage.Image, nil
+	}
+
+	// warn once per image rather than for every stage using it
+	b.unlockedImagesMutex.Lock(stage.Image)
+	defer b.unlockedImagesMutex.Unlock(stage.Image)
+	if _, ok := b.unlockedImages[stage.Image]; !ok {
+		b.unlockedImages[stage.Image] = struct{}{}
+		logger.Printf(aurora.BrightYellow("Image %v is not pinned in %v and may change between runs; run 'infinity lock' to pin it").String(), stage.Image, ImageLockFilename)
+	}
+
+	return stage.Image, nil
+}
+
+// checkLockedDigest warns if the tag of a locked image is present locally with another digest than the lockfile has, meaning the tag moved since it got locked; with --locked it fails instead
+func (b *dockerRunner) checkLockedDigest(ctx context.Context, logger *log.Logger, stage ManifestStage) (err error) {
+	if b.imageLock == nil {
+		return nil
+	}
+	lockedDigest, ok := b.imageLock.Images[stage.Image]
+	if !ok {
+		return nil
+	}
+
+	// check once per image rather than for every stage using it
+	b.lockedImagesMutex.Lock(stage.Image)
+	defer b.lockedImagesMutex.Unlock(stage.Image)
+	if _, ok := b.lockedImages[stage.Image]; ok {
+		return nil
+	}
+
+	dockerCommand := "docker"
+	dockerInspectArgs := []string{
+		"image",
+		"inspect",
+		`--format={{ join .RepoDigests "," }}`,
+		stage.Image,
+	}
+
+	output, err := b.commandRunner.RunCommandWithOutput(ctx, logger, "", dockerCommand, dockerInspectArgs)
+	if err != nil && !strings.Contains(strings.ToLower(string(output)), "no such image") {
+		return fmt.Errorf("inspecting image %v failed: %v: %w", stage.Image, strings.TrimSpace(string(output)), err)
+	}
+
+	// a tag that isn't pulled locally has nothing to compare with
+	if err == nil {
+		if digest, ok := getRepoDigest(stage.Image, output); ok && digest != lockedDigest {
+			if b.locked {
+				return fmt.Errorf("image %v is locked to %v in %v, but the tag resolves to %v by now; run 'infinity lock' to update the lockfile", stage.Image, lockedDigest, ImageLockFilename, digest)
+			}
+			logger.Printf(aurora.BrightYellow("Image %v is locked to %v in %v, but the tag resolves to %v by now; run 'infinity lock' to update the lockfile").String(), stage.Image, lockedDigest, ImageLockFilename, digest)
+		}
+	}
+	b.lockedImages[stage.Image] = struct{}{}
+
+	return nil
+}
+
+func (b *dockerRunner) getPinnedImage(stage ManifestStage) (image string, ok bool) {
+	if b.imageLock == nil {
+		return stage.Image, strings.Contains(stage.Image, "@")
+	}
+
+	return b.imageLock.GetPinnedImage(stage.Image)
+}
+
+// getContainerArgs returns the docker run arguments for network, mounts, devices, resource limits and envvars of a stage; secret envvars are passed by name only and their values returned separately
+func (b *dockerRunner) getContainerArgs(stage ManifestStage, env, secretEnv map[string]string, secretFileArgs []string, needsNetwork bool) (args []string, secretEnvArray []string, err error) {
+
+	pwd, err := filepath.Abs(b.buildDirectory)
+	if err != nil {
+		return
+	}
+
+	if needsNetwork {
+		args = append(args, fmt.Sprintf("--network=%v", b.networkName))
+	}
+
+	if stage.MountWorkingDirectory != nil && *stage.MountWorkingDirectory {
+		args = append(args, fmt.Sprintf("--volume=%v:%v", pwd, stage.WorkingDirectory))
+		args = append(args, fmt.Sprintf("--workdir=%v", stage.WorkingDirectory))
+	}
+
+	for _, v := range stage.Volumes {
+		args = append(args, fmt.Sprintf("--volume=%v", v))
+	}
+	for _, d := range stage.Devices {
+		args = append(args, fmt.Sprintf("--device=%v", d))
+	}
+	args = append(args, secretFileArgs...)
+
+	if r := stage.Resources; r != nil {
+		if r.CPUs > 0 {
+			args = append(args, fmt.Sprintf("--cpus=%v", strconv.FormatFloat(r.CPUs, 'f', -1, 64)))
+		}
+		if r.Memory != "" {
+			args = append(args, fmt.Sprintf("--memory=%v", r.Memory))
+		}
+		if r.PIDs != 0 {
+			args = append(args, fmt.Sprintf("--pids-limit=%v", r.PIDs))
+		}
+		if r.ShmSize != "" {
+			args = append(args, fmt.Sprintf("--shm-size=%v", r.ShmSize))
+		}
+	}
+	for _, u := range stage.Ulimits {
+		args = append(args, fmt.Sprintf("--ulimit=%v", u))
+	}
+
+	// loop envvars in sorted order
+	envKeys := make([]string, 0, len(env))
+	for k := range env {
+		envKeys = append(envKeys, k)
+	}
+	sort.Strings(envKeys)
+	for _, k := range envKeys {
+		if _, ok := secretEnv[k]; ok {
+			continue
+		}
+		args = append(args, fmt.Sprintf("--env=%v=%v", k, env[k]))
+	}
+
+	// pass secrets by name only, so docker reads their values from its own environment instead of the arguments
+	secretEnvKeys := make([]string, 0, len(secretEnv))
+	for k := range secretEnv {
+		secretEnvKeys = append(secretEnvKeys, k)
+	}
+	sort.Strings(secretEnvKeys)
+	secretEnvArray = make([]string, 0, len(secretEnv))
+	for _, k := range secretEnvKeys {
+		args = append(args, fmt.Sprintf("--env=%v", k))
+		secretEnvArray = append(secretEnvArray, fmt.Sprintf("%v=%v", k, secretEnv[k]))
+	}
+
+	if stage.Privileged {
+		args = append(args, "--privileged")
+	}
+
+	return
+}
+
+// debugContainer commits the failed container to an image and starts an interactive shell in it with the same mounts and envvars; the image gets removed once the shell exits
+func (b *dockerRunner) debugContainer(ctx context.Context, logger *log.Logger, stage ManifestStage, containerID string, containerArgs, secretEnvArray []string) {
+	// parallel stages still writing to the terminal would interfere with the shell
+	if !b.startDebugging(ctx, logger) {
+		return
+	}
+	defer b.stopDebugging()
+
+	logger.Printf(aurora.BrightYellow("Stage failed; starting %v in its container to debug it, exit the shell to continue").String(), stage.Shell)
+
+	imageBytes, err := b.commandRunner.RunCommandWithOutput(ctx, logger, "", "docker", []string{"commit", containerID})
+	if err != nil {
+		logger.Printf(aurora.BrightRed("Committing container %v failed: %v").String(), containerID, err)
+		return
+	}
+	image := strings.TrimSpace(string(imageBytes))
+	defer func() {
+		_, _ = b.commandRunner.RunCommandWithOutput(context.Background(), logger, "", "docker", []string{"rmi", "--force", image})
+	}()
+
+	dockerRunArgs := []string{
+		"run",
+		"--rm",
+		"--interactive",
+		"--tty",
+		fmt.Sprintf("--entrypoint=%v", stage.Shell),
+	}
+	dockerRunArgs = append(dockerRunArgs, containerArgs...)
+	dockerRunArgs = append(dockerRunArgs, image)
+
+	// don't let cancellation of parallel stages end the shell while it's being used
+	if err = b.commandRunner.RunInteractiveCommand(context.Background(), logger, "", "docker", dockerRunArgs, secretEnvArray...); err != nil {
+		logger.Printf(aurora.Gray(12, "Debug shell exited with: %v").String(), err)
+	}
+}
+
+// stageStarted counts the foreground stages that are running; it returns false if a failed stage is being debugged
+func (b *dockerRunner) stageStarted(stage ManifestStage) bool {
+	b.debugMutex.Lock()
+	defer b.debugMutex.Unlock()
+
+	if b.debugStarted {
+		return false
+	}
+	if !stage.Background {
+		b.runningStages++
+	}
+
+	return true
+}
+
+func (b *dockerRunner) stageFinished(stage ManifestStage) {
+	if stage.Background {
+		return
+	}
+
+	b.debugMutex.Lock()
+	defer b.debugMutex.Unlock()
+	b.runningStages--
+	b.debugCond.Broadcast()
+}
+
+// startDebugging returns true for the first failed stage only, once it's the only stage running in the foreground; background stages keep running to serve the debug shell
+func (b *dockerRunner) startDebugging(ctx context.Context, logger *log.Logger) bool {
+	b.debugMutex.Lock()
+	defer b.debugMutex.Unlock()
+
+	if b.debugStarted {
+		logger.Printf(aurora.Gray(12, "Stage failed; not starting a shell to debug it, since another stage gets debugged").String())
+		return false
+	}
+	b.debugStarted = true
+
+	if b.runningStages > 1 {
+		logger.Printf(aurora.Gray(12, "Stage failed; waiting for %v other running stages to finish before starting a shell to debug it").String(), b.runningStages-1)
+
+		// wake up the wait once the run gets canceled, since the other stages might not finish by themselves
+		waitDone := make(chan struct{})
+		defer close(waitDone)
+		go func() {
+			select {
+			case <-ctx.Done():
+				b.debugMutex.Lock()
+				b.debugCond.Broadcast()
+				b.debugMutex.Unlock()
+			case <-waitDone:
+			}
+		}()
+	}
+	for b.runningStages > 1 && ctx.Err() == nil {
+		b.debugCond.Wait()
+	}
+
+	if ctx.Err() != nil {
+		b.debugStarted = false
+		return false
+	}
+
+	return true
+}
+
+// stopDebugging lets stages start again once the debug shell exited
+func (b *dockerRunner) stopDebugging() {
+	b.debugMutex.Lock()
+	defer b.debugMutex.Unlock()
+
+	b.debugStarted = false
+}
+
 func (b *dockerRunner) ContainerLogs(ctx context.Context, logger *log.Logger, stage ManifestStage, containerID string) (err error) {
 
 	// follow logs
@@ -328,6 +836,28 @@ func (b *dockerRunner) ContainerStop(ctx context.Context, logger *log.Logger, st
 	return
 }
 
+// ContainerIsRunning returns true if the container started for the background stage still runs; it returns false if the container exited or was never started
+func (b *dockerRunner) ContainerIsRunning(ctx context.Context, logger *log.Logger, stage ManifestStage) (isRunning bool, err error) {
+	containerID, ok := b.getRunningContainerID(stage)
+	if !ok {
+		return false, nil
+	}
+
+	dockerCommand := "docker"
+	dockerInspectArgs := []string{
+		"inspect",
+		"--format={{.State.Running}}",
+		containerID,
+	}
+
+	output, err := b.commandRunner.RunCommandWithOutput(ctx, logger, "", dockerCommand, dockerInspectArgs)
+	if err != nil {
+		return false, fmt.Errorf("inspecting container %v of stage %v failed: %v: %w", containerID, stage.Name, strings.TrimSpace(string(output)), err)
+	}
+
+	return strings.TrimSpace(string(output)) == "true", nil
+}
+
 func (b *dockerRunner) NetworkCreate(ctx context.Context, logger *log.Logger) (err error) {
 	dockerCommand := "docker"
 	dockerNetworkCreateArgs := []string{
@@ -377,7 +907,7 @@ func (b *dockerRunner) NeedsNetwork(stages []*ManifestStage) bool {
 	return false
 }
 
-func (b *dockerRunner) StopRunningContainers(ctx context.Context) (err error) {
+func (b *dockerRunner) StopRunningContainers(ctx context.Context, logOutput io.Writer) (err error) {
 
 	if len(b.runningContainers) > 0 {
 		log.Printf("Stopping %v running stage containers\n\n", len(b.runningContainers))
@@ -387,7 +917,7 @@ func (b *dockerRunner) StopRunningContainers(ctx context.Context) (err error) {
 			stage := stage
 			containerID := containerID
 			g.Go(func() (err error) {
-				logger := log.New(os.Stdout, aurora.Index(stage.colorCode, fmt.Sprintf("[%v] ", stage.Name)).String(), 0)
+				logger := log.New(logOutput, aurora.Index(stage.colorCode, fmt.Sprintf("[%v] ", stage.Name)).String(), 0)
 
 				// ensure container gets removed at the end
 				defer func() {
@@ -420,7 +950,7 @@ func (b *dockerRunner) StopRunningContainers(ctx context.Context) (err error) {
 				}
 
 				if exitCode > 0 {
-					return fmt.Errorf("stage %v failed with exit code %v", stage.Name, exitCode)
+					return &StageExitError{Stage: stage.Name, ExitCode: exitCode}
 				}
 
 				// wait until stop finishes
@@ -444,11 +974,26 @@ func (b *dockerRunner) StopRunningContainers(ctx context.Context) (err error) {
 	return nil
 }
 
-func (b *dockerRunner) addRunningContainer(stage ManifestStage, containerID string) {
+func (b *dockerRunner) addRunningContainer(stage ManifestStage, containerID, secretFilesDirectory string) {
 	// add container id to running containers map
 	b.runningContainersMutex.Lock(stage.Name)
 	defer b.runningContainersMutex.Unlock(stage.Name)
 	b.runningContainers[containerID] = stage
+	if secretFilesDirectory != "" {
+		b.secretFileDirectories[containerID] = secretFilesDirectory
+	}
+}
+
+func (b *dockerRunner) getRunningContainerID(stage ManifestStage) (containerID string, ok bool) {
+	b.runningContainersMutex.RLock(stage.Name)
+	defer b.runningContainersMutex.RUnlock(stage.Name)
+	for id, s := range b.runningContainers {
+		if s.Name == stage.Name {
+			return id, true
+		}
+	}
+
+	return "", false
 }
 
 func (b *dockerRunner) removeRunningContainer(stage ManifestStage, containerID string) {
@@ -456,4 +1001,122 @@ func (b *dockerRunner) removeRunningContainer(stage ManifestStage, containerID s
 	b.runningContainersMutex.Lock(stage.Name)
 	defer b.runningContainersMutex.Unlock(stage.Name)
 	delete(b.runningContainers, containerID)
+
+	// remove secret files once the container that mounted them is gone
+	if secretFilesDirectory, ok := b.secretFileDirectories[containerID]; ok {
+		b.removeSecretFiles(secretFilesDirectory)
+		delete(b.secretFileDirectories, containerID)
+	}
+}
+
+// writeSecretFiles writes the secret files readable by the owner only and returns the docker run arguments to mount them; images running as a non-root user get the group of the host user added to read them instead
+func (b *dockerRunner) writeSecretFiles(ctx context.Context, logger *log.Logger, image string, env, secretFiles map[string]string) (directory string, args []string, err error) {
+	if len(secretFiles) == 0 {
+		return
+	}
+
+	user, home, err := b.getImageUser(ctx, logger, image)
+	if err != nil {
+		return
+	}
+	if envHome, ok := env["HOME"]; ok {
+		home = envHome
+	}
+
+	// root in the container reads files of any owner, other users only through the group of the host user
+	directoryMode, fileMode := os.FileMode(0700), os.FileMode(0400)
+	if !isRootUser(user) {
+		directoryMode, fileMode = 0750, 0440
+		args = append(args, fmt.Sprintf("--group-add=%v", os.Getgid()))
+	}
+
+	// write to a tmpfs outside the working copy where available, so secrets never touch disk or the repository
+	baseDirectory := ""
+	if runtime.GOOS == "linux" {
+		if info, statErr := os.Stat("/dev/shm"); statErr == nil && info.IsDir() {
+			baseDirectory = "/dev/shm"
+		}
+	}
+
+	directory, err = ioutil.TempDir(baseDirectory, "infinity-secrets-")
+	if err != nil {
+		return
+	}
+	if err = os.Chmod(directory, directoryMode); err != nil {
+		b.removeSecretFiles(directory)
+		return "", nil, err
+	}
+
+	// loop secret files in sorted order
+	paths := make([]string, 0, len(secretFiles))
+	for p := range secretFiles {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for i, p := range paths {
+		containerPath, pathErr := getContainerPath(p, user, home, image)
+		if pathErr != nil {
+			b.removeSecretFiles(directory)
+			return "", nil, pathErr
+		}
+
+		secretFilePath := filepath.Join(directory, fmt.Sprintf("secret-%v", i))
+		if err = ioutil.WriteFile(secretFilePath, []byte(secretFiles[p]), fileMode); err != nil {
+			b.removeSecretFiles(directory)
+			return "", nil, err
+		}
+		args = append(args, fmt.Sprintf("--volume=%v:%v:ro", secretFilePath, containerPath))
+	}
+
+	return
+}
+
+// getImageUser returns the user the image runs as and the home directory set in its environment, if any
+func (b *dockerRunner) getImageUser(ctx context.Context, logger *log.Logger, image string) (user, home string, err error) {
+	output, err := b.commandRunner.RunCommandWithOutput(ctx, logger, "", "docker", []string{"image", "inspect", "--format={{ json .Config }}", image})
+	if err != nil {
+		return "", "", fmt.Errorf("inspecting image %v for its user failed: %w", image, err)
+	}
+
+	var config struct {
+		User string   `json:"User"`
+		Env  []string `json:"Env"`
+	}
+	if err = json.Unmarshal(bytes.TrimSpace(output), &config); err != nil {
+		return "", "", fmt.Errorf("inspecting image %v for its user failed: %w", image, err)
+	}
+	for _, e := range config.Env {
+		if strings.HasPrefix(e, "HOME=") {
+			home = strings.TrimPrefix(e, "HOME=")
+		}
+	}
+
+	return config.User, home, nil
+}
+
+func isRootUser(user string) bool {
+	name := strings.Split(user, ":")[0]
+
+	return name == "" || name == "root" || name == "0"
+}
+
+// getContainerPath resolves ~/ to the home directory of the container user; it can only be guessed for root
+func getContainerPath(path, user, home, image string) (string, error) {
+	if !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	if home == "" && isRootUser(user) {
+		home = "/root"
+	}
+	if home == "" {
+		return "", fmt.Errorf("secret file %v can't be mounted, because image %v runs as user %v without HOME set; please set an absolute path with 'file: <path>'", path, image, user)
+	}
+
+	return strings.TrimSuffix(home, "/") + "/" + path[2:], nil
+}
+
+func (b *dockerRunner) removeSecretFiles(directory string) {
+	if directory != "" {
+		_ = os.RemoveAll(directory)
+	}
 }
@@ -6,6 +6,7 @@ package lib
 
 import (
 	context "context"
+	io "io"
 	log "log"
 	reflect "reflect"
 
@@ -50,6 +51,21 @@ func (mr *MockDockerRunnerMockRecorder) ContainerGetExitCode(ctx, logger, contai
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ContainerGetExitCode", reflect.TypeOf((*MockDockerRunner)(nil).ContainerGetExitCode), ctx, logger, containerID)
 }
 
+// ContainerImageDigest mocks base method.
+func (m *MockDockerRunner) ContainerImageDigest(ctx context.Context, logger *log.Logger, stage ManifestStage) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ContainerImageDigest", ctx, logger, stage)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ContainerImageDigest indicates an expected call of ContainerImageDigest.
+func (mr *MockDockerRunnerMockRecorder) ContainerImageDigest(ctx, logger, stage interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ContainerImageDigest", reflect.TypeOf((*MockDockerRunner)(nil).ContainerImageDigest), ctx, logger, stage)
+}
+
 // ContainerImageIsPulled mocks base method.
 func (m *MockDockerRunner) ContainerImageIsPulled(ctx context.Context, logger *log.Logger, stage ManifestStage) (bool, error) {
 	m.ctrl.T.Helper()
@@ -65,6 +81,36 @@ func (mr *MockDockerRunnerMockRecorder) ContainerImageIsPulled(ctx, logger, stag
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ContainerImageIsPulled", reflect.TypeOf((*MockDockerRunner)(nil).ContainerImageIsPulled), ctx, logger, stage)
 }
 
+// ContainerImageParameters mocks base method.
+func (m *MockDockerRunner) ContainerImageParameters(ctx context.Context, logger *log.Logger, stage ManifestStage) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ContainerImageParameters", ctx, logger, stage)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ContainerImageParameters indicates an expected call of ContainerImageParameters.
+func (mr *MockDockerRunnerMockRecorder) ContainerImageParameters(ctx, logger, stage interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ContainerImageParameters", reflect.TypeOf((*MockDockerRunner)(nil).ContainerImageParameters), ctx, logger, stage)
+}
+
+// ContainerIsRunning mocks base method.
+func (m *MockDockerRunner) ContainerIsRunning(ctx context.Context, logger *log.Logger, stage ManifestStage) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ContainerIsRunning", ctx, logger, stage)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ContainerIsRunning indicates an expected call of ContainerIsRunning.
+func (mr *MockDockerRunnerMockRecorder) ContainerIsRunning(ctx, logger, stage interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ContainerIsRunning", reflect.TypeOf((*MockDockerRunner)(nil).ContainerIsRunning), ctx, logger, stage)
+}
+
 // ContainerLogs mocks base method.
 func (m *MockDockerRunner) ContainerLogs(ctx context.Context, logger *log.Logger, stage ManifestStage, containerID string) error {
 	m.ctrl.T.Helper()
@@ -107,18 +153,32 @@ func (mr *MockDockerRunnerMockRecorder) ContainerRemove(ctx, logger, containerID
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ContainerRemove", reflect.TypeOf((*MockDockerRunner)(nil).ContainerRemove), ctx, logger, containerID)
 }
 
+// ContainerShell mocks base method.
+func (m *MockDockerRunner) ContainerShell(ctx context.Context, logger *log.Logger, stage ManifestStage, env, secretEnv, secretFiles map[string]string, needsNetwork bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ContainerShell", ctx, logger, stage, env, secretEnv, secretFiles, needsNetwork)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ContainerShell indicates an expected call of ContainerShell.
+func (mr *MockDockerRunnerMockRecorder) ContainerShell(ctx, logger, stage, env, secretEnv, secretFiles, needsNetwork interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ContainerShell", reflect.TypeOf((*MockDockerRunner)(nil).ContainerShell), ctx, logger, stage, env, secretEnv, secretFiles, needsNetwork)
+}
+
 // ContainerStart mocks base method.
-func (m *MockDockerRunner) ContainerStart(ctx context.Context, logger *log.Logger, stage ManifestStage, env map[string]string, needsNetwork bool) error {
+func (m *MockDockerRunner) ContainerStart(ctx context.Context, logger *log.Logger, stage ManifestStage, env, secretEnv, secretFiles map[string]string, needsNetwork bool) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ContainerStart", ctx, logger, stage, env, needsNetwork)
+	ret := m.ctrl.Call(m, "ContainerStart", ctx, logger, stage, env, secretEnv, secretFiles, needsNetwork)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // ContainerStart indicates an expected call of ContainerStart.
-func (mr *MockDockerRunnerMockRecorder) ContainerStart(ctx, logger, stage, env, needsNetwork interface{}) *gomock.Call {
+func (mr *MockDockerRunnerMockRecorder) ContainerStart(ctx, logger, stage, env, secretEnv, secretFiles, needsNetwork interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ContainerStart", reflect.TypeOf((*MockDockerRunner)(nil).ContainerStart), ctx, logger, stage, env, needsNetwork)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ContainerStart", reflect.TypeOf((*MockDockerRunner)(nil).ContainerStart), ctx, logger, stage, env, secretEnv, secretFiles, needsNetwork)
 }
 
 // ContainerStop mocks base method.
@@ -191,16 +251,45 @@ func (mr *MockDockerRunnerMockRecorder) NetworkRemove(ctx, logger interface{}) *
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NetworkRemove", reflect.TypeOf((*MockDockerRunner)(nil).NetworkRemove), ctx, logger)
 }
 
+// RegistryLogin mocks base method.
+func (m *MockDockerRunner) RegistryLogin(ctx context.Context, logger *log.Logger, credentials []RegistryCredentials) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RegistryLogin", ctx, logger, credentials)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RegistryLogin indicates an expected call of RegistryLogin.
+func (mr *MockDockerRunnerMockRecorder) RegistryLogin(ctx, logger, credentials interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RegistryLogin", reflect.TypeOf((*MockDockerRunner)(nil).RegistryLogin), ctx, logger, credentials)
+}
+
+// RegistryLogout mocks base method.
+func (m *MockDockerRunner) RegistryLogout(ctx context.Context, logger *log.Logger) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RegistryLogout", ctx, logger)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RegistryLogout indicates an expected call of RegistryLogout.
+func (mr *MockDockerRunnerMockRecorder) RegistryLogout(ctx, logger interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RegistryLogout", reflect.TypeOf((*MockDockerRunner)(nil).RegistryLogout), ctx, logger)
+}
+
 // StopRunningContainers mocks base method.
-func (m *MockDockerRunner) StopRunningContainers(ctx context.Context) error {
+func (m *MockDockerRunner) StopRunningContainers(ctx context.Context, logOutput io.Writer) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "StopRunningContainers", ctx)
+	ret := m.ctrl.Call(m, "StopRunningContainers", ctx, logOutput)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // StopRunningContainers indicates an expected call of StopRunningContainers.
-func (mr *MockDockerRunnerMockRecorder) StopRunningContainers(ctx interface{}) *gomock.Call {
+func (mr *MockDockerRunnerMockRecorder) StopRunningContainers(ctx, logOutput interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StopRunningContainers", reflect.TypeOf((*MockDockerRunner)(nil).StopRunningContainers), ctx)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StopRunningContainers", reflect.TypeOf((*MockDockerRunner)(nil).StopRunningContainers), ctx, logOutput)
 }
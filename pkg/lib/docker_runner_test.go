@@ -1,11 +1,17 @@
 package lib
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/alecthomas/assert"
 	gomock "github.com/golang/mock/gomock"
@@ -39,10 +45,10 @@ func TestContainerStart(t *testing.T) {
 		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"rm", "--volumes", "abcd"})).Times(1)
 		logger := log.New(os.Stdout, "", 0)
 
-		runner := NewDockerRunner(commandRunner, randomStringGenerator, "")
+		runner := NewDockerRunner(commandRunner, randomStringGenerator, "", false, nil, false)
 
 		// act
-		err = runner.ContainerStart(context.Background(), logger, stage, map[string]string{"INFINITY_PARAMETER_VULNERABILITY_THRESHOLD": "CRITICAL", "INFINITY_PARAMETER_CONTAINER_NAME": "mycontainer"}, false)
+		err = runner.ContainerStart(context.Background(), logger, stage, map[string]string{"INFINITY_PARAMETER_VULNERABILITY_THRESHOLD": "CRITICAL", "INFINITY_PARAMETER_CONTAINER_NAME": "mycontainer"}, map[string]string{}, map[string]string{}, false)
 
 		assert.Nil(t, err)
 	})
@@ -74,10 +80,10 @@ func TestContainerStart(t *testing.T) {
 		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"rm", "--volumes", "abcd"})).Times(1)
 		logger := log.New(os.Stdout, "", 0)
 
-		runner := NewDockerRunner(commandRunner, randomStringGenerator, "")
+		runner := NewDockerRunner(commandRunner, randomStringGenerator, "", false, nil, false)
 
 		// act
-		err = runner.ContainerStart(context.Background(), logger, stage, map[string]string{"INFINITY_PARAMETER_VULNERABILITY_THRESHOLD": "CRITICAL", "INFINITY_PARAMETER_CONTAINER_NAME": "mycontainer"}, false)
+		err = runner.ContainerStart(context.Background(), logger, stage, map[string]string{"INFINITY_PARAMETER_VULNERABILITY_THRESHOLD": "CRITICAL", "INFINITY_PARAMETER_CONTAINER_NAME": "mycontainer"}, map[string]string{}, map[string]string{}, false)
 
 		assert.Nil(t, err)
 	})
@@ -109,11 +115,818 @@ func TestContainerStart(t *testing.T) {
 		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"rm", "--volumes", "abcd"})).Times(1)
 		logger := log.New(os.Stdout, "", 0)
 
-		runner := NewDockerRunner(commandRunner, randomStringGenerator, "")
+		runner := NewDockerRunner(commandRunner, randomStringGenerator, "", false, nil, false)
 
 		// act
-		err = runner.ContainerStart(context.Background(), logger, stage, map[string]string{"INFINITY_PARAMETER_VULNERABILITY_THRESHOLD": "CRITICAL", "INFINITY_PARAMETER_CONTAINER_NAME": "mycontainer"}, false)
+		err = runner.ContainerStart(context.Background(), logger, stage, map[string]string{"INFINITY_PARAMETER_VULNERABILITY_THRESHOLD": "CRITICAL", "INFINITY_PARAMETER_CONTAINER_NAME": "mycontainer"}, map[string]string{}, map[string]string{}, false)
 
 		assert.Nil(t, err)
 	})
+
+	t.Run("PassesSecretEnvByNameOnlyAndValueThroughCommandEnvironment", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		stage := ManifestStage{
+			Name:     "stage-1",
+			Image:    "alpine:3.13",
+			Commands: []string{"sleep 1"},
+		}
+		stage.SetDefault()
+
+		pwd, err := os.Getwd()
+		assert.Nil(t, err)
+		randomStringGenerator := NewMockRandomStringGenerator(ctrl)
+		randomStringGenerator.EXPECT().GenerateRandomString(10).Return("abcdefghij").Times(1)
+		commandRunner := NewMockCommandRunner(ctrl)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"run", "--detach", fmt.Sprintf("--volume=%v:/work", pwd), "--workdir=/work", "--env=DOCKER_USER=me", "--env=DOCKER_PASSWORD", "--entrypoint=/bin/sh", "alpine:3.13", "-c", `set -e ; printf '\033[38;5;244m> %s\033[0m\n' 'sleep 1' ; sleep 1`}), gomock.Eq("DOCKER_PASSWORD=s3cr3t")).Return([]byte("abcd\n"), nil).Times(1)
+		commandRunner.EXPECT().RunCommand(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"logs", "--follow", "abcd"})).Times(1)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"inspect", "--format='{{.State.ExitCode}}'", "abcd"})).Return([]byte("0\n"), nil).Times(1)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"wait", "abcd"})).Times(1)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"rm", "--volumes", "abcd"})).Times(1)
+		logger := log.New(os.Stdout, "", 0)
+
+		runner := NewDockerRunner(commandRunner, randomStringGenerator, "", false, nil, false)
+
+		// act
+		err = runner.ContainerStart(context.Background(), logger, stage, map[string]string{"DOCKER_USER": "me", "DOCKER_PASSWORD": "s3cr3t"}, map[string]string{"DOCKER_PASSWORD": "s3cr3t"}, map[string]string{}, false)
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("StartsShellInCommittedContainerOfFailedStageWithDebugOnFailure", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		stage := ManifestStage{
+			Name:     "stage-1",
+			Image:    "alpine:3.13",
+			Commands: []string{"exit 1"},
+		}
+		stage.SetDefault()
+
+		pwd, err := os.Getwd()
+		assert.Nil(t, err)
+		randomStringGenerator := NewMockRandomStringGenerator(ctrl)
+		randomStringGenerator.EXPECT().GenerateRandomString(10).Return("abcdefghij").Times(1)
+		commandRunner := NewMockCommandRunner(ctrl)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"run", "--detach", fmt.Sprintf("--volume=%v:/work", pwd), "--workdir=/work", "--env=LOG_LEVEL=debug", "--entrypoint=/bin/sh", "alpine:3.13", "-c", `set -e ; printf '\033[38;5;244m> %s\033[0m\n' 'exit 1' ; exit 1`})).Return([]byte("abcd\n"), nil).Times(1)
+		commandRunner.EXPECT().RunCommand(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"logs", "--follow", "abcd"})).Times(1)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"inspect", "--format='{{.State.ExitCode}}'", "abcd"})).Return([]byte("1\n"), nil).Times(1)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"commit", "abcd"})).Return([]byte("sha256:1234\n"), nil).Times(1)
+		commandRunner.EXPECT().RunInteractiveCommand(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"run", "--rm", "--interactive", "--tty", "--entrypoint=/bin/sh", fmt.Sprintf("--volume=%v:/work", pwd), "--workdir=/work", "--env=LOG_LEVEL=debug", "sha256:1234"})).Times(1)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"rmi", "--force", "sha256:1234"})).Times(1)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"wait", "abcd"})).Times(1)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"rm", "--volumes", "abcd"})).Times(1)
+		logger := log.New(os.Stdout, "", 0)
+
+		runner := NewDockerRunner(commandRunner, randomStringGenerator, "", true, nil, false)
+
+		// act
+		err = runner.ContainerStart(context.Background(), logger, stage, map[string]string{"LOG_LEVEL": "debug"}, map[string]string{}, map[string]string{}, false)
+
+		assert.NotNil(t, err)
+		assert.Equal(t, "stage stage-1 failed with exit code 1", err.Error())
+	})
+
+	t.Run("StartsShellForFirstFailedParallelStageOnlyOnceOtherStagesFinished", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		stage1 := ManifestStage{
+			Name:     "stage-1",
+			Image:    "alpine:3.13",
+			Commands: []string{"exit 1"},
+		}
+		stage1.SetDefault()
+		stage2 := ManifestStage{
+			Name:     "stage-2",
+			Image:    "alpine:3.14",
+			Commands: []string{"exit 1"},
+		}
+		stage2.SetDefault()
+
+		pwd, err := os.Getwd()
+		assert.Nil(t, err)
+		randomStringGenerator := NewMockRandomStringGenerator(ctrl)
+		randomStringGenerator.EXPECT().GenerateRandomString(10).Return("abcdefghij").Times(1)
+		commandRunner := NewMockCommandRunner(ctrl)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"run", "--detach", fmt.Sprintf("--volume=%v:/work", pwd), "--workdir=/work", "--entrypoint=/bin/sh", "alpine:3.13", "-c", `set -e ; printf '\033[38;5;244m> %s\033[0m\n' 'exit 1' ; exit 1`})).Return([]byte("abcd\n"), nil).Times(1)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"run", "--detach", fmt.Sprintf("--volume=%v:/work", pwd), "--workdir=/work", "--entrypoint=/bin/sh", "alpine:3.14", "-c", `set -e ; printf '\033[38;5;244m> %s\033[0m\n' 'exit 1' ; exit 1`})).Return([]byte("efgh\n"), nil).Times(1)
+		commandRunner.EXPECT().RunCommand(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"logs", "--follow", "abcd"})).Times(1)
+		stage2Running, stage2Finished := make(chan struct{}), make(chan struct{})
+		commandRunner.EXPECT().RunCommand(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"logs", "--follow", "efgh"})).DoAndReturn(func(ctx context.Context, logger *log.Logger, dir, command string, args []string, env ...string) error {
+			close(stage2Running)
+			time.Sleep(100 * time.Millisecond)
+			close(stage2Finished)
+			return nil
+		}).Times(1)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"inspect", "--format='{{.State.ExitCode}}'", "abcd"})).Return([]byte("1\n"), nil).Times(1)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"inspect", "--format='{{.State.ExitCode}}'", "efgh"})).Return([]byte("1\n"), nil).Times(1)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"commit", "abcd"})).Return([]byte("sha256:1234\n"), nil).Times(1)
+		commandRunner.EXPECT().RunInteractiveCommand(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"run", "--rm", "--interactive", "--tty", "--entrypoint=/bin/sh", fmt.Sprintf("--volume=%v:/work", pwd), "--workdir=/work", "sha256:1234"})).DoAndReturn(func(ctx context.Context, logger *log.Logger, dir, command string, args []string, env ...string) error {
+			select {
+			case <-stage2Finished:
+			default:
+				t.Error("debug shell started while stage-2 was still running")
+			}
+			return nil
+		}).Times(1)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"rmi", "--force", "sha256:1234"})).Times(1)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"wait", "abcd"})).Times(1)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"rm", "--volumes", "abcd"})).Times(1)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"wait", "efgh"})).Times(1)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"rm", "--volumes", "efgh"})).Times(1)
+		logger := log.New(os.Stdout, "", 0)
+
+		runner := NewDockerRunner(commandRunner, randomStringGenerator, "", true, nil, false)
+
+		// act
+		stage2Err := make(chan error, 1)
+		go func() {
+			stage2Err <- runner.ContainerStart(context.Background(), logger, stage2, map[string]string{}, map[string]string{}, map[string]string{}, false)
+		}()
+		<-stage2Running
+		err = runner.ContainerStart(context.Background(), logger, stage1, map[string]string{}, map[string]string{}, map[string]string{}, false)
+
+		assert.Equal(t, "stage stage-1 failed with exit code 1", err.Error())
+		assert.Equal(t, "stage stage-2 failed with exit code 1", (<-stage2Err).Error())
+	})
+
+	t.Run("DoesNotStartStageWhileFailedStageIsDebugged", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		stage1 := ManifestStage{
+			Name:     "stage-1",
+			Image:    "alpine:3.13",
+			Commands: []string{"exit 1"},
+		}
+		stage1.SetDefault()
+		stage2 := ManifestStage{
+			Name:     "stage-2",
+			Image:    "alpine:3.14",
+			Commands: []string{"exit 1"},
+		}
+		stage2.SetDefault()
+
+		randomStringGenerator := NewMockRandomStringGenerator(ctrl)
+		randomStringGenerator.EXPECT().GenerateRandomString(10).Return("abcdefghij").Times(1)
+		commandRunner := NewMockCommandRunner(ctrl)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Any()).DoAndReturn(func(ctx context.Context, logger *log.Logger, dir, command string, args []string, env ...string) ([]byte, error) {
+			assert.False(t, stringArrayContains(args, "alpine:3.14"))
+			switch args[0] {
+			case "run":
+				return []byte("abcd\n"), nil
+			case "inspect":
+				return []byte("1\n"), nil
+			case "commit":
+				return []byte("sha256:1234\n"), nil
+			}
+			return nil, nil
+		}).AnyTimes()
+		commandRunner.EXPECT().RunCommand(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"logs", "--follow", "abcd"})).Times(1)
+		var runner DockerRunner
+		var stage2Err error
+		commandRunner.EXPECT().RunInteractiveCommand(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Any()).DoAndReturn(func(ctx context.Context, logger *log.Logger, dir, command string, args []string, env ...string) error {
+			stage2Err = runner.ContainerStart(context.Background(), logger, stage2, map[string]string{}, map[string]string{}, map[string]string{}, false)
+			return nil
+		}).Times(1)
+		logger := log.New(os.Stdout, "", 0)
+
+		runner = NewDockerRunner(commandRunner, randomStringGenerator, "", true, nil, false)
+
+		// act
+		err := runner.ContainerStart(context.Background(), logger, stage1, map[string]string{}, map[string]string{}, map[string]string{}, false)
+
+		assert.Equal(t, "stage stage-1 failed with exit code 1", err.Error())
+		assert.True(t, errors.Is(stage2Err, ErrCanceled))
+		assert.Equal(t, "stage stage-2 is not started, since a failed stage is being debugged: This function got canceled", stage2Err.Error())
+	})
+
+	t.Run("DoesNotStartShellIfRunGetsCanceledWhileWaitingForOtherStages", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		stage1 := ManifestStage{
+			Name:     "stage-1",
+			Image:    "alpine:3.13",
+			Commands: []string{"exit 1"},
+		}
+		stage1.SetDefault()
+		stage2 := ManifestStage{
+			Name:     "stage-2",
+			Image:    "alpine:3.14",
+			Commands: []string{"sleep 3600"},
+		}
+		stage2.SetDefault()
+
+		randomStringGenerator := NewMockRandomStringGenerator(ctrl)
+		randomStringGenerator.EXPECT().GenerateRandomString(10).Return("abcdefghij").Times(1)
+		commandRunner := NewMockCommandRunner(ctrl)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Any()).DoAndReturn(func(ctx context.Context, logger *log.Logger, dir, command string, args []string, env ...string) ([]byte, error) {
+			switch args[0] {
+			case "run":
+				if stringArrayContains(args, "alpine:3.14") {
+					return []byte("efgh\n"), nil
+				}
+				return []byte("abcd\n"), nil
+			case "inspect":
+				return []byte("1\n"), nil
+			}
+			return nil, nil
+		}).AnyTimes()
+		commandRunner.EXPECT().RunCommand(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"logs", "--follow", "abcd"})).Times(1)
+		stage2Running, stage2Released := make(chan struct{}), make(chan struct{})
+		commandRunner.EXPECT().RunCommand(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"logs", "--follow", "efgh"})).DoAndReturn(func(ctx context.Context, logger *log.Logger, dir, command string, args []string, env ...string) error {
+			close(stage2Running)
+			<-stage2Released
+			return nil
+		}).Times(1)
+		logger := log.New(os.Stdout, "", 0)
+
+		runner := NewDockerRunner(commandRunner, randomStringGenerator, "", true, nil, false)
+
+		runCtx, cancel := context.WithCancel(context.Background())
+		stage2Err := make(chan error, 1)
+		go func() {
+			stage2Err <- runner.ContainerStart(runCtx, logger, stage2, map[string]string{}, map[string]string{}, map[string]string{}, false)
+		}()
+		<-stage2Running
+		time.AfterFunc(50*time.Millisecond, cancel)
+
+		// act
+		stage1Err := make(chan error, 1)
+		go func() {
+			stage1Err <- runner.ContainerStart(runCtx, logger, stage1, map[string]string{}, map[string]string{}, map[string]string{}, false)
+		}()
+
+		select {
+		case err := <-stage1Err:
+			assert.Equal(t, "stage stage-1 failed with exit code 1", err.Error())
+		case <-time.After(5 * time.Second):
+			t.Error("stage-1 still waits to be debugged after the run got canceled")
+		}
+		close(stage2Released)
+		<-stage2Err
+	})
+
+	t.Run("MountsSecretFilesReadOnlyAndRemovesThemWhenStageEnds", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		stage := ManifestStage{
+			Name:     "stage-1",
+			Image:    "alpine:3.13",
+			Commands: []string{"sleep 1"},
+		}
+		stage.SetDefault()
+
+		randomStringGenerator := NewMockRandomStringGenerator(ctrl)
+		randomStringGenerator.EXPECT().GenerateRandomString(10).Return("abcdefghij").Times(1)
+		commandRunner := NewMockCommandRunner(ctrl)
+		var secretFilePath string
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"image", "inspect", "--format={{ json .Config }}", "alpine:3.13"})).Return([]byte(`{"User":"","Env":["PATH=/usr/local/bin:/usr/bin:/bin"]}`+"\n"), nil).Times(1)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Any()).DoAndReturn(func(ctx context.Context, logger *log.Logger, dir, command string, args []string, env ...string) ([]byte, error) {
+			for _, a := range args {
+				if strings.HasPrefix(a, "--volume=") && strings.HasSuffix(a, ":/root/.npmrc:ro") {
+					secretFilePath = strings.TrimSuffix(strings.TrimPrefix(a, "--volume="), ":/root/.npmrc:ro")
+				}
+				assert.False(t, strings.HasPrefix(a, "--group-add="))
+			}
+			content, err := ioutil.ReadFile(secretFilePath)
+			assert.Nil(t, err)
+			assert.Equal(t, "//registry.npmjs.org/:_authToken=abc", string(content))
+			fileInfo, err := os.Stat(secretFilePath)
+			assert.Nil(t, err)
+			assert.Equal(t, os.FileMode(0400), fileInfo.Mode().Perm())
+			directoryInfo, err := os.Stat(filepath.Dir(secretFilePath))
+			assert.Nil(t, err)
+			assert.Equal(t, os.FileMode(0700), directoryInfo.Mode().Perm())
+			return []byte("abcd\n"), nil
+		}).Times(1)
+		commandRunner.EXPECT().RunCommand(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"logs", "--follow", "abcd"})).Times(1)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"inspect", "--format='{{.State.ExitCode}}'", "abcd"})).Return([]byte("0\n"), nil).Times(1)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"wait", "abcd"})).Times(1)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"rm", "--volumes", "abcd"})).Times(1)
+		logger := log.New(os.Stdout, "", 0)
+
+		runner := NewDockerRunner(commandRunner, randomStringGenerator, "", false, nil, false)
+
+		// act
+		err := runner.ContainerStart(context.Background(), logger, stage, map[string]string{}, map[string]string{}, map[string]string{"~/.npmrc": "//registry.npmjs.org/:_authToken=abc"}, false)
+
+		assert.Nil(t, err)
+		assert.NotEqual(t, "", secretFilePath)
+		_, err = os.Stat(secretFilePath)
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("MountsSecretFilesInHomeOfNonRootImageUserReadableThroughHostGroup", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		stage := ManifestStage{
+			Name:  "stage-1",
+			Image: "node:16-alpine",
+		}
+		stage.SetDefault()
+
+		randomStringGenerator := NewMockRandomStringGenerator(ctrl)
+		randomStringGenerator.EXPECT().GenerateRandomString(10).Return("abcdefghij").Times(1)
+		commandRunner := NewMockCommandRunner(ctrl)
+		var secretFilePath string
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"image", "inspect", "--format={{ json .Config }}", "node:16-alpine"})).Return([]byte(`{"User":"node","Env":["HOME=/home/node"]}`), nil).Times(1)
+		commandRunner.EXPECT().RunInteractiveCommand(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Any()).DoAndReturn(func(ctx context.Context, logger *log.Logger, dir, command string, args []string, env ...string) error {
+			assert.True(t, stringArrayContains(args, fmt.Sprintf("--group-add=%v", os.Getgid())))
+			for _, a := range args {
+				if strings.HasPrefix(a, "--volume=") && strings.HasSuffix(a, ":/home/node/.npmrc:ro") {
+					secretFilePath = strings.TrimSuffix(strings.TrimPrefix(a, "--volume="), ":/home/node/.npmrc:ro")
+				}
+			}
+			fileInfo, err := os.Stat(secretFilePath)
+			assert.Nil(t, err)
+			assert.Equal(t, os.FileMode(0440), fileInfo.Mode().Perm())
+			return nil
+		}).Times(1)
+		logger := log.New(os.Stdout, "", 0)
+
+		runner := NewDockerRunner(commandRunner, randomStringGenerator, "", false, nil, false)
+
+		// act
+		err := runner.ContainerShell(context.Background(), logger, stage, map[string]string{}, map[string]string{}, map[string]string{"~/.npmrc": "//registry.npmjs.org/:_authToken=abc"}, false)
+
+		assert.Nil(t, err)
+		assert.NotEqual(t, "", secretFilePath)
+	})
+
+	t.Run("ReturnsErrorIfHomeOfNonRootImageUserIsUnknownForSecretFileInHome", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		stage := ManifestStage{
+			Name:  "stage-1",
+			Image: "node:16-alpine",
+		}
+		stage.SetDefault()
+
+		randomStringGenerator := NewMockRandomStringGenerator(ctrl)
+		randomStringGenerator.EXPECT().GenerateRandomString(10).Return("abcdefghij").Times(1)
+		commandRunner := NewMockCommandRunner(ctrl)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"image", "inspect", "--format={{ json .Config }}", "node:16-alpine"})).Return([]byte(`{"User":"1000","Env":null}`), nil).Times(1)
+		logger := log.New(os.Stdout, "", 0)
+
+		runner := NewDockerRunner(commandRunner, randomStringGenerator, "", false, nil, false)
+
+		// act
+		err := runner.ContainerShell(context.Background(), logger, stage, map[string]string{}, map[string]string{}, map[string]string{"~/.npmrc": "//registry.npmjs.org/:_authToken=abc"}, false)
+
+		assert.NotNil(t, err)
+		assert.Equal(t, "secret file ~/.npmrc can't be mounted, because image node:16-alpine runs as user 1000 without HOME set; please set an absolute path with 'file: <path>'", err.Error())
+	})
+}
+
+func TestContainerShell(t *testing.T) {
+	t.Run("StartsInteractiveContainerWithStageShellAsEntrypoint", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		stage := ManifestStage{
+			Name:     "stage-1",
+			Image:    "golang:1.17",
+			Commands: []string{"go build ."},
+			Devices:  []string{"/dev/ttyUSB0"},
+		}
+		stage.SetDefault()
+
+		pwd, err := os.Getwd()
+		assert.Nil(t, err)
+		randomStringGenerator := NewMockRandomStringGenerator(ctrl)
+		randomStringGenerator.EXPECT().GenerateRandomString(10).Return("abcdefghij").Times(1)
+		commandRunner := NewMockCommandRunner(ctrl)
+		commandRunner.EXPECT().RunInteractiveCommand(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"run", "--rm", "--interactive", "--tty", "--entrypoint=/bin/sh", "--network=infinity-abcdefghij", fmt.Sprintf("--volume=%v:/work", pwd), "--workdir=/work", "--device=/dev/ttyUSB0", "--env=INFINITY_PARAMETER_ACTION=build", "--env=TOKEN", "golang:1.17"}), gomock.Eq("TOKEN=abc")).Times(1)
+		logger := log.New(os.Stdout, "", 0)
+
+		runner := NewDockerRunner(commandRunner, randomStringGenerator, "", false, nil, false)
+
+		// act
+		err = runner.ContainerShell(context.Background(), logger, stage, map[string]string{"INFINITY_PARAMETER_ACTION": "build"}, map[string]string{"TOKEN": "abc"}, map[string]string{}, true)
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("LimitsResourcesOfContainer", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		stage := ManifestStage{
+			Name:      "stage-1",
+			Image:     "gradle:7.3-jdk17",
+			Commands:  []string{"gradle build"},
+			Resources: &ManifestResources{CPUs: 1.5, Memory: "4g", PIDs: 512, ShmSize: "1g"},
+			Ulimits:   []string{"nofile=65536", "nproc=1024:2048"},
+		}
+		stage.SetDefault()
+
+		pwd, err := os.Getwd()
+		assert.Nil(t, err)
+		randomStringGenerator := NewMockRandomStringGenerator(ctrl)
+		randomStringGenerator.EXPECT().GenerateRandomString(10).Return("abcdefghij").Times(1)
+		commandRunner := NewMockCommandRunner(ctrl)
+		commandRunner.EXPECT().RunInteractiveCommand(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"run", "--rm", "--interactive", "--tty", "--entrypoint=/bin/sh", fmt.Sprintf("--volume=%v:/work", pwd), "--workdir=/work", "--cpus=1.5", "--memory=4g", "--pids-limit=512", "--shm-size=1g", "--ulimit=nofile=65536", "--ulimit=nproc=1024:2048", "gradle:7.3-jdk17"})).Times(1)
+		logger := log.New(os.Stdout, "", 0)
+
+		runner := NewDockerRunner(commandRunner, randomStringGenerator, "", false, nil, false)
+
+		// act
+		err = runner.ContainerShell(context.Background(), logger, stage, map[string]string{}, map[string]string{}, map[string]string{}, false)
+
+		assert.Nil(t, err)
+	})
+}
+
+func TestContainerImageParameters(t *testing.T) {
+	t.Run("ReturnsParametersFromImageLabel", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		randomStringGenerator := NewMockRandomStringGenerator(ctrl)
+		randomStringGenerator.EXPECT().GenerateRandomString(10).Return("abcdefghij").Times(1)
+		commandRunner := NewMockCommandRunner(ctrl)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"image", "inspect", `--format={{ index .Config.Labels "infinity.parameters" }}`, "jsalverda/bake:1.0"})).Return([]byte("version, push,tags\n"), nil).Times(1)
+		logger := log.New(os.Stdout, "", 0)
+
+		runner := NewDockerRunner(commandRunner, randomStringGenerator, "", false, nil, false)
+
+		// act
+		parameters, err := runner.ContainerImageParameters(context.Background(), logger, ManifestStage{Name: "bake", Image: "jsalverda/bake:1.0"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"version", "push", "tags"}, parameters)
+	})
+
+	t.Run("ReturnsNilIfImageHasNoLabel", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		randomStringGenerator := NewMockRandomStringGenerator(ctrl)
+		randomStringGenerator.EXPECT().GenerateRandomString(10).Return("abcdefghij").Times(1)
+		commandRunner := NewMockCommandRunner(ctrl)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return([]byte("<no value>\n"), nil).Times(1)
+		logger := log.New(os.Stdout, "", 0)
+
+		runner := NewDockerRunner(commandRunner, randomStringGenerator, "", false, nil, false)
+
+		// act
+		parameters, err := runner.ContainerImageParameters(context.Background(), logger, ManifestStage{Name: "bake", Image: "jsalverda/bake:1.0"})
+
+		assert.Nil(t, err)
+		assert.Nil(t, parameters)
+	})
+
+	t.Run("ReturnsNilIfImageIsNotPulled", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		randomStringGenerator := NewMockRandomStringGenerator(ctrl)
+		randomStringGenerator.EXPECT().GenerateRandomString(10).Return("abcdefghij").Times(1)
+		commandRunner := NewMockCommandRunner(ctrl)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return([]byte("Error: No such image: jsalverda/bake:1.0\n"), fmt.Errorf("exit status 1")).Times(1)
+		logger := log.New(os.Stdout, "", 0)
+
+		runner := NewDockerRunner(commandRunner, randomStringGenerator, "", false, nil, false)
+
+		// act
+		parameters, err := runner.ContainerImageParameters(context.Background(), logger, ManifestStage{Name: "bake", Image: "jsalverda/bake:1.0"})
+
+		assert.Nil(t, err)
+		assert.Nil(t, parameters)
+	})
+}
+
+func TestContainerPull(t *testing.T) {
+	t.Run("PullsImagePinnedInLockfile", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		randomStringGenerator := NewMockRandomStringGenerator(ctrl)
+		randomStringGenerator.EXPECT().GenerateRandomString(10).Return("abcdefghij").Times(1)
+		commandRunner := NewMockCommandRunner(ctrl)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"image", "inspect", `--format={{ join .RepoDigests "," }}`, "golang:1.17-alpine"})).Return([]byte("golang@sha256:abc123\n"), nil).Times(1)
+		commandRunner.EXPECT().RunCommand(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"pull", "golang:1.17-alpine@sha256:abc123"})).Times(1)
+		logger := log.New(os.Stdout, "", 0)
+		imageLock := &ImageLock{Images: map[string]string{"golang:1.17-alpine": "sha256:abc123"}}
+
+		runner := NewDockerRunner(commandRunner, randomStringGenerator, "", false, imageLock, false)
+
+		// act
+		err := runner.ContainerPull(context.Background(), logger, ManifestStage{Name: "build", Image: "golang:1.17-alpine"})
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("PullsImageByTagIfNotInLockfile", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		randomStringGenerator := NewMockRandomStringGenerator(ctrl)
+		randomStringGenerator.EXPECT().GenerateRandomString(10).Return("abcdefghij").Times(1)
+		commandRunner := NewMockCommandRunner(ctrl)
+		commandRunner.EXPECT().RunCommand(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"pull", "alpine:3.13"})).Times(1)
+		logger := log.New(os.Stdout, "", 0)
+		imageLock := &ImageLock{Images: map[string]string{"golang:1.17-alpine": "sha256:abc123"}}
+
+		runner := NewDockerRunner(commandRunner, randomStringGenerator, "", false, imageLock, false)
+
+		// act
+		err := runner.ContainerPull(context.Background(), logger, ManifestStage{Name: "build", Image: "alpine:3.13"})
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("ReturnsErrorIfLockedAndImageNotInLockfile", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		randomStringGenerator := NewMockRandomStringGenerator(ctrl)
+		randomStringGenerator.EXPECT().GenerateRandomString(10).Return("abcdefghij").Times(1)
+		commandRunner := NewMockCommandRunner(ctrl)
+		logger := log.New(os.Stdout, "", 0)
+		imageLock := &ImageLock{Images: map[string]string{"golang:1.17-alpine": "sha256:abc123"}}
+
+		runner := NewDockerRunner(commandRunner, randomStringGenerator, "", false, imageLock, true)
+
+		// act
+		err := runner.ContainerPull(context.Background(), logger, ManifestStage{Name: "build", Image: "alpine:3.13"})
+
+		assert.NotNil(t, err)
+		assert.Equal(t, "image alpine:3.13 of stage build is not pinned in .infinity.lock; run 'infinity lock' to pin it", err.Error())
+	})
+
+	t.Run("ReturnsErrorIfLockedAndTagResolvesToOtherDigestThanLockfile", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		randomStringGenerator := NewMockRandomStringGenerator(ctrl)
+		randomStringGenerator.EXPECT().GenerateRandomString(10).Return("abcdefghij").Times(1)
+		commandRunner := NewMockCommandRunner(ctrl)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"image", "inspect", `--format={{ join .RepoDigests "," }}`, "golang:1.17-alpine"})).Return([]byte("golang@sha256:def456\n"), nil).Times(1)
+		logger := log.New(os.Stdout, "", 0)
+		imageLock := &ImageLock{Images: map[string]string{"golang:1.17-alpine": "sha256:abc123"}}
+
+		runner := NewDockerRunner(commandRunner, randomStringGenerator, "", false, imageLock, true)
+
+		// act
+		err := runner.ContainerPull(context.Background(), logger, ManifestStage{Name: "build", Image: "golang:1.17-alpine"})
+
+		assert.NotNil(t, err)
+		assert.Equal(t, "image golang:1.17-alpine is locked to sha256:abc123 in .infinity.lock, but the tag resolves to sha256:def456 by now; run 'infinity lock' to update the lockfile", err.Error())
+	})
+
+	t.Run("WarnsIfTagResolvesToOtherDigestThanLockfile", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		randomStringGenerator := NewMockRandomStringGenerator(ctrl)
+		randomStringGenerator.EXPECT().GenerateRandomString(10).Return("abcdefghij").Times(1)
+		commandRunner := NewMockCommandRunner(ctrl)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"image", "inspect", `--format={{ join .RepoDigests "," }}`, "golang:1.17-alpine"})).Return([]byte("golang@sha256:def456\n"), nil).Times(1)
+		commandRunner.EXPECT().RunCommand(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"pull", "golang:1.17-alpine@sha256:abc123"})).Times(1)
+		var logOutput bytes.Buffer
+		logger := log.New(&logOutput, "", 0)
+		imageLock := &ImageLock{Images: map[string]string{"golang:1.17-alpine": "sha256:abc123"}}
+
+		runner := NewDockerRunner(commandRunner, randomStringGenerator, "", false, imageLock, false)
+
+		// act
+		err := runner.ContainerPull(context.Background(), logger, ManifestStage{Name: "build", Image: "golang:1.17-alpine"})
+
+		assert.Nil(t, err)
+		assert.Contains(t, logOutput.String(), "Image golang:1.17-alpine is locked to sha256:abc123 in .infinity.lock, but the tag resolves to sha256:def456 by now")
+	})
+
+	t.Run("PullsLockedImageIfTagIsNotPresentLocally", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		randomStringGenerator := NewMockRandomStringGenerator(ctrl)
+		randomStringGenerator.EXPECT().GenerateRandomString(10).Return("abcdefghij").Times(1)
+		commandRunner := NewMockCommandRunner(ctrl)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"image", "inspect", `--format={{ join .RepoDigests "," }}`, "golang:1.17-alpine"})).Return([]byte("Error: No such image: golang:1.17-alpine\n"), fmt.Errorf("exit status 1")).Times(1)
+		commandRunner.EXPECT().RunCommand(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"pull", "golang:1.17-alpine@sha256:abc123"})).Times(1)
+		logger := log.New(os.Stdout, "", 0)
+		imageLock := &ImageLock{Images: map[string]string{"golang:1.17-alpine": "sha256:abc123"}}
+
+		runner := NewDockerRunner(commandRunner, randomStringGenerator, "", false, imageLock, true)
+
+		// act
+		err := runner.ContainerPull(context.Background(), logger, ManifestStage{Name: "build", Image: "golang:1.17-alpine"})
+
+		assert.Nil(t, err)
+	})
+}
+
+func TestContainerImageIsPulled(t *testing.T) {
+	t.Run("ReturnsTrueIfImageInspectSucceeds", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		randomStringGenerator := NewMockRandomStringGenerator(ctrl)
+		randomStringGenerator.EXPECT().GenerateRandomString(10).Return("abcdefghij").Times(1)
+		commandRunner := NewMockCommandRunner(ctrl)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"image", "inspect", "--format={{.Id}}", "alpine"})).Return([]byte("sha256:def456\n"), nil).Times(1)
+		logger := log.New(os.Stdout, "", 0)
+
+		runner := NewDockerRunner(commandRunner, randomStringGenerator, "", false, nil, false)
+
+		// act
+		isPulled, err := runner.ContainerImageIsPulled(context.Background(), logger, ManifestStage{Name: "build", Image: "alpine"})
+
+		assert.Nil(t, err)
+		assert.True(t, isPulled)
+	})
+
+	t.Run("InspectsImagePinnedInLockfile", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		randomStringGenerator := NewMockRandomStringGenerator(ctrl)
+		randomStringGenerator.EXPECT().GenerateRandomString(10).Return("abcdefghij").Times(1)
+		commandRunner := NewMockCommandRunner(ctrl)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"image", "inspect", `--format={{ join .RepoDigests "," }}`, "golang:1.17-alpine"})).Return([]byte("golang@sha256:abc123\n"), nil).Times(1)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"image", "inspect", "--format={{.Id}}", "golang:1.17-alpine@sha256:abc123"})).Return([]byte("sha256:def456\n"), nil).Times(1)
+		logger := log.New(os.Stdout, "", 0)
+		imageLock := &ImageLock{Images: map[string]string{"golang:1.17-alpine": "sha256:abc123"}}
+
+		runner := NewDockerRunner(commandRunner, randomStringGenerator, "", false, imageLock, false)
+
+		// act
+		isPulled, err := runner.ContainerImageIsPulled(context.Background(), logger, ManifestStage{Name: "build", Image: "golang:1.17-alpine"})
+
+		assert.Nil(t, err)
+		assert.True(t, isPulled)
+	})
+
+	t.Run("ReturnsFalseIfImageDoesNotExistLocally", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		randomStringGenerator := NewMockRandomStringGenerator(ctrl)
+		randomStringGenerator.EXPECT().GenerateRandomString(10).Return("abcdefghij").Times(1)
+		commandRunner := NewMockCommandRunner(ctrl)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return([]byte("Error: No such image: alpine:3.13\n"), fmt.Errorf("exit status 1")).Times(1)
+		logger := log.New(os.Stdout, "", 0)
+
+		runner := NewDockerRunner(commandRunner, randomStringGenerator, "", false, nil, false)
+
+		// act
+		isPulled, err := runner.ContainerImageIsPulled(context.Background(), logger, ManifestStage{Name: "build", Image: "alpine:3.13"})
+
+		assert.Nil(t, err)
+		assert.False(t, isPulled)
+	})
+
+	t.Run("ReturnsErrorIfDockerIsNotAvailable", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		randomStringGenerator := NewMockRandomStringGenerator(ctrl)
+		randomStringGenerator.EXPECT().GenerateRandomString(10).Return("abcdefghij").Times(1)
+		commandRunner := NewMockCommandRunner(ctrl)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return([]byte("Cannot connect to the Docker daemon at unix:///var/run/docker.sock. Is the docker daemon running?\n"), fmt.Errorf("exit status 1")).Times(1)
+		logger := log.New(os.Stdout, "", 0)
+
+		runner := NewDockerRunner(commandRunner, randomStringGenerator, "", false, nil, false)
+
+		// act
+		_, err := runner.ContainerImageIsPulled(context.Background(), logger, ManifestStage{Name: "build", Image: "alpine:3.13"})
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestContainerIsRunning(t *testing.T) {
+	t.Run("ReturnsFalseIfStageHasNoContainer", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		randomStringGenerator := NewMockRandomStringGenerator(ctrl)
+		randomStringGenerator.EXPECT().GenerateRandomString(10).Return("abcdefghij").Times(1)
+		logger := log.New(os.Stdout, "", 0)
+
+		runner := NewDockerRunner(NewMockCommandRunner(ctrl), randomStringGenerator, "", false, nil, false)
+
+		// act
+		isRunning, err := runner.ContainerIsRunning(context.Background(), logger, ManifestStage{Name: "database", Background: true})
+
+		assert.Nil(t, err)
+		assert.False(t, isRunning)
+	})
+
+	t.Run("ReturnsStateOfContainerStartedForStage", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		stage := ManifestStage{Name: "database", Image: "cockroachdb/cockroach:v21.1.5", Background: true}
+		stage.SetDefault()
+
+		pwd, err := os.Getwd()
+		assert.Nil(t, err)
+		randomStringGenerator := NewMockRandomStringGenerator(ctrl)
+		randomStringGenerator.EXPECT().GenerateRandomString(10).Return("abcdefghij").Times(1)
+		commandRunner := NewMockCommandRunner(ctrl)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"run", "--detach", "--name=database", fmt.Sprintf("--volume=%v:/work", pwd), "--workdir=/work", "cockroachdb/cockroach:v21.1.5"})).Return([]byte("abcd\n"), nil).Times(1)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"inspect", "--format={{.State.Running}}", "abcd"})).Return([]byte("false\n"), nil).Times(1)
+		logger := log.New(os.Stdout, "", 0)
+
+		runner := NewDockerRunner(commandRunner, randomStringGenerator, "", false, nil, false)
+		err = runner.ContainerStart(context.Background(), logger, stage, map[string]string{}, map[string]string{}, map[string]string{}, false)
+		assert.Nil(t, err)
+
+		// act
+		isRunning, err := runner.ContainerIsRunning(context.Background(), logger, stage)
+
+		assert.Nil(t, err)
+		assert.False(t, isRunning)
+	})
+}
+
+func TestContainerImageDigest(t *testing.T) {
+	t.Run("ReturnsDigestForRepositoryOfImage", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		randomStringGenerator := NewMockRandomStringGenerator(ctrl)
+		randomStringGenerator.EXPECT().GenerateRandomString(10).Return("abcdefghij").Times(1)
+		commandRunner := NewMockCommandRunner(ctrl)
+		commandRunner.EXPECT().RunCommand(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"pull", "ghcr.io/org/tool:1.0"})).Times(1)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"image", "inspect", `--format={{ join .RepoDigests "," }}`, "ghcr.io/org/tool:1.0"})).Return([]byte("org/tool@sha256:def456,ghcr.io/org/tool@sha256:abc123\n"), nil).Times(1)
+		logger := log.New(os.Stdout, "", 0)
+		imageLock := &ImageLock{Images: map[string]string{"ghcr.io/org/tool:1.0": "sha256:000000"}}
+
+		runner := NewDockerRunner(commandRunner, randomStringGenerator, "", false, imageLock, true)
+
+		// act
+		digest, err := runner.ContainerImageDigest(context.Background(), logger, ManifestStage{Image: "ghcr.io/org/tool:1.0"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, "sha256:abc123", digest)
+	})
+
+	t.Run("ReturnsErrorIfImageHasNoRepositoryDigest", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		randomStringGenerator := NewMockRandomStringGenerator(ctrl)
+		randomStringGenerator.EXPECT().GenerateRandomString(10).Return("abcdefghij").Times(1)
+		commandRunner := NewMockCommandRunner(ctrl)
+		commandRunner.EXPECT().RunCommand(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return([]byte("\n"), nil).Times(1)
+		logger := log.New(os.Stdout, "", 0)
+
+		runner := NewDockerRunner(commandRunner, randomStringGenerator, "", false, nil, false)
+
+		// act
+		_, err := runner.ContainerImageDigest(context.Background(), logger, ManifestStage{Image: "my-local-image:dev"})
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestRegistryLogin(t *testing.T) {
+	t.Run("PullsImagesFromRegistryWithDockerConfigHoldingToken", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		randomStringGenerator := NewMockRandomStringGenerator(ctrl)
+		randomStringGenerator.EXPECT().GenerateRandomString(10).Return("abcdefghij").Times(1)
+		commandRunner := NewMockCommandRunner(ctrl)
+		commandRunner.EXPECT().RunCommandWithOutput(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("sh"), gomock.Eq([]string{"-c", "aws ecr get-login-password"})).Return([]byte("warning: newer version available\ntoken123\n"), nil).Times(1)
+		logger := log.New(os.Stdout, "", 0)
+
+		runner := NewDockerRunner(commandRunner, randomStringGenerator, "", false, nil, false)
+
+		// act
+		tokens, err := runner.RegistryLogin(context.Background(), logger, []RegistryCredentials{{Host: "123456789.dkr.ecr.eu-west-1.amazonaws.com", Username: "AWS", Command: "aws ecr get-login-password"}})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"token123"}, tokens)
+		configDir := runner.(*dockerRunner).registryConfigDir
+		configBytes, err := ioutil.ReadFile(configDir + "/config.json")
+		assert.Nil(t, err)
+		assert.True(t, strings.Contains(string(configBytes), `"auth": "QVdTOnRva2VuMTIz"`))
+
+		commandRunner.EXPECT().RunCommand(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{fmt.Sprintf("--config=%v", configDir), "pull", "123456789.dkr.ecr.eu-west-1.amazonaws.com/base/go:1.17"})).Times(1)
+		commandRunner.EXPECT().RunCommand(gomock.Any(), gomock.Any(), gomock.Eq(""), gomock.Eq("docker"), gomock.Eq([]string{"pull", "alpine:3.13"})).Times(1)
+
+		err = runner.ContainerPull(context.Background(), logger, ManifestStage{Name: "build", Image: "123456789.dkr.ecr.eu-west-1.amazonaws.com/base/go:1.17"})
+		assert.Nil(t, err)
+		err = runner.ContainerPull(context.Background(), logger, ManifestStage{Name: "test", Image: "alpine:3.13"})
+		assert.Nil(t, err)
+
+		err = runner.RegistryLogout(context.Background(), logger)
+		assert.Nil(t, err)
+		_, err = os.Stat(configDir)
+		assert.True(t, os.IsNotExist(err))
+	})
 }
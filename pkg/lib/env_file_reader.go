@@ -0,0 +1,116 @@
+package lib
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//go:generate mockgen -package=lib -destination ./env_file_reader_mock.go -source=env_file_reader.go
+type EnvFileReader interface {
+	ReadEnvFile(ctx context.Context, envFilePath string) (env map[string]string, err error)
+	ReadEnvFiles(ctx context.Context, envFilePaths []string, ignoreMissing bool) (env map[string]string, err error)
+}
+
+type envFileReader struct {
+	buildDirectory string
+}
+
+func NewEnvFileReader(buildDirectory string) EnvFileReader {
+	return &envFileReader{
+		buildDirectory: buildDirectory,
+	}
+}
+
+// ReadEnvFile reads a dotenv file with KEY=VALUE lines; paths are relative to the build directory
+func (r *envFileReader) ReadEnvFile(ctx context.Context, envFilePath string) (env map[string]string, err error) {
+	if !filepath.IsAbs(envFilePath) {
+		envFilePath = filepath.Join(r.buildDirectory, envFilePath)
+	}
+
+	file, err := os.Open(envFilePath)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	env = map[string]string{}
+
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		keyAndValue := strings.SplitN(line, "=", 2)
+		key := strings.TrimSpace(keyAndValue[0])
+		if len(keyAndValue) != 2 || key == "" {
+			return nil, fmt.Errorf("env file %v line %v is invalid; please use 'KEY=VALUE'", envFilePath, lineNumber)
+		}
+
+		value, err := r.parseValue(strings.TrimSpace(keyAndValue[1]))
+		if err != nil {
+			return nil, fmt.Errorf("env file %v line %v is invalid: %w", envFilePath, lineNumber, err)
+		}
+
+		env[key] = value
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return env, nil
+}
+
+// ReadEnvFiles reads and merges the env files in order, so later files override earlier ones
+func (r *envFileReader) ReadEnvFiles(ctx context.Context, envFilePaths []string, ignoreMissing bool) (env map[string]string, err error) {
+	env = map[string]string{}
+
+	for _, p := range envFilePaths {
+		fileEnv, err := r.ReadEnvFile(ctx, p)
+		if err != nil {
+			if ignoreMissing && os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		for k, v := range fileEnv {
+			env[k] = v
+		}
+	}
+
+	return env, nil
+}
+
+func (r *envFileReader) parseValue(value string) (string, error) {
+	if len(value) > 0 && (value[0] == '"' || value[0] == '\'') {
+		quote := value[0]
+		end := strings.LastIndexByte(value, quote)
+		if end == 0 {
+			return "", fmt.Errorf("value has no closing quote")
+		}
+
+		// single quoted values are taken literally, double quoted values support escaped characters
+		if quote == '\'' {
+			return value[1:end], nil
+		}
+
+		replacer := strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\"`, `"`, `\\`, `\`)
+		return replacer.Replace(value[1:end]), nil
+	}
+
+	// strip inline comments from unquoted values
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+
+	return value, nil
+}
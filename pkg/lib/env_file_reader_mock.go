@@ -0,0 +1,65 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: env_file_reader.go
+
+// Package lib is a generated GoMock package.
+package lib
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockEnvFileReader is a mock of EnvFileReader interface.
+type MockEnvFileReader struct {
+	ctrl     *gomock.Controller
+	recorder *MockEnvFileReaderMockRecorder
+}
+
+// MockEnvFileReaderMockRecorder is the mock recorder for MockEnvFileReader.
+type MockEnvFileReaderMockRecorder struct {
+	mock *MockEnvFileReader
+}
+
+// NewMockEnvFileReader creates a new mock instance.
+func NewMockEnvFileReader(ctrl *gomock.Controller) *MockEnvFileReader {
+	mock := &MockEnvFileReader{ctrl: ctrl}
+	mock.recorder = &MockEnvFileReaderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockEnvFileReader) EXPECT() *MockEnvFileReaderMockRecorder {
+	return m.recorder
+}
+
+// ReadEnvFile mocks base method.
+func (m *MockEnvFileReader) ReadEnvFile(ctx context.Context, envFilePath string) (map[string]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadEnvFile", ctx, envFilePath)
+	ret0, _ := ret[0].(map[string]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadEnvFile indicates an expected call of ReadEnvFile.
+func (mr *MockEnvFileReaderMockRecorder) ReadEnvFile(ctx, envFilePath interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadEnvFile", reflect.TypeOf((*MockEnvFileReader)(nil).ReadEnvFile), ctx, envFilePath)
+}
+
+// ReadEnvFiles mocks base method.
+func (m *MockEnvFileReader) ReadEnvFiles(ctx context.Context, envFilePaths []string, ignoreMissing bool) (map[string]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadEnvFiles", ctx, envFilePaths, ignoreMissing)
+	ret0, _ := ret[0].(map[string]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadEnvFiles indicates an expected call of ReadEnvFiles.
+func (mr *MockEnvFileReaderMockRecorder) ReadEnvFiles(ctx, envFilePaths, ignoreMissing interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadEnvFiles", reflect.TypeOf((*MockEnvFileReader)(nil).ReadEnvFiles), ctx, envFilePaths, ignoreMissing)
+}
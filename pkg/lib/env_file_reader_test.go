@@ -0,0 +1,168 @@
+package lib
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestReadEnvFile(t *testing.T) {
+	t.Run("ReturnsKeysAndValues", func(t *testing.T) {
+
+		dir := writeEnvFile(t, ".env", "A=1\nB=two\n")
+		defer os.RemoveAll(dir)
+		envFileReader := NewEnvFileReader(dir)
+
+		// act
+		env, err := envFileReader.ReadEnvFile(context.Background(), ".env")
+
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]string{"A": "1", "B": "two"}, env)
+	})
+
+	t.Run("SkipsCommentsAndEmptyLines", func(t *testing.T) {
+
+		dir := writeEnvFile(t, ".env", "# comment\n\nA=1\n  # indented comment\n")
+		defer os.RemoveAll(dir)
+		envFileReader := NewEnvFileReader(dir)
+
+		// act
+		env, err := envFileReader.ReadEnvFile(context.Background(), ".env")
+
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]string{"A": "1"}, env)
+	})
+
+	t.Run("StripsExportPrefix", func(t *testing.T) {
+
+		dir := writeEnvFile(t, ".env", "export A=1\n")
+		defer os.RemoveAll(dir)
+		envFileReader := NewEnvFileReader(dir)
+
+		// act
+		env, err := envFileReader.ReadEnvFile(context.Background(), ".env")
+
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]string{"A": "1"}, env)
+	})
+
+	t.Run("KeepsEqualSymbolsInValue", func(t *testing.T) {
+
+		dir := writeEnvFile(t, ".env", "A=b=c\n")
+		defer os.RemoveAll(dir)
+		envFileReader := NewEnvFileReader(dir)
+
+		// act
+		env, err := envFileReader.ReadEnvFile(context.Background(), ".env")
+
+		assert.Nil(t, err)
+		assert.Equal(t, "b=c", env["A"])
+	})
+
+	t.Run("StripsInlineCommentsFromUnquotedValues", func(t *testing.T) {
+
+		dir := writeEnvFile(t, ".env", "A=1 # comment\nB=\"2 # not a comment\"\n")
+		defer os.RemoveAll(dir)
+		envFileReader := NewEnvFileReader(dir)
+
+		// act
+		env, err := envFileReader.ReadEnvFile(context.Background(), ".env")
+
+		assert.Nil(t, err)
+		assert.Equal(t, "1", env["A"])
+		assert.Equal(t, "2 # not a comment", env["B"])
+	})
+
+	t.Run("UnescapesDoubleQuotedValues", func(t *testing.T) {
+
+		dir := writeEnvFile(t, ".env", `A="line1\nline2"`+"\n")
+		defer os.RemoveAll(dir)
+		envFileReader := NewEnvFileReader(dir)
+
+		// act
+		env, err := envFileReader.ReadEnvFile(context.Background(), ".env")
+
+		assert.Nil(t, err)
+		assert.Equal(t, "line1\nline2", env["A"])
+	})
+
+	t.Run("KeepsSingleQuotedValuesLiteral", func(t *testing.T) {
+
+		dir := writeEnvFile(t, ".env", `A='line1\nline2'`+"\n")
+		defer os.RemoveAll(dir)
+		envFileReader := NewEnvFileReader(dir)
+
+		// act
+		env, err := envFileReader.ReadEnvFile(context.Background(), ".env")
+
+		assert.Nil(t, err)
+		assert.Equal(t, `line1\nline2`, env["A"])
+	})
+
+	t.Run("ReturnsErrorForLineWithoutEqualSymbol", func(t *testing.T) {
+
+		dir := writeEnvFile(t, ".env", "A\n")
+		defer os.RemoveAll(dir)
+		envFileReader := NewEnvFileReader(dir)
+
+		// act
+		_, err := envFileReader.ReadEnvFile(context.Background(), ".env")
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestReadEnvFiles(t *testing.T) {
+	t.Run("LaterFilesOverrideEarlierFiles", func(t *testing.T) {
+
+		dir := writeEnvFile(t, ".env", "A=1\nB=1\n")
+		defer os.RemoveAll(dir)
+		err := ioutil.WriteFile(filepath.Join(dir, ".env.ci"), []byte("B=2\n"), 0644)
+		assert.Nil(t, err)
+		envFileReader := NewEnvFileReader(dir)
+
+		// act
+		env, err := envFileReader.ReadEnvFiles(context.Background(), []string{".env", ".env.ci"}, false)
+
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]string{"A": "1", "B": "2"}, env)
+	})
+
+	t.Run("IgnoresMissingFilesIfRequested", func(t *testing.T) {
+
+		dir := writeEnvFile(t, ".env", "A=1\n")
+		defer os.RemoveAll(dir)
+		envFileReader := NewEnvFileReader(dir)
+
+		// act
+		env, err := envFileReader.ReadEnvFiles(context.Background(), []string{".env", ".env.missing"}, true)
+
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]string{"A": "1"}, env)
+	})
+
+	t.Run("ReturnsErrorForMissingFilesIfNotIgnored", func(t *testing.T) {
+
+		dir := writeEnvFile(t, ".env", "A=1\n")
+		defer os.RemoveAll(dir)
+		envFileReader := NewEnvFileReader(dir)
+
+		// act
+		_, err := envFileReader.ReadEnvFiles(context.Background(), []string{".env", ".env.missing"}, false)
+
+		assert.NotNil(t, err)
+	})
+}
+
+func writeEnvFile(t *testing.T, name, content string) string {
+	dir, err := ioutil.TempDir("", "infinity")
+	assert.Nil(t, err)
+	err = ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+	assert.Nil(t, err)
+
+	return dir
+}
@@ -0,0 +1,270 @@
+package lib
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// fileWatcherDebounce is how long the build directory has to be quiet before changes get reported, so saving many files at once triggers a single run
+const fileWatcherDebounce = 300 * time.Millisecond
+
+//go:generate mockgen -package=lib -destination ./file_watcher_mock.go -source=file_watcher.go
+type FileWatcher interface {
+	Watch(ctx context.Context) (changes <-chan []string, err error)
+}
+
+type fileWatcher struct {
+	buildDirectory string
+	paths          []*pathPattern
+	ignorePatterns []*pathPattern
+	debounce       time.Duration
+}
+
+// NewFileWatcher returns a watcher for changes in the build directory, limited to the paths globs if any, that skips everything ignored by .gitignore and .dockerignore and the ignorePaths
+func NewFileWatcher(buildDirectory string, paths, ignorePaths []string) FileWatcher {
+	pathPatterns := []*pathPattern{}
+	for _, p := range paths {
+		if pattern := newPathPattern(p, false); pattern != nil {
+			pathPatterns = append(pathPatterns, pattern)
+		}
+	}
+
+	// files written by the run itself, like reports, shouldn't trigger another run
+	ignorePatterns := []*pathPattern{}
+	for _, p := range ignorePaths {
+		if pattern := newPathPattern(p, true); pattern != nil {
+			ignorePatterns = append(ignorePatterns, pattern)
+		}
+	}
+
+	if buildDirectory == "" {
+		buildDirectory = "."
+	}
+
+	return &fileWatcher{
+		buildDirectory: buildDirectory,
+		paths:          pathPatterns,
+		ignorePatterns: ignorePatterns,
+		debounce:       fileWatcherDebounce,
+	}
+}
+
+// Watch sends the relative paths that changed after each quiet period, until the context is done
+func (w *fileWatcher) Watch(ctx context.Context) (changes <-chan []string, err error) {
+	ignorePatterns, err := w.readIgnorePatterns()
+	if err != nil {
+		return
+	}
+	w.ignorePatterns = append(ignorePatterns, w.ignorePatterns...)
+
+	events, err := w.watchEvents(ctx)
+	if err != nil {
+		return
+	}
+
+	debouncedChanges := make(chan []string)
+	go w.debounceEvents(ctx, events, debouncedChanges)
+
+	return debouncedChanges, nil
+}
+
+func (w *fileWatcher) debounceEvents(ctx context.Context, events <-chan string, changes chan<- []string) {
+	defer close(changes)
+
+	changedPaths := map[string]struct{}{}
+	timer := time.NewTimer(w.debounce)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case path, ok := <-events:
+			if !ok {
+				return
+			}
+			if !w.isWatched(path, false) {
+				continue
+			}
+			changedPaths[path] = struct{}{}
+			timer.Reset(w.debounce)
+
+		case <-timer.C:
+			paths := []string{}
+			for p := range changedPaths {
+				paths = append(paths, p)
+			}
+			sort.Strings(paths)
+			changedPaths = map[string]struct{}{}
+
+			select {
+			case changes <- paths:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// isWatched returns true if changes to the relative path should trigger a run
+func (w *fileWatcher) isWatched(path string, isDir bool) bool {
+	if w.isIgnored(path, isDir) {
+		return false
+	}
+	if isDir || len(w.paths) == 0 {
+		return true
+	}
+
+	for _, p := range w.paths {
+		if p.matches(path, false) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isIgnored applies the ignore patterns in order, so a later negated pattern can include a path again
+func (w *fileWatcher) isIgnored(path string, isDir bool) bool {
+	segments := strings.Split(filepath.ToSlash(path), "/")
+
+	// never react to git internals or the logs and history infinity writes itself
+	if segments[0] == ".git" || segments[0] == ".infinity" {
+		return true
+	}
+
+	ignored := false
+	for _, p := range w.ignorePatterns {
+		if p.matches(path, isDir) {
+			ignored = !p.negate
+		}
+	}
+
+	return ignored
+}
+
+func (w *fileWatcher) readIgnorePatterns() (patterns []*pathPattern, err error) {
+	gitignorePatterns, err := w.readIgnoreFile(".gitignore", false)
+	if err != nil {
+		return
+	}
+
+	// .dockerignore patterns are always relative to the root of the build context
+	dockerignorePatterns, err := w.readIgnoreFile(".dockerignore", true)
+	if err != nil {
+		return
+	}
+
+	return append(gitignorePatterns, dockerignorePatterns...), nil
+}
+
+func (w *fileWatcher) readIgnoreFile(filename string, anchored bool) (patterns []*pathPattern, err error) {
+	file, err := os.Open(filepath.Join(w.buildDirectory, filename))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if pattern := newPathPattern(scanner.Text(), anchored); pattern != nil {
+			patterns = append(patterns, pattern)
+		}
+	}
+
+	return patterns, scanner.Err()
+}
+
+// pathPattern is a glob in .gitignore syntax; ** matches any number of directories
+type pathPattern struct {
+	segments []string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+func newPathPattern(line string, anchored bool) *pathPattern {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+
+	pattern := &pathPattern{
+		anchored: anchored,
+	}
+	if strings.HasPrefix(line, "!") {
+		pattern.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		pattern.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	// a pattern with a slash other than at the end is relative to the root, otherwise it matches at any depth
+	if strings.Contains(line, "/") {
+		pattern.anchored = true
+	}
+	line = strings.TrimPrefix(line, "/")
+	if line == "" {
+		return nil
+	}
+	pattern.segments = strings.Split(line, "/")
+
+	return pattern
+}
+
+// matches returns true if the pattern matches the relative path or one of its parent directories
+func (p *pathPattern) matches(path string, isDir bool) bool {
+	segments := strings.Split(filepath.ToSlash(path), "/")
+
+	for i := 1; i <= len(segments); i++ {
+		if p.dirOnly && i == len(segments) && !isDir {
+			continue
+		}
+		if p.anchored {
+			if matchSegments(p.segments, segments[:i]) {
+				return true
+			}
+			continue
+		}
+		if matchSegments(p.segments, segments[i-1:i]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchSegments(patternSegments, pathSegments []string) bool {
+	if len(patternSegments) == 0 {
+		return len(pathSegments) == 0
+	}
+
+	if patternSegments[0] == "**" {
+		for i := 0; i <= len(pathSegments); i++ {
+			if matchSegments(patternSegments[1:], pathSegments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(pathSegments) == 0 {
+		return false
+	}
+	if matched, err := filepath.Match(patternSegments[0], pathSegments[0]); err != nil || !matched {
+		return false
+	}
+
+	return matchSegments(patternSegments[1:], pathSegments[1:])
+}
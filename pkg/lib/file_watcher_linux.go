@@ -0,0 +1,137 @@
+//go:build linux
+// +build linux
+
+package lib
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const inotifyMask = unix.IN_MODIFY | unix.IN_CLOSE_WRITE | unix.IN_CREATE | unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO
+
+// watchEvents sends the relative path of each file that gets changed, using inotify watches on every directory that isn't ignored
+func (w *fileWatcher) watchEvents(ctx context.Context) (events <-chan string, err error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+
+	directories := map[int]string{}
+	if err = w.addWatches(fd, directories, ""); err != nil {
+		unix.Close(fd)
+		return
+	}
+
+	pathEvents := make(chan string)
+	go func() {
+		defer close(pathEvents)
+		defer unix.Close(fd)
+
+		buffer := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+		for {
+			// poll with a timeout, since a blocking read can't be interrupted when the context is done
+			pollFds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+			n, err := unix.Poll(pollFds, 200)
+			if ctx.Err() != nil {
+				return
+			}
+			if err == unix.EINTR || n == 0 {
+				continue
+			}
+			if err != nil {
+				return
+			}
+
+			n, err = unix.Read(fd, buffer)
+			if err == unix.EAGAIN || err == unix.EINTR {
+				continue
+			}
+			if err != nil || n < unix.SizeofInotifyEvent {
+				return
+			}
+
+			for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+				event := (*unix.InotifyEvent)(unsafe.Pointer(&buffer[offset]))
+				nameBytes := buffer[offset+unix.SizeofInotifyEvent : offset+unix.SizeofInotifyEvent+int(event.Len)]
+				offset += unix.SizeofInotifyEvent + int(event.Len)
+
+				directory, ok := directories[int(event.Wd)]
+				if !ok {
+					continue
+				}
+				if event.Mask&unix.IN_IGNORED != 0 {
+					delete(directories, int(event.Wd))
+					continue
+				}
+
+				name := string(nameBytes)
+				for i, b := range nameBytes {
+					if b == 0 {
+						name = string(nameBytes[:i])
+						break
+					}
+				}
+				if name == "" {
+					continue
+				}
+				path := filepath.Join(directory, name)
+
+				// watch directories that get created while watching as well
+				if event.Mask&unix.IN_ISDIR != 0 {
+					if event.Mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 && !w.isIgnored(path, true) {
+						_ = w.addWatches(fd, directories, path)
+					}
+					continue
+				}
+
+				select {
+				case pathEvents <- path:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return pathEvents, nil
+}
+
+// addWatches adds an inotify watch for the directory and all its subdirectories that aren't ignored
+func (w *fileWatcher) addWatches(fd int, directories map[int]string, directory string) error {
+	return filepath.Walk(filepath.Join(w.buildDirectory, directory), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// directories can disappear while walking them
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+
+		relativePath, err := filepath.Rel(w.buildDirectory, path)
+		if err != nil {
+			return err
+		}
+		if relativePath == "." {
+			relativePath = ""
+		}
+		if relativePath != "" && w.isIgnored(relativePath, true) {
+			return filepath.SkipDir
+		}
+
+		wd, err := unix.InotifyAddWatch(fd, path, inotifyMask)
+		if err != nil {
+			return os.NewSyscallError("inotify_add_watch", err)
+		}
+		directories[wd] = relativePath
+
+		return nil
+	})
+}
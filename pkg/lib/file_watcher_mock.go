@@ -0,0 +1,50 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: file_watcher.go
+
+// Package lib is a generated GoMock package.
+package lib
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockFileWatcher is a mock of FileWatcher interface.
+type MockFileWatcher struct {
+	ctrl     *gomock.Controller
+	recorder *MockFileWatcherMockRecorder
+}
+
+// MockFileWatcherMockRecorder is the mock recorder for MockFileWatcher.
+type MockFileWatcherMockRecorder struct {
+	mock *MockFileWatcher
+}
+
+// NewMockFileWatcher creates a new mock instance.
+func NewMockFileWatcher(ctrl *gomock.Controller) *MockFileWatcher {
+	mock := &MockFileWatcher{ctrl: ctrl}
+	mock.recorder = &MockFileWatcherMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockFileWatcher) EXPECT() *MockFileWatcherMockRecorder {
+	return m.recorder
+}
+
+// Watch mocks base method.
+func (m *MockFileWatcher) Watch(ctx context.Context) (<-chan []string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Watch", ctx)
+	ret0, _ := ret[0].(<-chan []string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Watch indicates an expected call of Watch.
+func (mr *MockFileWatcherMockRecorder) Watch(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Watch", reflect.TypeOf((*MockFileWatcher)(nil).Watch), ctx)
+}
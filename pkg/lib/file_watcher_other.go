@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package lib
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+)
+
+func (w *fileWatcher) watchEvents(ctx context.Context) (events <-chan string, err error) {
+	return nil, fmt.Errorf("watching for file changes is not supported on %v; it needs inotify, which is only available on linux", runtime.GOOS)
+}
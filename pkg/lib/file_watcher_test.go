@@ -0,0 +1,100 @@
+package lib
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestFileWatcher(t *testing.T) {
+	t.Run("SkipsPathsIgnoredByGitignoreAndDockerignore", func(t *testing.T) {
+
+		dir := getTestFileWatcherDirectory(t)
+		defer os.RemoveAll(dir)
+		writeTestFile(t, dir, ".gitignore", "node_modules/\n*.log\n!keep.log\n/build\n")
+		writeTestFile(t, dir, ".dockerignore", "# comment\ntmp/**\n")
+		fileWatcher := NewFileWatcher(dir, []string{}, []string{"report.xml"}).(*fileWatcher)
+
+		// act
+		patterns, err := fileWatcher.readIgnorePatterns()
+		fileWatcher.ignorePatterns = append(patterns, fileWatcher.ignorePatterns...)
+
+		assert.Nil(t, err)
+		assert.True(t, fileWatcher.isWatched("main.go", false))
+		assert.True(t, fileWatcher.isWatched("keep.log", false))
+		assert.True(t, fileWatcher.isWatched("src/build/main.go", false))
+		assert.True(t, fileWatcher.isWatched("src/tmp/main.go", false))
+		assert.False(t, fileWatcher.isWatched("web/node_modules/react/index.js", false))
+		assert.False(t, fileWatcher.isWatched("web/node_modules", true))
+		assert.False(t, fileWatcher.isWatched("debug.log", false))
+		assert.False(t, fileWatcher.isWatched("build/app", false))
+		assert.False(t, fileWatcher.isWatched("tmp/cache/file", false))
+		assert.False(t, fileWatcher.isWatched("report.xml", false))
+		assert.False(t, fileWatcher.isWatched(".git/index", false))
+		assert.False(t, fileWatcher.isWatched(".infinity/history.jsonl", false))
+	})
+
+	t.Run("OnlyWatchesPathsMatchingGlobs", func(t *testing.T) {
+
+		fileWatcher := NewFileWatcher("", []string{"**/*.go", "web/src/**"}, []string{}).(*fileWatcher)
+
+		// act
+		watched := []bool{
+			fileWatcher.isWatched("main.go", false),
+			fileWatcher.isWatched("pkg/lib/runner.go", false),
+			fileWatcher.isWatched("web/src/index.js", false),
+			fileWatcher.isWatched("README.md", false),
+			fileWatcher.isWatched("web/package.json", false),
+		}
+
+		assert.Equal(t, []bool{true, true, true, false, false}, watched)
+	})
+
+	t.Run("SendsChangedPathsOnceDirectoryIsQuiet", func(t *testing.T) {
+
+		if runtime.GOOS != "linux" {
+			t.Skip("watching needs inotify")
+		}
+
+		dir := getTestFileWatcherDirectory(t)
+		defer os.RemoveAll(dir)
+		writeTestFile(t, dir, ".gitignore", "*.log\n")
+		assert.Nil(t, os.MkdirAll(filepath.Join(dir, "pkg"), 0755))
+		fileWatcher := NewFileWatcher(dir, []string{}, []string{})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// act
+		changes, err := fileWatcher.Watch(ctx)
+		assert.Nil(t, err)
+		writeTestFile(t, dir, "main.go", "package main\n")
+		writeTestFile(t, dir, "debug.log", "debug\n")
+		writeTestFile(t, dir, "pkg/lib.go", "package pkg\n")
+
+		select {
+		case changedPaths := <-changes:
+			assert.Equal(t, []string{"main.go", "pkg/lib.go"}, changedPaths)
+		case <-time.After(5 * time.Second):
+			t.Fatal("no changes received")
+		}
+	})
+}
+
+func getTestFileWatcherDirectory(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "watch")
+	assert.Nil(t, err)
+
+	return dir
+}
+
+func writeTestFile(t *testing.T, dir, path, content string) {
+	err := ioutil.WriteFile(filepath.Join(dir, path), []byte(content), 0644)
+	assert.Nil(t, err)
+}
@@ -0,0 +1,238 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sort"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+type GitInfo struct {
+	Revision      string `json:"revision,omitempty"`
+	ShortRevision string `json:"shortRevision,omitempty"`
+	Branch        string `json:"branch,omitempty"`
+	Tag           string `json:"tag,omitempty"`
+	Dirty         bool   `json:"dirty,omitempty"`
+	Repo          string `json:"repo,omitempty"`
+}
+
+//go:generate mockgen -package=lib -destination ./git_reader_mock.go -source=git_reader.go
+type GitReader interface {
+	GetInfo(ctx context.Context) (info GitInfo, err error)
+	GetCommitCount(ctx context.Context) (count int, err error)
+	GetTags(ctx context.Context) (tags []string, err error)
+}
+
+type gitReader struct {
+	buildDirectory string
+}
+
+// NewGitReader returns a reader for git metadata of the build directory; it doesn't need the git binary to be installed
+func NewGitReader(buildDirectory string) GitReader {
+	return &gitReader{
+		buildDirectory: buildDirectory,
+	}
+}
+
+func (r *gitReader) GetInfo(ctx context.Context) (info GitInfo, err error) {
+	repository, err := r.openRepository()
+	if err != nil || repository == nil {
+		return
+	}
+
+	info.Repo = r.getRepo(repository)
+
+	head, err := repository.Head()
+	if err != nil {
+		// a repository without commits has no head yet
+		if errors.Is(err, plumbing.ErrReferenceNotFound) {
+			return info, nil
+		}
+		return
+	}
+
+	info.Revision = head.Hash().String()
+	info.ShortRevision = info.Revision[:7]
+	if head.Name().IsBranch() {
+		info.Branch = head.Name().Short()
+	}
+
+	info.Tag, err = r.getTag(repository, head.Hash())
+	if err != nil {
+		return
+	}
+
+	worktree, err := repository.Worktree()
+	if err != nil {
+		// bare repositories have no worktree that can be dirty
+		if errors.Is(err, git.ErrIsBareRepository) {
+			return info, nil
+		}
+		return
+	}
+	status, err := worktree.Status()
+	if err != nil {
+		return
+	}
+	info.Dirty = !status.IsClean()
+
+	return info, nil
+}
+
+func (r *gitReader) GetCommitCount(ctx context.Context) (count int, err error) {
+	repository, err := r.openRepository()
+	if err != nil || repository == nil {
+		return
+	}
+
+	head, err := repository.Head()
+	if err != nil {
+		if errors.Is(err, plumbing.ErrReferenceNotFound) {
+			return 0, nil
+		}
+		return
+	}
+
+	commits, err := repository.Log(&git.LogOptions{From: head.Hash()})
+	if err != nil {
+		return
+	}
+	defer commits.Close()
+
+	err = commits.ForEach(func(c *object.Commit) error {
+		count++
+		return nil
+	})
+
+	return
+}
+
+// GetTags returns the tags of commits reachable from head, so tags on other branches don't affect the version
+func (r *gitReader) GetTags(ctx context.Context) (tags []string, err error) {
+	repository, err := r.openRepository()
+	if err != nil || repository == nil {
+		return
+	}
+
+	head, err := repository.Head()
+	if err != nil {
+		if errors.Is(err, plumbing.ErrReferenceNotFound) {
+			return nil, nil
+		}
+		return
+	}
+
+	commits, err := repository.Log(&git.LogOptions{From: head.Hash()})
+	if err != nil {
+		return
+	}
+	defer commits.Close()
+
+	ancestors := map[plumbing.Hash]bool{}
+	err = commits.ForEach(func(c *object.Commit) error {
+		ancestors[c.Hash] = true
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	tagRefs, err := repository.Tags()
+	if err != nil {
+		return
+	}
+
+	err = tagRefs.ForEach(func(ref *plumbing.Reference) error {
+		if hash, ok := r.getTagCommit(repository, ref); ok && ancestors[hash] {
+			tags = append(tags, ref.Name().Short())
+		}
+		return nil
+	})
+
+	return
+}
+
+// openRepository returns a nil repository without error outside of a git repository
+func (r *gitReader) openRepository() (repository *git.Repository, err error) {
+	directory := r.buildDirectory
+	if directory == "" {
+		directory = "."
+	}
+
+	repository, err = git.PlainOpenWithOptions(directory, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		if errors.Is(err, git.ErrRepositoryNotExists) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return repository, nil
+}
+
+func (r *gitReader) getTag(repository *git.Repository, revision plumbing.Hash) (tag string, err error) {
+	tagRefs, err := repository.Tags()
+	if err != nil {
+		return
+	}
+
+	tags := []string{}
+	err = tagRefs.ForEach(func(ref *plumbing.Reference) error {
+		if hash, ok := r.getTagCommit(repository, ref); ok && hash == revision {
+			tags = append(tags, ref.Name().Short())
+		}
+		return nil
+	})
+	if err != nil || len(tags) == 0 {
+		return
+	}
+
+	// pick the same tag each time if a commit has multiple tags
+	sort.Strings(tags)
+
+	return tags[len(tags)-1], nil
+}
+
+// getTagCommit returns the commit a tag points to; ok is false for annotated tags of something other than a commit
+func (r *gitReader) getTagCommit(repository *git.Repository, ref *plumbing.Reference) (hash plumbing.Hash, ok bool) {
+	hash = ref.Hash()
+
+	// annotated tags point to a tag object instead of the commit itself
+	if tagObject, err := repository.TagObject(hash); err == nil {
+		commit, err := tagObject.Commit()
+		if err != nil {
+			return hash, false
+		}
+		return commit.Hash, true
+	}
+
+	return hash, true
+}
+
+func (r *gitReader) getRepo(repository *git.Repository) string {
+	remote, err := repository.Remote(git.DefaultRemoteName)
+	if err != nil {
+		remotes, err := repository.Remotes()
+		if err != nil || len(remotes) == 0 {
+			return ""
+		}
+		remote = remotes[0]
+	}
+
+	urls := remote.Config().URLs
+	if len(urls) == 0 {
+		return ""
+	}
+
+	// strip credentials from https urls
+	if u, err := url.Parse(urls[0]); err == nil && u.User != nil && u.Scheme != "" {
+		u.User = nil
+		return u.String()
+	}
+
+	return urls[0]
+}
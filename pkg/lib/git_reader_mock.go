@@ -0,0 +1,80 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: git_reader.go
+
+// Package lib is a generated GoMock package.
+package lib
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockGitReader is a mock of GitReader interface.
+type MockGitReader struct {
+	ctrl     *gomock.Controller
+	recorder *MockGitReaderMockRecorder
+}
+
+// MockGitReaderMockRecorder is the mock recorder for MockGitReader.
+type MockGitReaderMockRecorder struct {
+	mock *MockGitReader
+}
+
+// NewMockGitReader creates a new mock instance.
+func NewMockGitReader(ctrl *gomock.Controller) *MockGitReader {
+	mock := &MockGitReader{ctrl: ctrl}
+	mock.recorder = &MockGitReaderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockGitReader) EXPECT() *MockGitReaderMockRecorder {
+	return m.recorder
+}
+
+// GetCommitCount mocks base method.
+func (m *MockGitReader) GetCommitCount(ctx context.Context) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCommitCount", ctx)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCommitCount indicates an expected call of GetCommitCount.
+func (mr *MockGitReaderMockRecorder) GetCommitCount(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCommitCount", reflect.TypeOf((*MockGitReader)(nil).GetCommitCount), ctx)
+}
+
+// GetInfo mocks base method.
+func (m *MockGitReader) GetInfo(ctx context.Context) (GitInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetInfo", ctx)
+	ret0, _ := ret[0].(GitInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetInfo indicates an expected call of GetInfo.
+func (mr *MockGitReaderMockRecorder) GetInfo(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetInfo", reflect.TypeOf((*MockGitReader)(nil).GetInfo), ctx)
+}
+
+// GetTags mocks base method.
+func (m *MockGitReader) GetTags(ctx context.Context) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTags", ctx)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTags indicates an expected call of GetTags.
+func (mr *MockGitReaderMockRecorder) GetTags(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTags", reflect.TypeOf((*MockGitReader)(nil).GetTags), ctx)
+}
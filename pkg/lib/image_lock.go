@@ -0,0 +1,120 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ImageLockFilename is the file next to the manifest that pins the images of the manifest to a digest
+const ImageLockFilename = ".infinity.lock"
+
+const imageLockHeader = "# generated by 'infinity lock'; run it again after changing an image in the manifest\n"
+
+// ImageLock pins each image of the manifest to the digest it resolved to when it got locked, so moving tags don't change a build
+type ImageLock struct {
+	Images map[string]string `yaml:"images" json:"images"`
+}
+
+// ReadImageLock reads the lockfile; without the file it returns nil, meaning images don't get pinned
+func ReadImageLock(imageLockPath string) (lock *ImageLock, err error) {
+	lockBytes, err := ioutil.ReadFile(imageLockPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return
+	}
+
+	lock = &ImageLock{}
+	decoder := yaml.NewDecoder(bytes.NewReader(lockBytes))
+	decoder.KnownFields(true)
+	if err = decoder.Decode(lock); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("lockfile %v is invalid: %w", imageLockPath, err)
+	}
+
+	for image, digest := range lock.Images {
+		if !strings.HasPrefix(digest, "sha256:") {
+			return nil, fmt.Errorf("lockfile %v is invalid: digest %v of image %v is not a sha256 digest; please run 'infinity lock' to update it", imageLockPath, digest, image)
+		}
+	}
+
+	return lock, nil
+}
+
+// WriteImageLock writes the lockfile with its images sorted, to keep diffs small
+func WriteImageLock(imageLockPath string, lock ImageLock) error {
+	var buffer bytes.Buffer
+	buffer.WriteString(imageLockHeader)
+
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(lock); err != nil {
+		return err
+	}
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(imageLockPath, buffer.Bytes(), 0644)
+}
+
+// GetPinnedImage returns the image with the locked digest appended; images that already have a digest are pinned as is
+func (l *ImageLock) GetPinnedImage(image string) (pinnedImage string, ok bool) {
+	if strings.Contains(image, "@") {
+		return image, true
+	}
+
+	digest, ok := l.Images[image]
+	if !ok {
+		return image, false
+	}
+
+	return fmt.Sprintf("%v@%v", image, digest), true
+}
+
+// GetDrift compares the lockfile with the images of the manifest; unlocked images are missing from the lockfile, unused images are locked but no longer in the manifest
+func (l *ImageLock) GetDrift(images []string) (unlocked, unused []string) {
+	for _, image := range images {
+		if _, ok := l.GetPinnedImage(image); !ok {
+			unlocked = append(unlocked, image)
+		}
+	}
+	for image := range l.Images {
+		if !stringArrayContains(images, image) {
+			unused = append(unused, image)
+		}
+	}
+	sort.Strings(unused)
+
+	return
+}
+
+// GetManifestImages returns the images of the container stages of all targets, sorted and without duplicates
+func GetManifestImages(manifest Manifest) (images []string) {
+	for _, t := range manifest.Targets {
+		images = appendStageImages(images, t.Stages)
+	}
+	sort.Strings(images)
+
+	return
+}
+
+func appendStageImages(images []string, stages []*ManifestStage) []string {
+	for _, s := range stages {
+		images = appendStageImages(images, s.Stages)
+
+		if s.RunnerType != RunnerTypeContainer || s.Image == "" || stringArrayContains(images, s.Image) {
+			continue
+		}
+		images = append(images, s.Image)
+	}
+
+	return images
+}
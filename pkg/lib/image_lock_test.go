@@ -0,0 +1,128 @@
+package lib
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestReadImageLock(t *testing.T) {
+	t.Run("ReturnsNilIfLockfileDoesNotExist", func(t *testing.T) {
+
+		// act
+		lock, err := ReadImageLock(filepath.Join(t.TempDir(), ImageLockFilename))
+
+		assert.Nil(t, err)
+		assert.Nil(t, lock)
+	})
+
+	t.Run("ReturnsLockWrittenByWriteImageLock", func(t *testing.T) {
+
+		lockPath := filepath.Join(t.TempDir(), ImageLockFilename)
+		err := WriteImageLock(lockPath, ImageLock{Images: map[string]string{"golang:1.17-alpine": "sha256:abc123", "alpine:3.13": "sha256:def456"}})
+		assert.Nil(t, err)
+
+		// act
+		lock, err := ReadImageLock(lockPath)
+
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]string{"golang:1.17-alpine": "sha256:abc123", "alpine:3.13": "sha256:def456"}, lock.Images)
+	})
+
+	t.Run("ReturnsErrorIfDigestIsNotSha256", func(t *testing.T) {
+
+		lockPath := filepath.Join(t.TempDir(), ImageLockFilename)
+		err := WriteImageLock(lockPath, ImageLock{Images: map[string]string{"golang:1.17-alpine": "1.17"}})
+		assert.Nil(t, err)
+
+		// act
+		_, err = ReadImageLock(lockPath)
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestGetPinnedImage(t *testing.T) {
+	t.Run("AppendsLockedDigestToImage", func(t *testing.T) {
+
+		lock := ImageLock{Images: map[string]string{"golang:1.17-alpine": "sha256:abc123"}}
+
+		// act
+		pinnedImage, ok := lock.GetPinnedImage("golang:1.17-alpine")
+
+		assert.True(t, ok)
+		assert.Equal(t, "golang:1.17-alpine@sha256:abc123", pinnedImage)
+	})
+
+	t.Run("ReturnsImageWithDigestAsIs", func(t *testing.T) {
+
+		lock := ImageLock{}
+
+		// act
+		pinnedImage, ok := lock.GetPinnedImage("golang:1.17-alpine@sha256:abc123")
+
+		assert.True(t, ok)
+		assert.Equal(t, "golang:1.17-alpine@sha256:abc123", pinnedImage)
+	})
+
+	t.Run("ReturnsFalseForImageNotInLockfile", func(t *testing.T) {
+
+		lock := ImageLock{Images: map[string]string{"golang:1.17-alpine": "sha256:abc123"}}
+
+		// act
+		pinnedImage, ok := lock.GetPinnedImage("alpine:3.13")
+
+		assert.False(t, ok)
+		assert.Equal(t, "alpine:3.13", pinnedImage)
+	})
+}
+
+func TestGetDrift(t *testing.T) {
+	t.Run("ReturnsUnlockedAndUnusedImages", func(t *testing.T) {
+
+		lock := ImageLock{Images: map[string]string{"golang:1.17-alpine": "sha256:abc123", "golang:1.16-alpine": "sha256:def456"}}
+
+		// act
+		unlocked, unused := lock.GetDrift([]string{"alpine:3.13", "golang:1.17-alpine", "hashicorp/terraform@sha256:012345"})
+
+		assert.Equal(t, []string{"alpine:3.13"}, unlocked)
+		assert.Equal(t, []string{"golang:1.16-alpine"}, unused)
+	})
+}
+
+func TestGetManifestImages(t *testing.T) {
+	t.Run("ReturnsSortedUniqueImagesOfContainerStagesInAllTargets", func(t *testing.T) {
+
+		manifest := Manifest{
+			Targets: []*ManifestTarget{
+				{
+					Name: "build",
+					Stages: []*ManifestStage{
+						{Name: "build", Image: "golang:1.17-alpine"},
+						{Name: "host", RunnerType: RunnerTypeHost},
+						{
+							Name: "parallel",
+							Stages: []*ManifestStage{
+								{Name: "lint", Image: "golangci/golangci-lint:latest-alpine"},
+								{Name: "test", Image: "golang:1.17-alpine"},
+							},
+						},
+					},
+				},
+				{
+					Name: "release",
+					Stages: []*ManifestStage{
+						{Name: "push", Image: "alpine:3.13"},
+					},
+				},
+			},
+		}
+		manifest.SetDefault()
+
+		// act
+		images := GetManifestImages(manifest)
+
+		assert.Equal(t, []string{"alpine:3.13", "golang:1.17-alpine", "golangci/golangci-lint:latest-alpine"}, images)
+	})
+}
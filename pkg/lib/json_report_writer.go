@@ -0,0 +1,37 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+//go:generate mockgen -package=lib -destination ./json_report_writer_mock.go -source=json_report_writer.go
+type JSONReportWriter interface {
+	WriteReport(ctx context.Context, report *RunReport, reportPath string) (err error)
+}
+
+type jsonReportWriter struct {
+}
+
+func NewJSONReportWriter() JSONReportWriter {
+	return &jsonReportWriter{}
+}
+
+// WriteReport writes the final tree of stages with their status, exit code and duration
+func (w *jsonReportWriter) WriteReport(ctx context.Context, report *RunReport, reportPath string) (err error) {
+	output, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return
+	}
+
+	if dir := filepath.Dir(reportPath); dir != "" {
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			return
+		}
+	}
+
+	return ioutil.WriteFile(reportPath, append(output, '\n'), 0644)
+}
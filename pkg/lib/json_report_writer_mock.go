@@ -0,0 +1,49 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: json_report_writer.go
+
+// Package lib is a generated GoMock package.
+package lib
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockJSONReportWriter is a mock of JSONReportWriter interface.
+type MockJSONReportWriter struct {
+	ctrl     *gomock.Controller
+	recorder *MockJSONReportWriterMockRecorder
+}
+
+// MockJSONReportWriterMockRecorder is the mock recorder for MockJSONReportWriter.
+type MockJSONReportWriterMockRecorder struct {
+	mock *MockJSONReportWriter
+}
+
+// NewMockJSONReportWriter creates a new mock instance.
+func NewMockJSONReportWriter(ctrl *gomock.Controller) *MockJSONReportWriter {
+	mock := &MockJSONReportWriter{ctrl: ctrl}
+	mock.recorder = &MockJSONReportWriterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockJSONReportWriter) EXPECT() *MockJSONReportWriterMockRecorder {
+	return m.recorder
+}
+
+// WriteReport mocks base method.
+func (m *MockJSONReportWriter) WriteReport(ctx context.Context, report *RunReport, reportPath string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WriteReport", ctx, report, reportPath)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WriteReport indicates an expected call of WriteReport.
+func (mr *MockJSONReportWriterMockRecorder) WriteReport(ctx, report, reportPath interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteReport", reflect.TypeOf((*MockJSONReportWriter)(nil).WriteReport), ctx, report, reportPath)
+}
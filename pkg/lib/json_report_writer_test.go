@@ -0,0 +1,35 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestJSONReportWriterWriteReport(t *testing.T) {
+	t.Run("WritesTreeOfStages", func(t *testing.T) {
+
+		report := getTestRunReport()
+		reportPath, dir := getTestReportPath(t)
+		defer os.RemoveAll(dir)
+		jsonReportWriter := NewJSONReportWriter()
+
+		// act
+		err := jsonReportWriter.WriteReport(context.Background(), report, reportPath)
+
+		assert.Nil(t, err)
+		output, err := ioutil.ReadFile(reportPath)
+		assert.Nil(t, err)
+		var writtenReport RunReport
+		err = json.Unmarshal(output, &writtenReport)
+		assert.Nil(t, err)
+		assert.Equal(t, 3, len(writtenReport.Stages))
+		assert.Equal(t, "unit", writtenReport.Stages[1].Stages[0].Name)
+		assert.Equal(t, StageStatusFailed, writtenReport.Stages[1].Stages[0].Status)
+		assert.Equal(t, 2, *writtenReport.Stages[1].Stages[0].ExitCode)
+	})
+}
@@ -0,0 +1,144 @@
+package lib
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//go:generate mockgen -package=lib -destination ./junit_report_writer_mock.go -source=junit_report_writer.go
+type JUnitReportWriter interface {
+	WriteReport(ctx context.Context, report *RunReport, reportPath string) (err error)
+}
+
+type junitReportWriter struct {
+}
+
+func NewJUnitReportWriter() JUnitReportWriter {
+	return &junitReportWriter{}
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr,omitempty"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteReport writes a testcase per stage; the stages of the target form one suite and nested parallel stages each form a suite of their own
+func (w *junitReportWriter) WriteReport(ctx context.Context, report *RunReport, reportPath string) (err error) {
+	testSuites := junitTestSuites{
+		Name: "infinity",
+		Time: w.formatSeconds(report.Duration.Seconds()),
+	}
+
+	testSuites.Suites = w.getTestSuites(report.Target, report.Target, report.Stages)
+	if len(testSuites.Suites) > 0 {
+		testSuites.Suites[0].Timestamp = report.Start.UTC().Format("2006-01-02T15:04:05")
+	}
+
+	for _, s := range testSuites.Suites {
+		testSuites.Tests += s.Tests
+		testSuites.Failures += s.Failures
+		testSuites.Errors += s.Errors
+		testSuites.Skipped += s.Skipped
+	}
+
+	output, err := xml.MarshalIndent(testSuites, "", "  ")
+	if err != nil {
+		return
+	}
+
+	if dir := filepath.Dir(reportPath); dir != "" {
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			return
+		}
+	}
+
+	return ioutil.WriteFile(reportPath, append([]byte(xml.Header), append(output, '\n')...), 0644)
+}
+
+func (w *junitReportWriter) getTestSuites(name, classname string, stages []*StageReport) (suites []junitTestSuite) {
+	suite := junitTestSuite{
+		Name: name,
+	}
+
+	var seconds float64
+	nestedSuites := []junitTestSuite{}
+	for _, s := range stages {
+		seconds += s.Duration.Seconds()
+
+		if len(s.Stages) > 0 {
+			nestedSuites = append(nestedSuites, w.getTestSuites(fmt.Sprintf("%v/%v", name, s.Name), fmt.Sprintf("%v.%v", classname, s.Name), s.Stages)...)
+			continue
+		}
+
+		testCase := junitTestCase{
+			Name:      s.Name,
+			Classname: classname,
+			Time:      w.formatSeconds(s.Duration.Seconds()),
+		}
+
+		switch s.Status {
+		case StageStatusFailed:
+			testCase.Failure = &junitMessage{
+				Message: s.Error,
+				Text:    strings.Join(s.LogTail, "\n"),
+			}
+			suite.Failures++
+		case StageStatusCanceled:
+			testCase.Error = &junitMessage{
+				Message: "stage got canceled",
+			}
+			suite.Errors++
+		case StageStatusSkipped:
+			testCase.Skipped = &junitMessage{
+				Message: "stage did not run",
+			}
+			suite.Skipped++
+		}
+
+		suite.Tests++
+		suite.Cases = append(suite.Cases, testCase)
+	}
+	suite.Time = w.formatSeconds(seconds)
+
+	return append([]junitTestSuite{suite}, nestedSuites...)
+}
+
+func (w *junitReportWriter) formatSeconds(seconds float64) string {
+	return fmt.Sprintf("%.3f", seconds)
+}
@@ -0,0 +1,49 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: junit_report_writer.go
+
+// Package lib is a generated GoMock package.
+package lib
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockJUnitReportWriter is a mock of JUnitReportWriter interface.
+type MockJUnitReportWriter struct {
+	ctrl     *gomock.Controller
+	recorder *MockJUnitReportWriterMockRecorder
+}
+
+// MockJUnitReportWriterMockRecorder is the mock recorder for MockJUnitReportWriter.
+type MockJUnitReportWriterMockRecorder struct {
+	mock *MockJUnitReportWriter
+}
+
+// NewMockJUnitReportWriter creates a new mock instance.
+func NewMockJUnitReportWriter(ctrl *gomock.Controller) *MockJUnitReportWriter {
+	mock := &MockJUnitReportWriter{ctrl: ctrl}
+	mock.recorder = &MockJUnitReportWriterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockJUnitReportWriter) EXPECT() *MockJUnitReportWriterMockRecorder {
+	return m.recorder
+}
+
+// WriteReport mocks base method.
+func (m *MockJUnitReportWriter) WriteReport(ctx context.Context, report *RunReport, reportPath string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WriteReport", ctx, report, reportPath)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WriteReport indicates an expected call of WriteReport.
+func (mr *MockJUnitReportWriterMockRecorder) WriteReport(ctx, report, reportPath interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteReport", reflect.TypeOf((*MockJUnitReportWriter)(nil).WriteReport), ctx, report, reportPath)
+}
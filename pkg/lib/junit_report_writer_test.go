@@ -0,0 +1,123 @@
+package lib
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestJUnitReportWriterWriteReport(t *testing.T) {
+	t.Run("WritesTestcaseForEachStage", func(t *testing.T) {
+
+		report := getTestRunReport()
+		reportPath, dir := getTestReportPath(t)
+		defer os.RemoveAll(dir)
+		junitReportWriter := NewJUnitReportWriter()
+
+		// act
+		err := junitReportWriter.WriteReport(context.Background(), report, reportPath)
+
+		assert.Nil(t, err)
+		output := readTestReport(t, reportPath)
+		assert.True(t, strings.Contains(output, `<testsuites name="infinity" tests="4" failures="1" errors="1" skipped="1" time="12.000">`))
+		assert.True(t, strings.Contains(output, `<testcase name="build" classname="build/local" time="10.000"></testcase>`))
+	})
+
+	t.Run("WritesParallelStagesAsSeparateTestsuite", func(t *testing.T) {
+
+		report := getTestRunReport()
+		reportPath, dir := getTestReportPath(t)
+		defer os.RemoveAll(dir)
+		junitReportWriter := NewJUnitReportWriter()
+
+		// act
+		err := junitReportWriter.WriteReport(context.Background(), report, reportPath)
+
+		assert.Nil(t, err)
+		output := readTestReport(t, reportPath)
+		assert.True(t, strings.Contains(output, `<testsuite name="build/local/test" tests="2" failures="1" errors="1" skipped="0" time="2.000">`))
+	})
+
+	t.Run("WritesLogTailOfFailedStage", func(t *testing.T) {
+
+		report := getTestRunReport()
+		reportPath, dir := getTestReportPath(t)
+		defer os.RemoveAll(dir)
+		junitReportWriter := NewJUnitReportWriter()
+
+		// act
+		err := junitReportWriter.WriteReport(context.Background(), report, reportPath)
+
+		assert.Nil(t, err)
+		output := readTestReport(t, reportPath)
+		assert.True(t, strings.Contains(output, `<failure message="stage unit failed with exit code 2">--- FAIL: TestSomething&#xA;FAIL</failure>`))
+		assert.True(t, strings.Contains(output, `<error message="stage got canceled"></error>`))
+		assert.True(t, strings.Contains(output, `<skipped message="stage did not run"></skipped>`))
+	})
+}
+
+func getTestRunReport() *RunReport {
+	exitCode := 2
+	return &RunReport{
+		Target:   "build/local",
+		Status:   StageStatusFailed,
+		Start:    time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC),
+		Duration: 12 * time.Second,
+		Stages: []*StageReport{
+			{
+				Name:     "build",
+				Path:     []string{"build"},
+				Status:   StageStatusPassed,
+				Duration: 10 * time.Second,
+			},
+			{
+				Name:     "test",
+				Path:     []string{"test"},
+				Status:   StageStatusFailed,
+				Duration: 2 * time.Second,
+				Stages: []*StageReport{
+					{
+						Name:     "unit",
+						Path:     []string{"test", "unit"},
+						Status:   StageStatusFailed,
+						Duration: 1 * time.Second,
+						ExitCode: &exitCode,
+						Error:    "stage unit failed with exit code 2",
+						LogTail:  []string{"--- FAIL: TestSomething", "FAIL"},
+					},
+					{
+						Name:     "integration",
+						Path:     []string{"test", "integration"},
+						Status:   StageStatusCanceled,
+						Duration: 1 * time.Second,
+					},
+				},
+			},
+			{
+				Name:   "push",
+				Path:   []string{"push"},
+				Status: StageStatusSkipped,
+			},
+		},
+	}
+}
+
+func getTestReportPath(t *testing.T) (reportPath, dir string) {
+	dir, err := ioutil.TempDir("", "junit")
+	assert.Nil(t, err)
+
+	return filepath.Join(dir, "reports", "junit.xml"), dir
+}
+
+func readTestReport(t *testing.T, reportPath string) string {
+	output, err := ioutil.ReadFile(reportPath)
+	assert.Nil(t, err)
+
+	return string(output)
+}
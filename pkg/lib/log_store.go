@@ -0,0 +1,184 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const logStoreExtension = ".log"
+
+//go:generate mockgen -package=lib -destination ./log_store_mock.go -source=log_store.go
+type LogStore interface {
+	CreateStageLog(ctx context.Context, runID string, stagePath []string) (stageLog io.WriteCloser, err error)
+	GetRunIDs(ctx context.Context) (runIDs []string, err error)
+	GetStagePaths(ctx context.Context, runID string) (stagePaths []string, err error)
+	ReadStageLog(ctx context.Context, runID, stagePath string) (stageLog []byte, err error)
+	Prune(ctx context.Context, retention int) (err error)
+}
+
+type logStore struct {
+	buildDirectory string
+}
+
+// NewLogStore returns a store for stage logs in .infinity/runs/<run-id>/<stage-path>.log of the build directory
+func NewLogStore(buildDirectory string) LogStore {
+	return &logStore{
+		buildDirectory: buildDirectory,
+	}
+}
+
+func (s *logStore) CreateStageLog(ctx context.Context, runID string, stagePath []string) (stageLog io.WriteCloser, err error) {
+	if err = createInfinityDirectory(s.buildDirectory); err != nil {
+		return
+	}
+
+	logPath := filepath.Join(s.getRunDirectory(runID), filepath.Join(stagePath...)+logStoreExtension)
+	if err = os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		return
+	}
+
+	file, err := os.Create(logPath)
+	if err != nil {
+		return
+	}
+
+	return &stageLogFile{
+		file:  file,
+		mutex: &sync.Mutex{},
+	}, nil
+}
+
+// GetRunIDs returns the ids of runs with logs, oldest first
+func (s *logStore) GetRunIDs(ctx context.Context) (runIDs []string, err error) {
+	entries, err := ioutil.ReadDir(s.getRunsDirectory())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return
+	}
+
+	for _, e := range entries {
+		if e.IsDir() {
+			runIDs = append(runIDs, e.Name())
+		}
+	}
+	sort.Strings(runIDs)
+
+	return
+}
+
+func (s *logStore) GetStagePaths(ctx context.Context, runID string) (stagePaths []string, err error) {
+	runDirectory := s.getRunDirectory(runID)
+	if _, err = os.Stat(runDirectory); err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("run %v has no logs", runID)
+		}
+		return
+	}
+
+	err = filepath.Walk(runDirectory, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(path, logStoreExtension) {
+			return nil
+		}
+
+		relativePath, err := filepath.Rel(runDirectory, path)
+		if err != nil {
+			return err
+		}
+		stagePaths = append(stagePaths, filepath.ToSlash(strings.TrimSuffix(relativePath, logStoreExtension)))
+
+		return nil
+	})
+
+	return
+}
+
+func (s *logStore) ReadStageLog(ctx context.Context, runID, stagePath string) (stageLog []byte, err error) {
+	stageLog, err = ioutil.ReadFile(filepath.Join(s.getRunDirectory(runID), filepath.FromSlash(stagePath)+logStoreExtension))
+	if err != nil && os.IsNotExist(err) {
+		return nil, fmt.Errorf("run %v has no logs for stage %v", runID, stagePath)
+	}
+
+	return
+}
+
+// Prune removes the logs of all but the most recent runs
+func (s *logStore) Prune(ctx context.Context, retention int) (err error) {
+	runIDs, err := s.GetRunIDs(ctx)
+	if err != nil || len(runIDs) <= retention {
+		return
+	}
+
+	for _, runID := range runIDs[:len(runIDs)-retention] {
+		if err = os.RemoveAll(s.getRunDirectory(runID)); err != nil {
+			return
+		}
+	}
+
+	return nil
+}
+
+func (s *logStore) getRunsDirectory() string {
+	return filepath.Join(s.buildDirectory, ".infinity", "runs")
+}
+
+func (s *logStore) getRunDirectory(runID string) string {
+	return filepath.Join(s.getRunsDirectory(), runID)
+}
+
+// createInfinityDirectory creates the .infinity directory with a .gitignore, so run logs and history don't get committed by accident
+func createInfinityDirectory(buildDirectory string) (err error) {
+	infinityDirectory := filepath.Join(buildDirectory, ".infinity")
+	if err = os.MkdirAll(infinityDirectory, 0755); err != nil {
+		return
+	}
+
+	gitignorePath := filepath.Join(infinityDirectory, ".gitignore")
+	if _, err = os.Stat(gitignorePath); err == nil || !os.IsNotExist(err) {
+		return
+	}
+
+	return ioutil.WriteFile(gitignorePath, []byte("*\n"), 0644)
+}
+
+// stageLogFile prefixes each line with a timestamp
+type stageLogFile struct {
+	file  *os.File
+	mutex *sync.Mutex
+}
+
+func (f *stageLogFile) Write(p []byte) (n int, err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	timestamp := time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
+	for _, line := range strings.SplitAfter(string(p), "\n") {
+		if line == "" {
+			continue
+		}
+		if !strings.HasSuffix(line, "\n") {
+			line += "\n"
+		}
+		if _, err = f.file.WriteString(fmt.Sprintf("%v %v", timestamp, line)); err != nil {
+			return
+		}
+	}
+
+	return len(p), nil
+}
+
+func (f *stageLogFile) Close() error {
+	return f.file.Close()
+}
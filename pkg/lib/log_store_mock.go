@@ -0,0 +1,110 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: log_store.go
+
+// Package lib is a generated GoMock package.
+package lib
+
+import (
+	context "context"
+	io "io"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockLogStore is a mock of LogStore interface.
+type MockLogStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockLogStoreMockRecorder
+}
+
+// MockLogStoreMockRecorder is the mock recorder for MockLogStore.
+type MockLogStoreMockRecorder struct {
+	mock *MockLogStore
+}
+
+// NewMockLogStore creates a new mock instance.
+func NewMockLogStore(ctrl *gomock.Controller) *MockLogStore {
+	mock := &MockLogStore{ctrl: ctrl}
+	mock.recorder = &MockLogStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockLogStore) EXPECT() *MockLogStoreMockRecorder {
+	return m.recorder
+}
+
+// CreateStageLog mocks base method.
+func (m *MockLogStore) CreateStageLog(ctx context.Context, runID string, stagePath []string) (io.WriteCloser, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateStageLog", ctx, runID, stagePath)
+	ret0, _ := ret[0].(io.WriteCloser)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateStageLog indicates an expected call of CreateStageLog.
+func (mr *MockLogStoreMockRecorder) CreateStageLog(ctx, runID, stagePath interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateStageLog", reflect.TypeOf((*MockLogStore)(nil).CreateStageLog), ctx, runID, stagePath)
+}
+
+// GetRunIDs mocks base method.
+func (m *MockLogStore) GetRunIDs(ctx context.Context) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRunIDs", ctx)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRunIDs indicates an expected call of GetRunIDs.
+func (mr *MockLogStoreMockRecorder) GetRunIDs(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRunIDs", reflect.TypeOf((*MockLogStore)(nil).GetRunIDs), ctx)
+}
+
+// GetStagePaths mocks base method.
+func (m *MockLogStore) GetStagePaths(ctx context.Context, runID string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetStagePaths", ctx, runID)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetStagePaths indicates an expected call of GetStagePaths.
+func (mr *MockLogStoreMockRecorder) GetStagePaths(ctx, runID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStagePaths", reflect.TypeOf((*MockLogStore)(nil).GetStagePaths), ctx, runID)
+}
+
+// Prune mocks base method.
+func (m *MockLogStore) Prune(ctx context.Context, retention int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Prune", ctx, retention)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Prune indicates an expected call of Prune.
+func (mr *MockLogStoreMockRecorder) Prune(ctx, retention interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Prune", reflect.TypeOf((*MockLogStore)(nil).Prune), ctx, retention)
+}
+
+// ReadStageLog mocks base method.
+func (m *MockLogStore) ReadStageLog(ctx context.Context, runID, stagePath string) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadStageLog", ctx, runID, stagePath)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadStageLog indicates an expected call of ReadStageLog.
+func (mr *MockLogStoreMockRecorder) ReadStageLog(ctx, runID, stagePath interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadStageLog", reflect.TypeOf((*MockLogStore)(nil).ReadStageLog), ctx, runID, stagePath)
+}
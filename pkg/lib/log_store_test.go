@@ -0,0 +1,108 @@
+package lib
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestLogStore(t *testing.T) {
+	t.Run("WritesStageLogWithTimestamps", func(t *testing.T) {
+
+		dir := getTestLogStoreDirectory(t)
+		defer os.RemoveAll(dir)
+		logStore := NewLogStore(dir)
+
+		// act
+		stageLog, err := logStore.CreateStageLog(context.Background(), "20210601-120000.000-abcd", []string{"parallel", "unit-test"})
+		assert.Nil(t, err)
+		_, err = stageLog.Write([]byte("ok\nFAIL\n"))
+		assert.Nil(t, err)
+		assert.Nil(t, stageLog.Close())
+
+		output, err := logStore.ReadStageLog(context.Background(), "20210601-120000.000-abcd", "parallel/unit-test")
+		assert.Nil(t, err)
+		assert.True(t, regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}\.\d{3}Z ok\n\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}\.\d{3}Z FAIL\n$`).Match(output))
+	})
+
+	t.Run("IgnoresInfinityDirectoryInGit", func(t *testing.T) {
+
+		dir := getTestLogStoreDirectory(t)
+		defer os.RemoveAll(dir)
+		logStore := NewLogStore(dir)
+
+		// act
+		stageLog, err := logStore.CreateStageLog(context.Background(), "20210601-120000.000-abcd", []string{"build"})
+		assert.Nil(t, err)
+		assert.Nil(t, stageLog.Close())
+
+		gitignore, err := ioutil.ReadFile(filepath.Join(dir, ".infinity", ".gitignore"))
+		assert.Nil(t, err)
+		assert.Equal(t, "*\n", string(gitignore))
+	})
+
+	t.Run("ReturnsStagePathsOfRun", func(t *testing.T) {
+
+		dir := getTestLogStoreDirectory(t)
+		defer os.RemoveAll(dir)
+		logStore := NewLogStore(dir)
+		createTestStageLogs(t, logStore, "20210601-120000.000-abcd", []string{"build"}, []string{"parallel", "unit-test"})
+
+		// act
+		stagePaths, err := logStore.GetStagePaths(context.Background(), "20210601-120000.000-abcd")
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"build", "parallel/unit-test"}, stagePaths)
+	})
+
+	t.Run("PruneKeepsMostRecentRuns", func(t *testing.T) {
+
+		dir := getTestLogStoreDirectory(t)
+		defer os.RemoveAll(dir)
+		logStore := NewLogStore(dir)
+		createTestStageLogs(t, logStore, "20210601-120000.000-abcd", []string{"build"})
+		createTestStageLogs(t, logStore, "20210602-120000.000-abcd", []string{"build"})
+		createTestStageLogs(t, logStore, "20210603-120000.000-abcd", []string{"build"})
+
+		// act
+		err := logStore.Prune(context.Background(), 2)
+
+		assert.Nil(t, err)
+		runIDs, err := logStore.GetRunIDs(context.Background())
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"20210602-120000.000-abcd", "20210603-120000.000-abcd"}, runIDs)
+	})
+
+	t.Run("ReturnsNoRunIDsIfThereAreNoLogs", func(t *testing.T) {
+
+		dir := getTestLogStoreDirectory(t)
+		defer os.RemoveAll(dir)
+		logStore := NewLogStore(dir)
+
+		// act
+		runIDs, err := logStore.GetRunIDs(context.Background())
+
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(runIDs))
+	})
+}
+
+func getTestLogStoreDirectory(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "logs")
+	assert.Nil(t, err)
+
+	return dir
+}
+
+func createTestStageLogs(t *testing.T, logStore LogStore, runID string, stagePaths ...[]string) {
+	for _, p := range stagePaths {
+		stageLog, err := logStore.CreateStageLog(context.Background(), runID, p)
+		assert.Nil(t, err)
+		assert.Nil(t, stageLog.Close())
+	}
+}
@@ -2,13 +2,19 @@ package lib
 
 import (
 	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
 type Manifest struct {
-	Metadata ManifestMetadata  `yaml:"metadata,omitempty" json:"metadata,omitempty"`
-	Env      map[string]string `yaml:"env,omitempty" json:"env,omitempty"`
-	Targets  []*ManifestTarget `yaml:"targets,omitempty" json:"targets,omitempty"`
+	Metadata   ManifestMetadata    `yaml:"metadata,omitempty" json:"metadata,omitempty"`
+	Env        map[string]string   `yaml:"env,omitempty" json:"env,omitempty"`
+	EnvFile    []string            `yaml:"envFile,omitempty" json:"envFile,omitempty"`
+	Secrets    []*ManifestSecret   `yaml:"secrets,omitempty" json:"secrets,omitempty"`
+	Registries []*ManifestRegistry `yaml:"registries,omitempty" json:"registries,omitempty"`
+	Targets    []*ManifestTarget   `yaml:"targets,omitempty" json:"targets,omitempty"`
+	node       manifestNode        `yaml:"-" json:"-"`
 }
 
 func (m *Manifest) SetDefault() {
@@ -19,49 +25,324 @@ func (m *Manifest) SetDefault() {
 	}
 }
 
-func (m *Manifest) Validate() (warnings []string, errors []error) {
+func (m *Manifest) GetSecret(name string) *ManifestSecret {
+	for _, s := range m.Secrets {
+		if s.Name == name {
+			return s
+		}
+	}
+
+	return nil
+}
+
+// GetRegistry returns the registry credentials configured for the registry of an image, or nil to pull it with the docker login of the host
+func (m *Manifest) GetRegistry(image string) *ManifestRegistry {
+	host := getImageRegistry(image)
+	for _, r := range m.Registries {
+		if getRegistryHost(r.Host) == host {
+			return r
+		}
+	}
+
+	return nil
+}
+
+// GetTarget returns the target with the name, or an error listing the available targets
+func (m *Manifest) GetTarget(name string) (*ManifestTarget, error) {
+	targetNames := []string{}
+	for _, t := range m.Targets {
+		if t.Name == name {
+			return t, nil
+		}
+		targetNames = append(targetNames, t.Name)
+	}
+
+	if len(targetNames) == 0 {
+		return nil, fmt.Errorf("Target %v is not defined in manifest; it has no targets", name)
+	}
+
+	return nil, fmt.Errorf("Target %v is not defined in manifest; available targets are %v, run 'infinity list' to see their stages", name, strings.Join(targetNames, ", "))
+}
+
+func (m *Manifest) Validate() (warnings []error, errors []error) {
 
 	w, e := m.Metadata.Validate()
 	warnings = append(warnings, w...)
 	errors = append(errors, e...)
 
+	secretNames := map[string]bool{}
+	for _, s := range m.Secrets {
+		w, e := s.Validate()
+		warnings = append(warnings, w...)
+		errors = append(errors, e...)
+
+		if s.Name != "" && secretNames[s.Name] {
+			errors = append(errors, newManifestError(s.node.getPosition("name"), "[secret %v] secret name is not unique; please rename one of the secrets", s.Name))
+		}
+		secretNames[s.Name] = true
+	}
+
+	registryHosts := map[string]bool{}
+	for _, r := range m.Registries {
+		w, e := r.Validate()
+		warnings = append(warnings, w...)
+		errors = append(errors, e...)
+
+		if r.Secret != "" && m.GetSecret(r.Secret) == nil {
+			errors = append(errors, newManifestError(r.node.getPosition("secret"), "[registry %v] secret %v is not defined; please add it to 'secrets'", r.Host, r.Secret))
+		}
+		if r.Host != "" && registryHosts[r.Host] {
+			errors = append(errors, newManifestError(r.node.getPosition("host"), "[registry %v] registry host is not unique; please remove one of the registries", r.Host))
+		}
+		registryHosts[r.Host] = true
+	}
+
 	for _, t := range m.Targets {
 		w, e := t.Validate()
 		warnings = append(warnings, w...)
 		errors = append(errors, e...)
+
+		errors = append(errors, m.validateStageSecrets(t.Stages)...)
+	}
+
+	return
+}
+
+func (m *Manifest) validateStageSecrets(stages []*ManifestStage, prefixes ...string) (errors []error) {
+	for _, s := range stages {
+		stagePrefixes := append(prefixes, s.Name)
+		prefix := strings.Join(stagePrefixes, "] [")
+
+		for _, ss := range s.Secrets {
+			if ss.Name != "" && m.GetSecret(ss.Name) == nil {
+				errors = append(errors, newManifestError(ss.node.position, "[%v] secret %v is not defined; please add it to 'secrets'", prefix, ss.Name))
+			}
+		}
+
+		errors = append(errors, m.validateStageSecrets(s.Stages, stagePrefixes...)...)
 	}
 
 	return
 }
 
 type ManifestMetadata struct {
-	ApplicationType ApplicationType `yaml:"type,omitempty" json:"type,omitempty"`
-	Language        Language        `yaml:"language,omitempty" json:"language,omitempty"`
-	Name            string          `yaml:"name,omitempty" json:"name,omitempty"`
+	Name            string           `yaml:"name,omitempty" json:"name,omitempty"`
+	ApplicationType ApplicationType  `yaml:"type,omitempty" json:"type,omitempty"`
+	Language        Language         `yaml:"language,omitempty" json:"language,omitempty"`
+	Version         *ManifestVersion `yaml:"version,omitempty" json:"version,omitempty"`
+	node            manifestNode     `yaml:"-" json:"-"`
 }
 
 func (m *ManifestMetadata) SetDefault() {
-
+	if m.Version != nil {
+		m.Version.SetDefault()
+	}
 }
 
-func (m *ManifestMetadata) Validate() (warnings []string, errors []error) {
+func (m *ManifestMetadata) Validate() (warnings []error, errors []error) {
 	if !m.ApplicationType.IsSupported() {
-		errors = append(errors, fmt.Errorf("application is unknown; set to a supported application type with 'type: %v'", strings.Join(SupportedApplicationTypes.ToStringArray(), "|")))
+		errors = append(errors, newManifestError(m.node.getPosition("type"), "application is unknown; set to a supported application type with 'type: %v'", strings.Join(SupportedApplicationTypes.ToStringArray(), "|")))
 	}
 	if !m.Language.IsSupported() {
-		errors = append(errors, fmt.Errorf("language is unknown; set to a supported language with 'language: %v'", strings.Join(SupportedLanguages.ToStringArray(), "|")))
+		errors = append(errors, newManifestError(m.node.getPosition("language"), "language is unknown; set to a supported language with 'language: %v'", strings.Join(SupportedLanguages.ToStringArray(), "|")))
 	}
 	if m.Name == "" {
-		errors = append(errors, fmt.Errorf("application has no name; please set 'name: <name>'"))
+		errors = append(errors, newManifestError(m.node.getPosition("name"), "application has no name; please set 'name: <name>'"))
+	}
+	if m.Version != nil {
+		w, e := m.Version.Validate()
+		warnings = append(warnings, w...)
+		errors = append(errors, e...)
+	}
+
+	return
+}
+
+type VersionPatch string
+
+const (
+	VersionPatchUnknown VersionPatch = ""
+	VersionPatchCommits VersionPatch = "commits"
+	VersionPatchTag     VersionPatch = "tag"
+)
+
+type ManifestVersion struct {
+	Major           int          `yaml:"major,omitempty" json:"major,omitempty"`
+	Minor           int          `yaml:"minor,omitempty" json:"minor,omitempty"`
+	Patch           VersionPatch `yaml:"patch,omitempty" json:"patch,omitempty"`
+	Label           string       `yaml:"label,omitempty" json:"label,omitempty"`
+	ReleaseBranches []string     `yaml:"releaseBranches,omitempty" json:"releaseBranches,omitempty"`
+	node            manifestNode `yaml:"-" json:"-"`
+}
+
+func (v *ManifestVersion) SetDefault() {
+	if v.Patch == VersionPatchUnknown {
+		v.Patch = VersionPatchCommits
+	}
+	if v.Label == "" {
+		v.Label = "{{branch}}"
+	}
+	if len(v.ReleaseBranches) == 0 {
+		v.ReleaseBranches = []string{"main", "master"}
+	}
+}
+
+func (v *ManifestVersion) Validate() (warnings []error, errors []error) {
+	if v.Major < 0 || v.Minor < 0 {
+		key := "major"
+		if v.Major >= 0 {
+			key = "minor"
+		}
+		errors = append(errors, newManifestError(v.node.getPosition(key), "[version] major and minor can't be negative; please set 'major: <number>' and 'minor: <number>'"))
+	}
+	if v.Patch != VersionPatchCommits && v.Patch != VersionPatchTag {
+		errors = append(errors, newManifestError(v.node.getPosition("patch"), "[version] patch is unknown; please set 'patch: %v|%v'", VersionPatchCommits, VersionPatchTag))
+	}
+
+	return
+}
+
+// GetVersion returns the semantic version for the git state; the patch is either the number of commits or follows the latest tag for the major and minor version, and branches other than the release branches get a pre-release label
+func (v *ManifestVersion) GetVersion(gitInfo GitInfo, commitCount int, tags []string) string {
+	version := fmt.Sprintf("%v.%v.%v", v.Major, v.Minor, v.getPatch(gitInfo, commitCount, tags))
+
+	if stringArrayContains(v.ReleaseBranches, gitInfo.Branch) {
+		return version
+	}
+	// a tagged detached head, as checked out for a release, needs no label either
+	if gitInfo.Branch == "" && gitInfo.Tag != "" {
+		return version
+	}
+
+	label := v.getLabel(gitInfo)
+	if label == "" {
+		return version
+	}
+
+	return version + "-" + label
+}
+
+func (v *ManifestVersion) getPatch(gitInfo GitInfo, commitCount int, tags []string) int {
+	if v.Patch != VersionPatchTag {
+		return commitCount
+	}
+
+	// find the highest patch released for this major and minor version
+	prefix := fmt.Sprintf("%v.%v.", v.Major, v.Minor)
+	latestPatch := -1
+	headPatch := -1
+	for _, t := range tags {
+		trimmedTag := strings.TrimPrefix(t, "v")
+		if !strings.HasPrefix(trimmedTag, prefix) {
+			continue
+		}
+		patch, err := strconv.Atoi(strings.TrimPrefix(trimmedTag, prefix))
+		if err != nil {
+			continue
+		}
+		if patch > latestPatch {
+			latestPatch = patch
+		}
+		if t == gitInfo.Tag {
+			headPatch = patch
+		}
+	}
+
+	// a tagged commit keeps the version of its tag, any other commit leads up to the next patch
+	if headPatch >= 0 {
+		return headPatch
+	}
+
+	return latestPatch + 1
+}
+
+func (v *ManifestVersion) getLabel(gitInfo GitInfo) string {
+	branch := gitInfo.Branch
+	if branch == "" {
+		branch = gitInfo.ShortRevision
+	}
+
+	label := strings.NewReplacer("{{branch}}", branch, "{{shortRevision}}", gitInfo.ShortRevision).Replace(v.Label)
+
+	// only alphanumerics and hyphens are allowed in a pre-release label
+	label = invalidVersionLabelCharacters.ReplaceAllString(label, "-")
+
+	return strings.Trim(label, "-")
+}
+
+var invalidVersionLabelCharacters = regexp.MustCompile("[^a-zA-Z0-9-]+")
+
+type ManifestSecret struct {
+	Name          string       `yaml:"name,omitempty" json:"name,omitempty"`
+	Env           string       `yaml:"env,omitempty" json:"env,omitempty"`
+	File          string       `yaml:"file,omitempty" json:"file,omitempty"`
+	EncryptedFile string       `yaml:"encryptedFile,omitempty" json:"encryptedFile,omitempty"`
+	node          manifestNode `yaml:"-" json:"-"`
+}
+
+func (s *ManifestSecret) Validate() (warnings []error, errors []error) {
+	if s.Name == "" {
+		errors = append(errors, newManifestError(s.node.position, "secret has no name; please set 'name: <name>'"))
+		return
+	}
+
+	sources := 0
+	for _, v := range []string{s.Env, s.File, s.EncryptedFile} {
+		if v != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		errors = append(errors, newManifestError(s.node.position, "[secret %v] secret needs exactly one source; please set one of 'env: <envvar>', 'file: <path>' or 'encryptedFile: <path>'", s.Name))
+	}
+
+	return
+}
+
+type ManifestRegistry struct {
+	Host             string       `yaml:"host,omitempty" json:"host,omitempty"`
+	Username         string       `yaml:"username,omitempty" json:"username,omitempty"`
+	Secret           string       `yaml:"secret,omitempty" json:"secret,omitempty"`
+	Env              string       `yaml:"env,omitempty" json:"env,omitempty"`
+	Command          string       `yaml:"command,omitempty" json:"command,omitempty"`
+	CredentialHelper string       `yaml:"credentialHelper,omitempty" json:"credentialHelper,omitempty"`
+	node             manifestNode `yaml:"-" json:"-"`
+}
+
+func (r *ManifestRegistry) Validate() (warnings []error, errors []error) {
+	if r.Host == "" {
+		errors = append(errors, newManifestError(r.node.position, "registry has no host; please set 'host: <registry host>'"))
+		return
+	}
+
+	sources := 0
+	for _, v := range []string{r.Secret, r.Env, r.Command, r.CredentialHelper} {
+		if v != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		errors = append(errors, newManifestError(r.node.position, "[registry %v] registry needs exactly one source for its password; please set one of 'secret: <secret name>', 'env: <envvar>', 'command: <command>' or 'credentialHelper: <helper>'", r.Host))
+	}
+	if r.Username == "" && r.CredentialHelper == "" {
+		errors = append(errors, newManifestError(r.node.position, "[registry %v] registry has no username; please set 'username: <username>'", r.Host))
+	}
+	if r.Username != "" && r.CredentialHelper != "" {
+		warnings = append(warnings, newManifestError(r.node.getPosition("username"), "[registry %v] username is provided by the credential helper; you might want to remove 'username: %v'", r.Host, r.Username))
+	}
+	if strings.Contains(r.Host, "/") {
+		errors = append(errors, newManifestError(r.node.getPosition("host"), "[registry %v] registry host has a path; please set only the host, like 'host: registry.example.com'", r.Host))
 	}
 
 	return
 }
 
 type ManifestTarget struct {
-	Name   string            `yaml:"name,omitempty" json:"name,omitempty"`
-	Env    map[string]string `yaml:"env,omitempty" json:"env,omitempty"`
-	Stages []*ManifestStage  `yaml:"stages,omitempty" json:"stages,omitempty"`
+	Name    string            `yaml:"name,omitempty" json:"name,omitempty"`
+	Env     map[string]string `yaml:"env,omitempty" json:"env,omitempty"`
+	EnvFile []string          `yaml:"envFile,omitempty" json:"envFile,omitempty"`
+	Stages  []*ManifestStage  `yaml:"stages,omitempty" json:"stages,omitempty"`
+	node    manifestNode      `yaml:"-" json:"-"`
 }
 
 func (b *ManifestTarget) SetDefault() {
@@ -70,13 +351,13 @@ func (b *ManifestTarget) SetDefault() {
 	}
 }
 
-func (b *ManifestTarget) Validate() (warnings []string, errors []error) {
+func (b *ManifestTarget) Validate() (warnings []error, errors []error) {
 	if b.Name == "" {
-		errors = append(errors, fmt.Errorf("target has no name; please set 'name: <name>'"))
+		errors = append(errors, newManifestError(b.node.position, "target has no name; please set 'name: <name>'"))
 	}
 
 	if len(b.Stages) == 0 {
-		errors = append(errors, fmt.Errorf("manifest has no stages; define at least stage through 'build.stages'"))
+		errors = append(errors, newManifestError(b.node.getPosition("stages"), "manifest has no stages; define at least stage through 'build.stages'"))
 	}
 
 	for _, s := range b.Stages {
@@ -92,24 +373,33 @@ type ManifestStage struct {
 	Name                  string                 `yaml:"name,omitempty" json:"name,omitempty"`
 	RunnerType            RunnerType             `yaml:"runner,omitempty" json:"runner,omitempty"`
 	Image                 string                 `yaml:"image,omitempty" json:"image,omitempty"`
+	PullPolicy            PullPolicy             `yaml:"pullPolicy,omitempty" json:"pullPolicy,omitempty"`
 	Background            bool                   `yaml:"background,omitempty" json:"background,omitempty"`
 	Privileged            bool                   `yaml:"privileged,omitempty" json:"privileged,omitempty"`
 	MountWorkingDirectory *bool                  `yaml:"mount,omitempty" json:"mount,omitempty"`
 	WorkingDirectory      string                 `yaml:"work,omitempty" json:"work,omitempty"`
 	Volumes               []string               `yaml:"volumes,omitempty" json:"volumes,omitempty"`
 	Devices               []string               `yaml:"devices,omitempty" json:"devices,omitempty"`
+	Resources             *ManifestResources     `yaml:"resources,omitempty" json:"resources,omitempty"`
+	Ulimits               []string               `yaml:"ulimits,omitempty" json:"ulimits,omitempty"`
 	Env                   map[string]string      `yaml:"env,omitempty" json:"env,omitempty"`
+	EnvFile               []string               `yaml:"envFile,omitempty" json:"envFile,omitempty"`
+	Secrets               []*ManifestStageSecret `yaml:"secrets,omitempty" json:"secrets,omitempty"`
 	Shell                 string                 `yaml:"shell,omitempty" json:"shell,omitempty"`
 	Commands              []string               `yaml:"commands,omitempty" json:"commands,omitempty"`
 	Stages                []*ManifestStage       `yaml:"stages,omitempty" json:"stages,omitempty"`
 	Parameters            map[string]interface{} `yaml:",inline"`
 	colorCode             uint8                  `yaml:"-" json:"-"`
+	node                  manifestNode           `yaml:"-" json:"-"`
 }
 
 func (s *ManifestStage) SetDefault() {
 	if s.RunnerType == RunnerTypeUnknown {
 		s.RunnerType = RunnerTypeContainer
 	}
+	if s.RunnerType == RunnerTypeContainer && s.PullPolicy == PullPolicyUnknown {
+		s.PullPolicy = PullPolicyIfNotPresent
+	}
 	if s.MountWorkingDirectory == nil {
 		defaultValue := true
 		s.MountWorkingDirectory = &defaultValue
@@ -123,12 +413,15 @@ func (s *ManifestStage) SetDefault() {
 	if s.Shell == "" {
 		s.Shell = "/bin/sh"
 	}
+	for _, ss := range s.Secrets {
+		ss.SetDefault()
+	}
 	for _, st := range s.Stages {
 		st.SetDefault()
 	}
 }
 
-func (s *ManifestStage) Validate(prefixes ...string) (warnings []string, errors []error) {
+func (s *ManifestStage) Validate(prefixes ...string) (warnings []error, errors []error) {
 
 	if s.Name != "" {
 		prefixes = append(prefixes, s.Name)
@@ -139,30 +432,65 @@ func (s *ManifestStage) Validate(prefixes ...string) (warnings []string, errors
 	prefix := strings.Join(prefixes, "] [")
 
 	if s.Name == "" {
-		errors = append(errors, fmt.Errorf("[%v] stage has no name; please set 'name: <name>'", prefix))
+		errors = append(errors, newManifestError(s.node.position, "[%v] stage has no name; please set 'name: <name>'", prefix))
 	}
 	if len(s.Stages) == 0 {
 		if s.MountWorkingDirectory == nil {
-			errors = append(errors, fmt.Errorf("[%v] mount has no value; please set 'mountWork: true|false'", prefix))
+			errors = append(errors, newManifestError(s.node.getPosition("mount"), "[%v] mount has no value; please set 'mountWork: true|false'", prefix))
 		}
 		if s.WorkingDirectory == "" {
-			errors = append(errors, fmt.Errorf("[%v] work has no value; please set 'work: <working directory>'", prefix))
+			errors = append(errors, newManifestError(s.node.getPosition("work"), "[%v] work has no value; please set 'work: <working directory>'", prefix))
 		}
 		if s.RunnerType == RunnerTypeUnknown {
-			errors = append(errors, fmt.Errorf("[%v] unknown runner; please set 'runner: %v'", prefix, strings.Join(SupportedRunnerTypes.ToStringArray(), "|")))
+			errors = append(errors, newManifestError(s.node.getPosition("runner"), "[%v] unknown runner; please set 'runner: %v'", prefix, strings.Join(SupportedRunnerTypes.ToStringArray(), "|")))
 		}
 		if len(s.Commands) == 0 && !s.Background {
-			warnings = append(warnings, fmt.Sprintf("[%v] stage has no commands; you might want to define at least one command through 'commands'", prefix))
+			warnings = append(warnings, newManifestError(s.node.position, "[%v] stage has no commands; you might want to define at least one command through 'commands'", prefix))
+		}
+
+		for _, ss := range s.Secrets {
+			if ss.Name == "" {
+				errors = append(errors, newManifestError(ss.node.position, "[%v] stage secret has no name; please set 'secrets: [<name>]'", prefix))
+			}
+			if ss.Env != "" && ss.File != "" {
+				errors = append(errors, newManifestError(ss.node.position, "[%v] stage secret %v has both env and file; please set either 'env: <envvar>' or 'file: <path>'", prefix, ss.Name))
+			}
+			if ss.File != "" && s.RunnerType == RunnerTypeHost {
+				errors = append(errors, newManifestError(ss.node.getPosition("file"), "[%v] stage secret %v has file which is not supported in combination with 'runner: host'; please use 'env: <envvar>' instead", prefix, ss.Name))
+			}
+			if ss.File != "" && !strings.HasPrefix(ss.File, "/") && !strings.HasPrefix(ss.File, "~/") {
+				errors = append(errors, newManifestError(ss.node.getPosition("file"), "[%v] stage secret %v has relative file path; please set an absolute path with 'file: <path>'", prefix, ss.Name))
+			}
 		}
 
 		switch s.RunnerType {
 		case RunnerTypeContainer:
 			if s.Image == "" {
-				errors = append(errors, fmt.Errorf("[%v] stage has no image; please set 'image: <image>'", prefix))
+				errors = append(errors, newManifestError(s.node.position, "[%v] stage has no image; please set 'image: <image>'", prefix))
+			}
+			if !s.PullPolicy.IsSupported() {
+				errors = append(errors, newManifestError(s.node.getPosition("pullPolicy"), "[%v] unknown pull policy %v; please set 'pullPolicy: %v'", prefix, s.PullPolicy, strings.Join(SupportedPullPolicies.ToStringArray(), "|")))
+			}
+			if s.Resources != nil {
+				errors = append(errors, s.Resources.Validate(prefix)...)
+			}
+			for _, u := range s.Ulimits {
+				if err := validateUlimit(u); err != nil {
+					errors = append(errors, newManifestError(s.node.getPosition("ulimits"), "[%v] %v", prefix, err))
+				}
 			}
 		case RunnerTypeHost:
 			if s.Image != "" {
-				errors = append(errors, fmt.Errorf("[%v] stage has image which is not supported in combination with 'runner: host'; please do not set 'image: <image>'", prefix))
+				errors = append(errors, newManifestError(s.node.getPosition("image"), "[%v] stage has image which is not supported in combination with 'runner: host'; please do not set 'image: <image>'", prefix))
+			}
+			if s.PullPolicy != PullPolicyUnknown {
+				warnings = append(warnings, newManifestError(s.node.getPosition("pullPolicy"), "[%v] stage has pullPolicy which has no effect in combination with 'runner: host'; you might want to remove 'pullPolicy: %v'", prefix, s.PullPolicy))
+			}
+			if s.Resources != nil {
+				errors = append(errors, newManifestError(s.node.getPosition("resources"), "[%v] stage has resources which is not supported in combination with 'runner: host'; please do not set 'resources'", prefix))
+			}
+			if len(s.Ulimits) > 0 {
+				errors = append(errors, newManifestError(s.node.getPosition("ulimits"), "[%v] stage has ulimits which is not supported in combination with 'runner: host'; please do not set 'ulimits'", prefix))
 			}
 		}
 	}
@@ -176,3 +504,89 @@ func (s *ManifestStage) Validate(prefixes ...string) (warnings []string, errors
 
 	return
 }
+
+// ManifestResources limits the resources of a stage container, so parallel stages can't starve each other
+type ManifestResources struct {
+	CPUs    float64      `yaml:"cpus,omitempty" json:"cpus,omitempty"`
+	Memory  string       `yaml:"memory,omitempty" json:"memory,omitempty"`
+	PIDs    int          `yaml:"pids,omitempty" json:"pids,omitempty"`
+	ShmSize string       `yaml:"shmSize,omitempty" json:"shmSize,omitempty"`
+	node    manifestNode `yaml:"-" json:"-"`
+}
+
+// byteSizeRegex matches sizes the way docker parses them, like 512m, 4g or 1.5GiB
+var byteSizeRegex = regexp.MustCompile(`^[0-9]+(\.[0-9]+)? ?[bkmgtpBKMGTP]?[iI]?[bB]?$`)
+
+func (r *ManifestResources) Validate(prefix string) (errors []error) {
+	if r.CPUs < 0 {
+		errors = append(errors, newManifestError(r.node.getPosition("cpus"), "[%v] resources cpus %v is negative; please set 'cpus: <number of cpus>', like 1.5", prefix, r.CPUs))
+	}
+	if r.Memory != "" && !byteSizeRegex.MatchString(r.Memory) {
+		errors = append(errors, newManifestError(r.node.getPosition("memory"), "[%v] resources memory %v is not a size; please set 'memory: <size>', like 512m or 4g", prefix, r.Memory))
+	}
+	if r.PIDs < -1 {
+		errors = append(errors, newManifestError(r.node.getPosition("pids"), "[%v] resources pids %v is negative; please set 'pids: <number of processes>', or -1 for unlimited", prefix, r.PIDs))
+	}
+	if r.ShmSize != "" && !byteSizeRegex.MatchString(r.ShmSize) {
+		errors = append(errors, newManifestError(r.node.getPosition("shmSize"), "[%v] resources shmSize %v is not a size; please set 'shmSize: <size>', like 64m or 1g", prefix, r.ShmSize))
+	}
+
+	return
+}
+
+// supportedUlimits are the ulimits docker can set on a container
+var supportedUlimits = []string{"core", "cpu", "data", "fsize", "locks", "memlock", "msgqueue", "nice", "nofile", "nproc", "rss", "rtprio", "rttime", "sigpending", "stack"}
+
+// validateUlimit checks a ulimit in the format of docker's --ulimit flag, <name>=<soft limit>[:<hard limit>]
+func validateUlimit(ulimit string) error {
+	parts := strings.SplitN(ulimit, "=", 2)
+	if len(parts) != 2 || !stringArrayContains(supportedUlimits, parts[0]) {
+		return fmt.Errorf("ulimit %v is invalid; please set '<name>=<soft limit>[:<hard limit>]' with name one of %v", ulimit, strings.Join(supportedUlimits, "|"))
+	}
+
+	limits := strings.SplitN(parts[1], ":", 2)
+	values := []int64{}
+	for _, l := range limits {
+		value, err := strconv.ParseInt(l, 10, 64)
+		if err != nil || value < -1 {
+			return fmt.Errorf("ulimit %v has invalid limit %v; please set a number, or -1 for unlimited", ulimit, l)
+		}
+		values = append(values, value)
+	}
+	if len(values) == 2 && values[1] != -1 && (values[0] == -1 || values[0] > values[1]) {
+		return fmt.Errorf("ulimit %v has a soft limit above its hard limit; please lower the soft limit", ulimit)
+	}
+
+	return nil
+}
+
+type ManifestStageSecret struct {
+	Name string       `yaml:"name,omitempty" json:"name,omitempty"`
+	Env  string       `yaml:"env,omitempty" json:"env,omitempty"`
+	File string       `yaml:"file,omitempty" json:"file,omitempty"`
+	node manifestNode `yaml:"-" json:"-"`
+}
+
+// UnmarshalYAML allows a stage secret to be set by name only, as in 'secrets: [<name>]'
+func (s *ManifestStageSecret) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name string
+	if err := unmarshal(&name); err == nil {
+		s.Name = name
+		return nil
+	}
+
+	type manifestStageSecret ManifestStageSecret
+	var secret manifestStageSecret
+	if err := unmarshal(&secret); err != nil {
+		return err
+	}
+	*s = ManifestStageSecret(secret)
+
+	return nil
+}
+
+func (s *ManifestStageSecret) SetDefault() {
+	if s.Env == "" && s.File == "" {
+		s.Env = ToUpperSnakeCase(s.Name)
+	}
+}
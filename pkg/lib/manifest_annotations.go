@@ -0,0 +1,179 @@
+package lib
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type AnnotationFormat string
+
+const (
+	// AnnotationFormatText writes file:line:column: message lines, as understood by editors and most CI log viewers
+	AnnotationFormatText AnnotationFormat = "text"
+	// AnnotationFormatGitHub writes GitHub Actions workflow commands that annotate the manifest in the pull request
+	AnnotationFormatGitHub AnnotationFormat = "github"
+	// AnnotationFormatGitLab writes a GitLab code quality report to show the findings in the merge request
+	AnnotationFormatGitLab AnnotationFormat = "gitlab"
+)
+
+type annotationFormats []AnnotationFormat
+
+func (annotationFormats annotationFormats) ToStringArray() (result []string) {
+	for _, f := range annotationFormats {
+		result = append(result, string(f))
+	}
+	return
+}
+
+var SupportedAnnotationFormats = annotationFormats{
+	AnnotationFormatText,
+	AnnotationFormatGitHub,
+	AnnotationFormatGitLab,
+}
+
+func (annotationFormat AnnotationFormat) IsSupported() bool {
+	for _, f := range SupportedAnnotationFormats {
+		if annotationFormat == f {
+			return true
+		}
+	}
+	return false
+}
+
+type gitLabCodeQualityIssue struct {
+	Description string                    `json:"description"`
+	CheckName   string                    `json:"check_name"`
+	Fingerprint string                    `json:"fingerprint"`
+	Severity    string                    `json:"severity"`
+	Location    gitLabCodeQualityLocation `json:"location"`
+}
+
+type gitLabCodeQualityLocation struct {
+	Path  string                 `json:"path"`
+	Lines gitLabCodeQualityLines `json:"lines"`
+}
+
+type gitLabCodeQualityLines struct {
+	Begin int `json:"begin"`
+}
+
+// WriteManifestAnnotations writes the warnings and errors from validating a manifest in the annotation format
+func WriteManifestAnnotations(w io.Writer, format AnnotationFormat, filename string, warnings, errors []error) (err error) {
+	switch format {
+	case AnnotationFormatText:
+		for _, e := range warnings {
+			if _, err = fmt.Fprintf(w, "%v: warning: %v\n", getAnnotationPosition(filename, e), getAnnotationMessage(e)); err != nil {
+				return
+			}
+		}
+		for _, e := range errors {
+			if _, err = fmt.Fprintf(w, "%v: error: %v\n", getAnnotationPosition(filename, e), getAnnotationMessage(e)); err != nil {
+				return
+			}
+		}
+
+	case AnnotationFormatGitHub:
+		for _, e := range warnings {
+			if _, err = fmt.Fprintln(w, getGitHubAnnotation("warning", filename, e)); err != nil {
+				return
+			}
+		}
+		for _, e := range errors {
+			if _, err = fmt.Fprintln(w, getGitHubAnnotation("error", filename, e)); err != nil {
+				return
+			}
+		}
+
+	case AnnotationFormatGitLab:
+		issues := []gitLabCodeQualityIssue{}
+		for _, e := range warnings {
+			issues = append(issues, getGitLabCodeQualityIssue("minor", filename, e))
+		}
+		for _, e := range errors {
+			issues = append(issues, getGitLabCodeQualityIssue("major", filename, e))
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(issues)
+
+	default:
+		return fmt.Errorf("annotation format %v is not supported; please use one of %v", format, strings.Join(SupportedAnnotationFormats.ToStringArray(), "|"))
+	}
+
+	return
+}
+
+// getAnnotationPosition returns the position of a manifest error, or just the manifest filename for other errors
+func getAnnotationPosition(filename string, err error) ManifestPosition {
+	var manifestErr *ManifestError
+	if errors.As(err, &manifestErr) && manifestErr.Position.Filename != "" {
+		return manifestErr.Position
+	}
+
+	return ManifestPosition{Filename: filename}
+}
+
+func getAnnotationMessage(err error) string {
+	var manifestErr *ManifestError
+	if errors.As(err, &manifestErr) {
+		return manifestErr.Message
+	}
+
+	return err.Error()
+}
+
+func getGitHubAnnotation(level, filename string, err error) string {
+	position := getAnnotationPosition(filename, err)
+
+	properties := []string{"file=" + escapeGitHubProperty(position.Filename)}
+	if position.Line > 0 {
+		properties = append(properties, fmt.Sprintf("line=%v", position.Line))
+	}
+	if position.Column > 0 {
+		properties = append(properties, fmt.Sprintf("col=%v", position.Column))
+	}
+
+	return fmt.Sprintf("::%v %v::%v", level, strings.Join(properties, ","), escapeGitHubData(getAnnotationMessage(err)))
+}
+
+func escapeGitHubData(value string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(value)
+}
+
+func escapeGitHubProperty(value string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(value)
+}
+
+func getGitLabCodeQualityIssue(severity, filename string, err error) gitLabCodeQualityIssue {
+	position := getAnnotationPosition(filename, err)
+	message := getAnnotationMessage(err)
+
+	line := position.Line
+	if line == 0 {
+		line = 1
+	}
+
+	// the fingerprint leaves out the line, so an issue is still recognized when lines above it change
+	fingerprint := sha256.Sum256([]byte(position.Filename + "\n" + message))
+
+	checkName := "infinity-manifest"
+	var manifestErr *ManifestError
+	if errors.As(err, &manifestErr) && manifestErr.Rule != "" {
+		checkName = "infinity-" + manifestErr.Rule
+	}
+
+	return gitLabCodeQualityIssue{
+		Description: message,
+		CheckName:   checkName,
+		Fingerprint: fmt.Sprintf("%x", fingerprint),
+		Severity:    severity,
+		Location: gitLabCodeQualityLocation{
+			Path:  position.Filename,
+			Lines: gitLabCodeQualityLines{Begin: line},
+		},
+	}
+}
@@ -0,0 +1,91 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestWriteManifestAnnotations(t *testing.T) {
+	warnings := []error{
+		newManifestError(ManifestPosition{Filename: ".infinity.yaml", Line: 8, Column: 5}, "[lint] stage has no commands"),
+	}
+	errs := []error{
+		newManifestError(ManifestPosition{Filename: ".infinity.yaml", Line: 23, Column: 7}, "[build] stage has no image; please set 'image: <image>'"),
+		fmt.Errorf("secret key is missing"),
+	}
+
+	t.Run("WritesFileLineAndColumnForText", func(t *testing.T) {
+
+		var output bytes.Buffer
+
+		// act
+		err := WriteManifestAnnotations(&output, AnnotationFormatText, ".infinity.yaml", warnings, errs)
+
+		assert.Nil(t, err)
+		assert.Equal(t, `.infinity.yaml:8:5: warning: [lint] stage has no commands
+.infinity.yaml:23:7: error: [build] stage has no image; please set 'image: <image>'
+.infinity.yaml: error: secret key is missing
+`, output.String())
+	})
+
+	t.Run("WritesWorkflowCommandsForGitHub", func(t *testing.T) {
+
+		var output bytes.Buffer
+
+		// act
+		err := WriteManifestAnnotations(&output, AnnotationFormatGitHub, ".infinity.yaml", warnings, errs)
+
+		assert.Nil(t, err)
+		assert.Equal(t, `::warning file=.infinity.yaml,line=8,col=5::[lint] stage has no commands
+::error file=.infinity.yaml,line=23,col=7::[build] stage has no image; please set 'image: <image>'
+::error file=.infinity.yaml::secret key is missing
+`, output.String())
+	})
+
+	t.Run("EscapesNewlinesForGitHub", func(t *testing.T) {
+
+		var output bytes.Buffer
+
+		// act
+		err := WriteManifestAnnotations(&output, AnnotationFormatGitHub, "dir,1/.infinity.yaml", nil, []error{fmt.Errorf("line 1\nline 2 at 100%%")})
+
+		assert.Nil(t, err)
+		assert.Equal(t, "::error file=dir%2C1/.infinity.yaml::line 1%0Aline 2 at 100%25\n", output.String())
+	})
+
+	t.Run("WritesCodeQualityReportForGitLab", func(t *testing.T) {
+
+		var output bytes.Buffer
+
+		// act
+		err := WriteManifestAnnotations(&output, AnnotationFormatGitLab, ".infinity.yaml", warnings, errs)
+
+		assert.Nil(t, err)
+		var issues []gitLabCodeQualityIssue
+		err = json.Unmarshal(output.Bytes(), &issues)
+		assert.Nil(t, err)
+		assert.Equal(t, 3, len(issues))
+		assert.Equal(t, "minor", issues[0].Severity)
+		assert.Equal(t, 8, issues[0].Location.Lines.Begin)
+		assert.Equal(t, "major", issues[1].Severity)
+		assert.Equal(t, "[build] stage has no image; please set 'image: <image>'", issues[1].Description)
+		assert.Equal(t, ".infinity.yaml", issues[1].Location.Path)
+		assert.Equal(t, 23, issues[1].Location.Lines.Begin)
+		assert.Equal(t, 1, issues[2].Location.Lines.Begin)
+		assert.NotEqual(t, issues[1].Fingerprint, issues[2].Fingerprint)
+	})
+
+	t.Run("ReturnsErrorForUnsupportedFormat", func(t *testing.T) {
+
+		var output bytes.Buffer
+
+		// act
+		err := WriteManifestAnnotations(&output, AnnotationFormat("xml"), ".infinity.yaml", warnings, errs)
+
+		assert.NotNil(t, err)
+	})
+}
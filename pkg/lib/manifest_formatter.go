@@ -0,0 +1,355 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FormatManifest rewrites a manifest with its keys in the order of the manifest types, two space indentation, sequences at the indentation of their key and a blank line between the top-level keys; comments are kept with the key or item they belong to
+func FormatManifest(manifestBytes []byte) (formattedBytes []byte, err error) {
+	var root yaml.Node
+	if err = yaml.Unmarshal(manifestBytes, &root); err != nil {
+		return nil, err
+	}
+	if root.Kind != yaml.DocumentNode || len(root.Content) == 0 {
+		return manifestBytes, nil
+	}
+
+	// the yaml parser attaches a comment at the end of the manifest to the last top-level key, keep it at the end when keys get reordered
+	footComments := []string{}
+	if content := root.Content[0]; content.Kind == yaml.MappingNode && len(content.Content) > 0 {
+		lastKey := content.Content[len(content.Content)-2]
+		if lastKey.FootComment != "" {
+			footComments = append(footComments, lastKey.FootComment)
+			lastKey.FootComment = ""
+		}
+	}
+	if root.FootComment != "" {
+		footComments = append(footComments, root.FootComment)
+	}
+
+	p := &manifestPrinter{}
+	p.writeComment(root.HeadComment, 0)
+	if root.HeadComment != "" {
+		p.sb.WriteString("\n")
+	}
+	if err = p.writeNode(root.Content[0], reflect.TypeOf(Manifest{}), 0, true); err != nil {
+		return nil, err
+	}
+	if len(footComments) > 0 {
+		p.sb.WriteString("\n")
+		p.writeComment(strings.Join(footComments, "\n\n"), 0)
+	}
+	formattedBytes = []byte(p.sb.String())
+
+	// leave a missing newline at the end of the manifest alone, editors differ in adding it
+	if !bytes.HasSuffix(manifestBytes, []byte("\n")) {
+		formattedBytes = bytes.TrimSuffix(formattedBytes, []byte("\n"))
+	}
+
+	// formatting should never change what the manifest means
+	var original, formatted interface{}
+	if err = yaml.Unmarshal(manifestBytes, &original); err != nil {
+		return nil, err
+	}
+	if err = yaml.Unmarshal(formattedBytes, &formatted); err != nil || !reflect.DeepEqual(original, formatted) {
+		return nil, fmt.Errorf("formatting changed the contents of the manifest; please file an issue with the manifest")
+	}
+
+	return formattedBytes, nil
+}
+
+type manifestPrinter struct {
+	sb strings.Builder
+}
+
+// writeNode writes a node that starts on a new line
+func (p *manifestPrinter) writeNode(node *yaml.Node, t reflect.Type, indent int, topLevel bool) error {
+	switch {
+	case isBlockMapping(node):
+		return p.writeMapping(node, t, indent, false, topLevel)
+	case isBlockSequence(node):
+		return p.writeSequence(node, t, indent, false, false)
+	}
+
+	value, err := p.formatInline(node, indent)
+	if err != nil {
+		return err
+	}
+	p.sb.WriteString(strings.Repeat(" ", indent) + value + formatLineComment(node.LineComment) + "\n")
+
+	return nil
+}
+
+// writeMapping writes the entries of a mapping, with the first one on the current line if it's a sequence item
+func (p *manifestPrinter) writeMapping(node *yaml.Node, t reflect.Type, indent int, inline bool, topLevel bool) error {
+	for i, entry := range getCanonicalEntries(node, t) {
+		key, value := entry[0], entry[1]
+		valueType := getFieldType(t, key.Value)
+
+		if topLevel && i > 0 {
+			p.sb.WriteString("\n")
+		}
+		// the head comment of the first key of a sequence item is written before the dash
+		if !inline || i > 0 {
+			p.writeComment(key.HeadComment, indent)
+			p.sb.WriteString(strings.Repeat(" ", indent))
+		}
+
+		formattedKey, err := p.formatInline(key, indent)
+		if err != nil {
+			return err
+		}
+		p.sb.WriteString(formattedKey + ":")
+
+		switch {
+		case isBlockMapping(value) || isBlockSequence(value):
+			if properties := formatProperties(value); properties != "" {
+				p.sb.WriteString(" " + properties)
+			}
+			p.sb.WriteString(formatLineComment(key.LineComment) + formatLineComment(value.LineComment) + "\n")
+			p.writeComment(value.HeadComment, indent+2)
+
+			if isBlockMapping(value) {
+				err = p.writeMapping(value, valueType, indent+2, false, false)
+			} else {
+				err = p.writeSequence(value, valueType, indent, false, topLevel)
+			}
+			if err != nil {
+				return err
+			}
+
+		default:
+			formattedValue, err := p.formatInline(value, indent)
+			if err != nil {
+				return err
+			}
+			if formattedValue != "" {
+				p.sb.WriteString(" " + formattedValue)
+			}
+			p.sb.WriteString(formatLineComment(key.LineComment) + formatLineComment(value.LineComment) + "\n")
+		}
+
+		p.writeComment(value.FootComment, indent)
+		p.writeComment(key.FootComment, indent)
+	}
+
+	return nil
+}
+
+// writeSequence writes the items of a sequence prefixed with a dash, at the indentation of the key it belongs to; items of top-level keys, like targets, get separated by a blank line
+func (p *manifestPrinter) writeSequence(node *yaml.Node, t reflect.Type, indent int, inline bool, topLevel bool) error {
+	itemType := getElemType(t)
+
+	for i, item := range node.Content {
+		if topLevel && i > 0 && isBlockMapping(item) {
+			p.sb.WriteString("\n")
+		}
+		if !inline || i > 0 {
+			p.writeComment(item.HeadComment, indent)
+			if isBlockMapping(item) && item.Anchor == "" {
+				p.writeComment(getCanonicalEntries(item, itemType)[0][0].HeadComment, indent)
+			}
+			p.sb.WriteString(strings.Repeat(" ", indent))
+		}
+		p.sb.WriteString("- ")
+
+		var err error
+		switch {
+		case (isBlockMapping(item) || isBlockSequence(item)) && item.Anchor != "":
+			p.sb.WriteString(formatProperties(item) + formatLineComment(item.LineComment) + "\n")
+			err = p.writeNode(item, itemType, indent+2, false)
+		case isBlockMapping(item):
+			err = p.writeMapping(item, itemType, indent+2, true, false)
+		case isBlockSequence(item):
+			err = p.writeSequence(item, itemType, indent+2, true, false)
+		default:
+			var value string
+			value, err = p.formatInline(item, indent)
+			p.sb.WriteString(value + formatLineComment(item.LineComment) + "\n")
+		}
+		if err != nil {
+			return err
+		}
+
+		p.writeComment(item.FootComment, indent)
+	}
+
+	return nil
+}
+
+// formatInline formats scalars, aliases, flow style and empty collections, which start on the line of their key or dash; block scalars continue on the next lines, indented relative to the key or dash
+func (p *manifestPrinter) formatInline(node *yaml.Node, indent int) (string, error) {
+	if node.Kind == yaml.AliasNode {
+		return "*" + node.Value, nil
+	}
+
+	// the yaml encoder takes care of quoting, block scalars and flow style
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(withoutComments(node)); err != nil {
+		return "", err
+	}
+	if err := encoder.Close(); err != nil {
+		return "", err
+	}
+
+	output := strings.TrimSuffix(buffer.String(), "\n")
+	// the encoder ends folded scalars with a blank line, which doesn't add to their value unless the trailing newlines are kept
+	if node.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 && !strings.Contains(strings.SplitN(output, "\n", 2)[0], "+") {
+		output = strings.TrimRight(output, "\n")
+	}
+
+	lines := strings.Split(output, "\n")
+	for i := 1; i < len(lines); i++ {
+		if lines[i] != "" {
+			lines[i] = strings.Repeat(" ", indent) + lines[i]
+		}
+	}
+	value := strings.Join(lines, "\n")
+
+	if properties := formatProperties(node); properties != "" {
+		if value == "" {
+			return properties, nil
+		}
+		return properties + " " + value, nil
+	}
+
+	return value, nil
+}
+
+func (p *manifestPrinter) writeComment(comment string, indent int) {
+	if comment == "" {
+		return
+	}
+	for _, line := range strings.Split(comment, "\n") {
+		if line == "" {
+			p.sb.WriteString("\n")
+			continue
+		}
+		p.sb.WriteString(strings.Repeat(" ", indent) + line + "\n")
+	}
+}
+
+func formatLineComment(comment string) string {
+	if comment == "" {
+		return ""
+	}
+
+	return " " + comment
+}
+
+// formatProperties returns the anchor of a node; the tag is written by the encoder
+func formatProperties(node *yaml.Node) string {
+	if node.Anchor == "" {
+		return ""
+	}
+
+	return "&" + node.Anchor
+}
+
+func withoutComments(node *yaml.Node) *yaml.Node {
+	copy := *node
+	copy.Anchor = ""
+	copy.HeadComment, copy.LineComment, copy.FootComment = "", "", ""
+	copy.Content = nil
+	for _, c := range node.Content {
+		copy.Content = append(copy.Content, withoutComments(c))
+	}
+
+	return &copy
+}
+
+func isBlockMapping(node *yaml.Node) bool {
+	return node.Kind == yaml.MappingNode && node.Style&yaml.FlowStyle == 0 && len(node.Content) > 0
+}
+
+func isBlockSequence(node *yaml.Node) bool {
+	return node.Kind == yaml.SequenceNode && node.Style&yaml.FlowStyle == 0 && len(node.Content) > 0
+}
+
+// getCanonicalEntries returns the key and value pairs of a mapping with the fields of the manifest type first, in the order they're defined in; other keys, like stage parameters and environment variables, follow in their original order
+func getCanonicalEntries(node *yaml.Node, t reflect.Type) (entries [][2]*yaml.Node) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		entries = append(entries, [2]*yaml.Node{node.Content[i], node.Content[i+1]})
+	}
+
+	fields := getYAMLFields(t)
+	if len(fields) == 0 {
+		return entries
+	}
+
+	ordered := [][2]*yaml.Node{}
+	for _, f := range fields {
+		for _, e := range entries {
+			if e[0].Value == f {
+				ordered = append(ordered, e)
+			}
+		}
+	}
+	for _, e := range entries {
+		if !stringArrayContains(fields, e[0].Value) {
+			ordered = append(ordered, e)
+		}
+	}
+
+	return ordered
+}
+
+// getYAMLFields returns the yaml keys of a struct type in the order of its fields
+func getYAMLFields(t reflect.Type) (fields []string) {
+	t = getStructType(t)
+	if t == nil {
+		return nil
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("yaml"), ",")
+		if tag[0] == "" || tag[0] == "-" {
+			continue
+		}
+		fields = append(fields, tag[0])
+	}
+
+	return
+}
+
+// getFieldType returns the type of the field for the yaml key, or nil for keys that aren't a field
+func getFieldType(t reflect.Type, key string) reflect.Type {
+	t = getStructType(t)
+	if t == nil {
+		return nil
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		if strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0] == key {
+			return t.Field(i).Type
+		}
+	}
+
+	return nil
+}
+
+func getElemType(t reflect.Type) reflect.Type {
+	if t == nil || t.Kind() != reflect.Slice {
+		return nil
+	}
+
+	return t.Elem()
+}
+
+func getStructType(t reflect.Type) reflect.Type {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	return t
+}
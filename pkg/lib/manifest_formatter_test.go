@@ -0,0 +1,256 @@
+package lib
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestFormatManifest(t *testing.T) {
+	t.Run("OrdersKeysAsInManifestTypes", func(t *testing.T) {
+
+		manifest := `targets:
+- stages:
+  - commands:
+    - go build ./...
+    image: golang:1.17
+    name: build
+  name: build/local
+metadata:
+  name: app
+  type: cli
+  language: go
+`
+
+		// act
+		formatted, err := FormatManifest([]byte(manifest))
+
+		assert.Nil(t, err)
+		assert.Equal(t, `metadata:
+  name: app
+  type: cli
+  language: go
+
+targets:
+- name: build/local
+  stages:
+  - name: build
+    image: golang:1.17
+    commands:
+    - go build ./...
+`, string(formatted))
+	})
+
+	t.Run("KeepsParametersAndEnvironmentVariablesInOriginalOrderAfterFields", func(t *testing.T) {
+
+		manifest := `targets:
+- name: build/local
+  stages:
+  - tag: 1.0.0
+    name: bake
+    action: build
+    image: jsalverda/docker:stable
+    env:
+      ZONE: a
+      APP: b
+`
+
+		// act
+		formatted, err := FormatManifest([]byte(manifest))
+
+		assert.Nil(t, err)
+		assert.Equal(t, `targets:
+- name: build/local
+  stages:
+  - name: bake
+    image: jsalverda/docker:stable
+    env:
+      ZONE: a
+      APP: b
+    tag: 1.0.0
+    action: build
+`, string(formatted))
+	})
+
+	t.Run("KeepsCommentsWithTheirKeys", func(t *testing.T) {
+
+		manifest := `# manifest for the app
+
+targets:
+# runs on a laptop
+- name: build/local # default target
+  stages:
+  - image: golang:1.17 # pinned
+    # the stage name
+    name: build
+metadata:
+  type: cli
+# the end
+`
+
+		// act
+		formatted, err := FormatManifest([]byte(manifest))
+
+		assert.Nil(t, err)
+		assert.Equal(t, `# manifest for the app
+
+metadata:
+  type: cli
+
+targets:
+# runs on a laptop
+- name: build/local # default target
+  stages:
+  # the stage name
+  - name: build
+    image: golang:1.17 # pinned
+
+# the end
+`, string(formatted))
+	})
+
+	t.Run("KeepsScalarStylesFlowCollectionsAndAnchors", func(t *testing.T) {
+
+		manifest := `targets:
+- name: build/local
+  stages:
+  - name: build
+    env: &env
+      CGO_ENABLED: "0"
+    volumes: [/tmp:/tmp]
+    commands:
+    - |
+      echo a
+      echo b
+    - 'echo c'
+  - name: test
+    env: *env
+    commands: []
+`
+
+		// act
+		formatted, err := FormatManifest([]byte(manifest))
+
+		assert.Nil(t, err)
+		assert.Equal(t, `targets:
+- name: build/local
+  stages:
+  - name: build
+    volumes: ['/tmp:/tmp']
+    env: &env
+      CGO_ENABLED: "0"
+    commands:
+    - |
+      echo a
+      echo b
+    - 'echo c'
+  - name: test
+    env: *env
+    commands: []
+`, string(formatted))
+	})
+
+	t.Run("SeparatesTargetsByBlankLine", func(t *testing.T) {
+
+		manifest := `targets:
+- name: build/local
+  stages:
+  - name: build
+- name: release
+  stages:
+  - name: push
+`
+
+		// act
+		formatted, err := FormatManifest([]byte(manifest))
+
+		assert.Nil(t, err)
+		assert.Equal(t, `targets:
+- name: build/local
+  stages:
+  - name: build
+
+- name: release
+  stages:
+  - name: push
+`, string(formatted))
+	})
+
+	t.Run("IsIdempotent", func(t *testing.T) {
+
+		manifest := `metadata:
+  type: cli
+  language: go
+  name: app
+  version:
+    major: 1
+    patch: tag
+
+secrets:
+- name: token
+  env: TOKEN
+
+targets:
+- name: build/local
+  stages:
+  - name: parallel
+    stages:
+    - name: unit
+      image: golang:1.17
+      commands:
+      - >
+        go test
+        ./...
+`
+		formatted, err := FormatManifest([]byte(manifest))
+		assert.Nil(t, err)
+
+		// act
+		formattedAgain, err := FormatManifest(formatted)
+
+		assert.Nil(t, err)
+		assert.Equal(t, string(formatted), string(formattedAgain))
+	})
+
+	t.Run("KeepsMissingNewlineAtEndOfManifest", func(t *testing.T) {
+
+		manifest := "metadata:\n  name: app\n\ntargets:\n- name: build/local"
+
+		// act
+		formatted, err := FormatManifest([]byte(manifest))
+
+		assert.Nil(t, err)
+		assert.Equal(t, manifest, string(formatted))
+	})
+
+	t.Run("ReturnsErrorForInvalidYAML", func(t *testing.T) {
+
+		// act
+		_, err := FormatManifest([]byte("metadata:\n  type: cli\n   name: app\n"))
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestFormatManifestOfExamples(t *testing.T) {
+	manifestPaths, err := filepath.Glob("../../examples/*/.infinity.yaml")
+	assert.Nil(t, err)
+	assert.NotEqual(t, 0, len(manifestPaths))
+
+	for _, manifestPath := range manifestPaths {
+		manifestPath := manifestPath
+		t.Run(filepath.Base(filepath.Dir(manifestPath)), func(t *testing.T) {
+
+			manifestBytes, err := ioutil.ReadFile(manifestPath)
+			assert.Nil(t, err)
+
+			// act
+			formatted, err := FormatManifest(manifestBytes)
+
+			assert.Nil(t, err)
+			assert.Equal(t, string(manifestBytes), string(formatted))
+		})
+	}
+}
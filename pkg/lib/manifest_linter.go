@@ -0,0 +1,180 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LintConfigFilename is the file next to the manifest that configures the severity of the lint rules for a repository
+const LintConfigFilename = ".infinity-lint.yaml"
+
+type LintRule string
+
+const (
+	LintRuleLatestTag              LintRule = "latest-tag"
+	LintRuleImageDigest            LintRule = "image-digest"
+	LintRulePrivilegedDockerSocket LintRule = "privileged-docker-socket"
+	LintRuleHostRunner             LintRule = "host-runner"
+	LintRuleDuplicateStageName     LintRule = "duplicate-stage-name"
+	LintRuleNoCommands             LintRule = "no-commands"
+)
+
+type LintSeverity string
+
+const (
+	LintSeverityOff     LintSeverity = "off"
+	LintSeverityWarning LintSeverity = "warning"
+	LintSeverityError   LintSeverity = "error"
+)
+
+// DefaultLintSeverities holds the severity of each rule unless configured otherwise; the stricter rules are opt-in
+var DefaultLintSeverities = map[LintRule]LintSeverity{
+	LintRuleLatestTag:              LintSeverityWarning,
+	LintRuleImageDigest:            LintSeverityOff,
+	LintRulePrivilegedDockerSocket: LintSeverityWarning,
+	LintRuleHostRunner:             LintSeverityOff,
+	LintRuleDuplicateStageName:     LintSeverityError,
+	LintRuleNoCommands:             LintSeverityWarning,
+}
+
+type LintConfig struct {
+	Rules map[LintRule]LintSeverity `yaml:"rules,omitempty" json:"rules,omitempty"`
+}
+
+// ReadLintConfig reads the lint configuration; without the file all rules have their default severity
+func ReadLintConfig(lintConfigPath string) (config LintConfig, err error) {
+	configBytes, err := ioutil.ReadFile(lintConfigPath)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(configBytes))
+	decoder.KnownFields(true)
+	if err = decoder.Decode(&config); err != nil && err != io.EOF {
+		return config, fmt.Errorf("lint config %v is invalid: %w", lintConfigPath, err)
+	}
+
+	return config, config.Validate()
+}
+
+func (c LintConfig) Validate() error {
+	for rule, severity := range c.Rules {
+		if _, ok := DefaultLintSeverities[rule]; !ok {
+			return fmt.Errorf("lint rule %v is unknown; please use one of %v", rule, strings.Join(getLintRules(), "|"))
+		}
+		if severity != LintSeverityOff && severity != LintSeverityWarning && severity != LintSeverityError {
+			return fmt.Errorf("severity %v for lint rule %v is unknown; please set '%v: %v|%v|%v'", severity, rule, rule, LintSeverityOff, LintSeverityWarning, LintSeverityError)
+		}
+	}
+
+	return nil
+}
+
+// GetSeverity returns the configured severity for a rule, or its default
+func (c LintConfig) GetSeverity(rule LintRule) LintSeverity {
+	if severity, ok := c.Rules[rule]; ok {
+		return severity
+	}
+
+	return DefaultLintSeverities[rule]
+}
+
+func getLintRules() (rules []string) {
+	for r := range DefaultLintSeverities {
+		rules = append(rules, string(r))
+	}
+	sort.Strings(rules)
+
+	return
+}
+
+// Lint checks the manifest for practices that make builds less reproducible or less safe; the findings are warnings or errors depending on the severity of their rule
+func (m *Manifest) Lint(config LintConfig) (warnings, errors []error) {
+	linter := &manifestLinter{config: config}
+
+	for _, t := range m.Targets {
+		stageNames := map[string]bool{}
+		linter.lintStages(t, t.Stages, stageNames)
+	}
+
+	return linter.warnings, linter.errors
+}
+
+type manifestLinter struct {
+	config   LintConfig
+	warnings []error
+	errors   []error
+}
+
+func (l *manifestLinter) lintStages(target *ManifestTarget, stages []*ManifestStage, stageNames map[string]bool, prefixes ...string) {
+	for _, s := range stages {
+		stagePrefixes := append(prefixes, s.Name)
+		prefix := strings.Join(stagePrefixes, "] [")
+
+		if s.Name != "" && stageNames[s.Name] {
+			l.add(LintRuleDuplicateStageName, s.node.getPosition("name"), "[%v] stage name is not unique in target %v; please rename one of the stages", prefix, target.Name)
+		}
+		stageNames[s.Name] = true
+
+		if len(s.Stages) > 0 {
+			l.lintStages(target, s.Stages, stageNames, stagePrefixes...)
+			continue
+		}
+
+		if len(s.Commands) == 0 && !s.Background {
+			l.add(LintRuleNoCommands, s.node.position, "[%v] stage has no commands; please define at least one command through 'commands'", prefix)
+		}
+
+		if s.RunnerType == RunnerTypeHost {
+			l.add(LintRuleHostRunner, s.node.getPosition("runner"), "[%v] stage runs on the host, which makes the build depend on the tools installed there; please run it in a container with 'image: <image>'", prefix)
+			continue
+		}
+
+		if s.Image != "" {
+			hasDigest := strings.Contains(s.Image, "@")
+			tag := strings.TrimPrefix(strings.TrimPrefix(s.Image, getImageRepository(s.Image)), ":")
+			if !hasDigest && (tag == "" || tag == "latest") {
+				l.add(LintRuleLatestTag, s.node.getPosition("image"), "[%v] image %v is not pinned to a version; please set a tag other than latest", prefix, s.Image)
+			}
+			if !hasDigest {
+				l.add(LintRuleImageDigest, s.node.getPosition("image"), "[%v] image %v is not pinned to a digest; please set 'image: <image>@sha256:<digest>'", prefix, s.Image)
+			}
+		}
+
+		if s.Privileged && mountsDockerSocket(s.Volumes) {
+			l.add(LintRulePrivilegedDockerSocket, s.node.getPosition("privileged"), "[%v] stage is privileged and mounts the docker socket, which both give it control over the host; please use only one of them", prefix)
+		}
+	}
+}
+
+func (l *manifestLinter) add(rule LintRule, position ManifestPosition, format string, a ...interface{}) {
+	err := newManifestError(position, format+" (%v)", append(a, rule)...)
+	err.Rule = string(rule)
+
+	switch l.config.GetSeverity(rule) {
+	case LintSeverityWarning:
+		l.warnings = append(l.warnings, err)
+	case LintSeverityError:
+		l.errors = append(l.errors, err)
+	}
+}
+
+func mountsDockerSocket(volumes []string) bool {
+	for _, v := range volumes {
+		if strings.HasSuffix(strings.Split(v, ":")[0], "docker.sock") {
+			return true
+		}
+	}
+
+	return false
+}
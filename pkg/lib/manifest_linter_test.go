@@ -0,0 +1,175 @@
+package lib
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestLint(t *testing.T) {
+	getManifest := func(stages ...*ManifestStage) Manifest {
+		manifest := Manifest{
+			Targets: []*ManifestTarget{
+				{
+					Name:   "build/local",
+					Stages: stages,
+				},
+			},
+		}
+		manifest.SetDefault()
+
+		return manifest
+	}
+
+	t.Run("WarnsAboutLatestOrMissingTag", func(t *testing.T) {
+
+		manifest := getManifest(
+			&ManifestStage{Name: "lint", Image: "golangci/golangci-lint", Commands: []string{"golangci-lint run"}},
+			&ManifestStage{Name: "build", Image: "golang:latest", Commands: []string{"go build"}},
+			&ManifestStage{Name: "test", Image: "golang:1.17", Commands: []string{"go test"}},
+			&ManifestStage{Name: "scan", Image: "localhost:5000/trivy@sha256:4e5d6f", Commands: []string{"trivy fs ."}},
+		)
+
+		// act
+		warnings, errors := manifest.Lint(LintConfig{})
+
+		assert.Equal(t, 0, len(errors))
+		assert.Equal(t, 2, len(warnings))
+		assert.Equal(t, "[lint] image golangci/golangci-lint is not pinned to a version; please set a tag other than latest (latest-tag)", warnings[0].Error())
+		assert.Equal(t, "[build] image golang:latest is not pinned to a version; please set a tag other than latest (latest-tag)", warnings[1].Error())
+	})
+
+	t.Run("WarnsAboutPrivilegedStageMountingDockerSocket", func(t *testing.T) {
+
+		manifest := getManifest(&ManifestStage{Name: "bake", Image: "docker:20.10.7", Privileged: true, Volumes: []string{"/var/run/docker.sock:/var/run/docker.sock"}, Commands: []string{"docker build ."}})
+
+		// act
+		warnings, _ := manifest.Lint(LintConfig{})
+
+		assert.Equal(t, 1, len(warnings))
+		assert.Equal(t, "[bake] stage is privileged and mounts the docker socket, which both give it control over the host; please use only one of them (privileged-docker-socket)", warnings[0].Error())
+	})
+
+	t.Run("WarnsAboutStagesWithoutCommandsUnlessInBackground", func(t *testing.T) {
+
+		manifest := getManifest(
+			&ManifestStage{Name: "bake", Image: "jsalverda/bake:1.0"},
+			&ManifestStage{Name: "database", Image: "cockroachdb/cockroach:v21.1.5", Background: true},
+		)
+
+		// act
+		warnings, _ := manifest.Lint(LintConfig{})
+
+		assert.Equal(t, 1, len(warnings))
+		assert.Equal(t, "[bake] stage has no commands; please define at least one command through 'commands' (no-commands)", warnings[0].Error())
+	})
+
+	t.Run("ReturnsErrorForDuplicateStageNamesInTarget", func(t *testing.T) {
+
+		manifest := getManifest(
+			&ManifestStage{Name: "parallel", Stages: []*ManifestStage{
+				{Name: "build", Image: "golang:1.17", Commands: []string{"go build"}},
+			}},
+			&ManifestStage{Name: "build", Image: "golang:1.17", Commands: []string{"go build"}},
+		)
+
+		// act
+		_, errors := manifest.Lint(LintConfig{})
+
+		assert.Equal(t, 1, len(errors))
+		assert.Equal(t, "[build] stage name is not unique in target build/local; please rename one of the stages (duplicate-stage-name)", errors[0].Error())
+	})
+
+	t.Run("UsesConfiguredSeverities", func(t *testing.T) {
+
+		manifest := getManifest(&ManifestStage{Name: "install", RunnerType: RunnerTypeHost, Commands: []string{"go install"}}, &ManifestStage{Name: "test", Image: "golang:1.17", Commands: []string{"go test"}})
+		config := LintConfig{
+			Rules: map[LintRule]LintSeverity{
+				LintRuleHostRunner:  LintSeverityError,
+				LintRuleImageDigest: LintSeverityWarning,
+			},
+		}
+
+		// act
+		warnings, errors := manifest.Lint(config)
+
+		assert.Equal(t, 1, len(errors))
+		assert.Equal(t, "[install] stage runs on the host, which makes the build depend on the tools installed there; please run it in a container with 'image: <image>' (host-runner)", errors[0].Error())
+		assert.Equal(t, 1, len(warnings))
+		assert.Equal(t, "[test] image golang:1.17 is not pinned to a digest; please set 'image: <image>@sha256:<digest>' (image-digest)", warnings[0].Error())
+	})
+
+	t.Run("SkipsRulesThatAreOff", func(t *testing.T) {
+
+		manifest := getManifest(&ManifestStage{Name: "lint", Image: "golangci/golangci-lint:latest", Commands: []string{"golangci-lint run"}})
+		config := LintConfig{
+			Rules: map[LintRule]LintSeverity{
+				LintRuleLatestTag: LintSeverityOff,
+			},
+		}
+
+		// act
+		warnings, errors := manifest.Lint(config)
+
+		assert.Equal(t, 0, len(errors))
+		assert.Equal(t, 0, len(warnings))
+	})
+}
+
+func TestReadLintConfig(t *testing.T) {
+	t.Run("ReturnsDefaultsIfFileDoesNotExist", func(t *testing.T) {
+
+		dir, err := ioutil.TempDir("", "lint")
+		assert.Nil(t, err)
+
+		// act
+		config, err := ReadLintConfig(filepath.Join(dir, LintConfigFilename))
+
+		assert.Nil(t, err)
+		assert.Equal(t, LintSeverityWarning, config.GetSeverity(LintRuleLatestTag))
+	})
+
+	t.Run("ReadsSeverityPerRule", func(t *testing.T) {
+
+		dir, err := ioutil.TempDir("", "lint")
+		assert.Nil(t, err)
+		err = ioutil.WriteFile(filepath.Join(dir, LintConfigFilename), []byte("rules:\n  latest-tag: error\n"), 0644)
+		assert.Nil(t, err)
+
+		// act
+		config, err := ReadLintConfig(filepath.Join(dir, LintConfigFilename))
+
+		assert.Nil(t, err)
+		assert.Equal(t, LintSeverityError, config.GetSeverity(LintRuleLatestTag))
+		assert.Equal(t, LintSeverityOff, config.GetSeverity(LintRuleImageDigest))
+	})
+
+	t.Run("ReturnsErrorForUnknownRule", func(t *testing.T) {
+
+		dir, err := ioutil.TempDir("", "lint")
+		assert.Nil(t, err)
+		err = ioutil.WriteFile(filepath.Join(dir, LintConfigFilename), []byte("rules:\n  latest: error\n"), 0644)
+		assert.Nil(t, err)
+
+		// act
+		_, err = ReadLintConfig(filepath.Join(dir, LintConfigFilename))
+
+		assert.NotNil(t, err)
+		assert.Equal(t, "lint rule latest is unknown; please use one of duplicate-stage-name|host-runner|image-digest|latest-tag|no-commands|privileged-docker-socket", err.Error())
+	})
+
+	t.Run("ReturnsErrorForUnknownSeverity", func(t *testing.T) {
+
+		dir, err := ioutil.TempDir("", "lint")
+		assert.Nil(t, err)
+		err = ioutil.WriteFile(filepath.Join(dir, LintConfigFilename), []byte("rules:\n  latest-tag: fatal\n"), 0644)
+		assert.Nil(t, err)
+
+		// act
+		_, err = ReadLintConfig(filepath.Join(dir, LintConfigFilename))
+
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,290 @@
+package lib
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ManifestPosition is the location of a value in the manifest file, to point errors at the line to fix
+type ManifestPosition struct {
+	Filename string
+	Line     int
+	Column   int
+}
+
+func (p ManifestPosition) String() string {
+	if p.Line == 0 {
+		return p.Filename
+	}
+	if p.Column == 0 {
+		return fmt.Sprintf("%v:%v", p.Filename, p.Line)
+	}
+
+	return fmt.Sprintf("%v:%v:%v", p.Filename, p.Line, p.Column)
+}
+
+// ManifestError is a manifest error or warning with the position it applies to, if the manifest was read from file
+type ManifestError struct {
+	Position ManifestPosition
+	Message  string
+	// Rule is the lint rule for lint findings
+	Rule string
+}
+
+func newManifestError(position ManifestPosition, format string, a ...interface{}) *ManifestError {
+	return &ManifestError{
+		Position: position,
+		Message:  fmt.Sprintf(format, a...),
+	}
+}
+
+func (e *ManifestError) Error() string {
+	if e.Position.Line == 0 {
+		return e.Message
+	}
+
+	return e.Position.String() + ": " + e.Message
+}
+
+// ManifestInvalidError is returned when the manifest file can't be parsed into a manifest
+type ManifestInvalidError struct {
+	Filename string
+	Errors   []error
+}
+
+func (e *ManifestInvalidError) Error() string {
+	messages := []string{}
+	for _, err := range e.Errors {
+		messages = append(messages, err.Error())
+	}
+
+	return fmt.Sprintf("manifest %v is invalid:\n%v", e.Filename, strings.Join(messages, "\n"))
+}
+
+var (
+	yamlSyntaxErrorRegex     = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+	yamlTypeErrorRegex       = regexp.MustCompile(`^line (\d+): (.*)$`)
+	yamlUnknownFieldRegex    = regexp.MustCompile(`^field (\S+) not found in type`)
+	yamlAlreadySetFieldRegex = regexp.MustCompile(`^mapping key "(.+)" already defined`)
+)
+
+// newManifestInvalidError turns the errors of the yaml package, which only mention the line, into errors with the position of the offending key
+func newManifestInvalidError(filename string, root *yaml.Node, err error) *ManifestInvalidError {
+	invalidErr := &ManifestInvalidError{Filename: filename}
+
+	if typeErr, ok := err.(*yaml.TypeError); ok {
+		for _, message := range typeErr.Errors {
+			invalidErr.Errors = append(invalidErr.Errors, newManifestErrorFromYAMLMessage(filename, root, yamlTypeErrorRegex, message))
+		}
+		return invalidErr
+	}
+
+	invalidErr.Errors = append(invalidErr.Errors, newManifestErrorFromYAMLMessage(filename, root, yamlSyntaxErrorRegex, err.Error()))
+
+	return invalidErr
+}
+
+func newManifestErrorFromYAMLMessage(filename string, root *yaml.Node, regex *regexp.Regexp, message string) *ManifestError {
+	matches := regex.FindStringSubmatch(message)
+	if matches == nil {
+		return newManifestError(ManifestPosition{Filename: filename}, "%v", strings.TrimPrefix(message, "yaml: "))
+	}
+
+	line, _ := strconv.Atoi(matches[1])
+	position := ManifestPosition{Filename: filename, Line: line}
+
+	// find the column of the key the error is about
+	for _, keyRegex := range []*regexp.Regexp{yamlUnknownFieldRegex, yamlAlreadySetFieldRegex} {
+		if keyMatches := keyRegex.FindStringSubmatch(matches[2]); keyMatches != nil && root != nil {
+			if key := findKeyNode(root, keyMatches[1], line); key != nil {
+				position.Column = key.Column
+			}
+		}
+	}
+
+	return newManifestError(position, "%v", matches[2])
+}
+
+func findKeyNode(node *yaml.Node, key string, line int) *yaml.Node {
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key && node.Content[i].Line == line {
+				return node.Content[i]
+			}
+		}
+	}
+	for _, n := range node.Content {
+		if found := findKeyNode(n, key, line); found != nil {
+			return found
+		}
+	}
+
+	return nil
+}
+
+// manifestNode keeps the position of a manifest type and of its keys
+type manifestNode struct {
+	position ManifestPosition
+	keys     map[string]ManifestPosition
+}
+
+// newManifestNode returns the positions for a mapping; without a mapping, as for a key that isn't set, it falls back to the parent position
+func newManifestNode(filename string, node *yaml.Node, parent manifestNode) manifestNode {
+	node = resolveAlias(node)
+	if node == nil {
+		return manifestNode{position: parent.position}
+	}
+
+	n := manifestNode{
+		position: ManifestPosition{Filename: filename, Line: node.Line, Column: node.Column},
+		keys:     map[string]ManifestPosition{},
+	}
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			n.keys[key.Value] = ManifestPosition{Filename: filename, Line: key.Line, Column: key.Column}
+		}
+	}
+
+	return n
+}
+
+// getPosition returns the position of the key, or of the mapping itself if the key isn't set
+func (n manifestNode) getPosition(key string) ManifestPosition {
+	if p, ok := n.keys[key]; ok {
+		return p
+	}
+
+	return n.position
+}
+
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node != nil && node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	return node
+}
+
+func getMappingValue(node *yaml.Node, key string) *yaml.Node {
+	node = resolveAlias(node)
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+
+	return nil
+}
+
+func getSequenceItem(node *yaml.Node, index int) *yaml.Node {
+	node = resolveAlias(node)
+	if node == nil || node.Kind != yaml.SequenceNode || index >= len(node.Content) {
+		return nil
+	}
+
+	return node.Content[index]
+}
+
+// setPositions walks the yaml tree the manifest got decoded from to record where each of its parts is defined
+func (m *Manifest) setPositions(filename string, root *yaml.Node) {
+	node := resolveAlias(root)
+	if node != nil && node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	m.node = newManifestNode(filename, node, manifestNode{position: ManifestPosition{Filename: filename, Line: 1, Column: 1}})
+
+	metadata := getMappingValue(node, "metadata")
+	m.Metadata.node = newManifestNode(filename, metadata, m.node)
+	if m.Metadata.Version != nil {
+		m.Metadata.Version.node = newManifestNode(filename, getMappingValue(metadata, "version"), m.Metadata.node)
+	}
+
+	secrets := getMappingValue(node, "secrets")
+	for i, s := range m.Secrets {
+		s.node = newManifestNode(filename, getSequenceItem(secrets, i), m.node)
+	}
+
+	registries := getMappingValue(node, "registries")
+	for i, r := range m.Registries {
+		r.node = newManifestNode(filename, getSequenceItem(registries, i), m.node)
+	}
+
+	targets := getMappingValue(node, "targets")
+	for i, t := range m.Targets {
+		target := getSequenceItem(targets, i)
+		t.node = newManifestNode(filename, target, m.node)
+		setStagePositions(filename, t.Stages, getMappingValue(target, "stages"), t.node)
+	}
+}
+
+func setStagePositions(filename string, stages []*ManifestStage, node *yaml.Node, parent manifestNode) {
+	for i, s := range stages {
+		stage := getSequenceItem(node, i)
+		s.node = newManifestNode(filename, stage, parent)
+
+		secrets := getMappingValue(stage, "secrets")
+		for j, ss := range s.Secrets {
+			ss.node = newManifestNode(filename, getSequenceItem(secrets, j), s.node)
+		}
+		if s.Resources != nil {
+			s.Resources.node = newManifestNode(filename, getMappingValue(stage, "resources"), s.node)
+		}
+
+		setStagePositions(filename, s.Stages, getMappingValue(stage, "stages"), s.node)
+	}
+}
+
+var yaml11Booleans = map[string]bool{
+	"y": true, "Y": true, "yes": true, "Yes": true, "YES": true, "on": true, "On": true, "ON": true,
+	"n": false, "N": false, "no": false, "No": false, "NO": false, "off": false, "Off": false, "OFF": false,
+}
+
+// getYAML11BooleanParameterErrors returns an error for each unquoted yaml 1.1 boolean, like yes or off, in stage parameters; fields of type bool still read them as booleans, but parameters would silently be passed as the string instead of true or false
+func getYAML11BooleanParameterErrors(filename string, root *yaml.Node, manifest Manifest) (errs []error) {
+	node := resolveAlias(root)
+	if node != nil && node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+
+	targets := getMappingValue(node, "targets")
+	for i, t := range manifest.Targets {
+		errs = append(errs, getYAML11BooleanStageParameterErrors(filename, t.Stages, getMappingValue(getSequenceItem(targets, i), "stages"))...)
+	}
+
+	return
+}
+
+func getYAML11BooleanStageParameterErrors(filename string, stages []*ManifestStage, node *yaml.Node) (errs []error) {
+	for i, s := range stages {
+		stage := getSequenceItem(node, i)
+
+		keys := []string{}
+		for k := range s.Parameters {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			value := resolveAlias(getMappingValue(stage, k))
+			if value == nil || value.Kind != yaml.ScalarNode || value.Style != 0 || value.Tag != "!!str" {
+				continue
+			}
+			if b, ok := yaml11Booleans[value.Value]; ok {
+				errs = append(errs, newManifestError(ManifestPosition{Filename: filename, Line: value.Line, Column: value.Column}, "parameter %v is set to %v, which is no longer read as boolean but as string; please set '%v: %v' or '%v: \"%v\"'", k, value.Value, k, b, k, value.Value))
+			}
+		}
+
+		errs = append(errs, getYAML11BooleanStageParameterErrors(filename, s.Stages, getMappingValue(stage, "stages"))...)
+	}
+
+	return
+}
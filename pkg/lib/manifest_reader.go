@@ -1,12 +1,14 @@
 package lib
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 
-	"gopkg.in/yaml.v2"
+	"gopkg.in/yaml.v3"
 )
 
 //go:generate mockgen -package=lib -destination ./manifest_reader_mock.go -source=manifest_reader.go
@@ -33,11 +35,26 @@ func (b *manifestReader) GetManifest(ctx context.Context, buildManifestFilename
 		return
 	}
 
-	// unmarshal bytes into manifest
-	if err = yaml.UnmarshalStrict(manifestBytes, &manifest); err != nil {
-		return manifest, fmt.Errorf("manifest %v is invalid: %w", buildManifestFilename, err)
+	// parse into a node tree to know where each value is defined
+	var root yaml.Node
+	if err = yaml.Unmarshal(manifestBytes, &root); err != nil {
+		return manifest, newManifestInvalidError(buildManifestFilename, nil, err)
 	}
 
+	// decode bytes into manifest, failing on unknown fields
+	decoder := yaml.NewDecoder(bytes.NewReader(manifestBytes))
+	decoder.KnownFields(true)
+	if err = decoder.Decode(&manifest); err != nil && err != io.EOF {
+		return manifest, newManifestInvalidError(buildManifestFilename, &root, err)
+	}
+	err = nil
+
+	// yaml 1.2 reads yes, on and the like as strings, unlike the yaml 1.1 parser used before
+	if errs := getYAML11BooleanParameterErrors(buildManifestFilename, &root, manifest); len(errs) > 0 {
+		return manifest, &ManifestInvalidError{Filename: buildManifestFilename, Errors: errs}
+	}
+
+	manifest.setPositions(buildManifestFilename, &root)
 	manifest.SetDefault()
 
 	return
@@ -0,0 +1,236 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestGetManifest(t *testing.T) {
+	t.Run("SetsPositionsOfValidationErrors", func(t *testing.T) {
+
+		manifestPath := writeTestManifest(t, `metadata:
+  type: cli
+  language: go
+  name: test
+targets:
+- name: build/local
+  stages:
+  - name: parallel
+    stages:
+    - name: unit
+      commands:
+      - go test ./...
+    - name: deploy
+      runner: host
+      image: alpine:3.13
+      commands:
+      - ./deploy.sh
+`)
+		manifestReader := NewManifestReader()
+
+		// act
+		manifest, err := manifestReader.GetManifest(context.Background(), manifestPath)
+
+		assert.Nil(t, err)
+		_, errs := manifest.Validate()
+		assert.Equal(t, 2, len(errs))
+		assert.Equal(t, manifestPath+":10:7: [parallel] [unit] stage has no image; please set 'image: <image>'", errs[0].Error())
+		assert.Equal(t, manifestPath+":15:7: [parallel] [deploy] stage has image which is not supported in combination with 'runner: host'; please do not set 'image: <image>'", errs[1].Error())
+	})
+
+	t.Run("FallsBackToParentPositionForMissingKeys", func(t *testing.T) {
+
+		manifestPath := writeTestManifest(t, `metadata:
+  type: cli
+  language: go
+targets:
+- name: build/local
+`)
+		manifestReader := NewManifestReader()
+
+		// act
+		manifest, err := manifestReader.GetManifest(context.Background(), manifestPath)
+
+		assert.Nil(t, err)
+		_, errs := manifest.Validate()
+		assert.Equal(t, 2, len(errs))
+		assert.Equal(t, manifestPath+":2:3: application has no name; please set 'name: <name>'", errs[0].Error())
+		assert.Equal(t, manifestPath+":5:3: manifest has no stages; define at least stage through 'build.stages'", errs[1].Error())
+	})
+
+	t.Run("ReturnsUnknownFieldsWithLineAndColumn", func(t *testing.T) {
+
+		manifestPath := writeTestManifest(t, `metadata:
+  type: cli
+  nmae: test
+targets:
+- name: build/local
+  stagse: []
+`)
+		manifestReader := NewManifestReader()
+
+		// act
+		_, err := manifestReader.GetManifest(context.Background(), manifestPath)
+
+		var invalidErr *ManifestInvalidError
+		assert.True(t, errors.As(err, &invalidErr))
+		assert.Equal(t, 2, len(invalidErr.Errors))
+		assert.Equal(t, manifestPath+":3:3: field nmae not found in type lib.ManifestMetadata", invalidErr.Errors[0].Error())
+		assert.Equal(t, manifestPath+":6:3: field stagse not found in type lib.ManifestTarget", invalidErr.Errors[1].Error())
+	})
+
+	t.Run("ReturnsSyntaxErrorWithLine", func(t *testing.T) {
+
+		manifestPath := writeTestManifest(t, "metadata:\n  type: cli\n   name: test\n")
+		manifestReader := NewManifestReader()
+
+		// act
+		_, err := manifestReader.GetManifest(context.Background(), manifestPath)
+
+		var invalidErr *ManifestInvalidError
+		assert.True(t, errors.As(err, &invalidErr))
+		assert.Equal(t, 1, len(invalidErr.Errors))
+		assert.Equal(t, manifestPath+":3: mapping values are not allowed in this context", invalidErr.Errors[0].Error())
+	})
+
+	t.Run("ReadsYAML11BooleansOfBoolFields", func(t *testing.T) {
+
+		manifestPath := writeTestManifest(t, `metadata:
+  name: test
+targets:
+- name: build/local
+  stages:
+  - name: database
+    image: cockroachdb/cockroach:v21.1.5
+    background: yes
+    privileged: On
+    mount: off
+`)
+		manifestReader := NewManifestReader()
+
+		// act
+		manifest, err := manifestReader.GetManifest(context.Background(), manifestPath)
+
+		assert.Nil(t, err)
+		stage := manifest.Targets[0].Stages[0]
+		assert.True(t, stage.Background)
+		assert.True(t, stage.Privileged)
+		assert.False(t, *stage.MountWorkingDirectory)
+	})
+
+	t.Run("ReturnsErrorForYAML11BooleansOfParameters", func(t *testing.T) {
+
+		manifestPath := writeTestManifest(t, `metadata:
+  name: test
+targets:
+- name: build/local
+  stages:
+  - name: deploy
+    image: extensions/deploy:stable
+    dry-run: yes
+    stages:
+    - name: notify
+      image: extensions/notify:stable
+      silent: OFF
+`)
+		manifestReader := NewManifestReader()
+
+		// act
+		_, err := manifestReader.GetManifest(context.Background(), manifestPath)
+
+		var invalidErr *ManifestInvalidError
+		assert.True(t, errors.As(err, &invalidErr))
+		assert.Equal(t, 2, len(invalidErr.Errors))
+		assert.Equal(t, manifestPath+":8:14: parameter dry-run is set to yes, which is no longer read as boolean but as string; please set 'dry-run: true' or 'dry-run: \"yes\"'", invalidErr.Errors[0].Error())
+		assert.Equal(t, manifestPath+":12:15: parameter silent is set to OFF, which is no longer read as boolean but as string; please set 'silent: false' or 'silent: \"OFF\"'", invalidErr.Errors[1].Error())
+	})
+
+	t.Run("ReadsQuotedYAML11BooleansOfParametersAsString", func(t *testing.T) {
+
+		manifestPath := writeTestManifest(t, `metadata:
+  name: test
+targets:
+- name: build/local
+  stages:
+  - name: deploy
+    image: extensions/deploy:stable
+    dry-run: true
+    answer: "yes"
+`)
+		manifestReader := NewManifestReader()
+
+		// act
+		manifest, err := manifestReader.GetManifest(context.Background(), manifestPath)
+
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]interface{}{"dry-run": true, "answer": "yes"}, manifest.Targets[0].Stages[0].Parameters)
+	})
+
+	t.Run("ReadsMergeKeys", func(t *testing.T) {
+
+		manifestPath := writeTestManifest(t, `metadata:
+  name: test
+targets:
+- name: build/local
+  stages:
+  - &golang
+    name: build
+    image: golang:1.17-alpine
+  - <<: *golang
+    name: test
+`)
+		manifestReader := NewManifestReader()
+
+		// act
+		manifest, err := manifestReader.GetManifest(context.Background(), manifestPath)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "test", manifest.Targets[0].Stages[1].Name)
+		assert.Equal(t, "golang:1.17-alpine", manifest.Targets[0].Stages[1].Image)
+	})
+
+	t.Run("ReturnsErrorForDuplicateKeys", func(t *testing.T) {
+
+		manifestPath := writeTestManifest(t, `metadata:
+  name: test
+  name: other
+`)
+		manifestReader := NewManifestReader()
+
+		// act
+		_, err := manifestReader.GetManifest(context.Background(), manifestPath)
+
+		var invalidErr *ManifestInvalidError
+		assert.True(t, errors.As(err, &invalidErr))
+		assert.Equal(t, 1, len(invalidErr.Errors))
+		assert.Equal(t, manifestPath+":3:3: mapping key \"name\" already defined at line 2", invalidErr.Errors[0].Error())
+	})
+
+	t.Run("ReturnsEmptyManifestForEmptyFile", func(t *testing.T) {
+
+		manifestPath := writeTestManifest(t, "")
+		manifestReader := NewManifestReader()
+
+		// act
+		manifest, err := manifestReader.GetManifest(context.Background(), manifestPath)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(manifest.Targets))
+	})
+}
+
+func writeTestManifest(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "manifest")
+	assert.Nil(t, err)
+
+	manifestPath := filepath.Join(dir, ".infinity.yaml")
+	err = ioutil.WriteFile(manifestPath, []byte(content), 0644)
+	assert.Nil(t, err)
+
+	return manifestPath
+}
@@ -0,0 +1,235 @@
+package lib
+
+import (
+	"reflect"
+	"strings"
+)
+
+// JSONSchema is the subset of JSON Schema draft-07 needed to describe the manifest
+type JSONSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Ref                  string                 `json:"$ref,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Enum                 []string               `json:"enum,omitempty"`
+	Default              interface{}            `json:"default,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties interface{}            `json:"additionalProperties,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	AllOf                []*JSONSchema          `json:"allOf,omitempty"`
+	OneOf                []*JSONSchema          `json:"oneOf,omitempty"`
+	Definitions          map[string]*JSONSchema `json:"definitions,omitempty"`
+}
+
+// manifestSchemaDescriptions describes the properties of the manifest types by <type>.<yaml key>
+var manifestSchemaDescriptions = map[string]string{
+	"Manifest.metadata":                 "metadata of the application",
+	"Manifest.env":                      "environment variables for all stages",
+	"Manifest.envFile":                  "dotenv files with environment variables for all stages; missing files are skipped, values from env take precedence",
+	"Manifest.secrets":                  "secrets that stages can opt in to",
+	"Manifest.registries":               "credentials for private registries to pull images from",
+	"Manifest.targets":                  "run targets, like build/local or release",
+	"ManifestMetadata.type":             "application type metadata for use in a future centralized CI/CD system",
+	"ManifestMetadata.language":         "language metadata",
+	"ManifestMetadata.name":             "unique name for the application",
+	"ManifestMetadata.version":          "semantic version calculated from git and passed to stages as INFINITY_VERSION",
+	"ManifestVersion.major":             "major version of the application",
+	"ManifestVersion.minor":             "minor version of the application",
+	"ManifestVersion.patch":             "source of the patch version; the number of commits or the latest tag for the major and minor version",
+	"ManifestVersion.label":             "pre-release label for branches other than the release branches, supporting {{branch}} and {{shortRevision}} placeholders",
+	"ManifestVersion.releaseBranches":   "branches that get a version without pre-release label",
+	"ManifestSecret.name":               "unique name for the secret, used by stages to opt in to it",
+	"ManifestSecret.env":                "host environment variable to read the secret value from",
+	"ManifestSecret.file":               "file to read the secret value from, relative to the working directory",
+	"ManifestSecret.encryptedFile":      "file with the secret value encrypted by infinity secret encrypt",
+	"ManifestRegistry.host":             "host of the registry, like registry.example.com or docker.io",
+	"ManifestRegistry.username":         "username to log in with",
+	"ManifestRegistry.secret":           "secret with the password or token to log in with",
+	"ManifestRegistry.env":              "host environment variable to read the password or token from",
+	"ManifestRegistry.command":          "command that prints a short-lived token to log in with, like aws ecr get-login-password",
+	"ManifestRegistry.credentialHelper": "docker credential helper that provides username and password, like ecr-login or gcloud",
+	"ManifestTarget.name":               "name for the run target",
+	"ManifestTarget.env":                "environment variables for all stages in the target",
+	"ManifestTarget.envFile":            "dotenv files with environment variables for all stages in the target; missing files are skipped",
+	"ManifestTarget.stages":             "stages that run one after the other",
+	"ManifestStage.name":                "name for the stage",
+	"ManifestStage.runner":              "runner type for the stage",
+	"ManifestStage.image":               "docker container image to run the stage commands in",
+	"ManifestStage.pullPolicy":          "when to pull the image; always, only if it's not present locally, or never to work offline",
+	"ManifestStage.background":          "run stage in background, to provide a service to the other stages",
+	"ManifestStage.privileged":          "run stage in privileged mode, to allow more privileges to the host operating system",
+	"ManifestStage.mount":               "mount the working directory into the stage container",
+	"ManifestStage.work":                "directory to which the working copy gets mounted",
+	"ManifestStage.volumes":             "volumes to mount, with source and target folder separated by :",
+	"ManifestStage.devices":             "devices to mount, with source and target device path separated by :",
+	"ManifestStage.resources":           "limits for the cpus, memory, processes and shared memory of the stage container",
+	"ManifestStage.ulimits":             "ulimits for the stage container, as name=soft limit with an optional :hard limit, like nofile=65536",
+	"ManifestStage.env":                 "environment variables for the stage",
+	"ManifestStage.envFile":             "dotenv files with environment variables for the stage; missing files are skipped, values from env take precedence",
+	"ManifestStage.secrets":             "secrets to pass to the stage, by name or with the envvar or file to pass them as",
+	"ManifestStage.shell":               "shell to run the commands with",
+	"ManifestStage.commands":            "commands to execute inside the stage container or on the host",
+	"ManifestStage.stages":              "nested stages that run in parallel",
+	"ManifestResources.cpus":            "number of cpus the container can use, like 1.5",
+	"ManifestResources.memory":          "memory the container can use before it gets killed, like 512m or 4g",
+	"ManifestResources.pids":            "number of processes the container can run, or -1 for unlimited",
+	"ManifestResources.shmSize":         "size of /dev/shm in the container, like 64m or 1g",
+	"ManifestStageSecret.name":          "name of the secret",
+	"ManifestStageSecret.env":           "environment variable to pass the secret as; defaults to the upper snake cased secret name",
+	"ManifestStageSecret.file":          "absolute path to mount the secret at as read-only file",
+}
+
+var manifestSchemaTypeDescriptions = map[string]string{
+	"Manifest":            "manifest with the targets and stages to run with infinity",
+	"ManifestMetadata":    "metadata of the application",
+	"ManifestVersion":     "semantic version settings",
+	"ManifestSecret":      "secret read from the host environment, a file or an encrypted file",
+	"ManifestRegistry":    "registry credentials from a secret, an envvar, a token command or a docker credential helper",
+	"ManifestTarget":      "run target with its stages",
+	"ManifestStage":       "stage that runs commands in a container or on the host, or runs its nested stages in parallel",
+	"ManifestResources":   "resource limits for a stage container",
+	"ManifestStageSecret": "secret with the envvar or file to pass it as",
+}
+
+// manifestSchemaDefaults are the values SetDefault fills in by <type>.<yaml key>
+var manifestSchemaDefaults = map[string]interface{}{
+	"ManifestVersion.patch":           string(VersionPatchCommits),
+	"ManifestVersion.label":           "{{branch}}",
+	"ManifestVersion.releaseBranches": []string{"main", "master"},
+	"ManifestStage.runner":            string(RunnerTypeContainer),
+	"ManifestStage.pullPolicy":        string(PullPolicyIfNotPresent),
+	"ManifestStage.mount":             true,
+	"ManifestStage.work":              "/work",
+	"ManifestStage.shell":             "/bin/sh",
+}
+
+var manifestSchemaRequired = map[string][]string{
+	"Manifest":            {"metadata"},
+	"ManifestMetadata":    {"type", "language", "name"},
+	"ManifestSecret":      {"name"},
+	"ManifestRegistry":    {"host"},
+	"ManifestTarget":      {"name", "stages"},
+	"ManifestStage":       {"name"},
+	"ManifestStageSecret": {"name"},
+}
+
+// GetManifestSchema returns a JSON Schema for the .infinity.yaml manifest, generated from the manifest types
+func GetManifestSchema() *JSONSchema {
+	generator := &manifestSchemaGenerator{
+		definitions: map[string]*JSONSchema{},
+		enums: map[reflect.Type][]string{
+			reflect.TypeOf(ApplicationType("")): SupportedApplicationTypes.ToStringArray(),
+			reflect.TypeOf(Language("")):        SupportedLanguages.ToStringArray(),
+			reflect.TypeOf(RunnerType("")):      SupportedRunnerTypes.ToStringArray(),
+			reflect.TypeOf(PullPolicy("")):      SupportedPullPolicies.ToStringArray(),
+			reflect.TypeOf(VersionPatch("")):    {string(VersionPatchCommits), string(VersionPatchTag)},
+		},
+	}
+
+	schema := generator.getStructSchema(reflect.TypeOf(Manifest{}))
+	schema.Schema = "http://json-schema.org/draft-07/schema#"
+	schema.Title = "infinity manifest"
+	schema.Definitions = generator.definitions
+
+	return schema
+}
+
+type manifestSchemaGenerator struct {
+	definitions map[string]*JSONSchema
+	enums       map[reflect.Type][]string
+}
+
+func (g *manifestSchemaGenerator) getSchema(t reflect.Type) *JSONSchema {
+	if enum, ok := g.enums[t]; ok {
+		return &JSONSchema{Type: "string", Enum: enum}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.getSchema(t.Elem())
+	case reflect.String:
+		return &JSONSchema{Type: "string"}
+	case reflect.Bool:
+		return &JSONSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &JSONSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &JSONSchema{Type: "number"}
+	case reflect.Slice:
+		return &JSONSchema{Type: "array", Items: g.getSchema(t.Elem())}
+	case reflect.Map:
+		return &JSONSchema{Type: "object", AdditionalProperties: g.getSchema(t.Elem())}
+	case reflect.Struct:
+		g.addDefinition(t)
+		return &JSONSchema{Ref: "#/definitions/" + t.Name()}
+	}
+
+	// interface values can be anything
+	return &JSONSchema{}
+}
+
+// addDefinition adds the struct once, so recursive types like nested stages refer to themselves
+func (g *manifestSchemaGenerator) addDefinition(t reflect.Type) {
+	if _, ok := g.definitions[t.Name()]; ok {
+		return
+	}
+	g.definitions[t.Name()] = &JSONSchema{}
+
+	schema := g.getStructSchema(t)
+
+	// a stage secret can be set by name only
+	if t == reflect.TypeOf(ManifestStageSecret{}) {
+		schema = &JSONSchema{
+			OneOf: []*JSONSchema{
+				{Type: "string", Description: "name of the secret, passed as upper snake cased environment variable"},
+				schema,
+			},
+		}
+	}
+
+	g.definitions[t.Name()] = schema
+}
+
+func (g *manifestSchemaGenerator) getStructSchema(t reflect.Type) *JSONSchema {
+	schema := &JSONSchema{
+		Type:                 "object",
+		Description:          manifestSchemaTypeDescriptions[t.Name()],
+		Properties:           map[string]*JSONSchema{},
+		Required:             manifestSchemaRequired[t.Name()],
+		AdditionalProperties: false,
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		tag := strings.Split(field.Tag.Get("yaml"), ",")
+		if tag[0] == "-" {
+			continue
+		}
+
+		// the inline parameters map accepts any other property
+		if len(tag) > 1 && tag[1] == "inline" {
+			schema.AdditionalProperties = &JSONSchema{
+				Description: "any other property is passed to the stage as INFINITY_PARAMETER_<UPPER_SNAKE_CASE_NAME> environment variable",
+			}
+			continue
+		}
+
+		property := g.getSchema(field.Type)
+		key := t.Name() + "." + tag[0]
+		if property.Ref != "" {
+			// draft-07 ignores siblings of $ref, so wrap it to keep the description
+			property = &JSONSchema{AllOf: []*JSONSchema{property}}
+		}
+		property.Description = manifestSchemaDescriptions[key]
+		property.Default = manifestSchemaDefaults[key]
+		schema.Properties[tag[0]] = property
+	}
+
+	return schema
+}
@@ -0,0 +1,71 @@
+package lib
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestGetManifestSchema(t *testing.T) {
+	t.Run("IncludesEnumsOfSupportedValues", func(t *testing.T) {
+
+		// act
+		schema := GetManifestSchema()
+
+		assert.Equal(t, SupportedRunnerTypes.ToStringArray(), schema.Definitions["ManifestStage"].Properties["runner"].Enum)
+		assert.Equal(t, SupportedApplicationTypes.ToStringArray(), schema.Definitions["ManifestMetadata"].Properties["type"].Enum)
+		assert.Equal(t, SupportedLanguages.ToStringArray(), schema.Definitions["ManifestMetadata"].Properties["language"].Enum)
+	})
+
+	t.Run("RefersToStageDefinitionForNestedStages", func(t *testing.T) {
+
+		// act
+		schema := GetManifestSchema()
+
+		assert.Equal(t, "#/definitions/ManifestStage", schema.Definitions["ManifestTarget"].Properties["stages"].Items.Ref)
+		assert.Equal(t, "#/definitions/ManifestStage", schema.Definitions["ManifestStage"].Properties["stages"].Items.Ref)
+	})
+
+	t.Run("AllowsParametersOnStagesOnly", func(t *testing.T) {
+
+		// act
+		schema := GetManifestSchema()
+
+		assert.Equal(t, false, schema.AdditionalProperties)
+		assert.Equal(t, false, schema.Definitions["ManifestTarget"].AdditionalProperties)
+		assert.NotEqual(t, false, schema.Definitions["ManifestStage"].AdditionalProperties)
+	})
+
+	t.Run("DescribesEveryProperty", func(t *testing.T) {
+
+		// act
+		schema := GetManifestSchema()
+
+		undescribed := []string{}
+		for name, definition := range schema.Definitions {
+			for _, d := range append([]*JSONSchema{definition}, definition.OneOf...) {
+				for key, property := range d.Properties {
+					if property.Description == "" {
+						undescribed = append(undescribed, name+"."+key)
+					}
+				}
+			}
+		}
+		for key, property := range schema.Properties {
+			if property.Description == "" {
+				undescribed = append(undescribed, "Manifest."+key)
+			}
+		}
+		assert.Equal(t, []string{}, undescribed)
+	})
+
+	t.Run("MarshalsToJSON", func(t *testing.T) {
+
+		// act
+		output, err := json.Marshal(GetManifestSchema())
+
+		assert.Nil(t, err)
+		assert.Contains(t, string(output), `"$schema":"http://json-schema.org/draft-07/schema#"`)
+	})
+}
@@ -5,7 +5,7 @@ import (
 	"testing"
 
 	"github.com/alecthomas/assert"
-	"gopkg.in/yaml.v2"
+	"gopkg.in/yaml.v3"
 )
 
 func TestUnmarshalManifest(t *testing.T) {
@@ -15,7 +15,7 @@ func TestUnmarshalManifest(t *testing.T) {
 		var manifest Manifest
 
 		// act
-		err = yaml.UnmarshalStrict(manifestData, &manifest)
+		err = yaml.Unmarshal(manifestData, &manifest)
 
 		assert.Nil(t, err)
 		assert.Equal(t, 1, len(manifest.Targets))
@@ -111,6 +111,346 @@ func TestValidateForManifest(t *testing.T) {
 	})
 }
 
+func TestValidateSecretsForManifest(t *testing.T) {
+	t.Run("ReturnsNoErrorIfStageSecretIsDefined", func(t *testing.T) {
+		manifest := getValidManifest()
+		manifest.Secrets = []*ManifestSecret{{Name: "token", Env: "TOKEN"}}
+		manifest.Targets[0].Stages[0].Secrets = []*ManifestStageSecret{{Name: "token"}}
+
+		// act
+		_, errors := manifest.Validate()
+
+		assert.Equal(t, 0, len(errors))
+	})
+
+	t.Run("ReturnsErrorIfStageSecretIsNotDefined", func(t *testing.T) {
+		manifest := getValidManifest()
+		manifest.Targets[0].Stages[0].Secrets = []*ManifestStageSecret{{Name: "token"}}
+
+		// act
+		_, errors := manifest.Validate()
+
+		assert.Equal(t, 1, len(errors))
+		assert.Equal(t, "[stage-1] secret token is not defined; please add it to 'secrets'", errors[0].Error())
+	})
+
+	t.Run("ReturnsErrorIfSecretHasNoSource", func(t *testing.T) {
+		manifest := getValidManifest()
+		manifest.Secrets = []*ManifestSecret{{Name: "token"}}
+
+		// act
+		_, errors := manifest.Validate()
+
+		assert.Equal(t, 1, len(errors))
+		assert.Equal(t, "[secret token] secret needs exactly one source; please set one of 'env: <envvar>', 'file: <path>' or 'encryptedFile: <path>'", errors[0].Error())
+	})
+
+	t.Run("ReturnsErrorIfSecretHasMultipleSources", func(t *testing.T) {
+		manifest := getValidManifest()
+		manifest.Secrets = []*ManifestSecret{{Name: "token", Env: "TOKEN", File: "token.txt"}}
+
+		// act
+		_, errors := manifest.Validate()
+
+		assert.Equal(t, 1, len(errors))
+	})
+
+	t.Run("ReturnsErrorIfSecretNameIsNotUnique", func(t *testing.T) {
+		manifest := getValidManifest()
+		manifest.Secrets = []*ManifestSecret{{Name: "token", Env: "TOKEN"}, {Name: "token", Env: "OTHER_TOKEN"}}
+
+		// act
+		_, errors := manifest.Validate()
+
+		assert.Equal(t, 1, len(errors))
+		assert.Equal(t, "[secret token] secret name is not unique; please rename one of the secrets", errors[0].Error())
+	})
+}
+
+func TestValidateRegistriesForManifest(t *testing.T) {
+	t.Run("ReturnsNoErrorIfRegistryHasOneSource", func(t *testing.T) {
+		manifest := getValidManifest()
+		manifest.Secrets = []*ManifestSecret{{Name: "registry-password", Env: "REGISTRY_PASSWORD"}}
+		manifest.Registries = []*ManifestRegistry{
+			{Host: "registry.example.com", Username: "ci", Secret: "registry-password"},
+			{Host: "docker.io", Username: "jsalverda", Env: "DOCKER_HUB_TOKEN"},
+			{Host: "123456789.dkr.ecr.eu-west-1.amazonaws.com", Username: "AWS", Command: "aws ecr get-login-password"},
+			{Host: "europe-docker.pkg.dev", CredentialHelper: "gcloud"},
+		}
+
+		// act
+		warnings, errors := manifest.Validate()
+
+		assert.Equal(t, 0, len(warnings))
+		assert.Equal(t, 0, len(errors))
+	})
+
+	t.Run("ReturnsErrorIfRegistryHasNoSource", func(t *testing.T) {
+		manifest := getValidManifest()
+		manifest.Registries = []*ManifestRegistry{{Host: "registry.example.com", Username: "ci"}}
+
+		// act
+		_, errors := manifest.Validate()
+
+		assert.Equal(t, 1, len(errors))
+		assert.Equal(t, "[registry registry.example.com] registry needs exactly one source for its password; please set one of 'secret: <secret name>', 'env: <envvar>', 'command: <command>' or 'credentialHelper: <helper>'", errors[0].Error())
+	})
+
+	t.Run("ReturnsErrorIfRegistryHasNoUsername", func(t *testing.T) {
+		manifest := getValidManifest()
+		manifest.Registries = []*ManifestRegistry{{Host: "registry.example.com", Env: "REGISTRY_PASSWORD"}}
+
+		// act
+		_, errors := manifest.Validate()
+
+		assert.Equal(t, 1, len(errors))
+		assert.Equal(t, "[registry registry.example.com] registry has no username; please set 'username: <username>'", errors[0].Error())
+	})
+
+	t.Run("ReturnsErrorIfRegistrySecretIsNotDefined", func(t *testing.T) {
+		manifest := getValidManifest()
+		manifest.Registries = []*ManifestRegistry{{Host: "registry.example.com", Username: "ci", Secret: "registry-password"}}
+
+		// act
+		_, errors := manifest.Validate()
+
+		assert.Equal(t, 1, len(errors))
+		assert.Equal(t, "[registry registry.example.com] secret registry-password is not defined; please add it to 'secrets'", errors[0].Error())
+	})
+
+	t.Run("ReturnsErrorIfRegistryHostIsNotUnique", func(t *testing.T) {
+		manifest := getValidManifest()
+		manifest.Registries = []*ManifestRegistry{{Host: "registry.example.com", Username: "ci", Env: "REGISTRY_PASSWORD"}, {Host: "registry.example.com", CredentialHelper: "pass"}}
+
+		// act
+		_, errors := manifest.Validate()
+
+		assert.Equal(t, 1, len(errors))
+		assert.Equal(t, "[registry registry.example.com] registry host is not unique; please remove one of the registries", errors[0].Error())
+	})
+}
+
+func TestGetRegistry(t *testing.T) {
+	t.Run("ReturnsRegistryForHostOfImage", func(t *testing.T) {
+		manifest := getValidManifest()
+		manifest.Registries = []*ManifestRegistry{{Host: "registry.example.com", Username: "ci", Env: "REGISTRY_PASSWORD"}, {Host: "index.docker.io", Username: "jsalverda", Env: "DOCKER_HUB_TOKEN"}}
+
+		// act
+		registries := []*ManifestRegistry{manifest.GetRegistry("registry.example.com/base/go:1.17"), manifest.GetRegistry("alpine:3.13"), manifest.GetRegistry("ghcr.io/org/tool:1.0")}
+
+		assert.Equal(t, []*ManifestRegistry{manifest.Registries[0], manifest.Registries[1], nil}, registries)
+	})
+}
+
+func TestValidateSecretsForManifestStage(t *testing.T) {
+	t.Run("ReturnsNoErrorIfSecretFileIsAbsolute", func(t *testing.T) {
+		stage := getValidManifestStage()
+		stage.Secrets = []*ManifestStageSecret{{Name: "kubeconfig", File: "/root/.kube/config"}}
+
+		// act
+		_, errors := stage.Validate()
+
+		assert.Equal(t, 0, len(errors))
+	})
+
+	t.Run("ReturnsNoErrorIfSecretFileIsInHomeDirectory", func(t *testing.T) {
+		stage := getValidManifestStage()
+		stage.Secrets = []*ManifestStageSecret{{Name: "docker-config", File: "~/.docker/config.json"}}
+
+		// act
+		_, errors := stage.Validate()
+
+		assert.Equal(t, 0, len(errors))
+	})
+
+	t.Run("ReturnsErrorIfSecretFileIsRelative", func(t *testing.T) {
+		stage := getValidManifestStage()
+		stage.Secrets = []*ManifestStageSecret{{Name: "npmrc", File: ".npmrc"}}
+
+		// act
+		_, errors := stage.Validate()
+
+		assert.Equal(t, 1, len(errors))
+		assert.Equal(t, "[stage-1] stage secret npmrc has relative file path; please set an absolute path with 'file: <path>'", errors[0].Error())
+	})
+
+	t.Run("ReturnsErrorIfSecretHasEnvAndFile", func(t *testing.T) {
+		stage := getValidManifestStage()
+		stage.Secrets = []*ManifestStageSecret{{Name: "npmrc", Env: "NPMRC", File: "/root/.npmrc"}}
+
+		// act
+		_, errors := stage.Validate()
+
+		assert.Equal(t, 1, len(errors))
+		assert.Equal(t, "[stage-1] stage secret npmrc has both env and file; please set either 'env: <envvar>' or 'file: <path>'", errors[0].Error())
+	})
+
+	t.Run("ReturnsErrorIfSecretFileIsUsedWithHostRunner", func(t *testing.T) {
+		stage := getValidManifestStage()
+		stage.RunnerType = RunnerTypeHost
+		stage.Image = ""
+		stage.Secrets = []*ManifestStageSecret{{Name: "npmrc", File: "/root/.npmrc"}}
+
+		// act
+		_, errors := stage.Validate()
+
+		assert.Equal(t, 1, len(errors))
+		assert.Equal(t, "[stage-1] stage secret npmrc has file which is not supported in combination with 'runner: host'; please use 'env: <envvar>' instead", errors[0].Error())
+	})
+}
+
+func TestUnmarshalManifestStageSecret(t *testing.T) {
+	t.Run("AcceptsNameOnly", func(t *testing.T) {
+		var stage ManifestStage
+
+		// act
+		err := yaml.Unmarshal([]byte("secrets:\n- registry-password\n"), &stage)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(stage.Secrets))
+		assert.Equal(t, "registry-password", stage.Secrets[0].Name)
+	})
+
+	t.Run("AcceptsNameAndEnv", func(t *testing.T) {
+		var stage ManifestStage
+
+		// act
+		err := yaml.Unmarshal([]byte("secrets:\n- name: registry-password\n  env: DOCKER_PASSWORD\n"), &stage)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(stage.Secrets))
+		assert.Equal(t, "registry-password", stage.Secrets[0].Name)
+		assert.Equal(t, "DOCKER_PASSWORD", stage.Secrets[0].Env)
+	})
+
+	t.Run("DefaultsEnvToUpperSnakeCasedName", func(t *testing.T) {
+		var stage ManifestStage
+		err := yaml.Unmarshal([]byte("secrets:\n- registry-password\n"), &stage)
+		assert.Nil(t, err)
+
+		// act
+		stage.SetDefault()
+
+		assert.Equal(t, "REGISTRY_PASSWORD", stage.Secrets[0].Env)
+	})
+
+	t.Run("DoesNotDefaultEnvIfFileIsSet", func(t *testing.T) {
+		var stage ManifestStage
+		err := yaml.Unmarshal([]byte("secrets:\n- name: docker-config\n  file: ~/.docker/config.json\n"), &stage)
+		assert.Nil(t, err)
+
+		// act
+		stage.SetDefault()
+
+		assert.Equal(t, "", stage.Secrets[0].Env)
+	})
+}
+
+func TestValidateForManifestVersion(t *testing.T) {
+	t.Run("ReturnsNoErrorIfVersionIsValid", func(t *testing.T) {
+		version := ManifestVersion{Major: 1, Minor: 2}
+		version.SetDefault()
+
+		// act
+		_, errors := version.Validate()
+
+		assert.Equal(t, 0, len(errors))
+	})
+
+	t.Run("ReturnsErrorIfPatchIsUnknown", func(t *testing.T) {
+		version := ManifestVersion{Major: 1, Minor: 2, Patch: "build"}
+		version.SetDefault()
+
+		// act
+		_, errors := version.Validate()
+
+		assert.Equal(t, 1, len(errors))
+		assert.Equal(t, "[version] patch is unknown; please set 'patch: commits|tag'", errors[0].Error())
+	})
+}
+
+func TestGetVersionForManifestVersion(t *testing.T) {
+	t.Run("ReturnsCommitCountAsPatchOnReleaseBranch", func(t *testing.T) {
+		version := ManifestVersion{Major: 1, Minor: 2}
+		version.SetDefault()
+
+		// act
+		semver := version.GetVersion(GitInfo{Branch: "main", ShortRevision: "0a4edf2"}, 15, nil)
+
+		assert.Equal(t, "1.2.15", semver)
+	})
+
+	t.Run("ReturnsBranchAsLabelOnOtherBranch", func(t *testing.T) {
+		version := ManifestVersion{Major: 1, Minor: 2}
+		version.SetDefault()
+
+		// act
+		semver := version.GetVersion(GitInfo{Branch: "feature/Add_Version", ShortRevision: "0a4edf2"}, 15, nil)
+
+		assert.Equal(t, "1.2.15-feature-Add-Version", semver)
+	})
+
+	t.Run("ReturnsLabelFromTemplate", func(t *testing.T) {
+		version := ManifestVersion{Major: 1, Minor: 2, Label: "{{branch}}.{{shortRevision}}"}
+		version.SetDefault()
+
+		// act
+		semver := version.GetVersion(GitInfo{Branch: "feature", ShortRevision: "0a4edf2"}, 15, nil)
+
+		assert.Equal(t, "1.2.15-feature-0a4edf2", semver)
+	})
+
+	t.Run("ReturnsShortRevisionAsLabelForDetachedHeadWithoutTag", func(t *testing.T) {
+		version := ManifestVersion{Major: 1, Minor: 2}
+		version.SetDefault()
+
+		// act
+		semver := version.GetVersion(GitInfo{ShortRevision: "0a4edf2"}, 15, nil)
+
+		assert.Equal(t, "1.2.15-0a4edf2", semver)
+	})
+
+	t.Run("ReturnsNoLabelForDetachedHeadWithTag", func(t *testing.T) {
+		version := ManifestVersion{Major: 1, Minor: 2}
+		version.SetDefault()
+
+		// act
+		semver := version.GetVersion(GitInfo{ShortRevision: "0a4edf2", Tag: "v1.2.15"}, 15, nil)
+
+		assert.Equal(t, "1.2.15", semver)
+	})
+
+	t.Run("ReturnsPatchOfTagPointingAtHead", func(t *testing.T) {
+		version := ManifestVersion{Major: 1, Minor: 2, Patch: VersionPatchTag}
+		version.SetDefault()
+
+		// act
+		semver := version.GetVersion(GitInfo{Branch: "main", Tag: "v1.2.3"}, 15, []string{"v1.1.9", "v1.2.2", "v1.2.3"})
+
+		assert.Equal(t, "1.2.3", semver)
+	})
+
+	t.Run("ReturnsNextPatchAfterLatestTagForUntaggedHead", func(t *testing.T) {
+		version := ManifestVersion{Major: 1, Minor: 2, Patch: VersionPatchTag}
+		version.SetDefault()
+
+		// act
+		semver := version.GetVersion(GitInfo{Branch: "main"}, 15, []string{"v1.1.9", "1.2.10", "v1.2.3", "v1.3.0", "nightly"})
+
+		assert.Equal(t, "1.2.11", semver)
+	})
+
+	t.Run("ReturnsPatchZeroIfNoTagMatchesMajorAndMinor", func(t *testing.T) {
+		version := ManifestVersion{Major: 2, Minor: 0, Patch: VersionPatchTag}
+		version.SetDefault()
+
+		// act
+		semver := version.GetVersion(GitInfo{Branch: "main"}, 15, []string{"v1.2.3"})
+
+		assert.Equal(t, "2.0.0", semver)
+	})
+}
+
 func TestSetDefaultForManifestStage(t *testing.T) {
 	t.Run("DefaultsRunnerTypeToContainerIfUnknown", func(t *testing.T) {
 		stage := ManifestStage{
@@ -277,6 +617,94 @@ func TestValidateForManifestStage(t *testing.T) {
 		assert.Equal(t, "[stage-1] stage has image which is not supported in combination with 'runner: host'; please do not set 'image: <image>'", errors[0].Error())
 	})
 
+	t.Run("ReturnsErrorIfPullPolicyIsUnknown", func(t *testing.T) {
+		stage := getValidManifestStage()
+		stage.PullPolicy = "IfNotPresent"
+
+		// act
+		_, errors := stage.Validate()
+
+		assert.Equal(t, 1, len(errors))
+		assert.Equal(t, "[stage-1] unknown pull policy IfNotPresent; please set 'pullPolicy: always|ifNotPresent|never'", errors[0].Error())
+	})
+
+	t.Run("DefaultsPullPolicyToIfNotPresent", func(t *testing.T) {
+
+		// act
+		stage := getValidManifestStage()
+
+		assert.Equal(t, PullPolicyIfNotPresent, stage.PullPolicy)
+	})
+
+	t.Run("ReturnsNoErrorsIfResourcesAndUlimitsAreValid", func(t *testing.T) {
+		stage := getValidManifestStage()
+		stage.Resources = &ManifestResources{CPUs: 2, Memory: "4g", PIDs: 512, ShmSize: "1.5GiB"}
+		stage.Ulimits = []string{"nofile=65536", "nproc=1024:2048", "memlock=-1:-1"}
+
+		// act
+		_, errors := stage.Validate()
+
+		assert.Equal(t, 0, len(errors))
+	})
+
+	t.Run("ReturnsErrorIfResourcesMemoryIsNotASize", func(t *testing.T) {
+		stage := getValidManifestStage()
+		stage.Resources = &ManifestResources{Memory: "4 gigabytes"}
+
+		// act
+		_, errors := stage.Validate()
+
+		assert.Equal(t, 1, len(errors))
+		assert.Equal(t, "[stage-1] resources memory 4 gigabytes is not a size; please set 'memory: <size>', like 512m or 4g", errors[0].Error())
+	})
+
+	t.Run("ReturnsErrorIfResourcesCPUsIsNegative", func(t *testing.T) {
+		stage := getValidManifestStage()
+		stage.Resources = &ManifestResources{CPUs: -1}
+
+		// act
+		_, errors := stage.Validate()
+
+		assert.Equal(t, 1, len(errors))
+		assert.Equal(t, "[stage-1] resources cpus -1 is negative; please set 'cpus: <number of cpus>', like 1.5", errors[0].Error())
+	})
+
+	t.Run("ReturnsErrorIfUlimitIsUnknown", func(t *testing.T) {
+		stage := getValidManifestStage()
+		stage.Ulimits = []string{"files=1024"}
+
+		// act
+		_, errors := stage.Validate()
+
+		assert.Equal(t, 1, len(errors))
+		assert.Equal(t, "[stage-1] ulimit files=1024 is invalid; please set '<name>=<soft limit>[:<hard limit>]' with name one of core|cpu|data|fsize|locks|memlock|msgqueue|nice|nofile|nproc|rss|rtprio|rttime|sigpending|stack", errors[0].Error())
+	})
+
+	t.Run("ReturnsErrorIfUlimitSoftLimitIsAboveHardLimit", func(t *testing.T) {
+		stage := getValidManifestStage()
+		stage.Ulimits = []string{"nofile=65536:1024"}
+
+		// act
+		_, errors := stage.Validate()
+
+		assert.Equal(t, 1, len(errors))
+		assert.Equal(t, "[stage-1] ulimit nofile=65536:1024 has a soft limit above its hard limit; please lower the soft limit", errors[0].Error())
+	})
+
+	t.Run("ReturnsErrorIfResourcesAreSetForHostRunner", func(t *testing.T) {
+		stage := getValidManifestStage()
+		stage.RunnerType = RunnerTypeHost
+		stage.Image = ""
+		stage.PullPolicy = PullPolicyUnknown
+		stage.Resources = &ManifestResources{Memory: "4g"}
+
+		// act
+		_, errors := stage.Validate()
+
+		assert.Equal(t, 1, len(errors))
+		assert.Equal(t, "[stage-1] stage has resources which is not supported in combination with 'runner: host'; please do not set 'resources'", errors[0].Error())
+	})
+
 	t.Run("ReturnsWarningIfNoCommandsAreSet", func(t *testing.T) {
 		stage := getValidManifestStage()
 		stage.Commands = []string{}
@@ -285,7 +713,7 @@ func TestValidateForManifestStage(t *testing.T) {
 		warnings, _ := stage.Validate()
 
 		assert.Equal(t, 1, len(warnings))
-		assert.Equal(t, "[stage-1] stage has no commands; you might want to define at least one command through 'commands'", warnings[0])
+		assert.Equal(t, "[stage-1] stage has no commands; you might want to define at least one command through 'commands'", warnings[0].Error())
 	})
 
 	t.Run("CallsValidateOnNestedStages", func(t *testing.T) {
@@ -0,0 +1,212 @@
+package lib
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	// ParameterLabel is the image label listing the parameters a stage running the image accepts, separated by commas
+	ParameterLabel = "infinity.parameters"
+	// ParameterSchemaFilename is the local file listing the accepted parameters by image, for images without the label
+	ParameterSchemaFilename = ".infinity-parameters.yaml"
+)
+
+// ParameterSchemas holds the accepted parameters by image, either with or without tag
+type ParameterSchemas map[string][]string
+
+// Get returns the accepted parameters for the image, falling back to the image without tag or digest
+func (p ParameterSchemas) Get(image string) (parameters []string, ok bool) {
+	if parameters, ok = p[image]; ok {
+		return
+	}
+
+	parameters, ok = p[getImageRepository(image)]
+	return
+}
+
+// getImageRepository strips the tag or digest from an image, taking into account registries with a port
+func getImageRepository(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+
+	return image
+}
+
+// ValidateParameters warns about stage parameters the image doesn't accept, and without schema for the image about parameters that look like a typo of a stage field
+func (m *Manifest) ValidateParameters(schemas ParameterSchemas) (warnings []error) {
+	for _, t := range m.Targets {
+		for _, s := range t.Stages {
+			warnings = append(warnings, s.validateParameters(schemas)...)
+		}
+	}
+
+	return
+}
+
+func (s *ManifestStage) validateParameters(schemas ParameterSchemas, prefixes ...string) (warnings []error) {
+	if s.Name != "" {
+		prefixes = append(prefixes, s.Name)
+	} else {
+		prefixes = append(prefixes, "?")
+	}
+
+	prefix := strings.Join(prefixes, "] [")
+
+	keys := []string{}
+	for k := range s.Parameters {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	accepted, isKnown := []string{}, false
+	if s.RunnerType == RunnerTypeContainer {
+		accepted, isKnown = schemas.Get(s.Image)
+	}
+
+	for _, k := range keys {
+		if isKnown && stringArrayContains(accepted, k) {
+			continue
+		}
+
+		envvar := ToUpperSnakeCase("INFINITY_PARAMETER_" + k)
+		fieldMatch, isFieldMatch := getClosestMatch(k, getManifestStageFields())
+
+		position := s.node.getPosition(k)
+		switch {
+		case isFieldMatch && isKnown:
+			warnings = append(warnings, newManifestError(position, "[%v] parameter %v is not accepted by image %v; did you mean '%v'?", prefix, k, s.Image, fieldMatch))
+		case isFieldMatch:
+			warnings = append(warnings, newManifestError(position, "[%v] parameter %v is not a stage field and gets passed as %v; did you mean '%v'?", prefix, k, envvar, fieldMatch))
+		case isKnown:
+			warnings = append(warnings, newUnacceptedParameterWarning(position, prefix, k, s.Image, accepted))
+		}
+	}
+
+	for _, st := range s.Stages {
+		warnings = append(warnings, st.validateParameters(schemas, prefixes...)...)
+	}
+
+	return
+}
+
+// ValidateImageParameters warns about parameters of the stages that their image doesn't accept, for images that only got a schema once they're pulled; stages with other images and parameters that look like a typo of a stage field are skipped, since validating the manifest warns about those already
+func ValidateImageParameters(stages []*ManifestStage, schemas ParameterSchemas, prefixes ...string) (warnings []error) {
+	for _, s := range stages {
+		stagePrefixes := append(prefixes, s.Name)
+		warnings = append(warnings, ValidateImageParameters(s.Stages, schemas, stagePrefixes...)...)
+
+		if s.RunnerType != RunnerTypeContainer {
+			continue
+		}
+		accepted, isKnown := schemas.Get(s.Image)
+		if !isKnown {
+			continue
+		}
+
+		keys := []string{}
+		for k := range s.Parameters {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			if stringArrayContains(accepted, k) {
+				continue
+			}
+			if _, isFieldMatch := getClosestMatch(k, getManifestStageFields()); isFieldMatch {
+				continue
+			}
+			warnings = append(warnings, newUnacceptedParameterWarning(s.node.getPosition(k), strings.Join(stagePrefixes, "] ["), k, s.Image, accepted))
+		}
+	}
+
+	return
+}
+
+func newUnacceptedParameterWarning(position ManifestPosition, prefix, key, image string, accepted []string) error {
+	suggestion := ""
+	if match, ok := getClosestMatch(key, accepted); ok {
+		suggestion = fmt.Sprintf(" did you mean '%v'?", match)
+	}
+
+	return newManifestError(position, "[%v] parameter %v is not accepted by image %v;%v accepted parameters are %v", prefix, key, image, suggestion, strings.Join(accepted, ", "))
+}
+
+// getManifestStageFields returns the yaml keys of a stage, which don't end up as parameter
+func getManifestStageFields() (fields []string) {
+	t := reflect.TypeOf(ManifestStage{})
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("yaml"), ",")
+		if tag[0] == "" || tag[0] == "-" {
+			continue
+		}
+		fields = append(fields, tag[0])
+	}
+
+	return
+}
+
+// getClosestMatch returns the candidate with the smallest edit distance, if it's close enough to be a typo
+func getClosestMatch(value string, candidates []string) (match string, ok bool) {
+	bestDistance := -1
+	for _, c := range candidates {
+		// allow one edit for every four characters, so short names don't match everything
+		maxDistance := len(c) / 4
+		distance := getEditDistance(strings.ToLower(value), strings.ToLower(c))
+		if distance > maxDistance {
+			continue
+		}
+		if bestDistance < 0 || distance < bestDistance {
+			match, bestDistance = c, distance
+		}
+	}
+
+	return match, bestDistance >= 0
+}
+
+// getEditDistance returns the number of insertions, deletions, substitutions and transpositions of adjacent characters to turn a into b
+func getEditDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = minInt(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+
+	return d[len(ra)][len(rb)]
+}
+
+func minInt(values ...int) int {
+	min := values[0]
+	for _, v := range values[1:] {
+		if v < min {
+			min = v
+		}
+	}
+
+	return min
+}
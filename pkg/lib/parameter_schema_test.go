@@ -0,0 +1,160 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestValidateParameters(t *testing.T) {
+	getManifest := func(stages ...*ManifestStage) Manifest {
+		manifest := Manifest{
+			Targets: []*ManifestTarget{
+				{
+					Name:   "build/local",
+					Stages: stages,
+				},
+			},
+		}
+		manifest.SetDefault()
+
+		return manifest
+	}
+
+	t.Run("WarnsAboutParametersThatLookLikeATypoOfAStageField", func(t *testing.T) {
+
+		manifest := getManifest(&ManifestStage{
+			Name:       "lint",
+			Image:      "golang:1.17",
+			Parameters: map[string]interface{}{"comands": []interface{}{"go vet ./..."}, "privilged": true, "port": 8080},
+		})
+
+		// act
+		warnings := manifest.ValidateParameters(ParameterSchemas{})
+
+		assert.Equal(t, 2, len(warnings))
+		assert.Equal(t, "[lint] parameter comands is not a stage field and gets passed as INFINITY_PARAMETER_COMANDS; did you mean 'commands'?", warnings[0].Error())
+		assert.Equal(t, "[lint] parameter privilged is not a stage field and gets passed as INFINITY_PARAMETER_PRIVILGED; did you mean 'privileged'?", warnings[1].Error())
+	})
+
+	t.Run("WarnsAboutParametersNotAcceptedByImage", func(t *testing.T) {
+
+		manifest := getManifest(&ManifestStage{
+			Name:       "bake",
+			Image:      "jsalverda/bake:1.0",
+			Parameters: map[string]interface{}{"versoin": "1.2.3", "push": true, "cache": true},
+		})
+
+		// act
+		warnings := manifest.ValidateParameters(ParameterSchemas{"jsalverda/bake": {"version", "push"}})
+
+		assert.Equal(t, 2, len(warnings))
+		assert.Equal(t, "[bake] parameter cache is not accepted by image jsalverda/bake:1.0; accepted parameters are version, push", warnings[0].Error())
+		assert.Equal(t, "[bake] parameter versoin is not accepted by image jsalverda/bake:1.0; did you mean 'version'? accepted parameters are version, push", warnings[1].Error())
+	})
+
+	t.Run("AcceptsParametersDeclaredByImageEvenIfCloseToAStageField", func(t *testing.T) {
+
+		manifest := getManifest(&ManifestStage{
+			Name:       "deploy",
+			Image:      "jsalverda/deploy:1.0",
+			Parameters: map[string]interface{}{"images": []interface{}{"app"}},
+		})
+
+		// act
+		warnings := manifest.ValidateParameters(ParameterSchemas{"jsalverda/deploy:1.0": {"images"}})
+
+		assert.Equal(t, 0, len(warnings))
+	})
+
+	t.Run("ValidatesNestedStages", func(t *testing.T) {
+
+		manifest := getManifest(&ManifestStage{
+			Name: "parallel",
+			Stages: []*ManifestStage{
+				{
+					Name:       "unit",
+					Image:      "golang:1.17",
+					Parameters: map[string]interface{}{"Commands": "go test ./..."},
+				},
+			},
+		})
+
+		// act
+		warnings := manifest.ValidateParameters(ParameterSchemas{})
+
+		assert.Equal(t, 1, len(warnings))
+		assert.Equal(t, "[parallel] [unit] parameter Commands is not a stage field and gets passed as INFINITY_PARAMETER_COMMANDS; did you mean 'commands'?", warnings[0].Error())
+	})
+}
+
+func TestValidateImageParameters(t *testing.T) {
+	t.Run("WarnsAboutParametersNotAcceptedByImageOnlyForImagesWithSchema", func(t *testing.T) {
+
+		stages := []*ManifestStage{
+			{
+				Name:       "bake",
+				Image:      "jsalverda/bake:1.0",
+				Parameters: map[string]interface{}{"versoin": "1.2.3", "push": true, "comands": []interface{}{"bake"}},
+			},
+			{
+				Name:       "lint",
+				Image:      "golang:1.17",
+				Parameters: map[string]interface{}{"port": 8080},
+			},
+		}
+		for _, s := range stages {
+			s.SetDefault()
+		}
+
+		// act
+		warnings := ValidateImageParameters(stages, ParameterSchemas{"jsalverda/bake:1.0": {"version", "push"}})
+
+		assert.Equal(t, 1, len(warnings))
+		assert.Equal(t, "[bake] parameter versoin is not accepted by image jsalverda/bake:1.0; did you mean 'version'? accepted parameters are version, push", warnings[0].Error())
+	})
+}
+
+func TestGetImageRepository(t *testing.T) {
+	t.Run("StripsTag", func(t *testing.T) {
+
+		// act
+		repository := getImageRepository("golang:1.17-alpine")
+
+		assert.Equal(t, "golang", repository)
+	})
+
+	t.Run("StripsDigest", func(t *testing.T) {
+
+		// act
+		repository := getImageRepository("golang@sha256:4e5d6f")
+
+		assert.Equal(t, "golang", repository)
+	})
+
+	t.Run("KeepsRegistryPort", func(t *testing.T) {
+
+		// act
+		repository := getImageRepository("localhost:5000/bake")
+
+		assert.Equal(t, "localhost:5000/bake", repository)
+	})
+}
+
+func TestGetEditDistance(t *testing.T) {
+	t.Run("CountsInsertionsDeletionsAndSubstitutions", func(t *testing.T) {
+
+		// act
+		distance := getEditDistance("kitten", "sitting")
+
+		assert.Equal(t, 3, distance)
+	})
+
+	t.Run("CountsTranspositionAsOneEdit", func(t *testing.T) {
+
+		// act
+		distance := getEditDistance("imgae", "image")
+
+		assert.Equal(t, 1, distance)
+	})
+}
@@ -0,0 +1,251 @@
+package lib
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type GraphNodeType string
+
+const (
+	GraphNodeTypeStage      GraphNodeType = "stage"
+	GraphNodeTypeBackground GraphNodeType = "background"
+	GraphNodeTypeParallel   GraphNodeType = "parallel"
+)
+
+type GraphEdgeType string
+
+const (
+	// GraphEdgeTypeSequence means the stage starts once the previous one finished
+	GraphEdgeTypeSequence GraphEdgeType = "sequence"
+	// GraphEdgeTypeBackground means the background stage keeps running while the next stage starts
+	GraphEdgeTypeBackground GraphEdgeType = "background"
+)
+
+type PipelineGraph struct {
+	Target string      `json:"target"`
+	Nodes  []GraphNode `json:"nodes"`
+	Edges  []GraphEdge `json:"edges"`
+}
+
+type GraphNode struct {
+	ID         string        `json:"id"`
+	Name       string        `json:"name"`
+	Path       string        `json:"path"`
+	Type       GraphNodeType `json:"type"`
+	RunnerType RunnerType    `json:"runner,omitempty"`
+	Image      string        `json:"image,omitempty"`
+	// Parent is the id of the parallel group the stage runs in
+	Parent string `json:"parent,omitempty"`
+}
+
+type GraphEdge struct {
+	From string        `json:"from"`
+	To   string        `json:"to"`
+	Type GraphEdgeType `json:"type"`
+}
+
+// GetPipelineGraph returns the stages of a target as nodes, with edges between stages that run after each other; parallel groups are nodes that contain their stages
+func GetPipelineGraph(manifest Manifest, target string) (graph PipelineGraph, err error) {
+	manifestTarget, err := manifest.GetTarget(target)
+	if err != nil {
+		return
+	}
+
+	builder := &pipelineGraphBuilder{
+		graph: PipelineGraph{
+			Target: target,
+			Nodes:  []GraphNode{},
+			Edges:  []GraphEdge{},
+		},
+		ids: map[string]bool{},
+	}
+
+	// top-level stages run one after the other
+	previous := []pipelineGraphExit{}
+	for _, s := range manifestTarget.Stages {
+		entries, exits := builder.addStage(*s, "")
+		for _, p := range previous {
+			for _, e := range entries {
+				builder.graph.Edges = append(builder.graph.Edges, GraphEdge{From: p.id, To: e, Type: p.edgeType})
+			}
+		}
+		previous = exits
+	}
+
+	return builder.graph, nil
+}
+
+type pipelineGraphBuilder struct {
+	graph PipelineGraph
+	ids   map[string]bool
+}
+
+type pipelineGraphExit struct {
+	id       string
+	edgeType GraphEdgeType
+}
+
+// addStage adds the nodes of a stage and returns the stages that start first and the ones the next stage waits for
+func (b *pipelineGraphBuilder) addStage(stage ManifestStage, parent string, prefixes ...string) (entries []string, exits []pipelineGraphExit) {
+	path := strings.Join(append(prefixes, stage.Name), "/")
+	node := GraphNode{
+		ID:     b.getID(path),
+		Name:   stage.Name,
+		Path:   path,
+		Parent: parent,
+	}
+
+	if len(stage.Stages) > 0 {
+		node.Type = GraphNodeTypeParallel
+		b.graph.Nodes = append(b.graph.Nodes, node)
+
+		backgroundExits := []pipelineGraphExit{}
+		for _, s := range stage.Stages {
+			nestedEntries, nestedExits := b.addStage(*s, node.ID, append(prefixes, stage.Name)...)
+			entries = append(entries, nestedEntries...)
+			// the group finishes without waiting for its background stages
+			for _, e := range nestedExits {
+				if e.edgeType == GraphEdgeTypeBackground {
+					backgroundExits = append(backgroundExits, e)
+					continue
+				}
+				exits = append(exits, e)
+			}
+		}
+		if len(exits) == 0 {
+			exits = backgroundExits
+		}
+
+		return
+	}
+
+	node.Type = GraphNodeTypeStage
+	node.RunnerType = stage.RunnerType
+	if stage.RunnerType == RunnerTypeContainer {
+		node.Image = stage.Image
+	}
+	edgeType := GraphEdgeTypeSequence
+	if stage.Background {
+		node.Type = GraphNodeTypeBackground
+		edgeType = GraphEdgeTypeBackground
+	}
+	b.graph.Nodes = append(b.graph.Nodes, node)
+
+	return []string{node.ID}, []pipelineGraphExit{{id: node.ID, edgeType: edgeType}}
+}
+
+var graphIDCharacters = regexp.MustCompile("[^a-zA-Z0-9_]+")
+
+// getID returns an id for the path that's valid in dot and mermaid
+func (b *pipelineGraphBuilder) getID(path string) string {
+	id := graphIDCharacters.ReplaceAllString(path, "_")
+	if id == "" || (id[0] >= '0' && id[0] <= '9') {
+		id = "stage_" + id
+	}
+
+	uniqueID := id
+	for i := 2; b.ids[uniqueID]; i++ {
+		uniqueID = fmt.Sprintf("%v_%v", id, i)
+	}
+	b.ids[uniqueID] = true
+
+	return uniqueID
+}
+
+// ToDOT renders the graph in the Graphviz dot language, with parallel groups as clusters
+func (g PipelineGraph) ToDOT() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("digraph %v {\n", quoteDOT(g.Target)))
+	sb.WriteString("  rankdir=LR;\n")
+	sb.WriteString("  node [shape=box, style=rounded];\n")
+	g.writeDOTNodes(&sb, "", "  ")
+	for _, e := range g.Edges {
+		if e.Type == GraphEdgeTypeBackground {
+			sb.WriteString(fmt.Sprintf("  %v -> %v [style=dashed];\n", e.From, e.To))
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("  %v -> %v;\n", e.From, e.To))
+	}
+	sb.WriteString("}\n")
+
+	return sb.String()
+}
+
+func (g PipelineGraph) writeDOTNodes(sb *strings.Builder, parent, indent string) {
+	for _, n := range g.Nodes {
+		if n.Parent != parent {
+			continue
+		}
+
+		switch n.Type {
+		case GraphNodeTypeParallel:
+			sb.WriteString(fmt.Sprintf("%vsubgraph cluster_%v {\n", indent, n.ID))
+			sb.WriteString(fmt.Sprintf("%v  label=%v;\n", indent, quoteDOT(n.Name)))
+			sb.WriteString(fmt.Sprintf("%v  style=dashed;\n", indent))
+			g.writeDOTNodes(sb, n.ID, indent+"  ")
+			sb.WriteString(fmt.Sprintf("%v}\n", indent))
+		case GraphNodeTypeBackground:
+			sb.WriteString(fmt.Sprintf("%v%v [label=%v, style=\"rounded,dashed\"];\n", indent, n.ID, quoteDOT(n.getLabel("\n"))))
+		default:
+			sb.WriteString(fmt.Sprintf("%v%v [label=%v];\n", indent, n.ID, quoteDOT(n.getLabel("\n"))))
+		}
+	}
+}
+
+// ToMermaid renders the graph as a Mermaid flowchart, with parallel groups as subgraphs and background stages as stadium shapes
+func (g PipelineGraph) ToMermaid() string {
+	var sb strings.Builder
+	sb.WriteString("flowchart LR\n")
+	g.writeMermaidNodes(&sb, "", "  ")
+	for _, e := range g.Edges {
+		if e.Type == GraphEdgeTypeBackground {
+			sb.WriteString(fmt.Sprintf("  %v -.-> %v\n", e.From, e.To))
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("  %v --> %v\n", e.From, e.To))
+	}
+
+	return sb.String()
+}
+
+func (g PipelineGraph) writeMermaidNodes(sb *strings.Builder, parent, indent string) {
+	for _, n := range g.Nodes {
+		if n.Parent != parent {
+			continue
+		}
+
+		switch n.Type {
+		case GraphNodeTypeParallel:
+			sb.WriteString(fmt.Sprintf("%vsubgraph %v [%v]\n", indent, n.ID, quoteMermaid(n.Name)))
+			g.writeMermaidNodes(sb, n.ID, indent+"  ")
+			sb.WriteString(fmt.Sprintf("%vend\n", indent))
+		case GraphNodeTypeBackground:
+			sb.WriteString(fmt.Sprintf("%v%v([%v])\n", indent, n.ID, quoteMermaid(n.getLabel("<br/>"))))
+		default:
+			sb.WriteString(fmt.Sprintf("%v%v[%v]\n", indent, n.ID, quoteMermaid(n.getLabel("<br/>"))))
+		}
+	}
+}
+
+func (n GraphNode) getLabel(lineBreak string) string {
+	if n.Image != "" {
+		return n.Name + lineBreak + n.Image
+	}
+	if n.RunnerType == RunnerTypeHost {
+		return n.Name + lineBreak + "host"
+	}
+
+	return n.Name
+}
+
+func quoteDOT(value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+
+	return `"` + value + `"`
+}
+
+func quoteMermaid(value string) string {
+	return `"` + strings.Replace(value, `"`, "#quot;", -1) + `"`
+}
@@ -0,0 +1,140 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestGetPipelineGraph(t *testing.T) {
+	t.Run("ConnectsSequentialStagesThroughParallelGroups", func(t *testing.T) {
+
+		manifest := getTestGraphManifest()
+
+		// act
+		graph, err := GetPipelineGraph(manifest, "build/local")
+
+		assert.Nil(t, err)
+		assert.Equal(t, []GraphEdge{
+			{From: "restore", To: "database", Type: GraphEdgeTypeSequence},
+			{From: "database", To: "test_unit_test", Type: GraphEdgeTypeBackground},
+			{From: "database", To: "test_integration_test", Type: GraphEdgeTypeBackground},
+			{From: "test_unit_test", To: "deploy", Type: GraphEdgeTypeSequence},
+			{From: "test_integration_test", To: "deploy", Type: GraphEdgeTypeSequence},
+		}, graph.Edges)
+		assert.Equal(t, GraphNode{ID: "test_integration_test", Name: "integration-test", Path: "test/integration-test", Type: GraphNodeTypeStage, RunnerType: RunnerTypeContainer, Image: "golang:1.17", Parent: "test"}, graph.Nodes[4])
+	})
+
+	t.Run("ReturnsErrorForUndefinedTarget", func(t *testing.T) {
+
+		manifest := getTestGraphManifest()
+
+		// act
+		_, err := GetPipelineGraph(manifest, "release")
+
+		assert.NotNil(t, err)
+		assert.Equal(t, "Target release is not defined in manifest; available targets are build/local, run 'infinity list' to see their stages", err.Error())
+	})
+}
+
+func TestPipelineGraphToMermaid(t *testing.T) {
+	t.Run("RendersParallelGroupsAsSubgraphsAndBackgroundStagesAsStadiums", func(t *testing.T) {
+
+		graph, err := GetPipelineGraph(getTestGraphManifest(), "build/local")
+		assert.Nil(t, err)
+
+		// act
+		output := graph.ToMermaid()
+
+		assert.Equal(t, `flowchart LR
+  restore["restore<br/>golang:1.17"]
+  database(["database<br/>cockroachdb/cockroach:v21.1.5"])
+  subgraph test ["test"]
+    test_unit_test["unit-test<br/>golang:1.17"]
+    test_integration_test["integration-test<br/>golang:1.17"]
+  end
+  deploy["deploy<br/>host"]
+  restore --> database
+  database -.-> test_unit_test
+  database -.-> test_integration_test
+  test_unit_test --> deploy
+  test_integration_test --> deploy
+`, output)
+	})
+}
+
+func TestPipelineGraphToDOT(t *testing.T) {
+	t.Run("RendersParallelGroupsAsClustersAndBackgroundStagesDashed", func(t *testing.T) {
+
+		graph, err := GetPipelineGraph(getTestGraphManifest(), "build/local")
+		assert.Nil(t, err)
+
+		// act
+		output := graph.ToDOT()
+
+		assert.Equal(t, `digraph "build/local" {
+  rankdir=LR;
+  node [shape=box, style=rounded];
+  restore [label="restore\ngolang:1.17"];
+  database [label="database\ncockroachdb/cockroach:v21.1.5", style="rounded,dashed"];
+  subgraph cluster_test {
+    label="test";
+    style=dashed;
+    test_unit_test [label="unit-test\ngolang:1.17"];
+    test_integration_test [label="integration-test\ngolang:1.17"];
+  }
+  deploy [label="deploy\nhost"];
+  restore -> database;
+  database -> test_unit_test [style=dashed];
+  database -> test_integration_test [style=dashed];
+  test_unit_test -> deploy;
+  test_integration_test -> deploy;
+}
+`, output)
+	})
+}
+
+func getTestGraphManifest() Manifest {
+	manifest := Manifest{
+		Targets: []*ManifestTarget{
+			{
+				Name: "build/local",
+				Stages: []*ManifestStage{
+					{
+						Name:     "restore",
+						Image:    "golang:1.17",
+						Commands: []string{"go mod download"},
+					},
+					{
+						Name:       "database",
+						Image:      "cockroachdb/cockroach:v21.1.5",
+						Background: true,
+					},
+					{
+						Name: "test",
+						Stages: []*ManifestStage{
+							{
+								Name:     "unit-test",
+								Image:    "golang:1.17",
+								Commands: []string{"go test ./..."},
+							},
+							{
+								Name:     "integration-test",
+								Image:    "golang:1.17",
+								Commands: []string{"go test -tags integration ./..."},
+							},
+						},
+					},
+					{
+						Name:       "deploy",
+						RunnerType: RunnerTypeHost,
+						Commands:   []string{"./deploy.sh"},
+					},
+				},
+			},
+		},
+	}
+	manifest.SetDefault()
+
+	return manifest
+}
@@ -0,0 +1,285 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/logrusorgru/aurora"
+)
+
+const progressViewRefreshInterval = 100 * time.Millisecond
+
+var progressViewSpinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+type progressView struct {
+	out           io.Writer
+	width         int
+	group         *StageReport
+	rows          []*progressViewRow
+	rowsByReport  map[*StageReport]*progressViewRow
+	renderedLines int
+	frame         int
+	done          chan struct{}
+	stopped       chan struct{}
+	mutex         *sync.Mutex
+}
+
+type progressViewRow struct {
+	report   *StageReport
+	path     string
+	status   StageStatus
+	start    time.Time
+	duration time.Duration
+	lastLine string
+}
+
+// NewProgressView returns an event writer that shows a live row per stage while parallel stages run; other stages log as usual
+func NewProgressView(out io.Writer, width int) RunEventWriter {
+	return &progressView{
+		out:          out,
+		width:        width,
+		rowsByReport: map[*StageReport]*progressViewRow{},
+		mutex:        &sync.Mutex{},
+	}
+}
+
+func (v *progressView) RunStarted(report *RunReport) {
+}
+
+func (v *progressView) StageStarted(report *StageReport) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if row, ok := v.rowsByReport[report]; ok {
+		row.status = StageStatusRunning
+		row.start = time.Now()
+		return
+	}
+
+	if v.group != nil || len(report.Stages) == 0 {
+		return
+	}
+
+	// show a row for each stage of the parallel group and redraw them until it's done
+	v.group = report
+	v.addRows(report.Stages)
+	v.renderedLines = 0
+	v.done = make(chan struct{})
+	v.stopped = make(chan struct{})
+	v.render()
+
+	go v.refresh(v.done, v.stopped)
+}
+
+func (v *progressView) StageLogLine(report *StageReport, line string) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if row, ok := v.rowsByReport[report]; ok && strings.TrimSpace(line) != "" {
+		row.lastLine = line
+	}
+}
+
+func (v *progressView) StageFinished(report *StageReport) {
+	v.mutex.Lock()
+	if row, ok := v.rowsByReport[report]; ok {
+		row.status = report.Status
+		row.duration = time.Since(row.start)
+	}
+	if report != v.group {
+		v.mutex.Unlock()
+		return
+	}
+	done, stopped := v.done, v.stopped
+	v.mutex.Unlock()
+
+	close(done)
+	<-stopped
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	v.render()
+	v.renderFailures()
+
+	v.group = nil
+	v.rows = nil
+	v.rowsByReport = map[*StageReport]*progressViewRow{}
+}
+
+func (v *progressView) RunFinished(report *RunReport) {
+}
+
+// LogOutput discards the logs of stages with a row, since the row shows their last line and failures are printed in full afterwards; other logs get printed above the rows while they're shown, so redrawing the rows doesn't overwrite them
+func (v *progressView) LogOutput(report *StageReport) io.Writer {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if _, ok := v.rowsByReport[report]; ok {
+		return ioutil.Discard
+	}
+
+	return &progressViewWriter{view: v}
+}
+
+type progressViewWriter struct {
+	view   *progressView
+	buffer []byte
+}
+
+// Write prints complete lines above the rows and redraws them below; without rows it writes straight through
+func (w *progressViewWriter) Write(p []byte) (n int, err error) {
+	v := w.view
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if v.group == nil {
+		output := append(w.buffer, p...)
+		w.buffer = nil
+		if _, err = v.out.Write(output); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	// hold on to a partial line until it's complete, a row redraw would split it otherwise
+	w.buffer = append(w.buffer, p...)
+	i := bytes.LastIndexByte(w.buffer, '\n')
+	if i < 0 {
+		return len(p), nil
+	}
+	lines := w.buffer[:i+1]
+	w.buffer = append([]byte{}, w.buffer[i+1:]...)
+
+	v.clear()
+	if _, err = v.out.Write(lines); err != nil {
+		return 0, err
+	}
+	v.render()
+
+	return len(p), nil
+}
+
+func (v *progressView) addRows(stages []*StageReport) {
+	for _, s := range stages {
+		if len(s.Stages) > 0 {
+			v.addRows(s.Stages)
+			continue
+		}
+		row := &progressViewRow{
+			report: s,
+			path:   strings.Join(s.Path, "/"),
+			status: StageStatusUnknown,
+		}
+		v.rows = append(v.rows, row)
+		v.rowsByReport[s] = row
+	}
+}
+
+func (v *progressView) refresh(done, stopped chan struct{}) {
+	defer close(stopped)
+
+	ticker := time.NewTicker(progressViewRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			v.mutex.Lock()
+			v.frame++
+			v.render()
+			v.mutex.Unlock()
+		}
+	}
+}
+
+// clear moves the cursor back to the first row and erases the rows, for other output to take their place
+func (v *progressView) clear() {
+	if v.renderedLines > 0 {
+		_, _ = v.out.Write([]byte(fmt.Sprintf("\x1b[%dA\x1b[J", v.renderedLines)))
+	}
+	v.renderedLines = 0
+}
+
+// render moves the cursor back to the first row and redraws all rows
+func (v *progressView) render() {
+	var sb strings.Builder
+	if v.renderedLines > 0 {
+		sb.WriteString(fmt.Sprintf("\x1b[%dA", v.renderedLines))
+	}
+
+	pathWidth := 0
+	for _, r := range v.rows {
+		if len(r.path) > pathWidth {
+			pathWidth = len(r.path)
+		}
+	}
+
+	for _, r := range v.rows {
+		sb.WriteString("\x1b[2K")
+		sb.WriteString(v.formatRow(r, pathWidth))
+		sb.WriteString("\n")
+	}
+	v.renderedLines = len(v.rows)
+
+	_, _ = v.out.Write([]byte(sb.String()))
+}
+
+func (v *progressView) formatRow(row *progressViewRow, pathWidth int) string {
+	var symbol aurora.Value
+	elapsed := ""
+	switch row.status {
+	case StageStatusRunning:
+		symbol = aurora.BrightCyan(progressViewSpinnerFrames[v.frame%len(progressViewSpinnerFrames)])
+		elapsed = time.Since(row.start).Round(time.Second).String()
+	case StageStatusPassed:
+		symbol = aurora.BrightGreen("✓")
+		elapsed = row.duration.Round(time.Millisecond).String()
+	case StageStatusFailed:
+		symbol = aurora.BrightRed("✗")
+		elapsed = row.duration.Round(time.Millisecond).String()
+	case StageStatusCanceled:
+		symbol = aurora.Gray(12, "⊘")
+		elapsed = row.duration.Round(time.Millisecond).String()
+	default:
+		symbol = aurora.Gray(12, "·")
+	}
+
+	// keep each row on a single line, otherwise moving the cursor up doesn't reach the first row
+	prefix := fmt.Sprintf("%-*v  %8v  ", pathWidth, row.path, elapsed)
+	lastLine := row.lastLine
+	if available := v.width - 2 - len(prefix); available > 0 {
+		if runes := []rune(lastLine); len(runes) > available {
+			lastLine = string(runes[:available-1]) + "…"
+		}
+	} else {
+		lastLine = ""
+	}
+
+	return fmt.Sprintf("%v %v%v", symbol, prefix, aurora.Gray(12, lastLine))
+}
+
+// renderFailures prints the last log lines of failed stages below the rows
+func (v *progressView) renderFailures() {
+	for _, r := range v.rows {
+		if r.status != StageStatusFailed {
+			continue
+		}
+
+		prefix := aurora.BrightRed(fmt.Sprintf("[%v] ", strings.Join(r.report.Path, "] ["))).String()
+		var sb strings.Builder
+		sb.WriteString("\n")
+		for _, line := range r.report.GetLogTail() {
+			sb.WriteString(prefix + line + "\n")
+		}
+
+		_, _ = v.out.Write([]byte(sb.String()))
+	}
+}
@@ -0,0 +1,123 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestProgressView(t *testing.T) {
+	t.Run("DiscardsLogOutputOfParallelStagesOnly", func(t *testing.T) {
+
+		out := &bytes.Buffer{}
+		progressView := NewProgressView(out, 80)
+		group, build, test := getTestParallelStageReports()
+
+		// act
+		progressView.StageStarted(group)
+		progressView.StageStarted(build)
+
+		assert.Equal(t, ioutil.Discard, progressView.LogOutput(build))
+		assert.Equal(t, ioutil.Discard, progressView.LogOutput(test))
+		assert.NotEqual(t, ioutil.Discard, progressView.LogOutput(nil))
+
+		progressView.StageFinished(build)
+		progressView.StageFinished(group)
+		assert.NotEqual(t, ioutil.Discard, progressView.LogOutput(build))
+	})
+
+	t.Run("PrintsOtherLogsAboveRowsAndRedrawsThem", func(t *testing.T) {
+
+		out := &bytes.Buffer{}
+		progressView := NewProgressView(out, 80)
+		group, build, test := getTestParallelStageReports()
+		progressView.StageStarted(group)
+		progressView.StageStarted(build)
+		progressView.StageStarted(test)
+		logOutput := progressView.LogOutput(nil)
+		out.Reset()
+
+		// act
+		_, err := logOutput.Write([]byte("[infinity] pulling "))
+		assert.Nil(t, err)
+		assert.False(t, strings.Contains(out.String(), "pulling"))
+		_, err = logOutput.Write([]byte("image\n"))
+
+		assert.Nil(t, err)
+		assert.True(t, strings.Contains(out.String(), "\x1b[2A\x1b[J[infinity] pulling image\n\x1b[2K"))
+		assert.True(t, strings.Contains(out.String(), "parallel/build"))
+		assert.True(t, strings.Contains(out.String(), "parallel/test"))
+
+		progressView.StageFinished(build)
+		progressView.StageFinished(test)
+		progressView.StageFinished(group)
+		out.Reset()
+		_, err = logOutput.Write([]byte("[infinity] done\n"))
+		assert.Nil(t, err)
+		assert.Equal(t, "[infinity] done\n", out.String())
+	})
+
+	t.Run("RendersRowPerStageWithLastLogLine", func(t *testing.T) {
+
+		out := &bytes.Buffer{}
+		progressView := NewProgressView(out, 80)
+		group, build, test := getTestParallelStageReports()
+
+		// act
+		progressView.StageStarted(group)
+		progressView.StageStarted(build)
+		progressView.StageStarted(test)
+		progressView.StageLogLine(build, "compiling")
+		build.Finish(context.Background(), nil)
+		progressView.StageFinished(build)
+		test.Finish(context.Background(), nil)
+		progressView.StageFinished(test)
+		progressView.StageFinished(group)
+
+		lastRender := out.String()[strings.LastIndex(out.String(), "\x1b[2A"):]
+		assert.True(t, strings.Contains(lastRender, "✓"))
+		assert.True(t, strings.Contains(lastRender, "parallel/build"))
+		assert.True(t, strings.Contains(lastRender, "compiling"))
+		assert.True(t, strings.Contains(lastRender, "parallel/test"))
+	})
+
+	t.Run("PrintsLogTailOfFailedStages", func(t *testing.T) {
+
+		out := &bytes.Buffer{}
+		progressView := NewProgressView(out, 80)
+		group, build, test := getTestParallelStageReports()
+
+		// act
+		progressView.StageStarted(group)
+		progressView.StageStarted(build)
+		progressView.StageStarted(test)
+		build.Finish(context.Background(), nil)
+		progressView.StageFinished(build)
+		test.AddLogLine("--- FAIL: TestSomething")
+		test.Finish(context.Background(), fmt.Errorf("stage test failed with exit code 1"))
+		progressView.StageFinished(test)
+		progressView.StageFinished(group)
+
+		assert.True(t, strings.Contains(out.String(), "✗"))
+		assert.True(t, strings.Contains(out.String(), "[parallel] [test] \x1b[0m--- FAIL: TestSomething\n"))
+	})
+}
+
+func getTestParallelStageReports() (group, build, test *StageReport) {
+	reports := newStageReports([]*ManifestStage{
+		{
+			Name: "parallel",
+			Stages: []*ManifestStage{
+				{Name: "build", RunnerType: RunnerTypeHost},
+				{Name: "test", RunnerType: RunnerTypeHost},
+			},
+		},
+	}, nil)
+
+	return reports[0], reports[0].Stages[0], reports[0].Stages[1]
+}
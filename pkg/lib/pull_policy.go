@@ -0,0 +1,45 @@
+package lib
+
+type PullPolicy string
+
+const (
+	PullPolicyUnknown      PullPolicy = ""
+	PullPolicyAlways       PullPolicy = "always"
+	PullPolicyIfNotPresent PullPolicy = "ifNotPresent"
+	PullPolicyNever        PullPolicy = "never"
+)
+
+type pullPolicies []PullPolicy
+
+func (pullPolicies pullPolicies) ToStringArray() (result []string) {
+	for _, p := range pullPolicies {
+		result = append(result, string(p))
+	}
+	return
+}
+
+// SupportedPullPolicies are ordered from the policy that pulls the most to the one that pulls the least
+var SupportedPullPolicies = pullPolicies{
+	PullPolicyAlways,
+	PullPolicyIfNotPresent,
+	PullPolicyNever,
+}
+
+func (pullPolicy PullPolicy) IsSupported() bool {
+	for _, p := range SupportedPullPolicies {
+		if pullPolicy == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Strictest returns the policy that pulls the most of both, for stages that share an image
+func (pullPolicy PullPolicy) Strictest(other PullPolicy) PullPolicy {
+	for _, p := range SupportedPullPolicies {
+		if pullPolicy == p || other == p {
+			return p
+		}
+	}
+	return pullPolicy
+}
@@ -0,0 +1,71 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestSupportedPullPolicies(t *testing.T) {
+	t.Run("ReturnsAllEnumValuesExceptForUnknown", func(t *testing.T) {
+
+		// act
+		supportedPullPolicies := SupportedPullPolicies.ToStringArray()
+
+		assert.Equal(t, 3, len(supportedPullPolicies))
+	})
+}
+
+func TestIsSupportedPullPolicy(t *testing.T) {
+	t.Run("ReturnsFalseForUnknownPullPolicy", func(t *testing.T) {
+
+		unknownPullPolicy := PullPolicy("IfNotPresent")
+
+		// act
+		isSupported := unknownPullPolicy.IsSupported()
+
+		assert.False(t, isSupported)
+	})
+
+	t.Run("ReturnsFalseForPullPolicyUnknown", func(t *testing.T) {
+
+		// act
+		isSupported := PullPolicyUnknown.IsSupported()
+
+		assert.False(t, isSupported)
+	})
+
+	t.Run("ReturnsTrueForAllSupportedPullPolicies", func(t *testing.T) {
+		for _, pullPolicy := range SupportedPullPolicies {
+			// act
+			isSupported := pullPolicy.IsSupported()
+			assert.True(t, isSupported)
+		}
+	})
+}
+
+func TestStrictestPullPolicy(t *testing.T) {
+	t.Run("ReturnsAlwaysIfEitherPolicyIsAlways", func(t *testing.T) {
+
+		// act
+		pullPolicy := PullPolicyIfNotPresent.Strictest(PullPolicyAlways)
+
+		assert.Equal(t, PullPolicyAlways, pullPolicy)
+	})
+
+	t.Run("ReturnsIfNotPresentForIfNotPresentAndNever", func(t *testing.T) {
+
+		// act
+		pullPolicy := PullPolicyNever.Strictest(PullPolicyIfNotPresent)
+
+		assert.Equal(t, PullPolicyIfNotPresent, pullPolicy)
+	})
+
+	t.Run("ReturnsNeverIfBothPoliciesAreNever", func(t *testing.T) {
+
+		// act
+		pullPolicy := PullPolicyNever.Strictest(PullPolicyNever)
+
+		assert.Equal(t, PullPolicyNever, pullPolicy)
+	})
+}
@@ -0,0 +1,71 @@
+package lib
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const dockerHubRegistry = "docker.io"
+
+// RegistryCredentials are the credentials to pull from a registry; the password comes from a secret or envvar, or is a token printed by the command, and with a credential helper docker asks the helper instead
+type RegistryCredentials struct {
+	Host             string
+	Username         string
+	Password         string
+	Command          string
+	CredentialHelper string
+}
+
+// getImageRegistry returns the registry host of an image the way docker resolves it; images without registry host come from Docker Hub
+func getImageRegistry(image string) string {
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		return getRegistryHost(parts[0])
+	}
+
+	return dockerHubRegistry
+}
+
+// getRegistryHost normalizes the aliases of Docker Hub
+func getRegistryHost(host string) string {
+	switch host {
+	case "index.docker.io", "registry-1.docker.io", "https://index.docker.io/v1/":
+		return dockerHubRegistry
+	}
+
+	return host
+}
+
+// getDockerConfig returns a docker config.json with the credentials for each registry, for docker to use instead of the logins of the host
+func getDockerConfig(credentials []RegistryCredentials) ([]byte, error) {
+	type dockerAuth struct {
+		Auth string `json:"auth"`
+	}
+	config := struct {
+		Auths       map[string]dockerAuth `json:"auths"`
+		CredHelpers map[string]string     `json:"credHelpers,omitempty"`
+	}{
+		Auths:       map[string]dockerAuth{},
+		CredHelpers: map[string]string{},
+	}
+
+	for _, c := range credentials {
+		// docker keys the credentials for Docker Hub by its legacy index url
+		key := getRegistryHost(c.Host)
+		if key == dockerHubRegistry {
+			key = "https://index.docker.io/v1/"
+		}
+
+		if c.CredentialHelper != "" {
+			config.CredHelpers[key] = c.CredentialHelper
+			continue
+		}
+		config.Auths[key] = dockerAuth{
+			Auth: base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%v:%v", c.Username, c.Password))),
+		}
+	}
+
+	return json.MarshalIndent(config, "", "  ")
+}
@@ -0,0 +1,54 @@
+package lib
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestGetImageRegistry(t *testing.T) {
+	t.Run("ReturnsDockerHubForImagesWithoutRegistryHost", func(t *testing.T) {
+
+		// act
+		registries := []string{getImageRegistry("alpine:3.13"), getImageRegistry("jsalverda/bake:1.0"), getImageRegistry("docker.io/library/golang:1.17")}
+
+		assert.Equal(t, []string{"docker.io", "docker.io", "docker.io"}, registries)
+	})
+
+	t.Run("ReturnsHostOfImagesWithRegistryHost", func(t *testing.T) {
+
+		// act
+		registries := []string{getImageRegistry("registry.example.com/base/go:1.17"), getImageRegistry("localhost:5000/app"), getImageRegistry("localhost/app@sha256:abc123")}
+
+		assert.Equal(t, []string{"registry.example.com", "localhost:5000", "localhost"}, registries)
+	})
+}
+
+func TestGetDockerConfig(t *testing.T) {
+	t.Run("ReturnsAuthForPasswordsAndCredHelperForCredentialHelpers", func(t *testing.T) {
+
+		credentials := []RegistryCredentials{
+			{Host: "registry.example.com", Username: "ci", Password: "s3cr3t"},
+			{Host: "docker.io", Username: "jsalverda", Password: "token"},
+			{Host: "123456789.dkr.ecr.eu-west-1.amazonaws.com", CredentialHelper: "ecr-login"},
+		}
+
+		// act
+		configBytes, err := getDockerConfig(credentials)
+
+		assert.Nil(t, err)
+		var config map[string]interface{}
+		err = json.Unmarshal(configBytes, &config)
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"auths": map[string]interface{}{
+				"registry.example.com":        map[string]interface{}{"auth": "Y2k6czNjcjN0"},
+				"https://index.docker.io/v1/": map[string]interface{}{"auth": "anNhbHZlcmRhOnRva2Vu"},
+			},
+			"credHelpers": map[string]interface{}{
+				"123456789.dkr.ecr.eu-west-1.amazonaws.com": "ecr-login",
+			},
+		}, config)
+	})
+}
@@ -0,0 +1,117 @@
+package lib
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type RunEventType string
+
+const (
+	RunEventTypeRunStarted    RunEventType = "runStarted"
+	RunEventTypeStageStarted  RunEventType = "stageStarted"
+	RunEventTypeLogLine       RunEventType = "logLine"
+	RunEventTypeStageFinished RunEventType = "stageFinished"
+	RunEventTypeRunFinished   RunEventType = "runFinished"
+)
+
+type RunEvent struct {
+	Type            RunEventType `json:"type"`
+	Time            time.Time    `json:"time"`
+	Target          string       `json:"target,omitempty"`
+	Stage           string       `json:"stage,omitempty"`
+	Line            string       `json:"line,omitempty"`
+	Status          StageStatus  `json:"status,omitempty"`
+	ExitCode        *int         `json:"exitCode,omitempty"`
+	DurationSeconds float64      `json:"durationSeconds,omitempty"`
+	Error           string       `json:"error,omitempty"`
+}
+
+//go:generate mockgen -package=lib -destination ./run_event_writer_mock.go -source=run_event_writer.go
+type RunEventWriter interface {
+	RunStarted(report *RunReport)
+	StageStarted(report *StageReport)
+	StageLogLine(report *StageReport, line string)
+	StageFinished(report *StageReport)
+	RunFinished(report *RunReport)
+	LogOutput(report *StageReport) io.Writer
+}
+
+type runEventWriter struct {
+	out   io.Writer
+	mutex *sync.Mutex
+}
+
+// NewRunEventWriter returns a writer that emits each event as a single line of json, so it can be consumed as a stream
+func NewRunEventWriter(out io.Writer) RunEventWriter {
+	return &runEventWriter{
+		out:   out,
+		mutex: &sync.Mutex{},
+	}
+}
+
+func (w *runEventWriter) RunStarted(report *RunReport) {
+	w.write(RunEvent{
+		Type:   RunEventTypeRunStarted,
+		Target: report.Target,
+	})
+}
+
+func (w *runEventWriter) StageStarted(report *StageReport) {
+	w.write(RunEvent{
+		Type:  RunEventTypeStageStarted,
+		Stage: strings.Join(report.Path, "/"),
+	})
+}
+
+func (w *runEventWriter) StageLogLine(report *StageReport, line string) {
+	w.write(RunEvent{
+		Type:  RunEventTypeLogLine,
+		Stage: strings.Join(report.Path, "/"),
+		Line:  line,
+	})
+}
+
+func (w *runEventWriter) StageFinished(report *StageReport) {
+	w.write(RunEvent{
+		Type:            RunEventTypeStageFinished,
+		Stage:           strings.Join(report.Path, "/"),
+		Status:          report.Status,
+		ExitCode:        report.ExitCode,
+		DurationSeconds: report.DurationSeconds,
+		Error:           report.Error,
+	})
+}
+
+func (w *runEventWriter) RunFinished(report *RunReport) {
+	w.write(RunEvent{
+		Type:            RunEventTypeRunFinished,
+		Target:          report.Target,
+		Status:          report.Status,
+		DurationSeconds: report.DurationSeconds,
+	})
+}
+
+// LogOutput returns stderr for human readable logs, to keep stdout machine-readable
+func (w *runEventWriter) LogOutput(report *StageReport) io.Writer {
+	return os.Stderr
+}
+
+func (w *runEventWriter) write(event RunEvent) {
+	event.Time = time.Now().UTC()
+
+	output, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	// parallel stages emit events concurrently, so keep lines from interleaving
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	_, _ = w.out.Write(append(output, '\n'))
+}
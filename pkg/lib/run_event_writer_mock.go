@@ -0,0 +1,109 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: run_event_writer.go
+
+// Package lib is a generated GoMock package.
+package lib
+
+import (
+	io "io"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockRunEventWriter is a mock of RunEventWriter interface.
+type MockRunEventWriter struct {
+	ctrl     *gomock.Controller
+	recorder *MockRunEventWriterMockRecorder
+}
+
+// MockRunEventWriterMockRecorder is the mock recorder for MockRunEventWriter.
+type MockRunEventWriterMockRecorder struct {
+	mock *MockRunEventWriter
+}
+
+// NewMockRunEventWriter creates a new mock instance.
+func NewMockRunEventWriter(ctrl *gomock.Controller) *MockRunEventWriter {
+	mock := &MockRunEventWriter{ctrl: ctrl}
+	mock.recorder = &MockRunEventWriterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRunEventWriter) EXPECT() *MockRunEventWriterMockRecorder {
+	return m.recorder
+}
+
+// LogOutput mocks base method.
+func (m *MockRunEventWriter) LogOutput(report *StageReport) io.Writer {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LogOutput", report)
+	ret0, _ := ret[0].(io.Writer)
+	return ret0
+}
+
+// LogOutput indicates an expected call of LogOutput.
+func (mr *MockRunEventWriterMockRecorder) LogOutput(report interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LogOutput", reflect.TypeOf((*MockRunEventWriter)(nil).LogOutput), report)
+}
+
+// RunFinished mocks base method.
+func (m *MockRunEventWriter) RunFinished(report *RunReport) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "RunFinished", report)
+}
+
+// RunFinished indicates an expected call of RunFinished.
+func (mr *MockRunEventWriterMockRecorder) RunFinished(report interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunFinished", reflect.TypeOf((*MockRunEventWriter)(nil).RunFinished), report)
+}
+
+// RunStarted mocks base method.
+func (m *MockRunEventWriter) RunStarted(report *RunReport) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "RunStarted", report)
+}
+
+// RunStarted indicates an expected call of RunStarted.
+func (mr *MockRunEventWriterMockRecorder) RunStarted(report interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunStarted", reflect.TypeOf((*MockRunEventWriter)(nil).RunStarted), report)
+}
+
+// StageFinished mocks base method.
+func (m *MockRunEventWriter) StageFinished(report *StageReport) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "StageFinished", report)
+}
+
+// StageFinished indicates an expected call of StageFinished.
+func (mr *MockRunEventWriterMockRecorder) StageFinished(report interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StageFinished", reflect.TypeOf((*MockRunEventWriter)(nil).StageFinished), report)
+}
+
+// StageLogLine mocks base method.
+func (m *MockRunEventWriter) StageLogLine(report *StageReport, line string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "StageLogLine", report, line)
+}
+
+// StageLogLine indicates an expected call of StageLogLine.
+func (mr *MockRunEventWriterMockRecorder) StageLogLine(report, line interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StageLogLine", reflect.TypeOf((*MockRunEventWriter)(nil).StageLogLine), report, line)
+}
+
+// StageStarted mocks base method.
+func (m *MockRunEventWriter) StageStarted(report *StageReport) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "StageStarted", report)
+}
+
+// StageStarted indicates an expected call of StageStarted.
+func (mr *MockRunEventWriterMockRecorder) StageStarted(report interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StageStarted", reflect.TypeOf((*MockRunEventWriter)(nil).StageStarted), report)
+}
@@ -0,0 +1,53 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestRunEventWriter(t *testing.T) {
+	t.Run("WritesEachEventAsSingleJSONLine", func(t *testing.T) {
+
+		out := &bytes.Buffer{}
+		eventWriter := NewRunEventWriter(out)
+		stageReport := &StageReport{Name: "test", Path: []string{"parallel", "test"}}
+
+		// act
+		eventWriter.StageStarted(stageReport)
+		eventWriter.StageLogLine(stageReport, "ok  	github.com/JorritSalverda/infinity")
+
+		lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+		assert.Equal(t, 2, len(lines))
+
+		var event RunEvent
+		err := json.Unmarshal([]byte(lines[1]), &event)
+		assert.Nil(t, err)
+		assert.Equal(t, RunEventTypeLogLine, event.Type)
+		assert.Equal(t, "parallel/test", event.Stage)
+		assert.Equal(t, "ok  	github.com/JorritSalverda/infinity", event.Line)
+	})
+
+	t.Run("WritesExitCodeAndDurationOfFinishedStage", func(t *testing.T) {
+
+		out := &bytes.Buffer{}
+		eventWriter := NewRunEventWriter(out)
+		exitCode := 3
+		stageReport := &StageReport{Name: "test", Path: []string{"test"}, Status: StageStatusFailed, ExitCode: &exitCode, DurationSeconds: 1.5, Error: "stage test failed with exit code 3"}
+
+		// act
+		eventWriter.StageFinished(stageReport)
+
+		var event RunEvent
+		err := json.Unmarshal(out.Bytes(), &event)
+		assert.Nil(t, err)
+		assert.Equal(t, RunEventTypeStageFinished, event.Type)
+		assert.Equal(t, StageStatusFailed, event.Status)
+		assert.Equal(t, 3, *event.ExitCode)
+		assert.Equal(t, 1.5, event.DurationSeconds)
+		assert.Equal(t, "stage test failed with exit code 3", event.Error)
+	})
+}
@@ -0,0 +1,256 @@
+package lib
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type RunHistoryEntry struct {
+	ID              string            `json:"id"`
+	Target          string            `json:"target"`
+	Revision        string            `json:"revision,omitempty"`
+	Branch          string            `json:"branch,omitempty"`
+	Dirty           bool              `json:"dirty,omitempty"`
+	Version         string            `json:"version,omitempty"`
+	Status          StageStatus       `json:"status"`
+	Start           time.Time         `json:"start"`
+	DurationSeconds float64           `json:"durationSeconds"`
+	Stages          []RunHistoryStage `json:"stages,omitempty"`
+}
+
+type RunHistoryStage struct {
+	Path            string      `json:"path"`
+	Status          StageStatus `json:"status"`
+	DurationSeconds float64     `json:"durationSeconds"`
+	ExitCode        *int        `json:"exitCode,omitempty"`
+}
+
+//go:generate mockgen -package=lib -destination ./run_history_mock.go -source=run_history.go
+type RunHistory interface {
+	AddRun(ctx context.Context, report *RunReport) (err error)
+	GetRuns(ctx context.Context, target string) (runs []RunHistoryEntry, err error)
+	GetRun(ctx context.Context, id string) (run RunHistoryEntry, err error)
+	Prune(ctx context.Context, retention int) (err error)
+}
+
+type runHistory struct {
+	buildDirectory string
+}
+
+// NewRunHistory returns a history of runs stored as json lines in .infinity/history.jsonl of the build directory
+func NewRunHistory(buildDirectory string) RunHistory {
+	return &runHistory{
+		buildDirectory: buildDirectory,
+	}
+}
+
+func (h *runHistory) AddRun(ctx context.Context, report *RunReport) (err error) {
+	if err = createInfinityDirectory(h.buildDirectory); err != nil {
+		return
+	}
+
+	entry := RunHistoryEntry{
+		ID:              report.ID,
+		Target:          report.Target,
+		Revision:        report.Git.Revision,
+		Branch:          report.Git.Branch,
+		Dirty:           report.Git.Dirty,
+		Version:         report.Version,
+		Status:          report.Status,
+		Start:           report.Start,
+		DurationSeconds: report.DurationSeconds,
+		Stages:          h.getStages(report.Stages),
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	file, err := os.OpenFile(h.getHistoryPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	_, err = file.Write(append(line, '\n'))
+	closeErr := file.Close()
+	if err != nil {
+		return
+	}
+
+	return closeErr
+}
+
+// GetRuns returns the runs of a target, or of all targets if it's empty, oldest first
+func (h *runHistory) GetRuns(ctx context.Context, target string) (runs []RunHistoryEntry, err error) {
+	allRuns, err := h.readRuns()
+	if err != nil {
+		return
+	}
+
+	for _, r := range allRuns {
+		if target == "" || r.Target == target {
+			runs = append(runs, r)
+		}
+	}
+
+	return
+}
+
+func (h *runHistory) GetRun(ctx context.Context, id string) (run RunHistoryEntry, err error) {
+	runs, err := h.readRuns()
+	if err != nil {
+		return
+	}
+
+	for _, r := range runs {
+		if r.ID == id {
+			return r, nil
+		}
+	}
+
+	return run, fmt.Errorf("run %v is not in the history", id)
+}
+
+func (h *runHistory) readRuns() (runs []RunHistoryEntry, err error) {
+	file, err := os.Open(h.getHistoryPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var run RunHistoryEntry
+		// skip entries that got truncated, for example by an interrupted write
+		if json.Unmarshal([]byte(line), &run) != nil {
+			continue
+		}
+		runs = append(runs, run)
+	}
+
+	return runs, scanner.Err()
+}
+
+// Prune removes all but the most recent runs from the history file
+func (h *runHistory) Prune(ctx context.Context, retention int) (err error) {
+	runs, err := h.readRuns()
+	if err != nil || len(runs) <= retention {
+		return
+	}
+
+	output := []byte{}
+	for _, r := range runs[len(runs)-retention:] {
+		line, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		output = append(output, append(line, '\n')...)
+	}
+
+	// replace the file in one go, so it doesn't end up half written
+	temporaryPath := h.getHistoryPath() + ".tmp"
+	if err = ioutil.WriteFile(temporaryPath, output, 0644); err != nil {
+		return
+	}
+
+	return os.Rename(temporaryPath, h.getHistoryPath())
+}
+
+func (h *runHistory) getStages(stages []*StageReport) (historyStages []RunHistoryStage) {
+	for _, s := range stages {
+		historyStages = append(historyStages, RunHistoryStage{
+			Path:            strings.Join(s.Path, "/"),
+			Status:          s.Status,
+			DurationSeconds: s.DurationSeconds,
+			ExitCode:        s.ExitCode,
+		})
+		historyStages = append(historyStages, h.getStages(s.Stages)...)
+	}
+
+	return
+}
+
+func (h *runHistory) getHistoryPath() string {
+	return filepath.Join(h.buildDirectory, ".infinity", "history.jsonl")
+}
+
+type StageTrend struct {
+	Path                   string
+	Runs                   int
+	Failures               int
+	AverageDurationSeconds float64
+	// Flips counts how often the stage changed between passing and failing in consecutive runs
+	Flips int
+}
+
+// GetStageTrends returns the average duration and stability of each stage over runs that ran it to completion
+func GetStageTrends(runs []RunHistoryEntry) (trends []StageTrend) {
+	trendsByPath := map[string]*StageTrend{}
+	lastStatusByPath := map[string]StageStatus{}
+	paths := []string{}
+
+	for _, r := range runs {
+		for _, s := range r.Stages {
+			if s.Status != StageStatusPassed && s.Status != StageStatusFailed {
+				continue
+			}
+
+			trend, ok := trendsByPath[s.Path]
+			if !ok {
+				trend = &StageTrend{Path: s.Path}
+				trendsByPath[s.Path] = trend
+				paths = append(paths, s.Path)
+			}
+
+			trend.AverageDurationSeconds = (trend.AverageDurationSeconds*float64(trend.Runs) + s.DurationSeconds) / float64(trend.Runs+1)
+			trend.Runs++
+			if s.Status == StageStatusFailed {
+				trend.Failures++
+			}
+			if lastStatus, ok := lastStatusByPath[s.Path]; ok && lastStatus != s.Status {
+				trend.Flips++
+			}
+			lastStatusByPath[s.Path] = s.Status
+		}
+	}
+
+	for _, p := range paths {
+		trends = append(trends, *trendsByPath[p])
+	}
+
+	return
+}
+
+// GetFlakiestStage returns the stage that flipped between passing and failing most often, or nil if none did
+func GetFlakiestStage(trends []StageTrend) *StageTrend {
+	sortedTrends := append([]StageTrend{}, trends...)
+	sort.SliceStable(sortedTrends, func(i, j int) bool {
+		if sortedTrends[i].Flips != sortedTrends[j].Flips {
+			return sortedTrends[i].Flips > sortedTrends[j].Flips
+		}
+		return sortedTrends[i].Failures > sortedTrends[j].Failures
+	})
+
+	if len(sortedTrends) == 0 || sortedTrends[0].Flips == 0 {
+		return nil
+	}
+
+	return &sortedTrends[0]
+}
@@ -0,0 +1,93 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: run_history.go
+
+// Package lib is a generated GoMock package.
+package lib
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockRunHistory is a mock of RunHistory interface.
+type MockRunHistory struct {
+	ctrl     *gomock.Controller
+	recorder *MockRunHistoryMockRecorder
+}
+
+// MockRunHistoryMockRecorder is the mock recorder for MockRunHistory.
+type MockRunHistoryMockRecorder struct {
+	mock *MockRunHistory
+}
+
+// NewMockRunHistory creates a new mock instance.
+func NewMockRunHistory(ctrl *gomock.Controller) *MockRunHistory {
+	mock := &MockRunHistory{ctrl: ctrl}
+	mock.recorder = &MockRunHistoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRunHistory) EXPECT() *MockRunHistoryMockRecorder {
+	return m.recorder
+}
+
+// AddRun mocks base method.
+func (m *MockRunHistory) AddRun(ctx context.Context, report *RunReport) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddRun", ctx, report)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddRun indicates an expected call of AddRun.
+func (mr *MockRunHistoryMockRecorder) AddRun(ctx, report interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddRun", reflect.TypeOf((*MockRunHistory)(nil).AddRun), ctx, report)
+}
+
+// GetRun mocks base method.
+func (m *MockRunHistory) GetRun(ctx context.Context, id string) (RunHistoryEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRun", ctx, id)
+	ret0, _ := ret[0].(RunHistoryEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRun indicates an expected call of GetRun.
+func (mr *MockRunHistoryMockRecorder) GetRun(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRun", reflect.TypeOf((*MockRunHistory)(nil).GetRun), ctx, id)
+}
+
+// GetRuns mocks base method.
+func (m *MockRunHistory) GetRuns(ctx context.Context, target string) ([]RunHistoryEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRuns", ctx, target)
+	ret0, _ := ret[0].([]RunHistoryEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRuns indicates an expected call of GetRuns.
+func (mr *MockRunHistoryMockRecorder) GetRuns(ctx, target interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRuns", reflect.TypeOf((*MockRunHistory)(nil).GetRuns), ctx, target)
+}
+
+// Prune mocks base method.
+func (m *MockRunHistory) Prune(ctx context.Context, retention int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Prune", ctx, retention)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Prune indicates an expected call of Prune.
+func (mr *MockRunHistoryMockRecorder) Prune(ctx, retention interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Prune", reflect.TypeOf((*MockRunHistory)(nil).Prune), ctx, retention)
+}
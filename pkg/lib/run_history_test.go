@@ -0,0 +1,145 @@
+package lib
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestRunHistory(t *testing.T) {
+	t.Run("AddsRunWithFlattenedStages", func(t *testing.T) {
+
+		dir, err := ioutil.TempDir("", "history")
+		assert.Nil(t, err)
+		defer os.RemoveAll(dir)
+		runHistory := NewRunHistory(dir)
+		report := getTestRunReport()
+		report.ID = "20210601-120000.000-abcd"
+		report.Git = GitInfo{Revision: "f2d3c4b5a6978877665544332211009988776655", Branch: "main"}
+
+		// act
+		err = runHistory.AddRun(context.Background(), report)
+
+		assert.Nil(t, err)
+		run, err := runHistory.GetRun(context.Background(), "20210601-120000.000-abcd")
+		assert.Nil(t, err)
+		assert.Equal(t, "build/local", run.Target)
+		assert.Equal(t, "f2d3c4b5a6978877665544332211009988776655", run.Revision)
+		assert.Equal(t, 5, len(run.Stages))
+		assert.Equal(t, "test/unit", run.Stages[2].Path)
+		assert.Equal(t, StageStatusFailed, run.Stages[2].Status)
+		assert.Equal(t, 2, *run.Stages[2].ExitCode)
+	})
+
+	t.Run("ReturnsRunsOfTargetOldestFirst", func(t *testing.T) {
+
+		dir, err := ioutil.TempDir("", "history")
+		assert.Nil(t, err)
+		defer os.RemoveAll(dir)
+		runHistory := NewRunHistory(dir)
+		for _, r := range []RunReport{{ID: "1", Target: "build/local"}, {ID: "2", Target: "release/production"}, {ID: "3", Target: "build/local"}} {
+			r := r
+			assert.Nil(t, runHistory.AddRun(context.Background(), &r))
+		}
+
+		// act
+		runs, err := runHistory.GetRuns(context.Background(), "build/local")
+
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(runs))
+		assert.Equal(t, "1", runs[0].ID)
+		assert.Equal(t, "3", runs[1].ID)
+	})
+
+	t.Run("ReturnsErrorForUnknownRun", func(t *testing.T) {
+
+		dir, err := ioutil.TempDir("", "history")
+		assert.Nil(t, err)
+		defer os.RemoveAll(dir)
+		runHistory := NewRunHistory(dir)
+
+		// act
+		_, err = runHistory.GetRun(context.Background(), "1")
+
+		assert.NotNil(t, err)
+		assert.Equal(t, "run 1 is not in the history", err.Error())
+	})
+
+	t.Run("PruneKeepsMostRecentRuns", func(t *testing.T) {
+
+		dir, err := ioutil.TempDir("", "history")
+		assert.Nil(t, err)
+		defer os.RemoveAll(dir)
+		runHistory := NewRunHistory(dir)
+		for _, r := range []RunReport{{ID: "1", Target: "build/local"}, {ID: "2", Target: "build/local"}, {ID: "3", Target: "build/local"}} {
+			r := r
+			assert.Nil(t, runHistory.AddRun(context.Background(), &r))
+		}
+
+		// act
+		err = runHistory.Prune(context.Background(), 2)
+
+		assert.Nil(t, err)
+		runs, err := runHistory.GetRuns(context.Background(), "")
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(runs))
+		assert.Equal(t, "2", runs[0].ID)
+		assert.Equal(t, "3", runs[1].ID)
+	})
+}
+
+func TestGetStageTrends(t *testing.T) {
+	t.Run("AveragesDurationOfCompletedStages", func(t *testing.T) {
+
+		runs := []RunHistoryEntry{
+			{Stages: []RunHistoryStage{{Path: "build", Status: StageStatusPassed, DurationSeconds: 10}}},
+			{Stages: []RunHistoryStage{{Path: "build", Status: StageStatusSkipped}}},
+			{Stages: []RunHistoryStage{{Path: "build", Status: StageStatusFailed, DurationSeconds: 20}}},
+		}
+
+		// act
+		trends := GetStageTrends(runs)
+
+		assert.Equal(t, []StageTrend{{Path: "build", Runs: 2, Failures: 1, AverageDurationSeconds: 15, Flips: 1}}, trends)
+	})
+}
+
+func TestGetFlakiestStage(t *testing.T) {
+	t.Run("ReturnsStageWithMostFlips", func(t *testing.T) {
+
+		runs := []RunHistoryEntry{}
+		for i, status := range []StageStatus{StageStatusPassed, StageStatusFailed, StageStatusPassed, StageStatusFailed} {
+			runs = append(runs, RunHistoryEntry{
+				Start: time.Date(2021, 6, i+1, 12, 0, 0, 0, time.UTC),
+				Stages: []RunHistoryStage{
+					{Path: "build", Status: StageStatusPassed},
+					{Path: "integration-test", Status: status},
+				},
+			})
+		}
+
+		// act
+		flakiestStage := GetFlakiestStage(GetStageTrends(runs))
+
+		assert.NotNil(t, flakiestStage)
+		assert.Equal(t, "integration-test", flakiestStage.Path)
+		assert.Equal(t, 3, flakiestStage.Flips)
+	})
+
+	t.Run("ReturnsNilIfNoStageFlipped", func(t *testing.T) {
+
+		runs := []RunHistoryEntry{
+			{Stages: []RunHistoryStage{{Path: "build", Status: StageStatusFailed}}},
+			{Stages: []RunHistoryStage{{Path: "build", Status: StageStatusFailed}}},
+		}
+
+		// act
+		flakiestStage := GetFlakiestStage(GetStageTrends(runs))
+
+		assert.Nil(t, flakiestStage)
+	})
+}
@@ -0,0 +1,175 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+type StageStatus string
+
+const (
+	StageStatusUnknown  StageStatus = ""
+	StageStatusRunning  StageStatus = "running"
+	StageStatusPassed   StageStatus = "passed"
+	StageStatusFailed   StageStatus = "failed"
+	StageStatusCanceled StageStatus = "canceled"
+	StageStatusSkipped  StageStatus = "skipped"
+)
+
+// stageLogTailLines is the number of log lines kept per stage to show why it failed
+const stageLogTailLines = 50
+
+type RunReport struct {
+	ID              string         `json:"id"`
+	Target          string         `json:"target"`
+	Git             GitInfo        `json:"git"`
+	Version         string         `json:"version,omitempty"`
+	Status          StageStatus    `json:"status"`
+	Start           time.Time      `json:"start"`
+	Duration        time.Duration  `json:"-"`
+	DurationSeconds float64        `json:"durationSeconds"`
+	Stages          []*StageReport `json:"stages,omitempty"`
+}
+
+func NewRunReport(target string) *RunReport {
+	start := time.Now()
+
+	return &RunReport{
+		// ids sort in order of start time
+		ID:     fmt.Sprintf("%v-%v", start.UTC().Format("20060102-150405.000"), generateRandomHex(2)),
+		Target: target,
+		Status: StageStatusRunning,
+		Start:  start,
+	}
+}
+
+// SetStages creates a skipped report for each stage, so stages that never run still show up
+func (r *RunReport) SetStages(stages []*ManifestStage) {
+	r.Stages = newStageReports(stages, nil)
+}
+
+func (r *RunReport) Finish(ctx context.Context, err error) {
+	r.Duration = time.Since(r.Start)
+	r.DurationSeconds = r.Duration.Seconds()
+	r.Status = getStageStatus(ctx, err)
+}
+
+type StageReport struct {
+	Name            string         `json:"name"`
+	Path            []string       `json:"path"`
+	RunnerType      RunnerType     `json:"runner,omitempty"`
+	Image           string         `json:"image,omitempty"`
+	Background      bool           `json:"background,omitempty"`
+	Status          StageStatus    `json:"status"`
+	Start           *time.Time     `json:"start,omitempty"`
+	Duration        time.Duration  `json:"-"`
+	DurationSeconds float64        `json:"durationSeconds"`
+	ExitCode        *int           `json:"exitCode,omitempty"`
+	Error           string         `json:"error,omitempty"`
+	LogTail         []string       `json:"logTail,omitempty"`
+	Stages          []*StageReport `json:"stages,omitempty"`
+	mutex           *sync.Mutex
+}
+
+func newStageReports(stages []*ManifestStage, parentPath []string) (reports []*StageReport) {
+	for _, s := range stages {
+		path := append(append([]string{}, parentPath...), s.Name)
+		report := &StageReport{
+			Name:       s.Name,
+			Path:       path,
+			Status:     StageStatusSkipped,
+			Background: s.Background,
+			mutex:      &sync.Mutex{},
+		}
+		if len(s.Stages) == 0 {
+			report.RunnerType = s.RunnerType
+			report.Image = s.Image
+		}
+		report.Stages = newStageReports(s.Stages, path)
+		reports = append(reports, report)
+	}
+
+	return
+}
+
+func (r *StageReport) Started() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	start := time.Now()
+	r.Start = &start
+	r.Status = StageStatusRunning
+}
+
+func (r *StageReport) Finish(ctx context.Context, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.Start != nil {
+		r.Duration = time.Since(*r.Start)
+		r.DurationSeconds = r.Duration.Seconds()
+	}
+	r.Status = getStageStatus(ctx, err)
+
+	if err != nil && r.Status == StageStatusFailed {
+		r.Error = err.Error()
+
+		var stageExitError *StageExitError
+		var commandExitError *exec.ExitError
+		if errors.As(err, &stageExitError) {
+			r.ExitCode = &stageExitError.ExitCode
+		} else if errors.As(err, &commandExitError) {
+			exitCode := commandExitError.ExitCode()
+			r.ExitCode = &exitCode
+		}
+	}
+}
+
+// AddLogLine keeps the last lines of the stage output
+func (r *StageReport) AddLogLine(line string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.LogTail = append(r.LogTail, line)
+	if len(r.LogTail) > stageLogTailLines {
+		r.LogTail = r.LogTail[len(r.LogTail)-stageLogTailLines:]
+	}
+}
+
+func (r *StageReport) GetLogTail() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]string{}, r.LogTail...)
+}
+
+func getStageStatus(ctx context.Context, err error) StageStatus {
+	select {
+	case <-ctx.Done():
+		return StageStatusCanceled
+	default:
+	}
+
+	if errors.Is(err, ErrCanceled) {
+		return StageStatusCanceled
+	}
+	if err != nil {
+		return StageStatusFailed
+	}
+
+	return StageStatusPassed
+}
+
+// StageExitError is returned when the commands of a stage exit with a non-zero exit code
+type StageExitError struct {
+	Stage    string
+	ExitCode int
+}
+
+func (e *StageExitError) Error() string {
+	return fmt.Sprintf("stage %v failed with exit code %v", e.Stage, e.ExitCode)
+}
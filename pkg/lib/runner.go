@@ -1,56 +1,92 @@
 package lib
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/logrusorgru/aurora"
 	"golang.org/x/sync/errgroup"
+	"gopkg.in/yaml.v3"
 )
 
 //go:generate mockgen -package=lib -destination ./runner_mock.go -source=runner.go
 type Runner interface {
 	Validate(ctx context.Context) (manifest Manifest, err error)
-	Run(ctx context.Context, target string) (err error)
+	ValidateManifest(ctx context.Context) (manifest Manifest, warnings, errors []error, err error)
+	Lock(ctx context.Context, check bool) (err error)
+	Run(ctx context.Context, target string) (report *RunReport, err error)
+	Shell(ctx context.Context, target, stage string) (err error)
+	Watch(ctx context.Context, target string, changes <-chan []string, runFinished func(ctx context.Context, report *RunReport, err error) error) (err error)
 }
 
 type runner struct {
 	manifestReader        ManifestReader
 	dockerRunner          DockerRunner
 	hostRunner            HostRunner
-	forcePull             bool
+	secretProvider        SecretProvider
+	secretMasker          SecretMasker
+	envFileReader         EnvFileReader
+	gitReader             GitReader
+	eventWriter           RunEventWriter
+	logStore              LogStore
+	stageSlots            chan struct{}
+	env                   map[string]string
 	buildDirectory        string
 	buildManifestFilename string
+
+	// in watch mode the network and background stages stay up between runs
+	keepBackgroundStages  bool
+	networkCreated        bool
+	backgroundStages      map[string]string
+	backgroundStagesMutex *sync.Mutex
 }
 
-func NewRunner(manifestReader ManifestReader, dockerRunner DockerRunner, hostRunner HostRunner, forcePull bool, buildDirectory, buildManifestFilename string) Runner {
+func NewRunner(manifestReader ManifestReader, dockerRunner DockerRunner, hostRunner HostRunner, secretProvider SecretProvider, secretMasker SecretMasker, envFileReader EnvFileReader, gitReader GitReader, eventWriter RunEventWriter, logStore LogStore, maxParallel int, env map[string]string, buildDirectory, buildManifestFilename string) Runner {
+	// a slot per stage that may run at the same time; without a limit all parallel stages start at once
+	var stageSlots chan struct{}
+	if maxParallel > 0 {
+		stageSlots = make(chan struct{}, maxParallel)
+	}
+
 	return &runner{
 		manifestReader:        manifestReader,
 		dockerRunner:          dockerRunner,
 		hostRunner:            hostRunner,
-		forcePull:             forcePull,
+		secretProvider:        secretProvider,
+		secretMasker:          secretMasker,
+		envFileReader:         envFileReader,
+		gitReader:             gitReader,
+		eventWriter:           eventWriter,
+		logStore:              logStore,
+		stageSlots:            stageSlots,
+		env:                   env,
 		buildDirectory:        buildDirectory,
 		buildManifestFilename: buildManifestFilename,
+		backgroundStages:      map[string]string{},
+		backgroundStagesMutex: &sync.Mutex{},
 	}
 }
 
 func (b *runner) Validate(ctx context.Context) (manifest Manifest, err error) {
 	log.Printf("Validating manifest %v", aurora.BrightBlue(b.buildManifestFilename))
 
-	manifestPath := filepath.Join(b.buildDirectory, b.buildManifestFilename)
-
-	manifest, err = b.manifestReader.GetManifest(ctx, manifestPath)
+	manifest, warnings, errors, err := b.ValidateManifest(ctx)
 	if err != nil {
 		return
 	}
 
-	warnings, errors := manifest.Validate()
 	if len(warnings) > 0 {
 		log.Println(aurora.BrightYellow("Manifest has warnings:"))
 		for _, w := range warnings {
@@ -70,7 +106,181 @@ func (b *runner) Validate(ctx context.Context) (manifest Manifest, err error) {
 	return
 }
 
-func (b *runner) Run(ctx context.Context, target string) (err error) {
+// ValidateManifest reads the manifest and returns its warnings and errors, including the ones for parameters the local parameter schema doesn't accept; it doesn't need docker, image labels are only checked by running a target
+func (b *runner) ValidateManifest(ctx context.Context) (manifest Manifest, warnings, errors []error, err error) {
+	manifestPath := filepath.Join(b.buildDirectory, b.buildManifestFilename)
+
+	manifest, err = b.manifestReader.GetManifest(ctx, manifestPath)
+	if err != nil {
+		return
+	}
+
+	warnings, errors = manifest.Validate()
+
+	schemas, err := b.getParameterSchemas()
+	if err != nil {
+		return
+	}
+	warnings = append(warnings, manifest.ValidateParameters(schemas)...)
+
+	return
+}
+
+// getParameterSchemas reads the accepted parameters by image from the local parameter schema, if there is one
+func (b *runner) getParameterSchemas() (schemas ParameterSchemas, err error) {
+	schemas = ParameterSchemas{}
+
+	schemaBytes, err := ioutil.ReadFile(filepath.Join(b.buildDirectory, ParameterSchemaFilename))
+	if os.IsNotExist(err) {
+		return schemas, nil
+	}
+	if err != nil {
+		return
+	}
+	if err = yaml.Unmarshal(schemaBytes, &schemas); err != nil {
+		return schemas, fmt.Errorf("parameter schema %v is invalid: %w", ParameterSchemaFilename, err)
+	}
+
+	return
+}
+
+// validateImageParameters warns about parameters the pulled images of the stages don't declare in their label; images in the local parameter schema got validated with the manifest already
+func (b *runner) validateImageParameters(ctx context.Context, stages []*ManifestStage) (err error) {
+	localSchemas, err := b.getParameterSchemas()
+	if err != nil {
+		return
+	}
+
+	logger := log.New(b.getLogOutput(nil), aurora.Gray(12, "[infinity] ").String(), 0)
+	labelSchemas := ParameterSchemas{}
+	if err = b.addImageParameterSchemas(ctx, logger, localSchemas, labelSchemas, stages); err != nil {
+		return
+	}
+
+	for _, w := range ValidateImageParameters(stages, labelSchemas) {
+		logger.Println(aurora.BrightYellow(w))
+	}
+
+	return nil
+}
+
+func (b *runner) addImageParameterSchemas(ctx context.Context, logger *log.Logger, localSchemas, labelSchemas ParameterSchemas, stages []*ManifestStage) (err error) {
+	for _, s := range stages {
+		if err = b.addImageParameterSchemas(ctx, logger, localSchemas, labelSchemas, s.Stages); err != nil {
+			return
+		}
+
+		if s.RunnerType != RunnerTypeContainer || len(s.Parameters) == 0 {
+			continue
+		}
+		if _, ok := localSchemas.Get(s.Image); ok {
+			continue
+		}
+		if _, ok := labelSchemas[s.Image]; ok {
+			continue
+		}
+
+		parameters, err := b.dockerRunner.ContainerImageParameters(ctx, logger, *s)
+		if err != nil {
+			return err
+		}
+		if parameters != nil {
+			labelSchemas[s.Image] = parameters
+		}
+	}
+
+	return
+}
+
+// Lock resolves the images of all targets to their current digest and writes them to the lockfile; with check it only verifies the lockfile has all images of the manifest
+func (b *runner) Lock(ctx context.Context, check bool) (err error) {
+	manifest, err := b.manifestReader.GetManifest(ctx, filepath.Join(b.buildDirectory, b.buildManifestFilename))
+	if err != nil {
+		return
+	}
+
+	images := GetManifestImages(manifest)
+	lockPath := filepath.Join(b.buildDirectory, ImageLockFilename)
+
+	if check {
+		lock, err := ReadImageLock(lockPath)
+		if err != nil {
+			return err
+		}
+		if lock == nil {
+			return fmt.Errorf("lockfile %v does not exist; run 'infinity lock' to create it", lockPath)
+		}
+
+		unlocked, unused := lock.GetDrift(images)
+		if len(unlocked) > 0 || len(unused) > 0 {
+			messages := []string{}
+			if len(unlocked) > 0 {
+				messages = append(messages, fmt.Sprintf("images %v are not pinned", strings.Join(unlocked, ", ")))
+			}
+			if len(unused) > 0 {
+				messages = append(messages, fmt.Sprintf("images %v are no longer in the manifest", strings.Join(unused, ", ")))
+			}
+			return fmt.Errorf("lockfile %v is out of date: %v; run 'infinity lock' to update it", lockPath, strings.Join(messages, " and "))
+		}
+
+		log.Printf("Lockfile %v is up to date", aurora.BrightBlue(lockPath))
+		return nil
+	}
+
+	logger := log.New(b.getLogOutput(nil), aurora.Gray(12, "[infinity] ").String(), 0)
+
+	loggedIn, err := b.registryLogin(ctx, logger, manifest, images)
+	if err != nil {
+		return
+	}
+	if loggedIn {
+		defer func() {
+			if logoutErr := b.dockerRunner.RegistryLogout(ctx, logger); err == nil {
+				err = logoutErr
+			}
+		}()
+	}
+
+	lock := ImageLock{Images: map[string]string{}}
+	for _, image := range images {
+		// images with a digest in the manifest are pinned already
+		if strings.Contains(image, "@") {
+			continue
+		}
+
+		digest, err := b.dockerRunner.ContainerImageDigest(ctx, logger, ManifestStage{Image: image})
+		if err != nil {
+			return err
+		}
+		lock.Images[image] = digest
+		logger.Printf("Pinned image %v to %v", aurora.BrightBlue(image), digest)
+	}
+
+	if err = WriteImageLock(lockPath, lock); err != nil {
+		return
+	}
+	log.Printf("Locked %v images in %v", len(lock.Images), aurora.BrightBlue(lockPath))
+
+	return nil
+}
+
+func (b *runner) Run(ctx context.Context, target string) (report *RunReport, err error) {
+	report = NewRunReport(target)
+	if b.eventWriter != nil {
+		b.eventWriter.RunStarted(report)
+	}
+	ctx, span := StartSpan(ctx, target, map[string]interface{}{
+		"infinity.target": target,
+	})
+	defer func() {
+		report.Finish(ctx, err)
+		span.SetAttribute("infinity.status", string(report.Status))
+		span.Finish(err)
+		if b.eventWriter != nil {
+			b.eventWriter.RunFinished(report)
+		}
+	}()
+
 	manifest, err := b.Validate(ctx)
 	if err != nil {
 		return
@@ -79,43 +289,334 @@ func (b *runner) Run(ctx context.Context, target string) (err error) {
 	log.Printf("Running manifest %v target %v", aurora.BrightBlue(b.buildManifestFilename), aurora.BrightBlue(target))
 
 	if err = b.handleFunc(ctx, nil, func() error {
-		return b.runManifest(ctx, manifest, target)
+		return b.runManifest(ctx, manifest, target, report)
 	}); err != nil {
 		if errors.Is(err, ErrCanceled) {
-			return nil
+			return report, nil
 		}
 		return
 	}
 
+	return report, nil
+}
+
+// Shell starts an interactive container for a stage of the target, with the target's background stages running alongside it
+func (b *runner) Shell(ctx context.Context, target, stageName string) (err error) {
+	manifest, err := b.Validate(ctx)
+	if err != nil {
+		return
+	}
+
+	manifestTarget, err := manifest.GetTarget(target)
+	if err != nil {
+		return
+	}
+
+	stage := b.getManifestStage(manifestTarget.Stages, stageName)
+	if stage == nil {
+		return fmt.Errorf("Stage %v is not defined in target %v", stageName, target)
+	}
+	if stage.RunnerType != RunnerTypeContainer {
+		return fmt.Errorf("Stage %v uses the %v runner; only stages with the container runner have a shell", stageName, stage.RunnerType)
+	}
+
+	log.Printf("Starting shell for manifest %v target %v stage %v", aurora.BrightBlue(b.buildManifestFilename), aurora.BrightBlue(target), aurora.BrightBlue(stageName))
+	log.Println("")
+
+	// set color codes for coloring stage logs
+	b.setColorCode(manifestTarget.Stages)
+
+	backgroundStages := []*ManifestStage{}
+	for _, s := range b.getBackgroundStages(manifestTarget.Stages) {
+		if s != stage {
+			backgroundStages = append(backgroundStages, s)
+		}
+	}
+	stages := append(backgroundStages, stage)
+
+	secrets, err := b.getSecrets(ctx, manifest, stages)
+	if err != nil {
+		return
+	}
+
+	env, _, err := b.getTargetEnv(ctx, manifest, manifestTarget)
+	if err != nil {
+		return
+	}
+
+	needsNetwork := b.dockerRunner.NeedsNetwork(stages)
+	if needsNetwork {
+		logger := log.New(b.getLogOutput(nil), aurora.Gray(12, "[infinity] ").String(), 0)
+		if err = b.handleFunc(ctx, logger, func() error {
+			return b.dockerRunner.NetworkCreate(ctx, logger)
+		}); err != nil {
+			return
+		}
+		log.Println("")
+
+		defer func() {
+			terminateErr := b.dockerRunner.StopRunningContainers(ctx, b.getLogOutput(nil))
+			if err == nil {
+				err = terminateErr
+			}
+			terminateErr = b.handleFunc(ctx, logger, func() error {
+				return b.dockerRunner.NetworkRemove(ctx, logger)
+			})
+			if err == nil && !errors.Is(terminateErr, ErrCanceled) {
+				err = terminateErr
+			}
+		}()
+	}
+
+	if err = b.pullImages(ctx, manifest, stages); err != nil {
+		return
+	}
+
+	for _, s := range stages {
+		logger := log.New(b.getLogOutput(nil), aurora.Index(s.colorCode, fmt.Sprintf("[%v] ", s.Name)).String(), 0)
+
+		stageEnv, secretEnv, secretFiles, err := b.getStageEnv(ctx, *s, env, secrets)
+		if err != nil {
+			return err
+		}
+
+		if s == stage {
+			return b.dockerRunner.ContainerShell(ctx, logger, *s, stageEnv, secretEnv, secretFiles, needsNetwork)
+		}
+
+		if err = b.dockerRunner.ContainerStart(ctx, logger, *s, stageEnv, secretEnv, secretFiles, needsNetwork); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-func (b *runner) getManifestTarget(ctx context.Context, manifest Manifest, target string) (manifestTarget *ManifestTarget, err error) {
-	for _, t := range manifest.Targets {
-		if t.Name == target {
-			return t, nil
+// Watch runs the target and re-runs it for every set of changes, canceling the run in progress; background stages keep running between runs until the context is done
+func (b *runner) Watch(ctx context.Context, target string, changes <-chan []string, runFinished func(ctx context.Context, report *RunReport, err error) error) (err error) {
+	b.keepBackgroundStages = true
+	defer func() {
+		// the context is done by now, so clean up with a fresh one
+		stopErr := b.stopBackgroundStages(context.Background())
+		if err == nil {
+			err = stopErr
+		}
+	}()
+
+	for {
+		runCtx, cancel := context.WithCancel(ctx)
+		// give each run its own trace
+		if GetTracerFromContext(ctx) != nil {
+			runCtx = ContextWithTracer(runCtx, NewTracer())
+		}
+
+		var report *RunReport
+		var runErr error
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			report, runErr = b.Run(runCtx, target)
+		}()
+
+		var changedPaths []string
+		var ok bool
+		select {
+		case <-done:
+		case changedPaths, ok = <-changes:
+			if ok {
+				log.Println("")
+				log.Printf("Detected changes in %v, canceling run", aurora.BrightBlue(strings.Join(changedPaths, ", ")))
+			}
+			cancel()
+			<-done
+		case <-ctx.Done():
+			<-done
+		}
+		cancel()
+
+		if err = runFinished(runCtx, report, runErr); err != nil {
+			return
+		}
+
+		// wait for changes if the run completed before any came in
+		if changedPaths == nil && ctx.Err() == nil {
+			log.Println("")
+			log.Println(aurora.Gray(12, "Waiting for changes..."))
+
+			select {
+			case changedPaths, ok = <-changes:
+				if ok {
+					log.Println("")
+					log.Printf("Detected changes in %v", aurora.BrightBlue(strings.Join(changedPaths, ", ")))
+				}
+			case <-ctx.Done():
+			}
+		}
+
+		if ctx.Err() != nil || !ok {
+			return nil
+		}
+
+		log.Printf("Re-running target %v", aurora.BrightBlue(target))
+		log.Println("")
+	}
+}
+
+// stopChangedBackgroundStages stops the background stages kept from the previous run if any of them changed, got removed from the manifest or stopped running, so the ones still defined start again with their current definition
+func (b *runner) stopChangedBackgroundStages(ctx context.Context, stages []*ManifestStage) (err error) {
+	backgroundStages := map[string]*ManifestStage{}
+	for _, s := range b.getBackgroundStages(stages) {
+		backgroundStages[s.Name] = s
+	}
+
+	b.backgroundStagesMutex.Lock()
+	keptStages := []string{}
+	reason := ""
+	for name, fingerprint := range b.backgroundStages {
+		keptStages = append(keptStages, name)
+		s, ok := backgroundStages[name]
+		if !ok {
+			reason = fmt.Sprintf("Background stage %v is no longer in the manifest", name)
+		} else if reason == "" && fingerprint != b.getStageFingerprint(*s) {
+			reason = "Background stages changed"
 		}
 	}
+	b.backgroundStagesMutex.Unlock()
+	sort.Strings(keptStages)
 
-	return nil, fmt.Errorf("Target %v is not defined in manifest", target)
+	// a kept container that exited in the meantime can't serve this run
+	if reason == "" {
+		logger := log.New(b.getLogOutput(nil), aurora.Gray(12, "[infinity] ").String(), 0)
+		for _, name := range keptStages {
+			isRunning, err := b.dockerRunner.ContainerIsRunning(ctx, logger, *backgroundStages[name])
+			if err != nil {
+				return err
+			}
+			if !isRunning {
+				reason = fmt.Sprintf("Background stage %v stopped running", name)
+				break
+			}
+		}
+	}
+
+	if reason == "" {
+		return nil
+	}
+
+	log.Println(aurora.Gray(12, reason+", restarting background stages"))
+
+	err = b.stopBackgroundStages(ctx)
+
+	// a background stage that stopped by itself often has a non-zero exit code, which shouldn't fail the run that restarts it
+	var exitErr *StageExitError
+	if errors.As(err, &exitErr) {
+		log.Println(aurora.BrightYellow(fmt.Sprintf("Background stage %v exited with exit code %v", exitErr.Stage, exitErr.ExitCode)))
+		return nil
+	}
+
+	return err
 }
 
-func (b *runner) runManifest(ctx context.Context, manifest Manifest, target string) (err error) {
+func (b *runner) stopBackgroundStages(ctx context.Context) (err error) {
+	b.backgroundStagesMutex.Lock()
+	b.backgroundStages = map[string]string{}
+	b.backgroundStagesMutex.Unlock()
+
+	err = b.dockerRunner.StopRunningContainers(ctx, b.getLogOutput(nil))
+
+	if b.networkCreated {
+		logger := log.New(b.getLogOutput(nil), aurora.Gray(12, "[infinity] ").String(), 0)
+		if removeErr := b.handleFunc(ctx, logger, func() error {
+			return b.dockerRunner.NetworkRemove(ctx, logger)
+		}); err == nil {
+			err = removeErr
+		}
+		b.networkCreated = false
+		log.Println("")
+	}
+
+	return
+}
+
+func (b *runner) keepBackgroundStage(stage ManifestStage) {
+	b.backgroundStagesMutex.Lock()
+	defer b.backgroundStagesMutex.Unlock()
+
+	b.backgroundStages[stage.Name] = b.getStageFingerprint(stage)
+}
+
+// isBackgroundStageKept returns true if the stage still runs from a previous run with the same definition
+func (b *runner) isBackgroundStageKept(stage ManifestStage) bool {
+	b.backgroundStagesMutex.Lock()
+	defer b.backgroundStagesMutex.Unlock()
+
+	fingerprint, ok := b.backgroundStages[stage.Name]
+
+	return ok && fingerprint == b.getStageFingerprint(stage)
+}
+
+func (b *runner) getStageFingerprint(stage ManifestStage) string {
+	// parameters can hold nested yaml maps, which don't marshal to json
+	fingerprint, _ := yaml.Marshal(stage)
+
+	return string(fingerprint)
+}
+
+// getManifestStage finds a stage by its name or by its path like parallel/unit-test
+func (b *runner) getManifestStage(stages []*ManifestStage, stageName string, prefixes ...string) *ManifestStage {
+	for _, s := range stages {
+		path := strings.Join(append(prefixes, s.Name), "/")
+		if len(s.Stages) == 0 && (s.Name == stageName || path == stageName) {
+			return s
+		}
+		if nestedStage := b.getManifestStage(s.Stages, stageName, append(prefixes, s.Name)...); nestedStage != nil {
+			return nestedStage
+		}
+	}
+
+	return nil
+}
+
+func (b *runner) getBackgroundStages(stages []*ManifestStage) (backgroundStages []*ManifestStage) {
+	for _, s := range stages {
+		if s.Background {
+			backgroundStages = append(backgroundStages, s)
+		}
+		backgroundStages = append(backgroundStages, b.getBackgroundStages(s.Stages)...)
+	}
+
+	return
+}
+
+func (b *runner) runManifest(ctx context.Context, manifest Manifest, target string, report *RunReport) (err error) {
 	log.Println("")
 
 	// get target
-	manifestTarget, err := b.getManifestTarget(ctx, manifest, target)
+	manifestTarget, err := manifest.GetTarget(target)
 	if err != nil {
 		return
 	}
+	report.SetStages(manifestTarget.Stages)
 
 	// set color codes for coloring stage logs
 	b.setColorCode(manifestTarget.Stages)
 
+	// read the secrets used by the target's stages before running anything
+	secrets, err := b.getSecrets(ctx, manifest, manifestTarget.Stages)
+	if err != nil {
+		return
+	}
+
 	needsNetwork := b.dockerRunner.NeedsNetwork(manifestTarget.Stages)
 
-	if needsNetwork {
-		logger := log.New(os.Stdout, aurora.Gray(12, "[infinity] ").String(), 0)
+	if b.keepBackgroundStages {
+		if err = b.stopChangedBackgroundStages(ctx, manifestTarget.Stages); err != nil {
+			return
+		}
+	}
+
+	if needsNetwork && !b.networkCreated {
+		logger := log.New(b.getLogOutput(nil), aurora.Gray(12, "[infinity] ").String(), 0)
 		if err = b.handleFunc(ctx, logger, func() error {
 			return b.dockerRunner.NetworkCreate(ctx, logger)
 		}); err != nil {
@@ -124,10 +625,16 @@ func (b *runner) runManifest(ctx context.Context, manifest Manifest, target stri
 			}
 			return
 		}
+		b.networkCreated = true
 		log.Println("")
 
 		defer func() {
-			terminateErr := b.dockerRunner.StopRunningContainers(ctx)
+			// Watch cleans up once it stops watching
+			if b.keepBackgroundStages {
+				return
+			}
+
+			terminateErr := b.dockerRunner.StopRunningContainers(ctx, b.getLogOutput(nil))
 			if err == nil {
 				err = terminateErr
 			}
@@ -140,36 +647,189 @@ func (b *runner) runManifest(ctx context.Context, manifest Manifest, target stri
 						err = terminateErr
 					}
 				}
+				b.networkCreated = false
 				log.Println("")
 			}
 		}()
 	}
 
+	env, gitInfo, err := b.getTargetEnv(ctx, manifest, manifestTarget)
+	if err != nil {
+		return
+	}
+	report.Git = gitInfo
+	report.Version = env["INFINITY_VERSION"]
+
+	if err = b.pullImages(ctx, manifest, manifestTarget.Stages); err != nil {
+		if errors.Is(err, ErrCanceled) {
+			return nil
+		}
+		return
+	}
+
+	// image labels can only be read once the images are pulled
+	if err = b.validateImageParameters(ctx, manifestTarget.Stages); err != nil {
+		return
+	}
+
+	for i, stage := range manifestTarget.Stages {
+		err = b.runStage(ctx, *stage, env, secrets, needsNetwork, report.ID, report.Stages[i])
+		log.Println("")
+		if err != nil {
+			return
+		}
+	}
+
+	return nil
+}
+
+// getTargetEnv returns the envvars shared by all stages of a target
+func (b *runner) getTargetEnv(ctx context.Context, manifest Manifest, manifestTarget *ManifestTarget) (env map[string]string, gitInfo GitInfo, err error) {
 	// get metadata as envvars
-	env := map[string]string{}
+	env = map[string]string{}
 	env["INFINITY_METADATA_NAME"] = manifest.Metadata.Name
 	env["INFINITY_METADATA_TYPE"] = string(manifest.Metadata.ApplicationType)
 	env["INFINITY_METADATA_LANGUAGE"] = string(manifest.Metadata.Language)
 
+	// get git facts of the build directory as envvars
+	gitInfo, gitErr := b.gitReader.GetInfo(ctx)
+	if gitErr != nil {
+		log.Println(aurora.BrightYellow(fmt.Sprintf("Reading git metadata failed: %v", gitErr)))
+	}
+	env["INFINITY_GIT_REVISION"] = gitInfo.Revision
+	env["INFINITY_GIT_SHORT_REVISION"] = gitInfo.ShortRevision
+	env["INFINITY_GIT_BRANCH"] = gitInfo.Branch
+	env["INFINITY_GIT_TAG"] = gitInfo.Tag
+	env["INFINITY_GIT_DIRTY"] = strconv.FormatBool(gitInfo.Dirty)
+	env["INFINITY_GIT_REPO"] = gitInfo.Repo
+
+	// calculate the version once, so all stages use the same one
+	if manifest.Metadata.Version != nil {
+		version, err := b.getVersion(ctx, *manifest.Metadata.Version, gitInfo)
+		if err != nil {
+			return nil, gitInfo, err
+		}
+		log.Printf("Version %v", aurora.BrightBlue(version))
+		log.Println("")
+		env["INFINITY_VERSION"] = version
+	}
+
 	//  add/overwrite global environment variables
-	for k, v := range manifest.Env {
-		env[k] = v
+	err = b.addEnv(ctx, env, manifest.EnvFile, manifest.Env)
+	if err != nil {
+		return
 	}
 
 	// add/overwrite target environment variables
-	for k, v := range manifestTarget.Env {
+	err = b.addEnv(ctx, env, manifestTarget.EnvFile, manifestTarget.Env)
+	if err != nil {
+		return
+	}
+
+	return env, gitInfo, nil
+}
+
+func (b *runner) getVersion(ctx context.Context, version ManifestVersion, gitInfo GitInfo) (string, error) {
+	var commitCount int
+	var tags []string
+	var err error
+
+	switch version.Patch {
+	case VersionPatchCommits:
+		commitCount, err = b.gitReader.GetCommitCount(ctx)
+	case VersionPatchTag:
+		tags, err = b.gitReader.GetTags(ctx)
+	}
+	if err != nil {
+		return "", fmt.Errorf("calculating version failed: %w", err)
+	}
+
+	return version.GetVersion(gitInfo, commitCount, tags), nil
+}
+
+// addEnv adds the values from env files and then the env map, so the latter takes precedence
+func (b *runner) addEnv(ctx context.Context, env map[string]string, envFiles []string, envMap map[string]string) (err error) {
+	// env files are often only present on developer machines, so ignore missing ones
+	fileEnv, err := b.envFileReader.ReadEnvFiles(ctx, envFiles, true)
+	if err != nil {
+		return
+	}
+	for k, v := range fileEnv {
 		env[k] = v
 	}
 
-	for _, stage := range manifestTarget.Stages {
-		err = b.runStage(ctx, *stage, env, needsNetwork)
-		log.Println("")
+	for k, v := range envMap {
+		env[k] = v
+	}
+
+	return nil
+}
+
+func (b *runner) getSecrets(ctx context.Context, manifest Manifest, stages []*ManifestStage) (secrets map[string]string, err error) {
+	secrets = map[string]string{}
+
+	for _, name := range b.getStageSecretNames(stages) {
+		secret := manifest.GetSecret(name)
+		if secret == nil {
+			return nil, fmt.Errorf("secret %v is not defined in manifest", name)
+		}
+
+		value, err := b.secretProvider.GetSecret(ctx, *secret)
 		if err != nil {
-			return
+			return nil, err
 		}
+
+		b.secretMasker.AddSecret(value)
+		secrets[name] = value
 	}
 
-	return nil
+	return
+}
+
+func (b *runner) getStageSecretNames(stages []*ManifestStage) (names []string) {
+	for _, s := range stages {
+		for _, ss := range s.Secrets {
+			if !stringArrayContains(names, ss.Name) {
+				names = append(names, ss.Name)
+			}
+		}
+		for _, name := range b.getStageSecretNames(s.Stages) {
+			if !stringArrayContains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+
+	return
+}
+
+func (b *runner) getStageSpanAttributes(stage ManifestStage, report *StageReport) map[string]interface{} {
+	attributes := map[string]interface{}{
+		"infinity.stage.path": strings.Join(report.Path, "/"),
+	}
+	if len(stage.Stages) > 0 {
+		attributes["infinity.stage.parallel"] = true
+		return attributes
+	}
+
+	attributes["infinity.stage.runner"] = string(stage.RunnerType)
+	if stage.RunnerType == RunnerTypeContainer {
+		attributes["container.image.name"] = stage.Image
+	}
+	if stage.Background {
+		attributes["infinity.stage.background"] = true
+	}
+
+	return attributes
+}
+
+// getLogOutput returns the writer for human readable logs of a stage, or of the run itself if the report is nil
+func (b *runner) getLogOutput(report *StageReport) io.Writer {
+	if b.eventWriter != nil {
+		return b.eventWriter.LogOutput(report)
+	}
+
+	return os.Stdout
 }
 
 func (b *runner) getColorCode(stageIndex int) uint8 {
@@ -186,50 +846,77 @@ func (b *runner) setColorCode(stages []*ManifestStage) {
 	}
 }
 
-func (b *runner) runStage(ctx context.Context, stage ManifestStage, env map[string]string, needsNetwork bool, prefixes ...string) (err error) {
+func (b *runner) runStage(ctx context.Context, stage ManifestStage, env, secrets map[string]string, needsNetwork bool, runID string, report *StageReport, prefixes ...string) (err error) {
 
 	prefixes = append(prefixes, stage.Name)
 	prefix := strings.Join(prefixes, "] [")
 
-	logger := log.New(os.Stdout, aurora.Index(stage.colorCode, fmt.Sprintf("[%v] ", prefix)).String(), 0)
+	// keep the output of each stage in its own file, so it's readable after interleaving with parallel stages
+	var logFile io.WriteCloser
+	if b.logStore != nil && len(stage.Stages) == 0 {
+		logFile, err = b.logStore.CreateStageLog(ctx, runID, report.Path)
+		if err != nil {
+			return
+		}
+		defer logFile.Close()
+	}
+
+	loggerPrefix := aurora.Index(stage.colorCode, fmt.Sprintf("[%v] ", prefix)).String()
+	logger := log.New(newStageLogWriter(b.getLogOutput(report), loggerPrefix, report, b.eventWriter, logFile), loggerPrefix, 0)
 
-	if len(stage.Stages) > 0 {
-		return b.runParallelStages(ctx, stage, env, needsNetwork)
+	// only stages that run commands take a slot, a stage with parallel stages waiting for a slot for each of them would deadlock
+	if b.stageSlots != nil && len(stage.Stages) == 0 {
+		select {
+		case b.stageSlots <- struct{}{}:
+		default:
+			logger.Printf(aurora.Gray(12, "Waiting for one of the %v running stages to finish (--max-parallel)").String(), cap(b.stageSlots))
+			select {
+			case b.stageSlots <- struct{}{}:
+			case <-ctx.Done():
+				// the stage never started, so it's reported as skipped
+				return nil
+			}
+		}
+		defer func() { <-b.stageSlots }()
 	}
 
-	// add and override with stage environment variables
-	for k, v := range stage.Env {
-		env[k] = v
+	ctx, span := StartSpan(ctx, stage.Name, b.getStageSpanAttributes(stage, report))
+
+	// record timing and status of the stage for reporting
+	report.Started()
+	if b.eventWriter != nil {
+		b.eventWriter.StageStarted(report)
 	}
+	defer func() {
+		report.Finish(ctx, err)
+		span.SetAttribute("infinity.stage.status", string(report.Status))
+		if report.ExitCode != nil {
+			span.SetAttribute("infinity.stage.exit_code", *report.ExitCode)
+		}
+		span.Finish(err)
+		if b.eventWriter != nil {
+			b.eventWriter.StageFinished(report)
+		}
+	}()
 
-	// add parameters to envvars
-	for k, v := range stage.Parameters {
-		env[ToUpperSnakeCase("INFINITY_PARAMETER_"+k)] = fmt.Sprintf("%v", v)
+	if len(stage.Stages) > 0 {
+		return b.runParallelStages(ctx, stage, env, secrets, needsNetwork, runID, report)
+	}
+
+	env, secretEnv, secretFiles, err := b.getStageEnv(ctx, stage, env, secrets)
+	if err != nil {
+		return
 	}
 
 	switch stage.RunnerType {
 	case RunnerTypeContainer:
-		var isPulled bool
-		if !b.forcePull {
-			isPulled, err = b.dockerRunner.ContainerImageIsPulled(ctx, logger, stage)
-			if err != nil {
-				return
-			}
-		}
-
-		if !isPulled {
-			if err = b.handleFunc(ctx, logger, func() error {
-				return b.dockerRunner.ContainerPull(ctx, logger, stage)
-			}); err != nil {
-				if errors.Is(err, ErrCanceled) {
-					return nil
-				}
-				return
-			}
+		if stage.Background && b.isBackgroundStageKept(stage) {
+			logger.Printf(aurora.Gray(12, "Stage is still running in background from the previous run").String())
+			return nil
 		}
 
 		if err = b.handleFunc(ctx, logger, func() error {
-			return b.dockerRunner.ContainerStart(ctx, logger, stage, env, needsNetwork)
+			return b.dockerRunner.ContainerStart(ctx, logger, stage, env, secretEnv, secretFiles, needsNetwork)
 		}); err != nil {
 			if errors.Is(err, ErrCanceled) {
 				return nil
@@ -237,20 +924,258 @@ func (b *runner) runStage(ctx context.Context, stage ManifestStage, env map[stri
 			return
 		}
 
+		if stage.Background && b.keepBackgroundStages {
+			b.keepBackgroundStage(stage)
+		}
+
 		return nil
 
 	case RunnerTypeHost:
-		return b.hostRunner.RunStage(ctx, logger, stage, env)
+		// secrets only end up in the environment of the host process, not in its arguments
+		hostEnv := map[string]string{}
+		for k, v := range env {
+			hostEnv[k] = v
+		}
+		for k, v := range secretEnv {
+			hostEnv[k] = v
+		}
+		return b.hostRunner.RunStage(ctx, logger, stage, hostEnv)
 	}
 
 	return fmt.Errorf("runner %v is not supported", stage.RunnerType)
 }
 
-func (b *runner) runParallelStages(ctx context.Context, stage ManifestStage, env map[string]string, needsNetwork bool) (err error) {
+// getStageEnv returns a copy of the target envvars with those of the stage added, and the secrets the stage opted in to either as envvar or as file
+func (b *runner) getStageEnv(ctx context.Context, stage ManifestStage, targetEnv, secrets map[string]string) (env, secretEnv, secretFiles map[string]string, err error) {
+	// copy envvars so parallel stages don't override each other's values
+	env = map[string]string{}
+	for k, v := range targetEnv {
+		env[k] = v
+	}
+
+	// add and override with stage environment variables
+	err = b.addEnv(ctx, env, stage.EnvFile, stage.Env)
+	if err != nil {
+		return
+	}
+
+	// add parameters to envvars
+	for k, v := range stage.Parameters {
+		env[ToUpperSnakeCase("INFINITY_PARAMETER_"+k)] = fmt.Sprintf("%v", v)
+	}
+
+	// override with envvars passed on the command line
+	for k, v := range b.env {
+		env[k] = v
+	}
+
+	secretEnv = map[string]string{}
+	secretFiles = map[string]string{}
+	for _, s := range stage.Secrets {
+		if s.File != "" {
+			secretFiles[s.File] = secrets[s.Name]
+			continue
+		}
+		secretEnv[s.Env] = secrets[s.Name]
+	}
+
+	return env, secretEnv, secretFiles, nil
+}
+
+// needsPull returns whether the image of a stage has to be pulled according to its pull policy; for pull policy never a missing image is an error
+func (b *runner) needsPull(ctx context.Context, logger *log.Logger, stage ManifestStage) (needsPull bool, err error) {
+	if stage.PullPolicy == PullPolicyAlways {
+		return true, nil
+	}
+
+	isPulled, err := b.dockerRunner.ContainerImageIsPulled(ctx, logger, stage)
+	if err != nil || isPulled {
+		return false, err
+	}
+	if stage.PullPolicy == PullPolicyNever {
+		return false, fmt.Errorf("image %v of stage %v is not present and its pull policy is %v; please pull it first or set 'pullPolicy: %v'", stage.Image, stage.Name, PullPolicyNever, PullPolicyIfNotPresent)
+	}
+
+	return true, nil
+}
+
+// imagePullConcurrency limits the number of images pulled at the same time, since docker already downloads the layers of each image in parallel
+const imagePullConcurrency = 3
+
+// pullImages pulls the missing images of all container stages, including nested and background stages, before the first stage starts, so stages don't wait for their pulls one after another
+func (b *runner) pullImages(ctx context.Context, manifest Manifest, stages []*ManifestStage) (err error) {
+	logger := log.New(b.getLogOutput(nil), aurora.Gray(12, "[infinity] ").String(), 0)
+
+	// check which images are missing first, so only actual pulls get reported
+	pullStages := []ManifestStage{}
+	for _, s := range b.getImageStages(stages, map[string]*ManifestStage{}) {
+		needsPull, err := b.needsPull(ctx, logger, *s)
+		if err != nil {
+			return err
+		}
+		if needsPull {
+			pullStages = append(pullStages, *s)
+		}
+	}
+	if len(pullStages) == 0 {
+		return nil
+	}
+
+	images := []string{}
+	formattedImages := []string{}
+	for _, s := range pullStages {
+		images = append(images, s.Image)
+		formattedImages = append(formattedImages, aurora.BrightBlue(s.Image).String())
+	}
+	logger.Printf(aurora.Gray(12, "Pulling %v images: %v").String(), len(pullStages), strings.Join(formattedImages, ", "))
+
+	loggedIn, err := b.registryLogin(ctx, logger, manifest, images)
+	if err != nil {
+		return
+	}
+	if loggedIn {
+		defer func() {
+			if logoutErr := b.dockerRunner.RegistryLogout(ctx, logger); err == nil {
+				err = logoutErr
+			}
+		}()
+	}
+
+	pulled := 0
+	pulledMutex := &sync.Mutex{}
+	semaphore := make(chan struct{}, imagePullConcurrency)
+
+	err = b.handleFunc(ctx, logger, func() error {
+		g, ctx := errgroup.WithContext(ctx)
+		for _, s := range pullStages {
+			s := s
+			g.Go(func() (err error) {
+				// queued pulls stop waiting once another pull failed
+				select {
+				case semaphore <- struct{}{}:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+				defer func() { <-semaphore }()
+
+				// keep the output of concurrent pulls from interleaving, it's only shown if the pull fails
+				var output bytes.Buffer
+				start := time.Now()
+
+				pullCtx, pullSpan := StartSpan(ctx, "pull", map[string]interface{}{
+					"container.image.name": s.Image,
+				})
+				err = b.dockerRunner.ContainerPull(pullCtx, log.New(&output, "", 0), s)
+				pullSpan.Finish(err)
+				if err != nil {
+					for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+						logger.Print(line)
+					}
+					return err
+				}
+
+				pulledMutex.Lock()
+				defer pulledMutex.Unlock()
+				pulled++
+				logger.Printf(aurora.Gray(12, "Pulled image %v in %v (%v/%v)").String(), aurora.BrightBlue(s.Image), aurora.BrightGreen(time.Since(start).String()), pulled, len(pullStages))
+
+				return nil
+			})
+		}
+		return g.Wait()
+	})
+	log.Println("")
+
+	return err
+}
+
+// registryLogin passes the credentials for the registries of the images to the docker runner; it returns false if none of the images come from a registry in the manifest
+func (b *runner) registryLogin(ctx context.Context, logger *log.Logger, manifest Manifest, images []string) (loggedIn bool, err error) {
+	credentials := []RegistryCredentials{}
+	hosts := map[string]bool{}
+
+	for _, image := range images {
+		registry := manifest.GetRegistry(image)
+		if registry == nil || hosts[registry.Host] {
+			continue
+		}
+		hosts[registry.Host] = true
+
+		c := RegistryCredentials{
+			Host:             registry.Host,
+			Username:         registry.Username,
+			Command:          registry.Command,
+			CredentialHelper: registry.CredentialHelper,
+		}
+
+		switch {
+		case registry.Secret != "":
+			secret := manifest.GetSecret(registry.Secret)
+			if secret == nil {
+				return false, fmt.Errorf("secret %v is not defined in manifest", registry.Secret)
+			}
+			c.Password, err = b.secretProvider.GetSecret(ctx, *secret)
+			if err != nil {
+				return false, err
+			}
+
+		case registry.Env != "":
+			value, ok := os.LookupEnv(registry.Env)
+			if !ok {
+				return false, fmt.Errorf("password for registry %v can't be read from envvar %v, because it is not set", registry.Host, registry.Env)
+			}
+			c.Password = value
+		}
+
+		if c.Password != "" {
+			b.secretMasker.AddSecret(c.Password)
+		}
+		credentials = append(credentials, c)
+	}
+
+	if len(credentials) == 0 {
+		return false, nil
+	}
+
+	// mask tokens printed by registry commands before any other command runs, also when logging in failed
+	tokens, err := b.dockerRunner.RegistryLogin(ctx, logger, credentials)
+	for _, t := range tokens {
+		b.secretMasker.AddSecret(t)
+	}
+
+	return true, err
+}
+
+// getImageStages returns a stage for each image used by the container stages, skipping background stages still running from a previous run; stages sharing an image get the strictest of their pull policies
+func (b *runner) getImageStages(stages []*ManifestStage, images map[string]*ManifestStage) (imageStages []*ManifestStage) {
+	for _, s := range stages {
+		if len(s.Stages) > 0 {
+			imageStages = append(imageStages, b.getImageStages(s.Stages, images)...)
+			continue
+		}
+		if s.RunnerType != RunnerTypeContainer || (s.Background && b.isBackgroundStageKept(*s)) {
+			continue
+		}
+		if imageStage, ok := images[s.Image]; ok {
+			imageStage.PullPolicy = imageStage.PullPolicy.Strictest(s.PullPolicy)
+			continue
+		}
+
+		// copy the stage, so merging pull policies doesn't change the manifest
+		imageStage := *s
+		images[s.Image] = &imageStage
+		imageStages = append(imageStages, &imageStage)
+	}
+
+	return
+}
+
+func (b *runner) runParallelStages(ctx context.Context, stage ManifestStage, env, secrets map[string]string, needsNetwork bool, runID string, report *StageReport) (err error) {
 	g, ctx := errgroup.WithContext(ctx)
-	for _, s := range stage.Stages {
+	for i, s := range stage.Stages {
 		s := s
-		g.Go(func() error { return b.runStage(ctx, *s, env, needsNetwork, stage.Name) })
+		stageReport := report.Stages[i]
+		g.Go(func() error { return b.runStage(ctx, *s, env, secrets, needsNetwork, runID, stageReport, stage.Name) })
 	}
 
 	return g.Wait()
@@ -294,3 +1219,12 @@ func (b *runner) handleFunc(ctx context.Context, logger *log.Logger, funcToRun f
 
 	return nil
 }
+
+func stringArrayContains(array []string, value string) bool {
+	for _, v := range array {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
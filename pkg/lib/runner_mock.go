@@ -34,20 +34,49 @@ func (m *MockRunner) EXPECT() *MockRunnerMockRecorder {
 	return m.recorder
 }
 
-// Run mocks base method.
-func (m *MockRunner) Run(ctx context.Context, target string) error {
+// Lock mocks base method.
+func (m *MockRunner) Lock(ctx context.Context, check bool) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Run", ctx, target)
+	ret := m.ctrl.Call(m, "Lock", ctx, check)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
+// Lock indicates an expected call of Lock.
+func (mr *MockRunnerMockRecorder) Lock(ctx, check interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Lock", reflect.TypeOf((*MockRunner)(nil).Lock), ctx, check)
+}
+
+// Run mocks base method.
+func (m *MockRunner) Run(ctx context.Context, target string) (*RunReport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Run", ctx, target)
+	ret0, _ := ret[0].(*RunReport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
 // Run indicates an expected call of Run.
 func (mr *MockRunnerMockRecorder) Run(ctx, target interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Run", reflect.TypeOf((*MockRunner)(nil).Run), ctx, target)
 }
 
+// Shell mocks base method.
+func (m *MockRunner) Shell(ctx context.Context, target, stage string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Shell", ctx, target, stage)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Shell indicates an expected call of Shell.
+func (mr *MockRunnerMockRecorder) Shell(ctx, target, stage interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Shell", reflect.TypeOf((*MockRunner)(nil).Shell), ctx, target, stage)
+}
+
 // Validate mocks base method.
 func (m *MockRunner) Validate(ctx context.Context) (Manifest, error) {
 	m.ctrl.T.Helper()
@@ -62,3 +91,34 @@ func (mr *MockRunnerMockRecorder) Validate(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Validate", reflect.TypeOf((*MockRunner)(nil).Validate), ctx)
 }
+
+// ValidateManifest mocks base method.
+func (m *MockRunner) ValidateManifest(ctx context.Context) (Manifest, []error, []error, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ValidateManifest", ctx)
+	ret0, _ := ret[0].(Manifest)
+	ret1, _ := ret[1].([]error)
+	ret2, _ := ret[2].([]error)
+	ret3, _ := ret[3].(error)
+	return ret0, ret1, ret2, ret3
+}
+
+// ValidateManifest indicates an expected call of ValidateManifest.
+func (mr *MockRunnerMockRecorder) ValidateManifest(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ValidateManifest", reflect.TypeOf((*MockRunner)(nil).ValidateManifest), ctx)
+}
+
+// Watch mocks base method.
+func (m *MockRunner) Watch(ctx context.Context, target string, changes <-chan []string, runFinished func(context.Context, *RunReport, error) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Watch", ctx, target, changes, runFinished)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Watch indicates an expected call of Watch.
+func (mr *MockRunnerMockRecorder) Watch(ctx, target, changes, runFinished interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Watch", reflect.TypeOf((*MockRunner)(nil).Watch), ctx, target, changes, runFinished)
+}
@@ -2,6 +2,13 @@ package lib
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -11,7 +18,7 @@ import (
 
 func TestValidate(t *testing.T) {
 	t.Run("SucceedsIfInfinityManifestIsValid", func(t *testing.T) {
-		runner := NewRunner(NewManifestReader(), NewDockerRunner(NewCommandRunner(false), NewRandomStringGenerator(), ""), NewHostRunner(NewCommandRunner(false), ""), false, "", ".infinity-test.yaml")
+		runner := NewRunner(NewManifestReader(), NewDockerRunner(NewCommandRunner(NewSecretMasker(), false), NewRandomStringGenerator(), "", false, nil, false), NewHostRunner(NewCommandRunner(NewSecretMasker(), false), ""), NewSecretProvider("", ""), NewSecretMasker(), NewEnvFileReader(""), NewGitReader(""), nil, nil, 0, map[string]string{}, "", ".infinity-test.yaml")
 
 		// act
 		_, err := runner.Validate(context.Background())
@@ -20,6 +27,122 @@ func TestValidate(t *testing.T) {
 	})
 }
 
+func TestValidateManifest(t *testing.T) {
+	t.Run("WarnsAboutParametersNotDeclaredInLocalParameterSchemaWithoutInspectingImages", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		manifest := Manifest{
+			Metadata: ManifestMetadata{
+				ApplicationType: ApplicationTypeAPI,
+				Language:        LanguageGo,
+				Name:            "test-app",
+			},
+			Targets: []*ManifestTarget{
+				{
+					Name: "build/local",
+					Stages: []*ManifestStage{
+						{
+							Name:       "bake",
+							Image:      "jsalverda/bake:1.0",
+							Commands:   []string{"bake"},
+							Parameters: map[string]interface{}{"version": "1.2.3", "pusj": true},
+						},
+					},
+				},
+			},
+		}
+		manifest.SetDefault()
+
+		buildDirectory := t.TempDir()
+		err := ioutil.WriteFile(filepath.Join(buildDirectory, ParameterSchemaFilename), []byte("jsalverda/bake:\n- version\n- push\n"), 0644)
+		assert.Nil(t, err)
+		manifestReader := NewMockManifestReader(ctrl)
+
+		manifestReader.EXPECT().GetManifest(gomock.Any(), gomock.Eq(filepath.Join(buildDirectory, ".infinity.yaml"))).Return(manifest, nil)
+
+		runner := NewRunner(manifestReader, NewMockDockerRunner(ctrl), NewMockHostRunner(ctrl), NewMockSecretProvider(ctrl), NewSecretMasker(), NewEnvFileReader(""), NewMockGitReader(ctrl), nil, nil, 0, map[string]string{}, buildDirectory, ".infinity.yaml")
+
+		// act
+		_, warnings, errors, err := runner.ValidateManifest(context.Background())
+
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(errors))
+		assert.Equal(t, 1, len(warnings))
+		assert.Equal(t, "[bake] parameter pusj is not accepted by image jsalverda/bake:1.0; did you mean 'push'? accepted parameters are version, push", warnings[0].Error())
+	})
+}
+
+func TestLock(t *testing.T) {
+	t.Run("WritesDigestOfEachImageToLockfile", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		manifest := Manifest{
+			Targets: []*ManifestTarget{
+				{
+					Name: "build/local",
+					Stages: []*ManifestStage{
+						{Name: "build", Image: "golang:1.17-alpine", Commands: []string{"go build"}},
+						{Name: "test", Image: "golang:1.17-alpine", Commands: []string{"go test"}},
+						{Name: "scan", Image: "aquasec/trivy@sha256:012345", Commands: []string{"trivy"}},
+					},
+				},
+			},
+		}
+		manifest.SetDefault()
+
+		buildDirectory := t.TempDir()
+		manifestReader := NewMockManifestReader(ctrl)
+		dockerRunner := NewMockDockerRunner(ctrl)
+
+		manifestReader.EXPECT().GetManifest(gomock.Any(), gomock.Eq(filepath.Join(buildDirectory, ".infinity.yaml"))).Return(manifest, nil)
+		dockerRunner.EXPECT().ContainerImageDigest(gomock.Any(), gomock.Any(), gomock.Eq(ManifestStage{Image: "golang:1.17-alpine"})).Return("sha256:abc123", nil).Times(1)
+
+		runner := NewRunner(manifestReader, dockerRunner, NewMockHostRunner(ctrl), NewMockSecretProvider(ctrl), NewSecretMasker(), NewEnvFileReader(""), NewMockGitReader(ctrl), nil, nil, 0, map[string]string{}, buildDirectory, ".infinity.yaml")
+
+		// act
+		err := runner.Lock(context.Background(), false)
+
+		assert.Nil(t, err)
+		lock, err := ReadImageLock(filepath.Join(buildDirectory, ImageLockFilename))
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]string{"golang:1.17-alpine": "sha256:abc123"}, lock.Images)
+	})
+
+	t.Run("ReturnsErrorIfCheckedLockfileMissesImage", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		manifest := Manifest{
+			Targets: []*ManifestTarget{
+				{
+					Name: "build/local",
+					Stages: []*ManifestStage{
+						{Name: "build", Image: "golang:1.17-alpine", Commands: []string{"go build"}},
+					},
+				},
+			},
+		}
+		manifest.SetDefault()
+
+		buildDirectory := t.TempDir()
+		err := WriteImageLock(filepath.Join(buildDirectory, ImageLockFilename), ImageLock{Images: map[string]string{"golang:1.16-alpine": "sha256:abc123"}})
+		assert.Nil(t, err)
+		manifestReader := NewMockManifestReader(ctrl)
+
+		manifestReader.EXPECT().GetManifest(gomock.Any(), gomock.Any()).Return(manifest, nil)
+
+		runner := NewRunner(manifestReader, NewMockDockerRunner(ctrl), NewMockHostRunner(ctrl), NewMockSecretProvider(ctrl), NewSecretMasker(), NewEnvFileReader(""), NewMockGitReader(ctrl), nil, nil, 0, map[string]string{}, buildDirectory, ".infinity.yaml")
+
+		// act
+		err = runner.Lock(context.Background(), true)
+
+		assert.NotNil(t, err)
+		assert.Equal(t, fmt.Sprintf("lockfile %v is out of date: images golang:1.17-alpine are not pinned and images golang:1.16-alpine are no longer in the manifest; run 'infinity lock' to update it", filepath.Join(buildDirectory, ImageLockFilename)), err.Error())
+	})
+}
+
 func TestBuild(t *testing.T) {
 	t.Run("CallsContainerStartForEachStages", func(t *testing.T) {
 
@@ -54,21 +177,70 @@ func TestBuild(t *testing.T) {
 		manifestReader := NewMockManifestReader(ctrl)
 		dockerRunner := NewMockDockerRunner(ctrl)
 		hostRunner := NewMockHostRunner(ctrl)
+		gitReader := NewMockGitReader(ctrl)
+		gitReader.EXPECT().GetInfo(gomock.Any()).AnyTimes()
 
 		manifestReader.EXPECT().GetManifest(gomock.Any(), gomock.Eq(".infinity.yaml")).Return(manifest, nil)
 		dockerRunner.EXPECT().NeedsNetwork(gomock.Eq(manifest.Targets[0].Stages)).Return(false).Times(1)
 		dockerRunner.EXPECT().ContainerImageIsPulled(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
 		dockerRunner.EXPECT().ContainerPull(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
-		dockerRunner.EXPECT().ContainerStart(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Eq(false)).Times(2)
+		dockerRunner.EXPECT().ContainerStart(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Eq(false)).Times(2)
 
-		runner := NewRunner(manifestReader, dockerRunner, hostRunner, false, "", ".infinity.yaml")
+		runner := NewRunner(manifestReader, dockerRunner, hostRunner, NewMockSecretProvider(ctrl), NewSecretMasker(), NewEnvFileReader(""), gitReader, nil, nil, 0, map[string]string{}, "", ".infinity.yaml")
 
 		// act
-		err := runner.Run(context.Background(), "build/local")
+		_, err := runner.Run(context.Background(), "build/local")
 
 		assert.Nil(t, err)
 	})
 
+	t.Run("ReturnsErrorListingAvailableTargetsForUndefinedTarget", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		manifest := Manifest{
+			Metadata: ManifestMetadata{
+				ApplicationType: ApplicationTypeAPI,
+				Language:        LanguageGo,
+				Name:            "test-app",
+			},
+			Targets: []*ManifestTarget{
+				{
+					Name: "build/local",
+					Stages: []*ManifestStage{
+						{
+							Name:     "stage-1",
+							Image:    "alpine:3.13",
+							Commands: []string{"sleep 1"},
+						},
+					},
+				},
+				{
+					Name: "release",
+					Stages: []*ManifestStage{
+						{
+							Name:     "stage-1",
+							Image:    "alpine:3.13",
+							Commands: []string{"sleep 1"},
+						},
+					},
+				},
+			},
+		}
+		manifest.SetDefault()
+
+		manifestReader := NewMockManifestReader(ctrl)
+		manifestReader.EXPECT().GetManifest(gomock.Any(), gomock.Eq(".infinity.yaml")).Return(manifest, nil)
+
+		runner := NewRunner(manifestReader, NewMockDockerRunner(ctrl), NewMockHostRunner(ctrl), NewMockSecretProvider(ctrl), NewSecretMasker(), NewEnvFileReader(""), NewMockGitReader(ctrl), nil, nil, 0, map[string]string{}, "", ".infinity.yaml")
+
+		// act
+		_, err := runner.Run(context.Background(), "build/ci")
+
+		assert.NotNil(t, err)
+		assert.Equal(t, "Target build/ci is not defined in manifest; available targets are build/local, release, run 'infinity list' to see their stages", err.Error())
+	})
+
 	t.Run("CallsContainerPullForEachStage", func(t *testing.T) {
 
 		ctrl := gomock.NewController(t)
@@ -90,7 +262,7 @@ func TestBuild(t *testing.T) {
 						},
 						{
 							Name:     "stage-2",
-							Image:    "alpine:3.13",
+							Image:    "alpine:3.14",
 							Commands: []string{"sleep 1"},
 						},
 					},
@@ -102,17 +274,67 @@ func TestBuild(t *testing.T) {
 		manifestReader := NewMockManifestReader(ctrl)
 		dockerRunner := NewMockDockerRunner(ctrl)
 		hostRunner := NewMockHostRunner(ctrl)
+		gitReader := NewMockGitReader(ctrl)
+		gitReader.EXPECT().GetInfo(gomock.Any()).AnyTimes()
 
 		manifestReader.EXPECT().GetManifest(gomock.Any(), gomock.Eq(".infinity.yaml")).Return(manifest, nil)
 		dockerRunner.EXPECT().NeedsNetwork(gomock.Eq(manifest.Targets[0].Stages)).Return(false).Times(1)
 		dockerRunner.EXPECT().ContainerImageIsPulled(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
 		dockerRunner.EXPECT().ContainerPull(gomock.Any(), gomock.Any(), gomock.Any()).Times(2)
-		dockerRunner.EXPECT().ContainerStart(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Eq(false)).AnyTimes()
+		dockerRunner.EXPECT().ContainerStart(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Eq(false)).AnyTimes()
+
+		runner := NewRunner(manifestReader, dockerRunner, hostRunner, NewMockSecretProvider(ctrl), NewSecretMasker(), NewEnvFileReader(""), gitReader, nil, nil, 0, map[string]string{}, "", ".infinity.yaml")
+
+		// act
+		_, err := runner.Run(context.Background(), "build/local")
 
-		runner := NewRunner(manifestReader, dockerRunner, hostRunner, false, "", ".infinity.yaml")
+		assert.Nil(t, err)
+	})
+
+	t.Run("ReadsParametersFromImageLabelOnceImageIsPulled", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		manifest := Manifest{
+			Metadata: ManifestMetadata{
+				ApplicationType: ApplicationTypeAPI,
+				Language:        LanguageGo,
+				Name:            "test-app",
+			},
+			Targets: []*ManifestTarget{
+				{
+					Name: "build/local",
+					Stages: []*ManifestStage{
+						{
+							Name:       "bake",
+							Image:      "jsalverda/bake:1.0",
+							Commands:   []string{"bake"},
+							Parameters: map[string]interface{}{"version": "1.2.3", "pusj": true},
+						},
+					},
+				},
+			},
+		}
+		manifest.SetDefault()
+
+		manifestReader := NewMockManifestReader(ctrl)
+		dockerRunner := NewMockDockerRunner(ctrl)
+		gitReader := NewMockGitReader(ctrl)
+		gitReader.EXPECT().GetInfo(gomock.Any()).AnyTimes()
+
+		manifestReader.EXPECT().GetManifest(gomock.Any(), gomock.Eq(".infinity.yaml")).Return(manifest, nil)
+		dockerRunner.EXPECT().NeedsNetwork(gomock.Any()).Return(false).Times(1)
+		dockerRunner.EXPECT().ContainerImageIsPulled(gomock.Any(), gomock.Any(), gomock.Any()).Return(false, nil).Times(1)
+		gomock.InOrder(
+			dockerRunner.EXPECT().ContainerPull(gomock.Any(), gomock.Any(), gomock.Any()).Times(1),
+			dockerRunner.EXPECT().ContainerImageParameters(gomock.Any(), gomock.Any(), gomock.Any()).Return([]string{"version", "push"}, nil).Times(1),
+			dockerRunner.EXPECT().ContainerStart(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Eq(false)).Times(1),
+		)
+
+		runner := NewRunner(manifestReader, dockerRunner, NewMockHostRunner(ctrl), NewMockSecretProvider(ctrl), NewSecretMasker(), NewEnvFileReader(""), gitReader, nil, nil, 0, map[string]string{}, "", ".infinity.yaml")
 
 		// act
-		err := runner.Run(context.Background(), "build/local")
+		_, err := runner.Run(context.Background(), "build/local")
 
 		assert.Nil(t, err)
 	})
@@ -155,22 +377,24 @@ func TestBuild(t *testing.T) {
 		manifestReader := NewMockManifestReader(ctrl)
 		dockerRunner := NewMockDockerRunner(ctrl)
 		hostRunner := NewMockHostRunner(ctrl)
+		gitReader := NewMockGitReader(ctrl)
+		gitReader.EXPECT().GetInfo(gomock.Any()).AnyTimes()
 
 		manifestReader.EXPECT().GetManifest(gomock.Any(), gomock.Eq(".infinity.yaml")).Return(manifest, nil)
 		dockerRunner.EXPECT().NeedsNetwork(gomock.Eq(manifest.Targets[0].Stages)).Return(false).Times(1)
 		dockerRunner.EXPECT().ContainerImageIsPulled(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
 		dockerRunner.EXPECT().ContainerPull(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
-		dockerRunner.EXPECT().ContainerStart(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Eq(false)).Times(2)
+		dockerRunner.EXPECT().ContainerStart(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Eq(false)).Times(2)
 
-		runner := NewRunner(manifestReader, dockerRunner, hostRunner, false, "", ".infinity.yaml")
+		runner := NewRunner(manifestReader, dockerRunner, hostRunner, NewMockSecretProvider(ctrl), NewSecretMasker(), NewEnvFileReader(""), gitReader, nil, nil, 0, map[string]string{}, "", ".infinity.yaml")
 
 		// act
-		err := runner.Run(context.Background(), "build/local")
+		_, err := runner.Run(context.Background(), "build/local")
 
 		assert.Nil(t, err)
 	})
 
-	t.Run("CallsContainerPullForEachParallelStage", func(t *testing.T) {
+	t.Run("CallsContainerPullWithoutCheckingImageIfPullPolicyIsAlways", func(t *testing.T) {
 
 		ctrl := gomock.NewController(t)
 
@@ -185,19 +409,10 @@ func TestBuild(t *testing.T) {
 					Name: "build/local",
 					Stages: []*ManifestStage{
 						{
-							Name: "parallel",
-							Stages: []*ManifestStage{
-								{
-									Name:     "stage-1",
-									Image:    "alpine:3.13",
-									Commands: []string{"sleep 1"},
-								},
-								{
-									Name:     "stage-2",
-									Image:    "alpine:3.13",
-									Commands: []string{"sleep 1"},
-								},
-							},
+							Name:       "stage-1",
+							Image:      "alpine:3.13",
+							PullPolicy: PullPolicyAlways,
+							Commands:   []string{"sleep 1"},
 						},
 					},
 				},
@@ -208,22 +423,24 @@ func TestBuild(t *testing.T) {
 		manifestReader := NewMockManifestReader(ctrl)
 		dockerRunner := NewMockDockerRunner(ctrl)
 		hostRunner := NewMockHostRunner(ctrl)
+		gitReader := NewMockGitReader(ctrl)
+		gitReader.EXPECT().GetInfo(gomock.Any()).AnyTimes()
 
 		manifestReader.EXPECT().GetManifest(gomock.Any(), gomock.Eq(".infinity.yaml")).Return(manifest, nil)
-		dockerRunner.EXPECT().NeedsNetwork(gomock.Eq(manifest.Targets[0].Stages)).Return(false).Times(1)
-		dockerRunner.EXPECT().ContainerImageIsPulled(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
-		dockerRunner.EXPECT().ContainerPull(gomock.Any(), gomock.Any(), gomock.Any()).Times(2)
-		dockerRunner.EXPECT().ContainerStart(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Eq(false)).AnyTimes()
+		dockerRunner.EXPECT().NeedsNetwork(gomock.Any()).Return(false).Times(1)
+		dockerRunner.EXPECT().ContainerImageIsPulled(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+		dockerRunner.EXPECT().ContainerPull(gomock.Any(), gomock.Any(), gomock.Any()).Times(1)
+		dockerRunner.EXPECT().ContainerStart(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1)
 
-		runner := NewRunner(manifestReader, dockerRunner, hostRunner, false, "", ".infinity.yaml")
+		runner := NewRunner(manifestReader, dockerRunner, hostRunner, NewMockSecretProvider(ctrl), NewSecretMasker(), NewEnvFileReader(""), gitReader, nil, nil, 0, map[string]string{}, "", ".infinity.yaml")
 
 		// act
-		err := runner.Run(context.Background(), "build/local")
+		_, err := runner.Run(context.Background(), "build/local")
 
 		assert.Nil(t, err)
 	})
 
-	t.Run("CreatesNetworkIfAnyStagesNeedNetwork", func(t *testing.T) {
+	t.Run("ReturnsErrorWithoutPullingIfPullPolicyIsNeverAndImageIsNotPresent", func(t *testing.T) {
 
 		ctrl := gomock.NewController(t)
 
@@ -239,14 +456,70 @@ func TestBuild(t *testing.T) {
 					Stages: []*ManifestStage{
 						{
 							Name:       "stage-1",
-							Background: true,
 							Image:      "alpine:3.13",
+							PullPolicy: PullPolicyNever,
 							Commands:   []string{"sleep 1"},
 						},
+					},
+				},
+			},
+		}
+		manifest.SetDefault()
+
+		manifestReader := NewMockManifestReader(ctrl)
+		dockerRunner := NewMockDockerRunner(ctrl)
+		hostRunner := NewMockHostRunner(ctrl)
+		gitReader := NewMockGitReader(ctrl)
+		gitReader.EXPECT().GetInfo(gomock.Any()).AnyTimes()
+
+		manifestReader.EXPECT().GetManifest(gomock.Any(), gomock.Eq(".infinity.yaml")).Return(manifest, nil)
+		dockerRunner.EXPECT().NeedsNetwork(gomock.Any()).Return(false).Times(1)
+		dockerRunner.EXPECT().ContainerImageIsPulled(gomock.Any(), gomock.Any(), gomock.Any()).Return(false, nil).Times(1)
+		dockerRunner.EXPECT().ContainerPull(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+		dockerRunner.EXPECT().ContainerStart(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+		runner := NewRunner(manifestReader, dockerRunner, hostRunner, NewMockSecretProvider(ctrl), NewSecretMasker(), NewEnvFileReader(""), gitReader, nil, nil, 0, map[string]string{}, "", ".infinity.yaml")
+
+		// act
+		_, err := runner.Run(context.Background(), "build/local")
+
+		assert.NotNil(t, err)
+		assert.Equal(t, "image alpine:3.13 of stage stage-1 is not present and its pull policy is never; please pull it first or set 'pullPolicy: ifNotPresent'", err.Error())
+	})
+
+	t.Run("RunsNoMoreParallelStagesAtTheSameTimeThanMaxParallel", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		manifest := Manifest{
+			Metadata: ManifestMetadata{
+				ApplicationType: ApplicationTypeAPI,
+				Language:        LanguageGo,
+				Name:            "test-app",
+			},
+			Targets: []*ManifestTarget{
+				{
+					Name: "build/local",
+					Stages: []*ManifestStage{
 						{
-							Name:     "stage-2",
-							Image:    "alpine:3.13",
-							Commands: []string{"sleep 1"},
+							Name: "parallel",
+							Stages: []*ManifestStage{
+								{
+									Name:     "stage-1",
+									Image:    "alpine:3.13",
+									Commands: []string{"sleep 1"},
+								},
+								{
+									Name:     "stage-2",
+									Image:    "alpine:3.13",
+									Commands: []string{"sleep 1"},
+								},
+								{
+									Name:     "stage-3",
+									Image:    "alpine:3.13",
+									Commands: []string{"sleep 1"},
+								},
+							},
 						},
 					},
 				},
@@ -257,25 +530,37 @@ func TestBuild(t *testing.T) {
 		manifestReader := NewMockManifestReader(ctrl)
 		dockerRunner := NewMockDockerRunner(ctrl)
 		hostRunner := NewMockHostRunner(ctrl)
+		gitReader := NewMockGitReader(ctrl)
+		gitReader.EXPECT().GetInfo(gomock.Any()).AnyTimes()
 
+		running, maxRunning := int32(0), int32(0)
 		manifestReader.EXPECT().GetManifest(gomock.Any(), gomock.Eq(".infinity.yaml")).Return(manifest, nil)
-		dockerRunner.EXPECT().NeedsNetwork(gomock.Eq(manifest.Targets[0].Stages)).Return(true).Times(1)
-		dockerRunner.EXPECT().NetworkCreate(gomock.Any(), gomock.Any()).Times(1)
-		dockerRunner.EXPECT().ContainerImageIsPulled(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
-		dockerRunner.EXPECT().ContainerPull(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
-		dockerRunner.EXPECT().ContainerStart(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Eq(true)).AnyTimes()
-		dockerRunner.EXPECT().StopRunningContainers(gomock.Any()).Times(1)
-		dockerRunner.EXPECT().NetworkRemove(gomock.Any(), gomock.Any()).Times(1)
+		dockerRunner.EXPECT().NeedsNetwork(gomock.Eq(manifest.Targets[0].Stages)).Return(false).Times(1)
+		dockerRunner.EXPECT().ContainerImageIsPulled(gomock.Any(), gomock.Any(), gomock.Any()).Return(true, nil).AnyTimes()
+		dockerRunner.EXPECT().ContainerStart(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Eq(false)).
+			DoAndReturn(func(ctx context.Context, logger *log.Logger, stage ManifestStage, env, secretEnv, secretFiles map[string]string, needsNetwork bool) error {
+				r := atomic.AddInt32(&running, 1)
+				for {
+					m := atomic.LoadInt32(&maxRunning)
+					if r <= m || atomic.CompareAndSwapInt32(&maxRunning, m, r) {
+						break
+					}
+				}
+				time.Sleep(50 * time.Millisecond)
+				atomic.AddInt32(&running, -1)
+				return nil
+			}).Times(3)
 
-		runner := NewRunner(manifestReader, dockerRunner, hostRunner, false, "", ".infinity.yaml")
+		runner := NewRunner(manifestReader, dockerRunner, hostRunner, NewMockSecretProvider(ctrl), NewSecretMasker(), NewEnvFileReader(""), gitReader, nil, nil, 2, map[string]string{}, "", ".infinity.yaml")
 
 		// act
-		err := runner.Run(context.Background(), "build/local")
+		_, err := runner.Run(context.Background(), "build/local")
 
 		assert.Nil(t, err)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&maxRunning))
 	})
 
-	t.Run("RunsHostRunForEachStageWithHostRunner", func(t *testing.T) {
+	t.Run("CallsContainerPullForEachParallelStage", func(t *testing.T) {
 
 		ctrl := gomock.NewController(t)
 
@@ -290,9 +575,19 @@ func TestBuild(t *testing.T) {
 					Name: "build/local",
 					Stages: []*ManifestStage{
 						{
-							Name:       "stage-1",
-							RunnerType: RunnerTypeHost,
-							Commands:   []string{"sleep 1"},
+							Name: "parallel",
+							Stages: []*ManifestStage{
+								{
+									Name:     "stage-1",
+									Image:    "alpine:3.13",
+									Commands: []string{"sleep 1"},
+								},
+								{
+									Name:     "stage-2",
+									Image:    "alpine:3.14",
+									Commands: []string{"sleep 1"},
+								},
+							},
 						},
 					},
 				},
@@ -303,17 +598,1175 @@ func TestBuild(t *testing.T) {
 		manifestReader := NewMockManifestReader(ctrl)
 		dockerRunner := NewMockDockerRunner(ctrl)
 		hostRunner := NewMockHostRunner(ctrl)
+		gitReader := NewMockGitReader(ctrl)
+		gitReader.EXPECT().GetInfo(gomock.Any()).AnyTimes()
 
 		manifestReader.EXPECT().GetManifest(gomock.Any(), gomock.Eq(".infinity.yaml")).Return(manifest, nil)
 		dockerRunner.EXPECT().NeedsNetwork(gomock.Eq(manifest.Targets[0].Stages)).Return(false).Times(1)
-		hostRunner.EXPECT().RunStage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1)
+		dockerRunner.EXPECT().ContainerImageIsPulled(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+		dockerRunner.EXPECT().ContainerPull(gomock.Any(), gomock.Any(), gomock.Any()).Times(2)
+		dockerRunner.EXPECT().ContainerStart(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Eq(false)).AnyTimes()
+
+		runner := NewRunner(manifestReader, dockerRunner, hostRunner, NewMockSecretProvider(ctrl), NewSecretMasker(), NewEnvFileReader(""), gitReader, nil, nil, 0, map[string]string{}, "", ".infinity.yaml")
+
+		// act
+		_, err := runner.Run(context.Background(), "build/local")
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("PullsImageSharedByStagesOnceBeforeRunningThem", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		manifest := Manifest{
+			Metadata: ManifestMetadata{
+				ApplicationType: ApplicationTypeAPI,
+				Language:        LanguageGo,
+				Name:            "test-app",
+			},
+			Targets: []*ManifestTarget{
+				{
+					Name: "build/local",
+					Stages: []*ManifestStage{
+						{
+							Name: "parallel",
+							Stages: []*ManifestStage{
+								{
+									Name:     "stage-1",
+									Image:    "alpine:3.13",
+									Commands: []string{"sleep 1"},
+								},
+								{
+									Name:     "stage-2",
+									Image:    "alpine:3.13",
+									Commands: []string{"sleep 1"},
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+		manifest.SetDefault()
+
+		manifestReader := NewMockManifestReader(ctrl)
+		dockerRunner := NewMockDockerRunner(ctrl)
+		hostRunner := NewMockHostRunner(ctrl)
+		gitReader := NewMockGitReader(ctrl)
+		gitReader.EXPECT().GetInfo(gomock.Any()).AnyTimes()
+
+		manifestReader.EXPECT().GetManifest(gomock.Any(), gomock.Eq(".infinity.yaml")).Return(manifest, nil)
+		dockerRunner.EXPECT().NeedsNetwork(gomock.Eq(manifest.Targets[0].Stages)).Return(false).Times(1)
+		dockerRunner.EXPECT().ContainerImageIsPulled(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+		pull := dockerRunner.EXPECT().ContainerPull(gomock.Any(), gomock.Any(), gomock.Any()).Times(1)
+		dockerRunner.EXPECT().ContainerStart(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Eq(false)).After(pull).Times(2)
+
+		runner := NewRunner(manifestReader, dockerRunner, hostRunner, NewMockSecretProvider(ctrl), NewSecretMasker(), NewEnvFileReader(""), gitReader, nil, nil, 0, map[string]string{}, "", ".infinity.yaml")
+
+		// act
+		_, err := runner.Run(context.Background(), "build/local")
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("PullsImageSharedByStagesWithStrictestPullPolicyOfThem", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		manifest := Manifest{
+			Metadata: ManifestMetadata{
+				ApplicationType: ApplicationTypeAPI,
+				Language:        LanguageGo,
+				Name:            "test-app",
+			},
+			Targets: []*ManifestTarget{
+				{
+					Name: "build/local",
+					Stages: []*ManifestStage{
+						{
+							Name:     "stage-1",
+							Image:    "alpine:latest",
+							Commands: []string{"sleep 1"},
+						},
+						{
+							Name:       "stage-2",
+							Image:      "alpine:latest",
+							PullPolicy: PullPolicyAlways,
+							Commands:   []string{"sleep 1"},
+						},
+					},
+				},
+			},
+		}
+		manifest.SetDefault()
+
+		manifestReader := NewMockManifestReader(ctrl)
+		dockerRunner := NewMockDockerRunner(ctrl)
+		hostRunner := NewMockHostRunner(ctrl)
+		gitReader := NewMockGitReader(ctrl)
+		gitReader.EXPECT().GetInfo(gomock.Any()).AnyTimes()
+
+		manifestReader.EXPECT().GetManifest(gomock.Any(), gomock.Eq(".infinity.yaml")).Return(manifest, nil)
+		dockerRunner.EXPECT().NeedsNetwork(gomock.Eq(manifest.Targets[0].Stages)).Return(false).Times(1)
+		dockerRunner.EXPECT().ContainerImageIsPulled(gomock.Any(), gomock.Any(), gomock.Any()).Return(true, nil).Times(0)
+		pull := dockerRunner.EXPECT().ContainerPull(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, logger *log.Logger, stage ManifestStage) error {
+			assert.Equal(t, PullPolicyAlways, stage.PullPolicy)
+			return nil
+		}).Times(1)
+		dockerRunner.EXPECT().ContainerStart(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Eq(false)).After(pull).Times(2)
+
+		runner := NewRunner(manifestReader, dockerRunner, hostRunner, NewMockSecretProvider(ctrl), NewSecretMasker(), NewEnvFileReader(""), gitReader, nil, nil, 0, map[string]string{}, "", ".infinity.yaml")
+
+		// act
+		_, err := runner.Run(context.Background(), "build/local")
+
+		assert.Nil(t, err)
+		assert.Equal(t, PullPolicyIfNotPresent, manifest.Targets[0].Stages[0].PullPolicy)
+	})
+
+	t.Run("ReturnsErrorWithoutRunningStagesIfPullFails", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		manifest := Manifest{
+			Metadata: ManifestMetadata{
+				ApplicationType: ApplicationTypeAPI,
+				Language:        LanguageGo,
+				Name:            "test-app",
+			},
+			Targets: []*ManifestTarget{
+				{
+					Name: "build/local",
+					Stages: []*ManifestStage{
+						{
+							Name: "parallel",
+							Stages: []*ManifestStage{
+								{
+									Name:     "stage-1",
+									Image:    "alpine:3.13",
+									Commands: []string{"sleep 1"},
+								},
+								{
+									Name:     "stage-2",
+									Image:    "alpine:3.14",
+									Commands: []string{"sleep 1"},
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+		manifest.SetDefault()
+
+		manifestReader := NewMockManifestReader(ctrl)
+		dockerRunner := NewMockDockerRunner(ctrl)
+		hostRunner := NewMockHostRunner(ctrl)
+		gitReader := NewMockGitReader(ctrl)
+		gitReader.EXPECT().GetInfo(gomock.Any()).AnyTimes()
+
+		manifestReader.EXPECT().GetManifest(gomock.Any(), gomock.Eq(".infinity.yaml")).Return(manifest, nil)
+		dockerRunner.EXPECT().NeedsNetwork(gomock.Eq(manifest.Targets[0].Stages)).Return(false).Times(1)
+		dockerRunner.EXPECT().ContainerImageIsPulled(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+		dockerRunner.EXPECT().ContainerPull(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, logger *log.Logger, stage ManifestStage) error {
+			if stage.Image == "alpine:3.14" {
+				return fmt.Errorf("pulling image alpine:3.14 for stage stage-2 failed: exit status 1")
+			}
+			return nil
+		}).MinTimes(1).MaxTimes(2)
+		dockerRunner.EXPECT().ContainerStart(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+		runner := NewRunner(manifestReader, dockerRunner, hostRunner, NewMockSecretProvider(ctrl), NewSecretMasker(), NewEnvFileReader(""), gitReader, nil, nil, 0, map[string]string{}, "", ".infinity.yaml")
+
+		// act
+		_, err := runner.Run(context.Background(), "build/local")
+
+		assert.NotNil(t, err)
+		assert.Equal(t, "pulling image alpine:3.14 for stage stage-2 failed: exit status 1", err.Error())
+	})
+
+	t.Run("LogsInToRegistryOfPrivateImagesBeforePullingThem", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		manifest := Manifest{
+			Metadata: ManifestMetadata{
+				ApplicationType: ApplicationTypeAPI,
+				Language:        LanguageGo,
+				Name:            "test-app",
+			},
+			Secrets: []*ManifestSecret{
+				{Name: "registry-password", Env: "REGISTRY_PASSWORD"},
+			},
+			Registries: []*ManifestRegistry{
+				{Host: "registry.example.com", Username: "ci", Secret: "registry-password"},
+				{Host: "ghcr.io", Username: "ci", Env: "GHCR_TOKEN"},
+			},
+			Targets: []*ManifestTarget{
+				{
+					Name: "build/local",
+					Stages: []*ManifestStage{
+						{
+							Name:     "stage-1",
+							Image:    "registry.example.com/base/go:1.17",
+							Commands: []string{"go build"},
+						},
+						{
+							Name:     "stage-2",
+							Image:    "alpine:3.13",
+							Commands: []string{"sleep 1"},
+						},
+					},
+				},
+			},
+		}
+		manifest.SetDefault()
+
+		manifestReader := NewMockManifestReader(ctrl)
+		dockerRunner := NewMockDockerRunner(ctrl)
+		hostRunner := NewMockHostRunner(ctrl)
+		secretProvider := NewMockSecretProvider(ctrl)
+		gitReader := NewMockGitReader(ctrl)
+		gitReader.EXPECT().GetInfo(gomock.Any()).AnyTimes()
+
+		manifestReader.EXPECT().GetManifest(gomock.Any(), gomock.Eq(".infinity.yaml")).Return(manifest, nil)
+		secretProvider.EXPECT().GetSecret(gomock.Any(), gomock.Eq(*manifest.Secrets[0])).Return("s3cr3t", nil).Times(1)
+		dockerRunner.EXPECT().NeedsNetwork(gomock.Any()).Return(false).Times(1)
+		dockerRunner.EXPECT().ContainerImageIsPulled(gomock.Any(), gomock.Any(), gomock.Any()).Return(false, nil).Times(2)
+		gomock.InOrder(
+			dockerRunner.EXPECT().RegistryLogin(gomock.Any(), gomock.Any(), gomock.Eq([]RegistryCredentials{{Host: "registry.example.com", Username: "ci", Password: "s3cr3t"}})).Return(nil, nil).Times(1),
+			dockerRunner.EXPECT().ContainerPull(gomock.Any(), gomock.Any(), gomock.Any()).Times(2),
+			dockerRunner.EXPECT().RegistryLogout(gomock.Any(), gomock.Any()).Times(1),
+			dockerRunner.EXPECT().ContainerStart(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(2),
+		)
+
+		runner := NewRunner(manifestReader, dockerRunner, hostRunner, secretProvider, NewSecretMasker(), NewEnvFileReader(""), gitReader, nil, nil, 0, map[string]string{}, "", ".infinity.yaml")
+
+		// act
+		_, err := runner.Run(context.Background(), "build/local")
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("MasksTokenPrintedByRegistryCommand", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		manifest := Manifest{
+			Metadata: ManifestMetadata{
+				ApplicationType: ApplicationTypeAPI,
+				Language:        LanguageGo,
+				Name:            "test-app",
+			},
+			Registries: []*ManifestRegistry{
+				{Host: "123456789.dkr.ecr.eu-west-1.amazonaws.com", Username: "AWS", Command: "aws ecr get-login-password"},
+			},
+			Targets: []*ManifestTarget{
+				{
+					Name: "build/local",
+					Stages: []*ManifestStage{
+						{
+							Name:     "stage-1",
+							Image:    "123456789.dkr.ecr.eu-west-1.amazonaws.com/base/go:1.17",
+							Commands: []string{"go build"},
+						},
+					},
+				},
+			},
+		}
+		manifest.SetDefault()
+
+		manifestReader := NewMockManifestReader(ctrl)
+		dockerRunner := NewMockDockerRunner(ctrl)
+		hostRunner := NewMockHostRunner(ctrl)
+		gitReader := NewMockGitReader(ctrl)
+		gitReader.EXPECT().GetInfo(gomock.Any()).AnyTimes()
+		secretMasker := NewSecretMasker()
+
+		manifestReader.EXPECT().GetManifest(gomock.Any(), gomock.Eq(".infinity.yaml")).Return(manifest, nil)
+		dockerRunner.EXPECT().NeedsNetwork(gomock.Any()).Return(false).Times(1)
+		dockerRunner.EXPECT().ContainerImageIsPulled(gomock.Any(), gomock.Any(), gomock.Any()).Return(false, nil).Times(1)
+		dockerRunner.EXPECT().RegistryLogin(gomock.Any(), gomock.Any(), gomock.Any()).Return([]string{"token123"}, nil).Times(1)
+		dockerRunner.EXPECT().ContainerPull(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, logger *log.Logger, stage ManifestStage) error {
+			assert.Equal(t, "login with ***", secretMasker.Mask("login with token123"))
+			return nil
+		}).Times(1)
+		dockerRunner.EXPECT().RegistryLogout(gomock.Any(), gomock.Any()).Times(1)
+		dockerRunner.EXPECT().ContainerStart(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1)
+
+		runner := NewRunner(manifestReader, dockerRunner, hostRunner, NewMockSecretProvider(ctrl), secretMasker, NewEnvFileReader(""), gitReader, nil, nil, 0, map[string]string{}, "", ".infinity.yaml")
+
+		// act
+		_, err := runner.Run(context.Background(), "build/local")
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("CreatesNetworkIfAnyStagesNeedNetwork", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		manifest := Manifest{
+			Metadata: ManifestMetadata{
+				ApplicationType: ApplicationTypeAPI,
+				Language:        LanguageGo,
+				Name:            "test-app",
+			},
+			Targets: []*ManifestTarget{
+				{
+					Name: "build/local",
+					Stages: []*ManifestStage{
+						{
+							Name:       "stage-1",
+							Background: true,
+							Image:      "alpine:3.13",
+							Commands:   []string{"sleep 1"},
+						},
+						{
+							Name:     "stage-2",
+							Image:    "alpine:3.13",
+							Commands: []string{"sleep 1"},
+						},
+					},
+				},
+			},
+		}
+		manifest.SetDefault()
+
+		manifestReader := NewMockManifestReader(ctrl)
+		dockerRunner := NewMockDockerRunner(ctrl)
+		hostRunner := NewMockHostRunner(ctrl)
+		gitReader := NewMockGitReader(ctrl)
+		gitReader.EXPECT().GetInfo(gomock.Any()).AnyTimes()
+
+		manifestReader.EXPECT().GetManifest(gomock.Any(), gomock.Eq(".infinity.yaml")).Return(manifest, nil)
+		dockerRunner.EXPECT().NeedsNetwork(gomock.Eq(manifest.Targets[0].Stages)).Return(true).Times(1)
+		dockerRunner.EXPECT().NetworkCreate(gomock.Any(), gomock.Any()).Times(1)
+		dockerRunner.EXPECT().ContainerImageIsPulled(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+		dockerRunner.EXPECT().ContainerPull(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+		dockerRunner.EXPECT().ContainerStart(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Eq(true)).AnyTimes()
+		dockerRunner.EXPECT().StopRunningContainers(gomock.Any(), gomock.Any()).Times(1)
+		dockerRunner.EXPECT().NetworkRemove(gomock.Any(), gomock.Any()).Times(1)
+
+		runner := NewRunner(manifestReader, dockerRunner, hostRunner, NewMockSecretProvider(ctrl), NewSecretMasker(), NewEnvFileReader(""), gitReader, nil, nil, 0, map[string]string{}, "", ".infinity.yaml")
+
+		// act
+		_, err := runner.Run(context.Background(), "build/local")
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("RunsHostRunForEachStageWithHostRunner", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		manifest := Manifest{
+			Metadata: ManifestMetadata{
+				ApplicationType: ApplicationTypeAPI,
+				Language:        LanguageGo,
+				Name:            "test-app",
+			},
+			Targets: []*ManifestTarget{
+				{
+					Name: "build/local",
+					Stages: []*ManifestStage{
+						{
+							Name:       "stage-1",
+							RunnerType: RunnerTypeHost,
+							Commands:   []string{"sleep 1"},
+						},
+					},
+				},
+			},
+		}
+		manifest.SetDefault()
+
+		manifestReader := NewMockManifestReader(ctrl)
+		dockerRunner := NewMockDockerRunner(ctrl)
+		hostRunner := NewMockHostRunner(ctrl)
+		gitReader := NewMockGitReader(ctrl)
+		gitReader.EXPECT().GetInfo(gomock.Any()).AnyTimes()
+
+		manifestReader.EXPECT().GetManifest(gomock.Any(), gomock.Eq(".infinity.yaml")).Return(manifest, nil)
+		dockerRunner.EXPECT().NeedsNetwork(gomock.Eq(manifest.Targets[0].Stages)).Return(false).Times(1)
+		hostRunner.EXPECT().RunStage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1)
+
+		runner := NewRunner(manifestReader, dockerRunner, hostRunner, NewMockSecretProvider(ctrl), NewSecretMasker(), NewEnvFileReader(""), gitReader, nil, nil, 0, map[string]string{}, "", ".infinity.yaml")
+
+		// act
+		_, err := runner.Run(context.Background(), "build/local")
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("ReportsFailedStageAndSkipsRemainingStages", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		manifest := Manifest{
+			Metadata: ManifestMetadata{
+				ApplicationType: ApplicationTypeAPI,
+				Language:        LanguageGo,
+				Name:            "test-app",
+			},
+			Targets: []*ManifestTarget{
+				{
+					Name: "build/local",
+					Stages: []*ManifestStage{
+						{
+							Name:       "stage-1",
+							RunnerType: RunnerTypeHost,
+							Commands:   []string{"exit 1"},
+						},
+						{
+							Name:       "stage-2",
+							RunnerType: RunnerTypeHost,
+							Commands:   []string{"sleep 1"},
+						},
+					},
+				},
+			},
+		}
+		manifest.SetDefault()
+
+		manifestReader := NewMockManifestReader(ctrl)
+		dockerRunner := NewMockDockerRunner(ctrl)
+		hostRunner := NewMockHostRunner(ctrl)
+		gitReader := NewMockGitReader(ctrl)
+		gitReader.EXPECT().GetInfo(gomock.Any()).AnyTimes()
+
+		manifestReader.EXPECT().GetManifest(gomock.Any(), gomock.Eq(".infinity.yaml")).Return(manifest, nil)
+		dockerRunner.EXPECT().NeedsNetwork(gomock.Eq(manifest.Targets[0].Stages)).Return(false).Times(1)
+		hostRunner.EXPECT().RunStage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(&StageExitError{Stage: "stage-1", ExitCode: 1}).Times(1)
+
+		runner := NewRunner(manifestReader, dockerRunner, hostRunner, NewMockSecretProvider(ctrl), NewSecretMasker(), NewEnvFileReader(""), gitReader, nil, nil, 0, map[string]string{}, "", ".infinity.yaml")
+
+		// act
+		report, err := runner.Run(context.Background(), "build/local")
+
+		assert.NotNil(t, err)
+		assert.Equal(t, StageStatusFailed, report.Status)
+		assert.Equal(t, 2, len(report.Stages))
+		assert.Equal(t, StageStatusFailed, report.Stages[0].Status)
+		assert.Equal(t, 1, *report.Stages[0].ExitCode)
+		assert.Equal(t, StageStatusSkipped, report.Stages[1].Status)
+	})
+
+	t.Run("WritesEventsForRunAndStages", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		manifest := Manifest{
+			Metadata: ManifestMetadata{
+				ApplicationType: ApplicationTypeAPI,
+				Language:        LanguageGo,
+				Name:            "test-app",
+			},
+			Targets: []*ManifestTarget{
+				{
+					Name: "build/local",
+					Stages: []*ManifestStage{
+						{
+							Name:       "stage-1",
+							RunnerType: RunnerTypeHost,
+							Commands:   []string{"sleep 1"},
+						},
+					},
+				},
+			},
+		}
+		manifest.SetDefault()
+
+		manifestReader := NewMockManifestReader(ctrl)
+		dockerRunner := NewMockDockerRunner(ctrl)
+		hostRunner := NewMockHostRunner(ctrl)
+		gitReader := NewMockGitReader(ctrl)
+		gitReader.EXPECT().GetInfo(gomock.Any()).AnyTimes()
+		eventWriter := NewMockRunEventWriter(ctrl)
+		eventWriter.EXPECT().LogOutput(gomock.Any()).Return(ioutil.Discard).AnyTimes()
+
+		manifestReader.EXPECT().GetManifest(gomock.Any(), gomock.Eq(".infinity.yaml")).Return(manifest, nil)
+		dockerRunner.EXPECT().NeedsNetwork(gomock.Eq(manifest.Targets[0].Stages)).Return(false).Times(1)
+		hostRunner.EXPECT().RunStage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1)
+		gomock.InOrder(
+			eventWriter.EXPECT().RunStarted(gomock.Any()).Times(1),
+			eventWriter.EXPECT().StageStarted(gomock.Any()).Times(1),
+			eventWriter.EXPECT().StageFinished(gomock.Any()).Times(1),
+			eventWriter.EXPECT().RunFinished(gomock.Any()).Times(1),
+		)
+
+		runner := NewRunner(manifestReader, dockerRunner, hostRunner, NewMockSecretProvider(ctrl), NewSecretMasker(), NewEnvFileReader(""), gitReader, eventWriter, nil, 0, map[string]string{}, "", ".infinity.yaml")
+
+		// act
+		_, err := runner.Run(context.Background(), "build/local")
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("RecordsSpanForTargetAndEachStage", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		manifest := Manifest{
+			Metadata: ManifestMetadata{
+				ApplicationType: ApplicationTypeAPI,
+				Language:        LanguageGo,
+				Name:            "test-app",
+			},
+			Targets: []*ManifestTarget{
+				{
+					Name: "build/local",
+					Stages: []*ManifestStage{
+						{
+							Name:       "stage-1",
+							RunnerType: RunnerTypeHost,
+							Commands:   []string{"sleep 1"},
+						},
+					},
+				},
+			},
+		}
+		manifest.SetDefault()
+
+		manifestReader := NewMockManifestReader(ctrl)
+		dockerRunner := NewMockDockerRunner(ctrl)
+		hostRunner := NewMockHostRunner(ctrl)
+		gitReader := NewMockGitReader(ctrl)
+		gitReader.EXPECT().GetInfo(gomock.Any()).AnyTimes()
+
+		manifestReader.EXPECT().GetManifest(gomock.Any(), gomock.Eq(".infinity.yaml")).Return(manifest, nil)
+		dockerRunner.EXPECT().NeedsNetwork(gomock.Eq(manifest.Targets[0].Stages)).Return(false).Times(1)
+		hostRunner.EXPECT().RunStage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1)
+
+		runner := NewRunner(manifestReader, dockerRunner, hostRunner, NewMockSecretProvider(ctrl), NewSecretMasker(), NewEnvFileReader(""), gitReader, nil, nil, 0, map[string]string{}, "", ".infinity.yaml")
+		tracer := NewTracer()
+
+		// act
+		_, err := runner.Run(ContextWithTracer(context.Background(), tracer), "build/local")
+
+		assert.Nil(t, err)
+		spans := tracer.GetSpans()
+		assert.Equal(t, 2, len(spans))
+		assert.Equal(t, "build/local", spans[0].Name)
+		assert.Equal(t, "stage-1", spans[1].Name)
+		assert.Equal(t, spans[0].SpanID, spans[1].ParentSpanID)
+		assert.Equal(t, "host", spans[1].Attributes["infinity.stage.runner"])
+		assert.Equal(t, "passed", spans[1].Attributes["infinity.stage.status"])
+	})
+
+	t.Run("PassesSecretsUsedByStageAsSecretEnv", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		manifest := Manifest{
+			Metadata: ManifestMetadata{
+				ApplicationType: ApplicationTypeAPI,
+				Language:        LanguageGo,
+				Name:            "test-app",
+			},
+			Secrets: []*ManifestSecret{
+				{
+					Name: "registry-password",
+					Env:  "REGISTRY_PASSWORD",
+				},
+				{
+					Name: "unused",
+					Env:  "UNUSED",
+				},
+			},
+			Targets: []*ManifestTarget{
+				{
+					Name: "build/local",
+					Stages: []*ManifestStage{
+						{
+							Name:     "stage-1",
+							Image:    "alpine:3.13",
+							Commands: []string{"sleep 1"},
+							Secrets: []*ManifestStageSecret{
+								{
+									Name: "registry-password",
+									Env:  "DOCKER_PASSWORD",
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+		manifest.SetDefault()
+
+		manifestReader := NewMockManifestReader(ctrl)
+		dockerRunner := NewMockDockerRunner(ctrl)
+		hostRunner := NewMockHostRunner(ctrl)
+		gitReader := NewMockGitReader(ctrl)
+		gitReader.EXPECT().GetInfo(gomock.Any()).AnyTimes()
+		secretProvider := NewMockSecretProvider(ctrl)
+
+		manifestReader.EXPECT().GetManifest(gomock.Any(), gomock.Eq(".infinity.yaml")).Return(manifest, nil)
+		secretProvider.EXPECT().GetSecret(gomock.Any(), gomock.Eq(*manifest.Secrets[0])).Return("s3cr3t", nil).Times(1)
+		dockerRunner.EXPECT().NeedsNetwork(gomock.Eq(manifest.Targets[0].Stages)).Return(false).Times(1)
+		dockerRunner.EXPECT().ContainerImageIsPulled(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+		dockerRunner.EXPECT().ContainerPull(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+		dockerRunner.EXPECT().ContainerStart(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Eq(map[string]string{"DOCKER_PASSWORD": "s3cr3t"}), gomock.Any(), gomock.Eq(false)).Times(1)
+
+		secretMasker := NewSecretMasker()
+		runner := NewRunner(manifestReader, dockerRunner, hostRunner, secretProvider, secretMasker, NewEnvFileReader(""), gitReader, nil, nil, 0, map[string]string{}, "", ".infinity.yaml")
+
+		// act
+		_, err := runner.Run(context.Background(), "build/local")
+
+		assert.Nil(t, err)
+		assert.Equal(t, "password=***", secretMasker.Mask("password=s3cr3t"))
+	})
+
+	t.Run("MergesEnvFilesAndEnvWithCommandLineEnvTakingPrecedence", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		dir := writeEnvFile(t, ".env", "GLOBAL_FILE=file\nGLOBAL=file\nSTAGE=file\nOVERRIDE=file\n")
+		defer os.RemoveAll(dir)
+
+		manifest := Manifest{
+			Metadata: ManifestMetadata{
+				ApplicationType: ApplicationTypeAPI,
+				Language:        LanguageGo,
+				Name:            "test-app",
+			},
+			Env: map[string]string{
+				"GLOBAL": "env",
+			},
+			EnvFile: []string{".env", ".env.missing"},
+			Targets: []*ManifestTarget{
+				{
+					Name: "build/local",
+					Stages: []*ManifestStage{
+						{
+							Name:     "stage-1",
+							Image:    "alpine:3.13",
+							Commands: []string{"sleep 1"},
+							Env: map[string]string{
+								"STAGE": "env",
+							},
+						},
+					},
+				},
+			},
+		}
+		manifest.SetDefault()
+
+		manifestReader := NewMockManifestReader(ctrl)
+		dockerRunner := NewMockDockerRunner(ctrl)
+		hostRunner := NewMockHostRunner(ctrl)
+		gitReader := NewMockGitReader(ctrl)
+		gitReader.EXPECT().GetInfo(gomock.Any()).AnyTimes()
+
+		manifestReader.EXPECT().GetManifest(gomock.Any(), gomock.Any()).Return(manifest, nil)
+		dockerRunner.EXPECT().NeedsNetwork(gomock.Eq(manifest.Targets[0].Stages)).Return(false).Times(1)
+		dockerRunner.EXPECT().ContainerImageIsPulled(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+		dockerRunner.EXPECT().ContainerPull(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+		dockerRunner.EXPECT().ContainerStart(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Eq(map[string]string{
+			"INFINITY_METADATA_NAME":      "test-app",
+			"INFINITY_METADATA_TYPE":      "api",
+			"INFINITY_METADATA_LANGUAGE":  "go",
+			"INFINITY_GIT_REVISION":       "",
+			"INFINITY_GIT_SHORT_REVISION": "",
+			"INFINITY_GIT_BRANCH":         "",
+			"INFINITY_GIT_TAG":            "",
+			"INFINITY_GIT_DIRTY":          "false",
+			"INFINITY_GIT_REPO":           "",
+			"GLOBAL_FILE":                 "file",
+			"GLOBAL":                      "env",
+			"STAGE":                       "env",
+			"OVERRIDE":                    "cli",
+		}), gomock.Any(), gomock.Any(), gomock.Eq(false)).Times(1)
+
+		runner := NewRunner(manifestReader, dockerRunner, hostRunner, NewMockSecretProvider(ctrl), NewSecretMasker(), NewEnvFileReader(dir), gitReader, nil, nil, 0, map[string]string{"OVERRIDE": "cli"}, dir, ".infinity.yaml")
+
+		// act
+		_, err := runner.Run(context.Background(), "build/local")
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("PassesGitMetadataAsEnvironmentVariables", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		manifest := Manifest{
+			Metadata: ManifestMetadata{
+				ApplicationType: ApplicationTypeAPI,
+				Language:        LanguageGo,
+				Name:            "test-app",
+			},
+			Targets: []*ManifestTarget{
+				{
+					Name: "build/local",
+					Stages: []*ManifestStage{
+						{
+							Name:     "stage-1",
+							Image:    "alpine:3.13",
+							Commands: []string{"sleep 1"},
+						},
+					},
+				},
+			},
+		}
+		manifest.SetDefault()
+
+		manifestReader := NewMockManifestReader(ctrl)
+		dockerRunner := NewMockDockerRunner(ctrl)
+		hostRunner := NewMockHostRunner(ctrl)
+		gitReader := NewMockGitReader(ctrl)
+
+		manifestReader.EXPECT().GetManifest(gomock.Any(), gomock.Any()).Return(manifest, nil)
+		gitReader.EXPECT().GetInfo(gomock.Any()).Return(GitInfo{
+			Revision:      "0a4edf2b1c3d4e5f60718293a4b5c6d7e8f90123",
+			ShortRevision: "0a4edf2",
+			Branch:        "main",
+			Tag:           "v1.0.0",
+			Dirty:         true,
+			Repo:          "https://github.com/JorritSalverda/infinity.git",
+		}, nil).Times(1)
+		dockerRunner.EXPECT().NeedsNetwork(gomock.Eq(manifest.Targets[0].Stages)).Return(false).Times(1)
+		dockerRunner.EXPECT().ContainerImageIsPulled(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+		dockerRunner.EXPECT().ContainerPull(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+		dockerRunner.EXPECT().ContainerStart(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Eq(map[string]string{
+			"INFINITY_METADATA_NAME":      "test-app",
+			"INFINITY_METADATA_TYPE":      "api",
+			"INFINITY_METADATA_LANGUAGE":  "go",
+			"INFINITY_GIT_REVISION":       "0a4edf2b1c3d4e5f60718293a4b5c6d7e8f90123",
+			"INFINITY_GIT_SHORT_REVISION": "0a4edf2",
+			"INFINITY_GIT_BRANCH":         "main",
+			"INFINITY_GIT_TAG":            "v1.0.0",
+			"INFINITY_GIT_DIRTY":          "true",
+			"INFINITY_GIT_REPO":           "https://github.com/JorritSalverda/infinity.git",
+		}), gomock.Any(), gomock.Any(), gomock.Eq(false)).Times(1)
+
+		runner := NewRunner(manifestReader, dockerRunner, hostRunner, NewMockSecretProvider(ctrl), NewSecretMasker(), NewEnvFileReader(""), gitReader, nil, nil, 0, map[string]string{}, "", ".infinity.yaml")
+
+		// act
+		_, err := runner.Run(context.Background(), "build/local")
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("PassesCalculatedVersionAsEnvironmentVariable", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		manifest := Manifest{
+			Metadata: ManifestMetadata{
+				ApplicationType: ApplicationTypeAPI,
+				Language:        LanguageGo,
+				Name:            "test-app",
+				Version: &ManifestVersion{
+					Major: 1,
+					Minor: 2,
+				},
+			},
+			Targets: []*ManifestTarget{
+				{
+					Name: "build/local",
+					Stages: []*ManifestStage{
+						{
+							Name:     "stage-1",
+							Image:    "alpine:3.13",
+							Commands: []string{"sleep 1"},
+						},
+					},
+				},
+			},
+		}
+		manifest.SetDefault()
+
+		manifestReader := NewMockManifestReader(ctrl)
+		dockerRunner := NewMockDockerRunner(ctrl)
+		hostRunner := NewMockHostRunner(ctrl)
+		gitReader := NewMockGitReader(ctrl)
+
+		manifestReader.EXPECT().GetManifest(gomock.Any(), gomock.Any()).Return(manifest, nil)
+		gitReader.EXPECT().GetInfo(gomock.Any()).Return(GitInfo{Branch: "feature", ShortRevision: "0a4edf2"}, nil).Times(1)
+		gitReader.EXPECT().GetCommitCount(gomock.Any()).Return(42, nil).Times(1)
+		dockerRunner.EXPECT().NeedsNetwork(gomock.Eq(manifest.Targets[0].Stages)).Return(false).Times(1)
+		dockerRunner.EXPECT().ContainerImageIsPulled(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+		dockerRunner.EXPECT().ContainerPull(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+		dockerRunner.EXPECT().ContainerStart(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Eq(false)).Do(func(ctx context.Context, logger *log.Logger, stage ManifestStage, env, secretEnv, secretFiles map[string]string, needsNetwork bool) {
+			assert.Equal(t, "1.2.42-feature", env["INFINITY_VERSION"])
+		}).Times(1)
+
+		runner := NewRunner(manifestReader, dockerRunner, hostRunner, NewMockSecretProvider(ctrl), NewSecretMasker(), NewEnvFileReader(""), gitReader, nil, nil, 0, map[string]string{}, "", ".infinity.yaml")
+
+		// act
+		_, err := runner.Run(context.Background(), "build/local")
+
+		assert.Nil(t, err)
+	})
+}
+
+func TestShell(t *testing.T) {
+	t.Run("StartsBackgroundStagesAndShellForStage", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		manifest := Manifest{
+			Metadata: ManifestMetadata{
+				ApplicationType: ApplicationTypeAPI,
+				Language:        LanguageGo,
+				Name:            "test-app",
+			},
+			Targets: []*ManifestTarget{
+				{
+					Name: "build/local",
+					Stages: []*ManifestStage{
+						{
+							Name:       "database",
+							Image:      "cockroachdb/cockroach:v21.1.5",
+							Background: true,
+						},
+						{
+							Name: "parallel",
+							Stages: []*ManifestStage{
+								{
+									Name:     "integration-test",
+									Image:    "golang:1.17",
+									Commands: []string{"go test ./..."},
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+		manifest.SetDefault()
+
+		manifestReader := NewMockManifestReader(ctrl)
+		dockerRunner := NewMockDockerRunner(ctrl)
+		hostRunner := NewMockHostRunner(ctrl)
+		gitReader := NewMockGitReader(ctrl)
+		gitReader.EXPECT().GetInfo(gomock.Any()).AnyTimes()
+
+		manifestReader.EXPECT().GetManifest(gomock.Any(), gomock.Eq(".infinity.yaml")).Return(manifest, nil)
+		dockerRunner.EXPECT().NeedsNetwork(gomock.Any()).Return(true).Times(1)
+		dockerRunner.EXPECT().NetworkCreate(gomock.Any(), gomock.Any()).Times(1)
+		dockerRunner.EXPECT().ContainerImageIsPulled(gomock.Any(), gomock.Any(), gomock.Any()).Return(true, nil).Times(2)
+		gomock.InOrder(
+			dockerRunner.EXPECT().ContainerStart(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Eq(true)).Do(func(ctx context.Context, logger *log.Logger, stage ManifestStage, env map[string]string, secretEnv map[string]string, secretFiles map[string]string, needsNetwork bool) {
+				assert.Equal(t, "database", stage.Name)
+			}).Times(1),
+			dockerRunner.EXPECT().ContainerShell(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Eq(true)).Do(func(ctx context.Context, logger *log.Logger, stage ManifestStage, env map[string]string, secretEnv map[string]string, secretFiles map[string]string, needsNetwork bool) {
+				assert.Equal(t, "integration-test", stage.Name)
+			}).Times(1),
+			dockerRunner.EXPECT().StopRunningContainers(gomock.Any(), gomock.Any()).Times(1),
+			dockerRunner.EXPECT().NetworkRemove(gomock.Any(), gomock.Any()).Times(1),
+		)
+
+		runner := NewRunner(manifestReader, dockerRunner, hostRunner, NewMockSecretProvider(ctrl), NewSecretMasker(), NewEnvFileReader(""), gitReader, nil, nil, 0, map[string]string{}, "", ".infinity.yaml")
+
+		// act
+		err := runner.Shell(context.Background(), "build/local", "parallel/integration-test")
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("ReturnsErrorForStageWithHostRunner", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		manifest := Manifest{
+			Metadata: ManifestMetadata{
+				ApplicationType: ApplicationTypeAPI,
+				Language:        LanguageGo,
+				Name:            "test-app",
+			},
+			Targets: []*ManifestTarget{
+				{
+					Name: "build/local",
+					Stages: []*ManifestStage{
+						{
+							Name:       "stage-1",
+							RunnerType: RunnerTypeHost,
+							Commands:   []string{"sleep 1"},
+						},
+					},
+				},
+			},
+		}
+		manifest.SetDefault()
+
+		manifestReader := NewMockManifestReader(ctrl)
+		manifestReader.EXPECT().GetManifest(gomock.Any(), gomock.Eq(".infinity.yaml")).Return(manifest, nil)
+
+		runner := NewRunner(manifestReader, NewMockDockerRunner(ctrl), NewMockHostRunner(ctrl), NewMockSecretProvider(ctrl), NewSecretMasker(), NewEnvFileReader(""), NewMockGitReader(ctrl), nil, nil, 0, map[string]string{}, "", ".infinity.yaml")
+
+		// act
+		err := runner.Shell(context.Background(), "build/local", "stage-1")
+
+		assert.NotNil(t, err)
+		assert.Equal(t, "Stage stage-1 uses the host runner; only stages with the container runner have a shell", err.Error())
+	})
+
+	t.Run("ReturnsErrorForUndefinedStage", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		manifest := Manifest{
+			Metadata: ManifestMetadata{
+				ApplicationType: ApplicationTypeAPI,
+				Language:        LanguageGo,
+				Name:            "test-app",
+			},
+			Targets: []*ManifestTarget{
+				{
+					Name: "build/local",
+					Stages: []*ManifestStage{
+						{
+							Name:     "stage-1",
+							Image:    "golang:1.17",
+							Commands: []string{"go build ."},
+						},
+					},
+				},
+			},
+		}
+		manifest.SetDefault()
+
+		manifestReader := NewMockManifestReader(ctrl)
+		manifestReader.EXPECT().GetManifest(gomock.Any(), gomock.Eq(".infinity.yaml")).Return(manifest, nil)
+
+		runner := NewRunner(manifestReader, NewMockDockerRunner(ctrl), NewMockHostRunner(ctrl), NewMockSecretProvider(ctrl), NewSecretMasker(), NewEnvFileReader(""), NewMockGitReader(ctrl), nil, nil, 0, map[string]string{}, "", ".infinity.yaml")
+
+		// act
+		err := runner.Shell(context.Background(), "build/local", "stage-2")
+
+		assert.NotNil(t, err)
+		assert.Equal(t, "Stage stage-2 is not defined in target build/local", err.Error())
+	})
+}
+
+func TestWatch(t *testing.T) {
+	t.Run("RerunsTargetOnChangesAndKeepsBackgroundStagesRunning", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		manifest := Manifest{
+			Metadata: ManifestMetadata{
+				ApplicationType: ApplicationTypeAPI,
+				Language:        LanguageGo,
+				Name:            "test-app",
+			},
+			Targets: []*ManifestTarget{
+				{
+					Name: "build/local",
+					Stages: []*ManifestStage{
+						{
+							Name:       "database",
+							Image:      "cockroachdb/cockroach:v21.1.5",
+							Background: true,
+						},
+						{
+							Name:     "test",
+							Image:    "golang:1.17",
+							Commands: []string{"go test ./..."},
+						},
+					},
+				},
+			},
+		}
+		manifest.SetDefault()
+
+		manifestReader := NewMockManifestReader(ctrl)
+		dockerRunner := NewMockDockerRunner(ctrl)
+		hostRunner := NewMockHostRunner(ctrl)
+		gitReader := NewMockGitReader(ctrl)
+		gitReader.EXPECT().GetInfo(gomock.Any()).AnyTimes()
+
+		manifestReader.EXPECT().GetManifest(gomock.Any(), gomock.Eq(".infinity.yaml")).Return(manifest, nil).Times(2)
+		dockerRunner.EXPECT().NeedsNetwork(gomock.Any()).Return(true).Times(2)
+		dockerRunner.EXPECT().NetworkCreate(gomock.Any(), gomock.Any()).Times(1)
+		dockerRunner.EXPECT().ContainerImageIsPulled(gomock.Any(), gomock.Any(), gomock.Any()).Return(true, nil).AnyTimes()
+		startedStages := []string{}
+		dockerRunner.EXPECT().ContainerStart(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Eq(true)).Do(func(ctx context.Context, logger *log.Logger, stage ManifestStage, env map[string]string, secretEnv map[string]string, secretFiles map[string]string, needsNetwork bool) {
+			startedStages = append(startedStages, stage.Name)
+		}).Times(3)
+		dockerRunner.EXPECT().ContainerIsRunning(gomock.Any(), gomock.Any(), gomock.Any()).Return(true, nil).Times(1)
+		dockerRunner.EXPECT().StopRunningContainers(gomock.Any(), gomock.Any()).Times(1)
+		dockerRunner.EXPECT().NetworkRemove(gomock.Any(), gomock.Any()).Times(1)
+
+		runner := NewRunner(manifestReader, dockerRunner, hostRunner, NewMockSecretProvider(ctrl), NewSecretMasker(), NewEnvFileReader(""), gitReader, nil, nil, 0, map[string]string{}, "", ".infinity.yaml")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		changes := make(chan []string, 1)
+		reports := []*RunReport{}
+
+		// act
+		err := runner.Watch(ctx, "build/local", changes, func(ctx context.Context, report *RunReport, err error) error {
+			reports = append(reports, report)
+			if len(reports) == 1 {
+				changes <- []string{"main.go"}
+			} else {
+				cancel()
+			}
+			return err
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(reports))
+		assert.Equal(t, []string{"database", "test", "test"}, startedStages)
+		assert.Equal(t, StageStatusPassed, reports[1].Status)
+		assert.Equal(t, StageStatusPassed, reports[1].Stages[0].Status)
+	})
+
+	t.Run("StopsKeptBackgroundStageRemovedFromManifest", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		getManifest := func(stages ...*ManifestStage) Manifest {
+			manifest := Manifest{
+				Metadata: ManifestMetadata{
+					ApplicationType: ApplicationTypeAPI,
+					Language:        LanguageGo,
+					Name:            "test-app",
+				},
+				Targets: []*ManifestTarget{
+					{
+						Name:   "build/local",
+						Stages: stages,
+					},
+				},
+			}
+			manifest.SetDefault()
+
+			return manifest
+		}
+		manifest := getManifest(
+			&ManifestStage{Name: "database", Image: "cockroachdb/cockroach:v21.1.5", Background: true},
+			&ManifestStage{Name: "test", Image: "golang:1.17", Commands: []string{"go test ./..."}},
+		)
+		changedManifest := getManifest(
+			&ManifestStage{Name: "test", Image: "golang:1.17", Commands: []string{"go test ./..."}},
+		)
+
+		manifestReader := NewMockManifestReader(ctrl)
+		dockerRunner := NewMockDockerRunner(ctrl)
+		gitReader := NewMockGitReader(ctrl)
+		gitReader.EXPECT().GetInfo(gomock.Any()).AnyTimes()
+
+		gomock.InOrder(
+			manifestReader.EXPECT().GetManifest(gomock.Any(), gomock.Eq(".infinity.yaml")).Return(manifest, nil).Times(1),
+			manifestReader.EXPECT().GetManifest(gomock.Any(), gomock.Eq(".infinity.yaml")).Return(changedManifest, nil).Times(1),
+		)
+		gomock.InOrder(
+			dockerRunner.EXPECT().NeedsNetwork(gomock.Any()).Return(true).Times(1),
+			dockerRunner.EXPECT().NeedsNetwork(gomock.Any()).Return(false).Times(1),
+		)
+		dockerRunner.EXPECT().NetworkCreate(gomock.Any(), gomock.Any()).Times(1)
+		dockerRunner.EXPECT().ContainerImageIsPulled(gomock.Any(), gomock.Any(), gomock.Any()).Return(true, nil).AnyTimes()
+		startedStages := []string{}
+		dockerRunner.EXPECT().ContainerStart(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Do(func(ctx context.Context, logger *log.Logger, stage ManifestStage, env map[string]string, secretEnv map[string]string, secretFiles map[string]string, needsNetwork bool) {
+			startedStages = append(startedStages, stage.Name)
+		}).Times(3)
+		stoppedAfterStages := [][]string{}
+		dockerRunner.EXPECT().StopRunningContainers(gomock.Any(), gomock.Any()).Do(func(ctx context.Context, logOutput io.Writer) {
+			stoppedAfterStages = append(stoppedAfterStages, append([]string{}, startedStages...))
+		}).Times(2)
+		dockerRunner.EXPECT().NetworkRemove(gomock.Any(), gomock.Any()).Times(1)
+
+		runner := NewRunner(manifestReader, dockerRunner, NewMockHostRunner(ctrl), NewMockSecretProvider(ctrl), NewSecretMasker(), NewEnvFileReader(""), gitReader, nil, nil, 0, map[string]string{}, "", ".infinity.yaml")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		changes := make(chan []string, 1)
+		reports := []*RunReport{}
+
+		// act
+		err := runner.Watch(ctx, "build/local", changes, func(ctx context.Context, report *RunReport, err error) error {
+			reports = append(reports, report)
+			if len(reports) == 1 {
+				changes <- []string{".infinity.yaml"}
+			} else {
+				cancel()
+			}
+			return err
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(reports))
+		assert.Equal(t, []string{"database", "test", "test"}, startedStages)
+		assert.Equal(t, []string{"database", "test"}, stoppedAfterStages[0])
+	})
+
+	t.Run("RestartsKeptBackgroundStageThatStoppedRunning", func(t *testing.T) {
+
+		ctrl := gomock.NewController(t)
+
+		manifest := Manifest{
+			Metadata: ManifestMetadata{
+				ApplicationType: ApplicationTypeAPI,
+				Language:        LanguageGo,
+				Name:            "test-app",
+			},
+			Targets: []*ManifestTarget{
+				{
+					Name: "build/local",
+					Stages: []*ManifestStage{
+						{
+							Name:       "database",
+							Image:      "cockroachdb/cockroach:v21.1.5",
+							Background: true,
+						},
+						{
+							Name:     "test",
+							Image:    "golang:1.17",
+							Commands: []string{"go test ./..."},
+						},
+					},
+				},
+			},
+		}
+		manifest.SetDefault()
+
+		manifestReader := NewMockManifestReader(ctrl)
+		dockerRunner := NewMockDockerRunner(ctrl)
+		gitReader := NewMockGitReader(ctrl)
+		gitReader.EXPECT().GetInfo(gomock.Any()).AnyTimes()
+
+		manifestReader.EXPECT().GetManifest(gomock.Any(), gomock.Eq(".infinity.yaml")).Return(manifest, nil).Times(2)
+		dockerRunner.EXPECT().NeedsNetwork(gomock.Any()).Return(true).Times(2)
+		dockerRunner.EXPECT().NetworkCreate(gomock.Any(), gomock.Any()).Times(2)
+		dockerRunner.EXPECT().ContainerImageIsPulled(gomock.Any(), gomock.Any(), gomock.Any()).Return(true, nil).AnyTimes()
+		startedStages := []string{}
+		dockerRunner.EXPECT().ContainerStart(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Eq(true)).Do(func(ctx context.Context, logger *log.Logger, stage ManifestStage, env map[string]string, secretEnv map[string]string, secretFiles map[string]string, needsNetwork bool) {
+			startedStages = append(startedStages, stage.Name)
+		}).Times(4)
+		dockerRunner.EXPECT().ContainerIsRunning(gomock.Any(), gomock.Any(), gomock.Any()).Return(false, nil).Times(1)
+		dockerRunner.EXPECT().StopRunningContainers(gomock.Any(), gomock.Any()).Return(&StageExitError{Stage: "database", ExitCode: 137}).Times(1)
+		dockerRunner.EXPECT().StopRunningContainers(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		dockerRunner.EXPECT().NetworkRemove(gomock.Any(), gomock.Any()).Times(2)
+
+		runner := NewRunner(manifestReader, dockerRunner, NewMockHostRunner(ctrl), NewMockSecretProvider(ctrl), NewSecretMasker(), NewEnvFileReader(""), gitReader, nil, nil, 0, map[string]string{}, "", ".infinity.yaml")
 
-		runner := NewRunner(manifestReader, dockerRunner, hostRunner, false, "", ".infinity.yaml")
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		changes := make(chan []string, 1)
+		reports := []*RunReport{}
 
 		// act
-		err := runner.Run(context.Background(), "build/local")
+		err := runner.Watch(ctx, "build/local", changes, func(ctx context.Context, report *RunReport, err error) error {
+			reports = append(reports, report)
+			if len(reports) == 1 {
+				changes <- []string{"main.go"}
+			} else {
+				cancel()
+			}
+			return err
+		})
 
 		assert.Nil(t, err)
+		assert.Equal(t, 2, len(reports))
+		assert.Equal(t, []string{"database", "test", "database", "test"}, startedStages)
+		assert.Equal(t, StageStatusPassed, reports[1].Status)
 	})
 }
 
@@ -358,11 +1811,11 @@ func TestCancellation(t *testing.T) {
 		ctrl := gomock.NewController(t)
 		manifestReader := NewMockManifestReader(ctrl)
 		manifestReader.EXPECT().GetManifest(gomock.Any(), gomock.Eq(".infinity.yaml")).Return(manifest, nil)
-		runner := NewRunner(manifestReader, NewDockerRunner(NewCommandRunner(false), NewRandomStringGenerator(), ""), NewHostRunner(NewCommandRunner(false), ""), false, "", ".infinity.yaml")
+		runner := NewRunner(manifestReader, NewDockerRunner(NewCommandRunner(NewSecretMasker(), false), NewRandomStringGenerator(), "", false, nil, false), NewHostRunner(NewCommandRunner(NewSecretMasker(), false), ""), NewSecretProvider("", ""), NewSecretMasker(), NewEnvFileReader(""), NewGitReader(""), nil, nil, 0, map[string]string{}, "", ".infinity.yaml")
 
 		// act
 		start := time.Now()
-		err := runner.Run(ctx, "build/local")
+		_, err := runner.Run(ctx, "build/local")
 		elapsed := time.Since(start)
 
 		assert.NotNil(t, err)
@@ -412,11 +1865,11 @@ func TestCancellation(t *testing.T) {
 		ctrl := gomock.NewController(t)
 		manifestReader := NewMockManifestReader(ctrl)
 		manifestReader.EXPECT().GetManifest(gomock.Any(), gomock.Eq(".infinity.yaml")).Return(manifest, nil)
-		runner := NewRunner(manifestReader, NewDockerRunner(NewCommandRunner(false), NewRandomStringGenerator(), ""), NewHostRunner(NewCommandRunner(false), ""), false, "", ".infinity.yaml")
+		runner := NewRunner(manifestReader, NewDockerRunner(NewCommandRunner(NewSecretMasker(), false), NewRandomStringGenerator(), "", false, nil, false), NewHostRunner(NewCommandRunner(NewSecretMasker(), false), ""), NewSecretProvider("", ""), NewSecretMasker(), NewEnvFileReader(""), NewGitReader(""), nil, nil, 0, map[string]string{}, "", ".infinity.yaml")
 
 		// act
 		start := time.Now()
-		err := runner.Run(ctx, "build/local")
+		_, err := runner.Run(ctx, "build/local")
 		elapsed := time.Since(start)
 
 		assert.NotNil(t, err)
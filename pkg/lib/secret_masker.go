@@ -0,0 +1,56 @@
+package lib
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+const maskedSecret = "***"
+
+//go:generate mockgen -package=lib -destination ./secret_masker_mock.go -source=secret_masker.go
+type SecretMasker interface {
+	AddSecret(value string)
+	Mask(text string) string
+}
+
+type secretMasker struct {
+	values []string
+	mutex  *sync.RWMutex
+}
+
+func NewSecretMasker() SecretMasker {
+	return &secretMasker{
+		mutex: &sync.RWMutex{},
+	}
+}
+
+func (m *secretMasker) AddSecret(value string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	// logs are masked per line, so mask each line of a multiline secret separately as well
+	for _, v := range append([]string{value}, strings.Split(value, "\n")...) {
+		v = strings.TrimSpace(v)
+		if v == "" || stringArrayContains(m.values, v) {
+			continue
+		}
+		m.values = append(m.values, v)
+	}
+
+	// replace longest values first so a secret containing another secret gets masked as a whole
+	sort.SliceStable(m.values, func(i, j int) bool {
+		return len(m.values[i]) > len(m.values[j])
+	})
+}
+
+func (m *secretMasker) Mask(text string) string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	for _, v := range m.values {
+		text = strings.Replace(text, v, maskedSecret, -1)
+	}
+
+	return text
+}
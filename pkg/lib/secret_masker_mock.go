@@ -0,0 +1,60 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: secret_masker.go
+
+// Package lib is a generated GoMock package.
+package lib
+
+import (
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockSecretMasker is a mock of SecretMasker interface.
+type MockSecretMasker struct {
+	ctrl     *gomock.Controller
+	recorder *MockSecretMaskerMockRecorder
+}
+
+// MockSecretMaskerMockRecorder is the mock recorder for MockSecretMasker.
+type MockSecretMaskerMockRecorder struct {
+	mock *MockSecretMasker
+}
+
+// NewMockSecretMasker creates a new mock instance.
+func NewMockSecretMasker(ctrl *gomock.Controller) *MockSecretMasker {
+	mock := &MockSecretMasker{ctrl: ctrl}
+	mock.recorder = &MockSecretMaskerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockSecretMasker) EXPECT() *MockSecretMaskerMockRecorder {
+	return m.recorder
+}
+
+// AddSecret mocks base method.
+func (m *MockSecretMasker) AddSecret(value string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "AddSecret", value)
+}
+
+// AddSecret indicates an expected call of AddSecret.
+func (mr *MockSecretMaskerMockRecorder) AddSecret(value interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddSecret", reflect.TypeOf((*MockSecretMasker)(nil).AddSecret), value)
+}
+
+// Mask mocks base method.
+func (m *MockSecretMasker) Mask(text string) string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Mask", text)
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// Mask indicates an expected call of Mask.
+func (mr *MockSecretMaskerMockRecorder) Mask(text interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Mask", reflect.TypeOf((*MockSecretMasker)(nil).Mask), text)
+}
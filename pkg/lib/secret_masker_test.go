@@ -0,0 +1,64 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestMask(t *testing.T) {
+	t.Run("ReturnsTextUnchangedIfNoSecretsAreAdded", func(t *testing.T) {
+
+		secretMasker := NewSecretMasker()
+
+		// act
+		masked := secretMasker.Mask("docker login --password=abc")
+
+		assert.Equal(t, "docker login --password=abc", masked)
+	})
+
+	t.Run("ReplacesAllOccurrencesOfSecretValues", func(t *testing.T) {
+
+		secretMasker := NewSecretMasker()
+		secretMasker.AddSecret("abc")
+
+		// act
+		masked := secretMasker.Mask("--env=PASSWORD=abc --env=TOKEN=abc")
+
+		assert.Equal(t, "--env=PASSWORD=*** --env=TOKEN=***", masked)
+	})
+
+	t.Run("ReplacesEachLineOfMultilineSecretValues", func(t *testing.T) {
+
+		secretMasker := NewSecretMasker()
+		secretMasker.AddSecret("line-one\nline-two\n")
+
+		// act
+		masked := secretMasker.Mask("> cat key: line-two")
+
+		assert.Equal(t, "> cat key: ***", masked)
+	})
+
+	t.Run("ReplacesLongestSecretValueFirst", func(t *testing.T) {
+
+		secretMasker := NewSecretMasker()
+		secretMasker.AddSecret("abc")
+		secretMasker.AddSecret("abcdef")
+
+		// act
+		masked := secretMasker.Mask("token abcdef")
+
+		assert.Equal(t, "token ***", masked)
+	})
+
+	t.Run("IgnoresEmptySecretValues", func(t *testing.T) {
+
+		secretMasker := NewSecretMasker()
+		secretMasker.AddSecret("")
+
+		// act
+		masked := secretMasker.Mask("some text")
+
+		assert.Equal(t, "some text", masked)
+	})
+}
@@ -0,0 +1,155 @@
+package lib
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//go:generate mockgen -package=lib -destination ./secret_provider_mock.go -source=secret_provider.go
+type SecretProvider interface {
+	GetSecret(ctx context.Context, secret ManifestSecret) (value string, err error)
+	Encrypt(ctx context.Context, plaintext []byte) (ciphertext []byte, err error)
+	GenerateKey(ctx context.Context) (key string, err error)
+}
+
+// SecretKeyEnvvar is the envvar the secret key is read from if it isn't passed with --secret-key
+const SecretKeyEnvvar = "INFINITY_SECRET_KEY"
+
+type secretProvider struct {
+	buildDirectory string
+	secretKey      string
+}
+
+// NewSecretProvider returns a provider that reads secrets from envvars, files or files encrypted with AES-256-GCM; the secret key is the base64 encoded 32 byte key used to decrypt them, read from envvar INFINITY_SECRET_KEY if it's empty
+func NewSecretProvider(buildDirectory, secretKey string) SecretProvider {
+	// the key is read here instead of being the flag default, so it doesn't show up in the help output
+	if secretKey == "" {
+		secretKey = os.Getenv(SecretKeyEnvvar)
+	}
+
+	return &secretProvider{
+		buildDirectory: buildDirectory,
+		secretKey:      secretKey,
+	}
+}
+
+func (p *secretProvider) GetSecret(ctx context.Context, secret ManifestSecret) (value string, err error) {
+	switch {
+	case secret.Env != "":
+		value, ok := os.LookupEnv(secret.Env)
+		if !ok {
+			return "", fmt.Errorf("secret %v can't be read from envvar %v, because it is not set", secret.Name, secret.Env)
+		}
+		return value, nil
+
+	case secret.File != "":
+		valueBytes, err := ioutil.ReadFile(p.getPath(secret.File))
+		if err != nil {
+			return "", fmt.Errorf("secret %v can't be read from file %v: %w", secret.Name, secret.File, err)
+		}
+		return strings.TrimSuffix(string(valueBytes), "\n"), nil
+
+	case secret.EncryptedFile != "":
+		ciphertext, err := ioutil.ReadFile(p.getPath(secret.EncryptedFile))
+		if err != nil {
+			return "", fmt.Errorf("secret %v can't be read from file %v: %w", secret.Name, secret.EncryptedFile, err)
+		}
+		plaintext, err := p.decrypt(ciphertext)
+		if err != nil {
+			return "", fmt.Errorf("secret %v can't be decrypted from file %v: %w", secret.Name, secret.EncryptedFile, err)
+		}
+		return strings.TrimSuffix(string(plaintext), "\n"), nil
+	}
+
+	return "", fmt.Errorf("secret %v has no source", secret.Name)
+}
+
+func (p *secretProvider) Encrypt(ctx context.Context, plaintext []byte) (ciphertext []byte, err error) {
+	aead, err := p.getAEAD()
+	if err != nil {
+		return
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return
+	}
+
+	sealed := aead.Seal(nonce, nonce, plaintext, nil)
+
+	// store base64 encoded so the encrypted file can be committed as text
+	ciphertext = make([]byte, base64.StdEncoding.EncodedLen(len(sealed)))
+	base64.StdEncoding.Encode(ciphertext, sealed)
+	ciphertext = append(ciphertext, '\n')
+
+	return ciphertext, nil
+}
+
+func (p *secretProvider) GenerateKey(ctx context.Context) (key string, err error) {
+	keyBytes := make([]byte, 32)
+	if _, err = io.ReadFull(rand.Reader, keyBytes); err != nil {
+		return
+	}
+
+	return base64.StdEncoding.EncodeToString(keyBytes), nil
+}
+
+func (p *secretProvider) decrypt(ciphertext []byte) (plaintext []byte, err error) {
+	aead, err := p.getAEAD()
+	if err != nil {
+		return
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(ciphertext)))
+	if err != nil {
+		return
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("encrypted value is too short")
+	}
+
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+}
+
+func (p *secretProvider) getAEAD() (aead cipher.AEAD, err error) {
+	if p.secretKey == "" {
+		return nil, fmt.Errorf("no secret key is set; please pass it with --secret-key or envvar %v", SecretKeyEnvvar)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(p.secretKey)
+	if err != nil {
+		return nil, fmt.Errorf("secret key is not base64 encoded: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("secret key has %v bytes instead of 32; generate one with 'infinity secret key'", len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func (p *secretProvider) getPath(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[2:])
+		}
+	}
+	if filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(p.buildDirectory, path)
+}
@@ -0,0 +1,80 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: secret_provider.go
+
+// Package lib is a generated GoMock package.
+package lib
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockSecretProvider is a mock of SecretProvider interface.
+type MockSecretProvider struct {
+	ctrl     *gomock.Controller
+	recorder *MockSecretProviderMockRecorder
+}
+
+// MockSecretProviderMockRecorder is the mock recorder for MockSecretProvider.
+type MockSecretProviderMockRecorder struct {
+	mock *MockSecretProvider
+}
+
+// NewMockSecretProvider creates a new mock instance.
+func NewMockSecretProvider(ctrl *gomock.Controller) *MockSecretProvider {
+	mock := &MockSecretProvider{ctrl: ctrl}
+	mock.recorder = &MockSecretProviderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockSecretProvider) EXPECT() *MockSecretProviderMockRecorder {
+	return m.recorder
+}
+
+// Encrypt mocks base method.
+func (m *MockSecretProvider) Encrypt(ctx context.Context, plaintext []byte) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Encrypt", ctx, plaintext)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Encrypt indicates an expected call of Encrypt.
+func (mr *MockSecretProviderMockRecorder) Encrypt(ctx, plaintext interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Encrypt", reflect.TypeOf((*MockSecretProvider)(nil).Encrypt), ctx, plaintext)
+}
+
+// GenerateKey mocks base method.
+func (m *MockSecretProvider) GenerateKey(ctx context.Context) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GenerateKey", ctx)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GenerateKey indicates an expected call of GenerateKey.
+func (mr *MockSecretProviderMockRecorder) GenerateKey(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GenerateKey", reflect.TypeOf((*MockSecretProvider)(nil).GenerateKey), ctx)
+}
+
+// GetSecret mocks base method.
+func (m *MockSecretProvider) GetSecret(ctx context.Context, secret ManifestSecret) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSecret", ctx, secret)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSecret indicates an expected call of GetSecret.
+func (mr *MockSecretProviderMockRecorder) GetSecret(ctx, secret interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSecret", reflect.TypeOf((*MockSecretProvider)(nil).GetSecret), ctx, secret)
+}
@@ -0,0 +1,131 @@
+package lib
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestGetSecret(t *testing.T) {
+	t.Run("ReturnsValueOfEnvvar", func(t *testing.T) {
+
+		os.Setenv("INFINITY_TEST_SECRET", "s3cr3t")
+		defer os.Unsetenv("INFINITY_TEST_SECRET")
+		secretProvider := NewSecretProvider("", "")
+
+		// act
+		value, err := secretProvider.GetSecret(context.Background(), ManifestSecret{Name: "test", Env: "INFINITY_TEST_SECRET"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, "s3cr3t", value)
+	})
+
+	t.Run("ReturnsErrorIfEnvvarIsNotSet", func(t *testing.T) {
+
+		secretProvider := NewSecretProvider("", "")
+
+		// act
+		_, err := secretProvider.GetSecret(context.Background(), ManifestSecret{Name: "test", Env: "INFINITY_TEST_SECRET_NOT_SET"})
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("ReturnsContentOfFileRelativeToBuildDirectory", func(t *testing.T) {
+
+		dir, err := ioutil.TempDir("", "infinity")
+		assert.Nil(t, err)
+		defer os.RemoveAll(dir)
+		err = ioutil.WriteFile(filepath.Join(dir, "token"), []byte("s3cr3t\n"), 0600)
+		assert.Nil(t, err)
+		secretProvider := NewSecretProvider(dir, "")
+
+		// act
+		value, err := secretProvider.GetSecret(context.Background(), ManifestSecret{Name: "test", File: "token"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, "s3cr3t", value)
+	})
+
+	t.Run("ReturnsDecryptedContentOfEncryptedFile", func(t *testing.T) {
+
+		dir, err := ioutil.TempDir("", "infinity")
+		assert.Nil(t, err)
+		defer os.RemoveAll(dir)
+		key, err := NewSecretProvider(dir, "").GenerateKey(context.Background())
+		assert.Nil(t, err)
+		secretProvider := NewSecretProvider(dir, key)
+		ciphertext, err := secretProvider.Encrypt(context.Background(), []byte("s3cr3t"))
+		assert.Nil(t, err)
+		err = ioutil.WriteFile(filepath.Join(dir, "token.enc"), ciphertext, 0644)
+		assert.Nil(t, err)
+
+		// act
+		value, err := secretProvider.GetSecret(context.Background(), ManifestSecret{Name: "test", EncryptedFile: "token.enc"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, "s3cr3t", value)
+	})
+
+	t.Run("DecryptsEncryptedFileWithSecretKeyFromEnvvarIfNotPassed", func(t *testing.T) {
+
+		dir, err := ioutil.TempDir("", "infinity")
+		assert.Nil(t, err)
+		defer os.RemoveAll(dir)
+		key, err := NewSecretProvider(dir, "").GenerateKey(context.Background())
+		assert.Nil(t, err)
+		ciphertext, err := NewSecretProvider(dir, key).Encrypt(context.Background(), []byte("s3cr3t"))
+		assert.Nil(t, err)
+		err = ioutil.WriteFile(filepath.Join(dir, "token.enc"), ciphertext, 0644)
+		assert.Nil(t, err)
+		os.Setenv(SecretKeyEnvvar, key)
+		defer os.Unsetenv(SecretKeyEnvvar)
+		secretProvider := NewSecretProvider(dir, "")
+
+		// act
+		value, err := secretProvider.GetSecret(context.Background(), ManifestSecret{Name: "test", EncryptedFile: "token.enc"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, "s3cr3t", value)
+	})
+
+	t.Run("ReturnsErrorIfEncryptedFileIsDecryptedWithOtherKey", func(t *testing.T) {
+
+		dir, err := ioutil.TempDir("", "infinity")
+		assert.Nil(t, err)
+		defer os.RemoveAll(dir)
+		key, err := NewSecretProvider(dir, "").GenerateKey(context.Background())
+		assert.Nil(t, err)
+		otherKey, err := NewSecretProvider(dir, "").GenerateKey(context.Background())
+		assert.Nil(t, err)
+		ciphertext, err := NewSecretProvider(dir, key).Encrypt(context.Background(), []byte("s3cr3t"))
+		assert.Nil(t, err)
+		err = ioutil.WriteFile(filepath.Join(dir, "token.enc"), ciphertext, 0644)
+		assert.Nil(t, err)
+		secretProvider := NewSecretProvider(dir, otherKey)
+
+		// act
+		_, err = secretProvider.GetSecret(context.Background(), ManifestSecret{Name: "test", EncryptedFile: "token.enc"})
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("ReturnsErrorIfSecretKeyIsNotSetForEncryptedFile", func(t *testing.T) {
+
+		dir, err := ioutil.TempDir("", "infinity")
+		assert.Nil(t, err)
+		defer os.RemoveAll(dir)
+		err = ioutil.WriteFile(filepath.Join(dir, "token.enc"), []byte("abc\n"), 0644)
+		assert.Nil(t, err)
+		secretProvider := NewSecretProvider(dir, "")
+
+		// act
+		_, err = secretProvider.GetSecret(context.Background(), ManifestSecret{Name: "test", EncryptedFile: "token.enc"})
+
+		assert.NotNil(t, err)
+		assert.Equal(t, "secret test can't be decrypted from file token.enc: no secret key is set; please pass it with --secret-key or envvar INFINITY_SECRET_KEY", err.Error())
+	})
+}
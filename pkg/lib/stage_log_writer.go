@@ -0,0 +1,51 @@
+package lib
+
+import (
+	"io"
+	"regexp"
+	"strings"
+)
+
+// stageLogWriter passes stage log output on while keeping the last lines in the stage report
+type stageLogWriter struct {
+	out         io.Writer
+	prefix      string
+	report      *StageReport
+	eventWriter RunEventWriter
+	logFile     io.Writer
+}
+
+func newStageLogWriter(out io.Writer, prefix string, report *StageReport, eventWriter RunEventWriter, logFile io.Writer) io.Writer {
+	return &stageLogWriter{
+		out:         out,
+		prefix:      prefix,
+		report:      report,
+		eventWriter: eventWriter,
+		logFile:     logFile,
+	}
+}
+
+func (w *stageLogWriter) Write(p []byte) (n int, err error) {
+	if w.report != nil {
+		// the logger writes one prefixed message per call
+		message := strings.TrimSuffix(strings.TrimPrefix(string(p), w.prefix), "\n")
+		for _, line := range strings.Split(message, "\n") {
+			line = stripANSIEscapeCodes(line)
+			w.report.AddLogLine(line)
+			if w.eventWriter != nil {
+				w.eventWriter.StageLogLine(w.report, line)
+			}
+			if w.logFile != nil {
+				_, _ = w.logFile.Write([]byte(line + "\n"))
+			}
+		}
+	}
+
+	return w.out.Write(p)
+}
+
+var ansiEscapeCodes = regexp.MustCompile("\x1b\\[[0-9;]*[a-zA-Z]")
+
+func stripANSIEscapeCodes(text string) string {
+	return ansiEscapeCodes.ReplaceAllString(text, "")
+}
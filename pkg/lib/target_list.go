@@ -0,0 +1,86 @@
+package lib
+
+import (
+	"fmt"
+)
+
+// DefaultTarget is the target infinity run runs if none is passed
+const DefaultTarget = "build/local"
+
+type TargetSummary struct {
+	Name    string         `json:"name"`
+	Default bool           `json:"default,omitempty"`
+	Stages  []StageSummary `json:"stages,omitempty"`
+}
+
+type StageSummary struct {
+	Name       string                 `json:"name"`
+	RunnerType RunnerType             `json:"runner,omitempty"`
+	Image      string                 `json:"image,omitempty"`
+	Background bool                   `json:"background,omitempty"`
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+	Stages     []StageSummary         `json:"stages,omitempty"`
+}
+
+// GetTargetSummaries returns the targets of the manifest with their stage tree, in the order of the manifest
+func GetTargetSummaries(manifest Manifest) (targets []TargetSummary) {
+	for _, t := range manifest.Targets {
+		targets = append(targets, TargetSummary{
+			Name:    t.Name,
+			Default: t.Name == DefaultTarget,
+			Stages:  getStageSummaries(t.Stages),
+		})
+	}
+
+	return
+}
+
+func getStageSummaries(stages []*ManifestStage) (summaries []StageSummary) {
+	for _, s := range stages {
+		summary := StageSummary{
+			Name:   s.Name,
+			Stages: getStageSummaries(s.Stages),
+		}
+		// parallel groups only run their nested stages
+		if len(s.Stages) == 0 {
+			summary.RunnerType = s.RunnerType
+			summary.Image = s.Image
+			summary.Background = s.Background
+		}
+		if len(s.Parameters) > 0 {
+			summary.Parameters = map[string]interface{}{}
+			for k, v := range s.Parameters {
+				summary.Parameters[k] = toJSONValue(v)
+			}
+		}
+		summaries = append(summaries, summary)
+	}
+
+	return
+}
+
+// toJSONValue converts the maps yaml unmarshals nested values into to maps with string keys, so they marshal to json
+func toJSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for k, vv := range v {
+			m[fmt.Sprintf("%v", k)] = toJSONValue(vv)
+		}
+		return m
+	case map[string]interface{}:
+		m := map[string]interface{}{}
+		for k, vv := range v {
+			m[k] = toJSONValue(vv)
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(v))
+		for i, vv := range v {
+			a[i] = toJSONValue(vv)
+		}
+		return a
+	}
+
+	return value
+}
@@ -0,0 +1,98 @@
+package lib
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/alecthomas/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestGetTargetSummaries(t *testing.T) {
+	t.Run("ReturnsStageTreeOfEachTarget", func(t *testing.T) {
+
+		manifest := Manifest{
+			Targets: []*ManifestTarget{
+				{
+					Name: "build/local",
+					Stages: []*ManifestStage{
+						{
+							Name: "parallel",
+							Stages: []*ManifestStage{
+								{
+									Name:     "unit-test",
+									Image:    "golang:1.17",
+									Commands: []string{"go test ./..."},
+								},
+								{
+									Name:       "database",
+									Image:      "cockroachdb/cockroach:v21.1.5",
+									Background: true,
+								},
+							},
+						},
+					},
+				},
+				{
+					Name: "release",
+					Stages: []*ManifestStage{
+						{
+							Name:       "deploy",
+							RunnerType: RunnerTypeHost,
+							Commands:   []string{"./deploy.sh"},
+						},
+					},
+				},
+			},
+		}
+		manifest.SetDefault()
+
+		// act
+		targets := GetTargetSummaries(manifest)
+
+		assert.Equal(t, []TargetSummary{
+			{
+				Name:    "build/local",
+				Default: true,
+				Stages: []StageSummary{
+					{
+						Name: "parallel",
+						Stages: []StageSummary{
+							{Name: "unit-test", RunnerType: RunnerTypeContainer, Image: "golang:1.17"},
+							{Name: "database", RunnerType: RunnerTypeContainer, Image: "cockroachdb/cockroach:v21.1.5", Background: true},
+						},
+					},
+				},
+			},
+			{
+				Name: "release",
+				Stages: []StageSummary{
+					{Name: "deploy", RunnerType: RunnerTypeHost},
+				},
+			},
+		}, targets)
+	})
+
+	t.Run("ConvertsNestedParametersSoTheyMarshalToJSON", func(t *testing.T) {
+
+		var manifest Manifest
+		err := yaml.Unmarshal([]byte(`targets:
+- name: build/local
+  stages:
+  - name: bake
+    image: extensions/docker:stable
+    action: build
+    tags:
+      latest: true
+    platforms:
+    - linux/amd64
+`), &manifest)
+		assert.Nil(t, err)
+
+		// act
+		output, err := json.Marshal(GetTargetSummaries(manifest))
+
+		assert.Nil(t, err)
+		assert.Equal(t, `[{"name":"build/local","default":true,"stages":[{"name":"bake","image":"extensions/docker:stable","parameters":{"action":"build","platforms":["linux/amd64"],"tags":{"latest":true}}}]}]`, string(output))
+	})
+}
@@ -0,0 +1,244 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:generate mockgen -package=lib -destination ./trace_exporter_mock.go -source=trace_exporter.go
+type TraceExporter interface {
+	Export(ctx context.Context, spans []*TraceSpan) (err error)
+}
+
+type otlpHTTPTraceExporter struct {
+	endpoint string
+	client   *http.Client
+}
+
+// NewOTLPHTTPTraceExporter returns an exporter that sends spans to an OpenTelemetry collector using OTLP/HTTP with json encoding
+func NewOTLPHTTPTraceExporter(endpoint string) TraceExporter {
+	return &otlpHTTPTraceExporter{
+		endpoint: endpoint,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+func (e *otlpHTTPTraceExporter) Export(ctx context.Context, spans []*TraceSpan) (err error) {
+	body, err := json.Marshal(newOTLPTraces(spans))
+	if err != nil {
+		return
+	}
+
+	endpoint, err := e.getTracesURL()
+	if err != nil {
+		return
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := e.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("exporting trace to %v failed: %w", endpoint, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("exporting trace to %v failed with status code %v", endpoint, response.StatusCode)
+	}
+
+	return nil
+}
+
+// getTracesURL appends the default traces path if the endpoint has none, like the OpenTelemetry sdks do
+func (e *otlpHTTPTraceExporter) getTracesURL() (string, error) {
+	u, err := url.Parse(e.endpoint)
+	if err != nil {
+		return "", fmt.Errorf("trace endpoint %v is invalid: %w", e.endpoint, err)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/traces"
+	}
+
+	return u.String(), nil
+}
+
+type otlpFileTraceExporter struct {
+	filePath string
+}
+
+// NewOTLPFileTraceExporter returns an exporter that writes spans in the OTLP json format to a file
+func NewOTLPFileTraceExporter(filePath string) TraceExporter {
+	return &otlpFileTraceExporter{
+		filePath: filePath,
+	}
+}
+
+func (e *otlpFileTraceExporter) Export(ctx context.Context, spans []*TraceSpan) (err error) {
+	output, err := json.Marshal(newOTLPTraces(spans))
+	if err != nil {
+		return
+	}
+
+	if dir := filepath.Dir(e.filePath); dir != "" {
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			return
+		}
+	}
+
+	return ioutil.WriteFile(e.filePath, append(output, '\n'), 0644)
+}
+
+// the OTLP json encoding, see https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string             `json:"key"`
+	Value otlpAttributeValue `json:"value"`
+}
+
+type otlpAttributeValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+const (
+	otlpSpanKindInternal = 1
+	otlpStatusCodeOk     = 1
+	otlpStatusCodeError  = 2
+)
+
+func newOTLPTraces(spans []*TraceSpan) otlpTraces {
+	otlpSpans := []otlpSpan{}
+	for _, s := range spans {
+		s.mutex.Lock()
+		end := s.End
+		if end.IsZero() {
+			end = time.Now()
+		}
+		otlpSpan := otlpSpan{
+			TraceID:           s.TraceID,
+			SpanID:            s.SpanID,
+			ParentSpanID:      s.ParentSpanID,
+			Name:              s.Name,
+			Kind:              otlpSpanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(end.UnixNano(), 10),
+			Attributes:        newOTLPAttributes(s.Attributes),
+			Status: otlpStatus{
+				Code: otlpStatusCodeOk,
+			},
+		}
+		if s.Error != "" {
+			otlpSpan.Status = otlpStatus{
+				Code:    otlpStatusCodeError,
+				Message: s.Error,
+			}
+		}
+		s.mutex.Unlock()
+
+		otlpSpans = append(otlpSpans, otlpSpan)
+	}
+
+	return otlpTraces{
+		ResourceSpans: []otlpResourceSpans{
+			{
+				Resource: otlpResource{
+					Attributes: newOTLPAttributes(map[string]interface{}{
+						"service.name": "infinity",
+					}),
+				},
+				ScopeSpans: []otlpScopeSpans{
+					{
+						Scope: otlpScope{
+							Name: "github.com/JorritSalverda/infinity",
+						},
+						Spans: otlpSpans,
+					},
+				},
+			},
+		},
+	}
+}
+
+func newOTLPAttributes(attributes map[string]interface{}) (otlpAttributes []otlpAttribute) {
+	// sort keys to get the same output each time
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		value := otlpAttributeValue{}
+		switch v := attributes[k].(type) {
+		case bool:
+			value.BoolValue = &v
+		case int:
+			intValue := strconv.Itoa(v)
+			value.IntValue = &intValue
+		case float64:
+			value.DoubleValue = &v
+		default:
+			stringValue := fmt.Sprintf("%v", v)
+			value.StringValue = &stringValue
+		}
+		otlpAttributes = append(otlpAttributes, otlpAttribute{Key: k, Value: value})
+	}
+
+	return
+}
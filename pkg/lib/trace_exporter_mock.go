@@ -0,0 +1,49 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: trace_exporter.go
+
+// Package lib is a generated GoMock package.
+package lib
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockTraceExporter is a mock of TraceExporter interface.
+type MockTraceExporter struct {
+	ctrl     *gomock.Controller
+	recorder *MockTraceExporterMockRecorder
+}
+
+// MockTraceExporterMockRecorder is the mock recorder for MockTraceExporter.
+type MockTraceExporterMockRecorder struct {
+	mock *MockTraceExporter
+}
+
+// NewMockTraceExporter creates a new mock instance.
+func NewMockTraceExporter(ctrl *gomock.Controller) *MockTraceExporter {
+	mock := &MockTraceExporter{ctrl: ctrl}
+	mock.recorder = &MockTraceExporterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockTraceExporter) EXPECT() *MockTraceExporterMockRecorder {
+	return m.recorder
+}
+
+// Export mocks base method.
+func (m *MockTraceExporter) Export(ctx context.Context, spans []*TraceSpan) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Export", ctx, spans)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Export indicates an expected call of Export.
+func (mr *MockTraceExporterMockRecorder) Export(ctx, spans interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Export", reflect.TypeOf((*MockTraceExporter)(nil).Export), ctx, spans)
+}
@@ -0,0 +1,100 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestOTLPHTTPTraceExporterExport(t *testing.T) {
+	t.Run("PostsSpansAsOTLPJSONToCollector", func(t *testing.T) {
+
+		var requestPath, contentType string
+		var traces otlpTraces
+		collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestPath = r.URL.Path
+			contentType = r.Header.Get("Content-Type")
+			_ = json.NewDecoder(r.Body).Decode(&traces)
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer collector.Close()
+
+		spans := getTestSpans()
+		traceExporter := NewOTLPHTTPTraceExporter(collector.URL)
+
+		// act
+		err := traceExporter.Export(context.Background(), spans)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "/v1/traces", requestPath)
+		assert.Equal(t, "application/json", contentType)
+		assert.Equal(t, 1, len(traces.ResourceSpans))
+		otlpSpans := traces.ResourceSpans[0].ScopeSpans[0].Spans
+		assert.Equal(t, 2, len(otlpSpans))
+		assert.Equal(t, "stage-1", otlpSpans[1].Name)
+		assert.Equal(t, otlpSpans[0].SpanID, otlpSpans[1].ParentSpanID)
+		assert.Equal(t, otlpStatusCodeError, otlpSpans[1].Status.Code)
+		assert.Equal(t, "container.image.name", otlpSpans[1].Attributes[0].Key)
+		assert.Equal(t, "golang:1.17", *otlpSpans[1].Attributes[0].Value.StringValue)
+		assert.Equal(t, "infinity.stage.exit_code", otlpSpans[1].Attributes[1].Key)
+		assert.Equal(t, "2", *otlpSpans[1].Attributes[1].Value.IntValue)
+	})
+
+	t.Run("ReturnsErrorIfCollectorRejectsSpans", func(t *testing.T) {
+
+		collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+		defer collector.Close()
+
+		traceExporter := NewOTLPHTTPTraceExporter(collector.URL + "/otlp/v1/traces")
+
+		// act
+		err := traceExporter.Export(context.Background(), getTestSpans())
+
+		assert.NotNil(t, err)
+		assert.Equal(t, fmt.Sprintf("exporting trace to %v/otlp/v1/traces failed with status code 400", collector.URL), err.Error())
+	})
+}
+
+func TestOTLPFileTraceExporterExport(t *testing.T) {
+	t.Run("WritesSpansAsOTLPJSONToFile", func(t *testing.T) {
+
+		dir, err := ioutil.TempDir("", "trace")
+		assert.Nil(t, err)
+		defer os.RemoveAll(dir)
+		traceExporter := NewOTLPFileTraceExporter(filepath.Join(dir, "trace.json"))
+
+		// act
+		err = traceExporter.Export(context.Background(), getTestSpans())
+
+		assert.Nil(t, err)
+		output, err := ioutil.ReadFile(filepath.Join(dir, "trace.json"))
+		assert.Nil(t, err)
+		var traces otlpTraces
+		err = json.Unmarshal(output, &traces)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(traces.ResourceSpans[0].ScopeSpans[0].Spans))
+	})
+}
+
+func getTestSpans() []*TraceSpan {
+	tracer := NewTracer()
+	ctx := ContextWithTracer(context.Background(), tracer)
+
+	ctx, targetSpan := StartSpan(ctx, "build/local", map[string]interface{}{"infinity.target": "build/local"})
+	_, stageSpan := StartSpan(ctx, "stage-1", map[string]interface{}{"container.image.name": "golang:1.17"})
+	stageSpan.SetAttribute("infinity.stage.exit_code", 2)
+	stageSpan.Finish(fmt.Errorf("stage stage-1 failed with exit code 2"))
+	targetSpan.Finish(nil)
+
+	return tracer.GetSpans()
+}
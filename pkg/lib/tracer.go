@@ -0,0 +1,134 @@
+package lib
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+//go:generate mockgen -package=lib -destination ./tracer_mock.go -source=tracer.go
+type Tracer interface {
+	StartSpan(ctx context.Context, name string, attributes map[string]interface{}) (context.Context, *TraceSpan)
+	GetSpans() []*TraceSpan
+}
+
+type tracer struct {
+	traceID string
+	spans   []*TraceSpan
+	mutex   *sync.Mutex
+}
+
+// NewTracer returns a tracer that records all spans of a run in a single trace
+func NewTracer() Tracer {
+	return &tracer{
+		traceID: generateRandomHex(16),
+		mutex:   &sync.Mutex{},
+	}
+}
+
+func (t *tracer) StartSpan(ctx context.Context, name string, attributes map[string]interface{}) (context.Context, *TraceSpan) {
+	span := &TraceSpan{
+		TraceID:    t.traceID,
+		SpanID:     generateRandomHex(8),
+		Name:       name,
+		Start:      time.Now(),
+		Attributes: map[string]interface{}{},
+		mutex:      &sync.Mutex{},
+	}
+	if parent := getSpanFromContext(ctx); parent != nil {
+		span.ParentSpanID = parent.SpanID
+	}
+	for k, v := range attributes {
+		span.Attributes[k] = v
+	}
+
+	t.mutex.Lock()
+	t.spans = append(t.spans, span)
+	t.mutex.Unlock()
+
+	return context.WithValue(context.WithValue(ctx, spanContextKey{}, span), tracerContextKey{}, t), span
+}
+
+func (t *tracer) GetSpans() []*TraceSpan {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return append([]*TraceSpan{}, t.spans...)
+}
+
+type TraceSpan struct {
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Name         string
+	Start        time.Time
+	End          time.Time
+	Attributes   map[string]interface{}
+	Error        string
+	mutex        *sync.Mutex
+}
+
+// SetAttribute is safe to call on a nil span, which is returned when tracing is disabled
+func (s *TraceSpan) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.Attributes[key] = value
+}
+
+// Finish is safe to call on a nil span, which is returned when tracing is disabled
+func (s *TraceSpan) Finish(err error) {
+	if s == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.End = time.Now()
+	if err != nil {
+		s.Error = err.Error()
+	}
+}
+
+type tracerContextKey struct{}
+type spanContextKey struct{}
+
+// ContextWithTracer enables tracing for everything that runs with the returned context
+func ContextWithTracer(ctx context.Context, tracer Tracer) context.Context {
+	return context.WithValue(ctx, tracerContextKey{}, tracer)
+}
+
+// GetTracerFromContext returns the tracer of the context, or nil if tracing is disabled
+func GetTracerFromContext(ctx context.Context) Tracer {
+	tracer, _ := ctx.Value(tracerContextKey{}).(Tracer)
+	return tracer
+}
+
+// StartSpan starts a child span of the span in the context; it returns a nil span if the context has no tracer
+func StartSpan(ctx context.Context, name string, attributes map[string]interface{}) (context.Context, *TraceSpan) {
+	tracer := GetTracerFromContext(ctx)
+	if tracer == nil {
+		return ctx, nil
+	}
+
+	return tracer.StartSpan(ctx, name, attributes)
+}
+
+func getSpanFromContext(ctx context.Context) *TraceSpan {
+	span, _ := ctx.Value(spanContextKey{}).(*TraceSpan)
+	return span
+}
+
+func generateRandomHex(length int) string {
+	id := make([]byte, length)
+	_, _ = rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,64 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: tracer.go
+
+// Package lib is a generated GoMock package.
+package lib
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockTracer is a mock of Tracer interface.
+type MockTracer struct {
+	ctrl     *gomock.Controller
+	recorder *MockTracerMockRecorder
+}
+
+// MockTracerMockRecorder is the mock recorder for MockTracer.
+type MockTracerMockRecorder struct {
+	mock *MockTracer
+}
+
+// NewMockTracer creates a new mock instance.
+func NewMockTracer(ctrl *gomock.Controller) *MockTracer {
+	mock := &MockTracer{ctrl: ctrl}
+	mock.recorder = &MockTracerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockTracer) EXPECT() *MockTracerMockRecorder {
+	return m.recorder
+}
+
+// GetSpans mocks base method.
+func (m *MockTracer) GetSpans() []*TraceSpan {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSpans")
+	ret0, _ := ret[0].([]*TraceSpan)
+	return ret0
+}
+
+// GetSpans indicates an expected call of GetSpans.
+func (mr *MockTracerMockRecorder) GetSpans() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSpans", reflect.TypeOf((*MockTracer)(nil).GetSpans))
+}
+
+// StartSpan mocks base method.
+func (m *MockTracer) StartSpan(ctx context.Context, name string, attributes map[string]interface{}) (context.Context, *TraceSpan) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StartSpan", ctx, name, attributes)
+	ret0, _ := ret[0].(context.Context)
+	ret1, _ := ret[1].(*TraceSpan)
+	return ret0, ret1
+}
+
+// StartSpan indicates an expected call of StartSpan.
+func (mr *MockTracerMockRecorder) StartSpan(ctx, name, attributes interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StartSpan", reflect.TypeOf((*MockTracer)(nil).StartSpan), ctx, name, attributes)
+}
@@ -0,0 +1,51 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestStartSpan(t *testing.T) {
+	t.Run("ReturnsNilSpanIfContextHasNoTracer", func(t *testing.T) {
+
+		// act
+		_, span := StartSpan(context.Background(), "stage-1", nil)
+
+		assert.Nil(t, span)
+		span.SetAttribute("infinity.stage.exit_code", 1)
+		span.Finish(nil)
+	})
+
+	t.Run("SetsParentOfChildSpanToSpanInContext", func(t *testing.T) {
+
+		tracer := NewTracer()
+		ctx := ContextWithTracer(context.Background(), tracer)
+		ctx, parent := StartSpan(ctx, "build/local", nil)
+
+		// act
+		_, child := StartSpan(ctx, "stage-1", map[string]interface{}{"infinity.stage.runner": "host"})
+
+		assert.Equal(t, "", parent.ParentSpanID)
+		assert.Equal(t, parent.SpanID, child.ParentSpanID)
+		assert.Equal(t, parent.TraceID, child.TraceID)
+		assert.Equal(t, 32, len(child.TraceID))
+		assert.Equal(t, 16, len(child.SpanID))
+		assert.Equal(t, "host", child.Attributes["infinity.stage.runner"])
+		assert.Equal(t, 2, len(tracer.GetSpans()))
+	})
+
+	t.Run("KeepsErrorOfFinishedSpan", func(t *testing.T) {
+
+		ctx := ContextWithTracer(context.Background(), NewTracer())
+		_, span := StartSpan(ctx, "stage-1", nil)
+
+		// act
+		span.Finish(fmt.Errorf("stage stage-1 failed with exit code 1"))
+
+		assert.Equal(t, "stage stage-1 failed with exit code 1", span.Error)
+		assert.False(t, span.End.IsZero())
+	})
+}